@@ -0,0 +1,79 @@
+// Command configdump prints config types from the cache as JSON.
+//
+// Usage:
+//
+//	configdump [-cache dir] <kind> [id...]
+//
+// With no ids, every type of the kind is printed.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/util/cache"
+)
+
+var cacheDir = flag.String("cache", "data/cache", "directory the cache is in")
+
+func main() {
+	flag.Usage = func() {
+		kinds := config.NewRegistry(nil).Kinds()
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: configdump [-cache dir] <kind> [id...]\n\nkinds: %s\n\n", strings.Join(kinds, ", "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := dump(config.NewRegistry(cache.Open(*cacheDir)), flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "configdump:", err)
+		os.Exit(1)
+	}
+}
+
+func dump(registry *config.Registry, kind string, args []string) error {
+	// everything is loaded so noted objs get their names
+	if _, err := registry.Load(); err != nil {
+		return err
+	}
+	for _, err := range registry.Failed() {
+		fmt.Fprintln(os.Stderr, "configdump: skipped", err)
+	}
+
+	var types []any
+	if len(args) == 0 {
+		all, err := registry.All(kind)
+		if err != nil {
+			return err
+		}
+		types = all
+	}
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("bad id %q", arg)
+		}
+		v, err := registry.Get(kind, id)
+		if err != nil {
+			return err
+		}
+		types = append(types, v)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, v := range types {
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
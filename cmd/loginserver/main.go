@@ -0,0 +1,60 @@
+// Command loginserver runs the login service that game worlds register with.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/zsrv/rt5-server-go/login"
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+var (
+	listenAddr = flag.String("addr", "127.0.0.1:40002", "address to listen for worlds on")
+	worldsPath = flag.String("worlds", "", "world list config file (empty starts with no worlds)")
+	offline    = flag.Int("offline-players", util.WorldPlayersOffline, "player count shown for configured worlds that are down")
+
+	accountsDir = flag.String("accounts", "data/accounts", "directory player accounts are stored in")
+	auditPath   = flag.String("audit", "data/audit/create.jsonl", "file account creation attempts are recorded in")
+	modPath     = flag.String("moderation", "data/moderation.json", "file bans, mutes and locks are stored in")
+	devLogins   = flag.Bool("dev-logins", false, "let players without an account log in with any password (for development only)")
+)
+
+func main() {
+	flag.Parse()
+
+	logger := util.NewLogger()
+
+	var worlds *util.WorldList
+	if *worldsPath != "" {
+		var err error
+		worlds, err = util.LoadWorldList(*worldsPath)
+		if err != nil {
+			logger.Error("could not load world list", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	service := login.NewLocal(worlds)
+	service.OfflinePlayers = *offline
+	service.Accounts = login.NewAccounts(*accountsDir)
+	service.AllowUnregistered = *devLogins
+	service.Audit = &login.AuditLog{Path: *auditPath}
+
+	moderation, err := login.LoadModeration(*modPath)
+	if err != nil {
+		logger.Error("could not load moderation state", "error", err)
+		os.Exit(1)
+	}
+	service.Moderation = moderation
+
+	s := login.NewServer(service, *logger)
+	s.Addr = *listenAddr
+
+	logger.Info("starting login server", "listenAddr", s.Addr)
+	err = s.ListenAndServe()
+	if err != nil {
+		logger.Error("error", "error", err)
+		os.Exit(1)
+	}
+}
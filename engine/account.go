@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/login"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// CreateProgress is sent by the client as the player moves through the
+// account creation screens, so the date of birth and country can be checked
+// before the rest of the form is filled in.
+type CreateProgress struct {
+	Day     int
+	Month   int
+	Year    int
+	Country int
+}
+
+// decodeCreateProgress decodes the LoginProtCreateLogProgress payload.
+func decodeCreateProgress(buf *packet.Packet) (progress CreateProgress, err error) {
+	defer recoverDecode(&err)
+
+	progress.Day = int(buf.G1())
+	progress.Month = int(buf.G1())
+	progress.Year = int(buf.G2())
+	progress.Country = int(buf.G2())
+	return progress, nil
+}
+
+// decodeCreateAccount decodes the LoginProtCreateAccount payload (after its
+// length), which is an RSA block holding the form fields and the XTEA key
+// the email address is encrypted with.
+func decodeCreateAccount(buf *packet.Packet) (req login.CreateRequest, err error) {
+	defer recoverDecode(&err)
+
+	revision := buf.G2()
+	if revision != 578 {
+		return req, fmt.Errorf("client version is not 578: %d", revision)
+	}
+
+	decrypted, err := buf.RSADec()
+	if err != nil {
+		return req, err
+	}
+
+	rsaMagic := decrypted.G1()
+	if rsaMagic != 10 {
+		return req, fmt.Errorf("bad rsa magic: %d", rsaMagic)
+	}
+
+	key := make([]uint32, 4)
+
+	req.OptIn = decrypted.G2() != 0
+	req.Username = util.FromBase37(decrypted.G8())
+	key[0] = decrypted.G4()
+	req.Password = decrypted.GJStr()
+	key[1] = decrypted.G4()
+	req.Affiliate = int(decrypted.G2())
+	req.Day = int(decrypted.G1())
+	req.Month = int(decrypted.G1())
+	key[2] = decrypted.G4()
+	req.Year = int(decrypted.G2())
+	req.Country = int(decrypted.G2())
+	key[3] = decrypted.G4()
+
+	// only whole blocks are encrypted, any trailing bytes are sent as-is
+	rest := buf.Bytes()
+	blocks := len(rest) / 8 * 8
+
+	encrypted := packet.NewPacket(append([]byte(nil), rest[:blocks]...))
+	encrypted.TinyDec(0, key, blocks)
+
+	extra := packet.NewPacket(append(encrypted.Bytes(), rest[blocks:]...))
+	req.Email = extra.GJStr()
+
+	return req, nil
+}
+
+// recoverDecode turns a panic from reading past the end of a packet into an
+// error, for use in a deferred call.
+func recoverDecode(err *error) {
+	if r := recover(); r != nil {
+		*err = errors.New(fmt.Sprint("malformed packet: ", r))
+	}
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/login"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// useTestRSAKey installs a freshly generated RSA key for the duration of the
+// test, returning the public half for encoding client payloads.
+func useTestRSAKey(t *testing.T) (*big.Int, *big.Int) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modulus, exponent := packet.RSAModulus, packet.RSAPrivateExponent
+	t.Cleanup(func() {
+		packet.RSAModulus, packet.RSAPrivateExponent = modulus, exponent
+	})
+	packet.RSAModulus, packet.RSAPrivateExponent = key.N, key.D
+
+	return key.N, big.NewInt(int64(key.E))
+}
+
+// encodeCreateAccount builds a LoginProtCreateAccount payload the way the
+// client does.
+func encodeCreateAccount(req login.CreateRequest, revision uint16, magic uint8, modulus, exponent *big.Int) []byte {
+	key := []uint32{0x1234, 0x5678, 0x9abc, 0xdef0}
+
+	var rsaBlock packet.Packet
+	rsaBlock.P1(magic)
+	if req.OptIn {
+		rsaBlock.P2(1)
+	} else {
+		rsaBlock.P2(0)
+	}
+	rsaBlock.P8(util.ToBase37(req.Username))
+	rsaBlock.P4(key[0])
+	rsaBlock.PJStr(req.Password)
+	rsaBlock.P4(key[1])
+	rsaBlock.P2(uint16(req.Affiliate))
+	rsaBlock.P1(uint8(req.Day))
+	rsaBlock.P1(uint8(req.Month))
+	rsaBlock.P4(key[2])
+	rsaBlock.P2(uint16(req.Year))
+	rsaBlock.P2(uint16(req.Country))
+	rsaBlock.P4(key[3])
+	rsaBlock.RSAEnc(modulus, exponent)
+
+	var email packet.Packet
+	email.PJStr(req.Email)
+	plain := email.Bytes()
+	blocks := len(plain) / 8 * 8
+
+	encrypted := packet.NewPacket(append([]byte(nil), plain[:blocks]...))
+	encrypted.TinyEnc(key)
+
+	var buf packet.Packet
+	buf.P2(revision)
+	buf.PData(rsaBlock.Bytes(), rsaBlock.Len())
+	buf.PData(encrypted.Bytes(), encrypted.Len())
+	buf.PData(plain[blocks:], len(plain)-blocks)
+	return buf.Bytes()
+}
+
+func Test_decodeCreateAccount(t *testing.T) {
+	modulus, exponent := useTestRSAKey(t)
+
+	req := login.CreateRequest{
+		Username:  "zezima",
+		Password:  "hunter22",
+		Email:     "zezima@example.com",
+		Day:       22,
+		Month:     4,
+		Year:      1990,
+		Country:   11,
+		OptIn:     true,
+		Affiliate: 3,
+	}
+	// an email that is a whole number of blocks long, including its terminator
+	blockEmail := req
+	blockEmail.Email = "abc@example.com"
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    login.CreateRequest
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			payload: encodeCreateAccount(req, 578, 10, modulus, exponent),
+			want:    req,
+		},
+		{
+			name:    "email of whole blocks",
+			payload: encodeCreateAccount(blockEmail, 578, 10, modulus, exponent),
+			want:    blockEmail,
+		},
+		{
+			name:    "wrong revision",
+			payload: encodeCreateAccount(req, 577, 10, modulus, exponent),
+			wantErr: true,
+		},
+		{
+			name:    "bad rsa magic",
+			payload: encodeCreateAccount(req, 578, 11, modulus, exponent),
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			payload: encodeCreateAccount(req, 578, 10, modulus, exponent)[:40],
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCreateAccount(packet.NewPacket(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCreateAccount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCreateAccount() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decodeCreateProgress(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    CreateProgress
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			payload: []byte{22, 4, 0x07, 0xc6, 0x00, 0x0b},
+			want:    CreateProgress{Day: 22, Month: 4, Year: 1990, Country: 11},
+		},
+		{
+			name:    "truncated",
+			payload: []byte{22, 4, 0x07},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCreateProgress(packet.NewPacket(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeCreateProgress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want && !tt.wantErr {
+				t.Errorf("decodeCreateProgress() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
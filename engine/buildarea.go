@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"slices"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// buildAreaMargin is how close to the edge of the build area the player can
+// get, in tiles, before it's rebuilt around them.
+const buildAreaMargin = 16
+
+// SetBuildAreaSize switches the player's build area to one of the sizes in
+// util.BuildArea, rebuilding it on the next tick.
+func (p *Player) SetBuildAreaSize(index int) {
+	if index < 0 || index >= len(util.BuildArea) {
+		return
+	}
+	p.Pos.UpdateBuildArea(index)
+}
+
+// needsRebuild reports whether the player has left the middle of the build
+// area their client has loaded, gone in or out of an instance, or asked for
+// a different size. Changing plane doesn't need a rebuild, as the client
+// loads every plane.
+func (p *Player) needsRebuild() bool {
+	if p.Pos.BAIndex != p.Origin.BAIndex || p.instance != p.originInstance {
+		return true
+	}
+
+	localX := p.Pos.X - p.Origin.BAStartX()
+	localZ := p.Pos.Z - p.Origin.BAStartZ()
+	return localX < buildAreaMargin || localX >= p.Origin.BASizeX-buildAreaMargin ||
+		localZ < buildAreaMargin || localZ >= p.Origin.BASizeZ-buildAreaMargin
+}
+
+// updateBuildArea sends REBUILD_NORMAL, or REBUILD_REGION in an instance,
+// if the player has moved too far from where their build area was last
+// built.
+func (p *Player) updateBuildArea() {
+	switch {
+	case !p.needsRebuild():
+	case p.instance != nil:
+		p.sendRebuildRegion()
+	default:
+		p.sendRebuildNormal()
+	}
+}
+
+// sendRebuildNormal queues REBUILD_NORMAL, which has the client load the
+// build area around the player.
+func (p *Player) sendRebuildNormal() {
+	var response packet.PacketBit
+	response.P1(util.ServerProtRebuildNormal)
+	response.P2(0)
+	start := response.Len()
+
+	p.putRebuildNormal(&response)
+
+	response.PSize2(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// putRebuildNormal writes the build area centred on the player's zone, with
+// the XTEA keys of each mapsquare in it, and remembers it as their origin.
+func (p *Player) putRebuildNormal(buf *packet.PacketBit) {
+	p.setOrigin()
+	zoneX, zoneZ := p.Origin.ZoneX(), p.Origin.ZoneZ()
+
+	buf.IP2(uint16(zoneX))
+	buf.P2(uint16(zoneZ))
+	buf.P1(uint8(p.Origin.BAIndex))
+	buf.P1Alt2(0)
+
+	for mapsquareX := (zoneX - (p.Origin.BASizeX >> 4)) >> 3; mapsquareX <= (zoneX+(p.Origin.BASizeX>>4))>>3; mapsquareX++ {
+		for mapsquareZ := (zoneZ - (p.Origin.BASizeZ >> 4)) >> 3; mapsquareZ <= (zoneZ+(p.Origin.BASizeZ>>4))>>3; mapsquareZ++ {
+			putXTEA(buf, mapsquareX, mapsquareZ)
+		}
+	}
+}
+
+// sendRebuildRegion queues REBUILD_REGION, which has the client build the
+// area around the player in their instance from copies of zones.
+func (p *Player) sendRebuildRegion() {
+	var response packet.PacketBit
+	response.P1(util.ServerProtRebuildRegion)
+	response.P2(0)
+	start := response.Len()
+
+	p.putRebuildRegion(&response)
+
+	response.PSize2(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// putRebuildRegion writes the build area centred on the player's zone in
+// their instance: a palette of the zone each zone is copied from, followed
+// by the XTEA keys of the mapsquares they're copied from, and remembers it
+// as their origin.
+// TODO: confirm the layout against a 578 client
+func (p *Player) putRebuildRegion(buf *packet.PacketBit) {
+	p.setOrigin()
+	zoneX, zoneZ := p.Origin.ZoneX(), p.Origin.ZoneZ()
+
+	buf.IP2(uint16(zoneX))
+	buf.P2(uint16(zoneZ))
+	buf.P1(uint8(p.Origin.BAIndex))
+	buf.P1Alt2(0)
+
+	var mapsquares []int
+	buf.AccessBits()
+	for plane := 0; plane < 4; plane++ {
+		for x := zoneX - (p.Origin.BASizeX >> 4); x <= zoneX+(p.Origin.BASizeX>>4); x++ {
+			for z := zoneZ - (p.Origin.BASizeZ >> 4); z <= zoneZ+(p.Origin.BASizeZ>>4); z++ {
+				zone := p.instance.zone(x, z, plane)
+				if zone == nil {
+					buf.PBit(1, 0)
+					continue
+				}
+				buf.PBit(1, 1)
+				buf.PBit(26, zone.Plane<<24|zone.X>>3<<14|zone.Z>>3<<3|zone.Rotation<<1)
+
+				if mapsquare := zone.X>>6<<8 | zone.Z>>6; !slices.Contains(mapsquares, mapsquare) {
+					mapsquares = append(mapsquares, mapsquare)
+				}
+			}
+		}
+	}
+	buf.AccessBytes()
+
+	for _, v := range mapsquares {
+		putXTEA(buf, v>>8, v&0xff)
+	}
+}
+
+// putXTEA writes the XTEA key of a mapsquare's loc file, or zeros if it
+// doesn't have one.
+func putXTEA(buf *packet.PacketBit, mapsquareX int, mapsquareZ int) {
+	xtea, found := util.GetXTEA(mapsquareX, mapsquareZ)
+	if found {
+		for i := 0; i < len(xtea.Key); i++ {
+			// TODO: converting signed to unsigned!!
+			buf.P4(uint32(xtea.Key[i]))
+		}
+	} else {
+		for i := 0; i < 4; i++ {
+			buf.P4(0)
+		}
+	}
+}
+
+// setOrigin records that the client's build area is centred where the
+// player stands.
+func (p *Player) setOrigin() {
+	p.Origin.Clone(p.Pos)
+	p.Origin.UpdateBuildArea(p.Pos.BAIndex)
+	p.originInstance = p.instance
+}
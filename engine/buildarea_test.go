@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// newBuildAreaTestPlayer returns a loaded player at x, z whose build area is
+// centred on them.
+func newBuildAreaTestPlayer(x int, z int) *Player {
+	p := newTestPlayer(x, z)
+	p.Client = &Client{Server: &Server{Logger: *util.NewLogger()}}
+	p.setOrigin()
+	return p
+}
+
+type sentRebuild struct {
+	ZoneX   int
+	ZoneZ   int
+	BAIndex int
+	Keys    int
+}
+
+// sentRebuilds returns the REBUILD_NORMALs queued for p, and forgets every
+// packet queued.
+func sentRebuilds(p *Player) []sentRebuild {
+	var rebuilds []sentRebuild
+	for _, v := range p.Client.NetOut {
+		buf := packet.NewPacket(v.Data)
+		if buf.G1() != util.ServerProtRebuildNormal {
+			continue
+		}
+		buf.G2() // size
+		rebuild := sentRebuild{ZoneX: int(buf.G2Alt1()), ZoneZ: int(buf.G2()), BAIndex: int(buf.G1())}
+		buf.G1Alt2()
+		rebuild.Keys = buf.Len() / 16
+		rebuilds = append(rebuilds, rebuild)
+	}
+	p.Client.NetOut = nil
+	return rebuilds
+}
+
+func TestPlayer_needsRebuild(t *testing.T) {
+	// centred on zone 400_400, so the build area runs from 3152 to 3255 and
+	// the middle from 3168 to 3239
+	tests := []struct {
+		name    string
+		x       int
+		z       int
+		plane   int
+		baIndex int
+		want    bool
+	}{
+		{name: "origin", x: 3200, z: 3200},
+		{name: "west edge of the middle", x: 3168, z: 3200},
+		{name: "past the west edge", x: 3167, z: 3200, want: true},
+		{name: "east edge of the middle", x: 3239, z: 3200},
+		{name: "past the east edge", x: 3240, z: 3200, want: true},
+		{name: "south edge of the middle", x: 3200, z: 3168},
+		{name: "past the south edge", x: 3200, z: 3167, want: true},
+		{name: "north edge of the middle", x: 3200, z: 3239},
+		{name: "past the north edge", x: 3200, z: 3240, want: true},
+		{name: "other plane", x: 3200, z: 3200, plane: 2},
+		{name: "far away", x: 2965, z: 3380, want: true},
+		{name: "bigger build area", x: 3200, z: 3200, baIndex: 3, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBuildAreaTestPlayer(3200, 3200)
+			p.Pos.X, p.Pos.Z, p.Pos.Plane = tt.x, tt.z, tt.plane
+			p.SetBuildAreaSize(tt.baIndex)
+
+			if got := p.needsRebuild(); got != tt.want {
+				t.Errorf("needsRebuild() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_needsRebuild_bigger(t *testing.T) {
+	// 168 tiles across, from 3120 to 3287
+	p := newBuildAreaTestPlayer(3200, 3200)
+	p.SetBuildAreaSize(3)
+	p.setOrigin()
+
+	for x, want := range map[int]bool{3135: true, 3136: false, 3271: false, 3272: true} {
+		p.Pos.X = x
+		if got := p.needsRebuild(); got != want {
+			t.Errorf("needsRebuild() at x %d = %v, want %v", x, got, want)
+		}
+	}
+}
+
+func TestPlayer_Teleport(t *testing.T) {
+	tests := []struct {
+		name  string
+		x     int
+		z     int
+		plane int
+		want  []sentRebuild
+	}{
+		{
+			name: "nearby",
+			x:    3210,
+			z:    3190,
+		},
+		{
+			name:  "upstairs",
+			x:     3200,
+			z:     3200,
+			plane: 1,
+		},
+		{
+			name: "over the border",
+			x:    3240,
+			z:    3200,
+			want: []sentRebuild{{ZoneX: 405, ZoneZ: 400, Keys: 6}},
+		},
+		{
+			name:  "far away and upstairs",
+			x:     2965,
+			z:     3380,
+			plane: 2,
+			want:  []sentRebuild{{ZoneX: 370, ZoneZ: 422, Keys: 6}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBuildAreaTestPlayer(3200, 3200)
+			p.Teleport(tt.x, tt.z, tt.plane)
+			p.Tick()
+
+			if got := sentRebuilds(p); len(got) != len(tt.want) || len(got) == 1 && got[0] != tt.want[0] {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+			if p.MoveType != MoveTeleport {
+				t.Errorf("MoveType = %v, want %v", p.MoveType, MoveTeleport)
+			}
+			if p.LastPos.X != 3200 || p.LastPos.Z != 3200 || p.LastPos.Plane != 0 {
+				t.Errorf("LastPos = %v", p.LastPos.ToString())
+			}
+			if p.needsRebuild() {
+				t.Errorf("still needs a rebuild at %v, origin %v", p.Pos.ToString(), p.Origin.ToString())
+			}
+		})
+	}
+}
+
+func TestPlayer_Tick_walkOverBorder(t *testing.T) {
+	p := newBuildAreaTestPlayer(3200, 3200)
+	p.Pos.X = 3238
+	p.Steps = []Step{{X: 3239, Z: 3200}, {X: 3240, Z: 3200}}
+
+	p.Tick()
+	if got := sentRebuilds(p); len(got) != 0 {
+		t.Errorf("sent %v before the border", got)
+	}
+
+	p.Tick()
+	got := sentRebuilds(p)
+	if len(got) != 1 || got[0] != (sentRebuild{ZoneX: 405, ZoneZ: 400, Keys: 6}) {
+		t.Errorf("sent %v, want a rebuild around zone 405_400", got)
+	}
+	if p.Origin.X != 3240 || p.Origin.Z != 3200 {
+		t.Errorf("Origin = %v, want (3240, 3200, 0)", p.Origin.ToString())
+	}
+}
+
+func TestPlayer_SetBuildAreaSize(t *testing.T) {
+	p := newBuildAreaTestPlayer(3200, 3200)
+	p.SetBuildAreaSize(2)
+	p.SetBuildAreaSize(4) // not a size
+	p.Tick()
+
+	got := sentRebuilds(p)
+	if len(got) != 1 || got[0] != (sentRebuild{ZoneX: 400, ZoneZ: 400, BAIndex: 2, Keys: 9}) {
+		t.Errorf("sent %v, want a 136 tile rebuild", got)
+	}
+	if p.Pos.BASizeX != 136 || p.Origin.BASizeX != 136 {
+		t.Errorf("BASizeX = %v, origin %v, want 136", p.Pos.BASizeX, p.Origin.BASizeX)
+	}
+}
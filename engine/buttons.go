@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ifButtonOptions maps the IF_BUTTON opcodes to the option they're for,
+// from 1.
+// TODO: add the opcodes of options 2-10 once they're known
+var ifButtonOptions = map[int]int{
+	util.ClientProtIfButton: 1,
+}
+
+// ButtonClick is a click on an interface component.
+type ButtonClick struct {
+	Interface int
+	Component int
+	// Slot is the subcomponent clicked, such as an inventory slot, or -1.
+	Slot int
+	// Obj is the obj in the slot, or -1.
+	Obj int
+	// Option is which of the component's options was picked, from 1.
+	Option int
+}
+
+// ButtonHandler handles a click on the component it's registered for.
+type ButtonHandler func(p *Player, click ButtonClick)
+
+// buttonHandlers holds the handlers for each component, by ComponentHash.
+var buttonHandlers = map[int]ButtonHandler{}
+
+// RegisterButton sets the handler for clicks on a component, replacing any
+// set before.
+func RegisterButton(iface int, component int, handler ButtonHandler) {
+	buttonHandlers[ComponentHash(iface, component)] = handler
+}
+
+// RegisterButtons sets the handler for clicks on every component of iface.
+// Handlers for single components take precedence.
+func RegisterButtons(iface int, handler ButtonHandler) {
+	buttonHandlers[ComponentHash(iface, 0xffff)] = handler
+}
+
+// decodeIfButton decodes IF_BUTTON.
+// TODO: confirm the field order and byte orders against a 578 client
+func decodeIfButton(opcode int, buf *packet.Packet) (click ButtonClick, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("IF_BUTTON is truncated: %v", r)
+		}
+	}()
+
+	option, ok := ifButtonOptions[opcode]
+	if !ok {
+		return ButtonClick{}, fmt.Errorf("%d isn't an IF_BUTTON opcode", opcode)
+	}
+
+	hash := int(buf.G4())
+	click = ButtonClick{
+		Interface: hash >> 16,
+		Component: hash & 0xffff,
+		Slot:      int(buf.G2()),
+		Obj:       int(buf.G2()),
+		Option:    option,
+	}
+	if click.Slot == 0xffff {
+		click.Slot = -1
+	}
+	if click.Obj == 0xffff {
+		click.Obj = -1
+	}
+	return click, nil
+}
+
+// HandleButton runs the handler for a click. Clicks on interfaces the
+// player doesn't have open are ignored.
+func (p *Player) HandleButton(click ButtonClick) {
+	if !p.IsInterfaceOpen(click.Interface) {
+		p.Client.Server.Logger.Debug("button on a closed interface", "interface", click.Interface, "component", click.Component)
+		return
+	}
+
+	handler, ok := buttonHandlers[ComponentHash(click.Interface, click.Component)]
+	if !ok {
+		handler, ok = buttonHandlers[ComponentHash(click.Interface, 0xffff)]
+	}
+	if !ok {
+		p.Client.Server.Logger.Debug("unhandled button", "interface", click.Interface, "component", click.Component, "slot", click.Slot, "option", click.Option)
+		return
+	}
+	handler(p, click)
+}
+
+// built in interfaces
+// TODO: confirm the components against a 578 client
+const (
+	ifLogoutTab  = 182
+	ifSettingTab = 261
+	ifEmoteTab   = 464
+	ifRunOrb     = 750
+)
+
+// emotes holds the seq played by each component of the emote tab.
+var emotes = map[int]int{
+	2:  855,  // yes
+	3:  856,  // no
+	4:  858,  // bow
+	5:  859,  // angry
+	6:  857,  // think
+	7:  863,  // wave
+	8:  2113, // shrug
+	9:  862,  // cheer
+	10: 864,  // beckon
+	11: 861,  // laugh
+	12: 2109, // jump for joy
+	13: 2111, // yawn
+	14: 866,  // dance
+	15: 2106, // jig
+	16: 2107, // spin
+	17: 2108, // headbang
+	18: 860,  // cry
+	19: 1374, // blow kiss
+	20: 2105, // panic
+	21: 2110, // raspberry
+	22: 865,  // clap
+	23: 2112, // salute
+}
+
+func init() {
+	RegisterButton(ifLogoutTab, 6, func(p *Player, click ButtonClick) {
+		p.Logout()
+	})
+
+	toggleRun := func(p *Player, click ButtonClick) {
+		p.SetRunning(!p.Running)
+	}
+	RegisterButton(ifRunOrb, 1, toggleRun)
+	RegisterButton(ifSettingTab, 3, toggleRun)
+
+	RegisterButtons(ifEmoteTab, func(p *Player, click ButtonClick) {
+		if seq, ok := emotes[click.Component]; ok {
+			p.Anim(seq, 0)
+		}
+	})
+
+	RegisterButtons(ifSettingTab, func(p *Player, click ButtonClick) {
+		switch click.Component {
+		case 4:
+			p.toggleVarp(VarpChatEffectsOff)
+		case 5:
+			p.toggleVarp(VarpSplitPrivateChat)
+		case 6:
+			p.toggleVarp(VarpOneMouseButton)
+		case 7:
+			p.toggleVarp(VarpAcceptAid)
+		case 14, 15, 16, 17:
+			p.SetVarp(VarpBrightness, click.Component-13)
+		}
+	})
+}
+
+// toggleVarp flips a varp between 0 and 1.
+func (p *Player) toggleVarp(id int) {
+	p.SetVarp(id, 1-p.Varp(id))
+}
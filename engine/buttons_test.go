@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// click sends p an IF_BUTTON for a component, the way the client does.
+func click(t *testing.T, p *Player, iface int, component int, slot int, obj int) {
+	t.Helper()
+
+	var buf packet.Packet
+	buf.P4(uint32(ComponentHash(iface, component)))
+	buf.P2(uint16(slot))
+	buf.P2(uint16(obj))
+
+	c, err := decodeIfButton(util.ClientProtIfButton, packet.NewPacket(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("decodeIfButton() error = %v", err)
+	}
+	p.HandleButton(c)
+}
+
+// newButtonTestPlayer returns a player with the game frame and its tabs
+// open.
+func newButtonTestPlayer() *Player {
+	p := newConnectedTestPlayer(1)
+	p.World = newTestWorld()
+	p.World.AddPlayer(p)
+	p.OpenTop(p.Frame())
+	p.OpenTab(12, ifSettingTab)
+	p.OpenTab(13, ifEmoteTab)
+	p.OpenTab(16, ifLogoutTab)
+	p.OpenSub(p.Frame(), 1, ifRunOrb, SubFlagsFrame)
+	sent(p)
+	return p
+}
+
+func Test_decodeIfButton(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  int
+		payload []byte
+		want    ButtonClick
+		wantErr bool
+	}{
+		{
+			name:    "component",
+			opcode:  util.ClientProtIfButton,
+			payload: []byte{0x01, 0xd0, 0x00, 0x0e, 0xff, 0xff, 0xff, 0xff},
+			want:    ButtonClick{Interface: 464, Component: 14, Slot: -1, Obj: -1, Option: 1},
+		},
+		{
+			name:    "inventory slot",
+			opcode:  util.ClientProtIfButton,
+			payload: []byte{0x00, 0x95, 0x00, 0x00, 0x00, 0x03, 0x10, 0x37},
+			want:    ButtonClick{Interface: 149, Component: 0, Slot: 3, Obj: 4151, Option: 1},
+		},
+		{
+			name:    "truncated",
+			opcode:  util.ClientProtIfButton,
+			payload: []byte{0x01, 0xd0},
+			wantErr: true,
+		},
+		{
+			name:    "not a button",
+			opcode:  util.ClientProtMoveGameClick,
+			payload: make([]byte, 8),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeIfButton(tt.opcode, packet.NewPacket(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeIfButton() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want && !tt.wantErr {
+				t.Errorf("decodeIfButton() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_HandleButton(t *testing.T) {
+	tests := []struct {
+		name      string
+		iface     int
+		component int
+		slot      int
+		check     func(t *testing.T, p *Player)
+	}{
+		{
+			name:  "logout",
+			iface: ifLogoutTab, component: 6,
+			check: func(t *testing.T, p *Player) {
+				if got := sent(p); !reflect.DeepEqual(got, []int{util.ServerProtLogout}) {
+					t.Errorf("sent %v, want LOGOUT", got)
+				}
+			},
+		},
+		{
+			name:  "run orb",
+			iface: ifRunOrb, component: 1,
+			check: func(t *testing.T, p *Player) {
+				if !p.Running || p.Varp(VarpRunning) != 1 {
+					t.Errorf("Running = %v, run varp = %v", p.Running, p.Varp(VarpRunning))
+				}
+			},
+		},
+		{
+			name:  "run setting",
+			iface: ifSettingTab, component: 3,
+			check: func(t *testing.T, p *Player) {
+				if !p.Running || p.Varp(VarpRunning) != 1 {
+					t.Errorf("Running = %v, run varp = %v", p.Running, p.Varp(VarpRunning))
+				}
+			},
+		},
+		{
+			name:  "emote",
+			iface: ifEmoteTab, component: 14,
+			check: func(t *testing.T, p *Player) {
+				if p.masks.flags != MaskAnim || p.masks.anim != 866 {
+					t.Errorf("masks = %+v, want the dance anim", p.masks)
+				}
+			},
+		},
+		{
+			name:  "settings",
+			iface: ifSettingTab, component: 4,
+			check: func(t *testing.T, p *Player) {
+				if p.Varp(VarpChatEffectsOff) != 1 {
+					t.Errorf("chat effects varp = %v, want 1", p.Varp(VarpChatEffectsOff))
+				}
+			},
+		},
+		{
+			name:  "brightness",
+			iface: ifSettingTab, component: 16,
+			check: func(t *testing.T, p *Player) {
+				if p.Varp(VarpBrightness) != 3 {
+					t.Errorf("brightness varp = %v, want 3", p.Varp(VarpBrightness))
+				}
+			},
+		},
+		{
+			name:  "interface not open",
+			iface: 12, component: 1,
+			check: func(t *testing.T, p *Player) {
+				if got := sent(p); len(got) != 0 {
+					t.Errorf("sent %v", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newButtonTestPlayer()
+			click(t, p, tt.iface, tt.component, -1, -1)
+			tt.check(t, p)
+		})
+	}
+}
+
+func TestRegisterButton(t *testing.T) {
+	const iface = 9999
+	defer func() {
+		delete(buttonHandlers, ComponentHash(iface, 1))
+		delete(buttonHandlers, ComponentHash(iface, 0xffff))
+	}()
+
+	var clicked []string
+	RegisterButtons(iface, func(p *Player, click ButtonClick) { clicked = append(clicked, "any") })
+	RegisterButton(iface, 1, func(p *Player, click ButtonClick) { clicked = append(clicked, "one") })
+
+	p := newButtonTestPlayer()
+	p.OpenFrameSub(SlotMain, iface, 0)
+	click(t, p, iface, 1, -1, -1)
+	click(t, p, iface, 2, -1, -1)
+	p.CloseFrameSub(SlotMain)
+	click(t, p, iface, 1, -1, -1)
+
+	if want := []string{"one", "any"}; !reflect.DeepEqual(clicked, want) {
+		t.Errorf("clicked %v, want %v", clicked, want)
+	}
+}
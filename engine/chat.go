@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util/huffman"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+const (
+	// maxChatLength is the most characters the client lets a player type.
+	maxChatLength = 80
+	// a player can send chatRateLimit messages in any chatRateWindow
+	chatRateLimit  = 5
+	chatRateWindow = 5 * time.Second
+)
+
+// PublicMessage is a line of public chat sent by a client.
+type PublicMessage struct {
+	Colour  int
+	Effects int
+	Text    string
+}
+
+// ChatFilter checks a message before it's sent to anyone, returning the
+// text to send in its place, or false to drop it.
+type ChatFilter func(p *Player, text string) (string, bool)
+
+// decodeMessagePublic decodes MESSAGE_PUBLIC.
+// TODO: confirm the field order against a 578 client
+func decodeMessagePublic(codec *huffman.Huffman, buf *packet.Packet) (msg PublicMessage, err error) {
+	defer recoverDecode(&err)
+
+	msg.Colour = int(buf.G1())
+	msg.Effects = int(buf.G1())
+	msg.Text, err = unpackChat(codec, buf)
+	return msg, err
+}
+
+// unpackChat reads text packed by packChat.
+func unpackChat(codec *huffman.Huffman, buf *packet.Packet) (string, error) {
+	length := int(buf.GSmart())
+	if length > maxChatLength {
+		return "", fmt.Errorf("chat is %d characters long", length)
+	}
+	return codec.Decode(buf.Bytes(), length)
+}
+
+// packChat returns text as the client sends and reads chat: its length,
+// then the text compressed.
+func packChat(codec *huffman.Huffman, text string) ([]byte, error) {
+	encoded, err := codec.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf packet.Packet
+	buf.PSmart(uint16(len([]rune(text))))
+	buf.PData(encoded, len(encoded))
+	return buf.Bytes(), nil
+}
+
+// modIcon returns the crown shown next to the player's name in chat.
+func (p *Player) modIcon() int {
+	icon := int(min(p.StaffModLevel, 2))
+	if icon == 0 && p.PlayerModLevel > 0 {
+		icon = 1
+	}
+	return icon
+}
+
+// chatAllowed reports whether the player can send another message at now,
+// counting it if they can.
+func (p *Player) chatAllowed(now time.Time) bool {
+	recent := p.chatTimes[:0]
+	for _, sent := range p.chatTimes {
+		if now.Sub(sent) < chatRateWindow {
+			recent = append(recent, sent)
+		}
+	}
+	p.chatTimes = recent
+
+	if len(p.chatTimes) >= chatRateLimit {
+		return false
+	}
+	p.chatTimes = append(p.chatTimes, now)
+	return true
+}
+
+// PublicChat says msg in public chat, to every player that can see the
+// player. Messages starting with a / go to the player's clan channel
+// instead.
+func (p *Player) PublicChat(msg PublicMessage, now time.Time) {
+	if text, ok := strings.CutPrefix(msg.Text, "/"); ok {
+		p.ClanChat(text, now)
+		return
+	}
+
+	if p.IsMuted(now) {
+		p.MessageGame("You have been muted and can't talk in public chat.", MessageTypeGame, "", "")
+		return
+	}
+	if !p.chatAllowed(now) {
+		p.MessageGame("You're sending messages too quickly.", MessageTypeGame, "", "")
+		return
+	}
+
+	text := msg.Text
+	if filter := p.World.ChatFilter; filter != nil {
+		var ok bool
+		text, ok = filter(p, text)
+		if !ok {
+			return
+		}
+	}
+
+	packed, err := packChat(p.World.huffman(), text)
+	if err != nil {
+		p.Client.Server.Logger.Warn("could not pack chat", "username", p.Username, "error", err)
+		return
+	}
+	p.Chat(ChatMessage{
+		Colour:  msg.Colour,
+		Effects: msg.Effects,
+		ModIcon: p.modIcon(),
+		Packed:  packed,
+	})
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/huffman"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+func Test_decodeMessagePublic(t *testing.T) {
+	encode := func(colour uint8, effects uint8, text string) []byte {
+		packed, err := packChat(huffman.Default, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte{colour, effects}, packed...)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    PublicMessage
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			data: encode(0, 0, "hello world"),
+			want: PublicMessage{Text: "hello world"},
+		},
+		{
+			name: "wave red",
+			data: encode(1, 2, "Selling lobsters"),
+			want: PublicMessage{Colour: 1, Effects: 2, Text: "Selling lobsters"},
+		},
+		{
+			name: "empty",
+			data: encode(0, 0, ""),
+			want: PublicMessage{},
+		},
+		{
+			name:    "too long",
+			data:    []byte{0, 0, maxChatLength + 1, 0},
+			wantErr: true,
+		},
+		{
+			name:    "truncated text",
+			data:    []byte{0, 0, 20, 0x83},
+			wantErr: true,
+		},
+		{
+			name:    "missing effects",
+			data:    []byte{0},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMessagePublic(huffman.Default, packet.NewPacket(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeMessagePublic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeMessagePublic() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// chatText returns the text of the chat mask set on p, or false if there
+// isn't one.
+func chatText(t *testing.T, p *Player) (string, bool) {
+	t.Helper()
+	if p.masks.flags&MaskChat == 0 {
+		return "", false
+	}
+	text, err := unpackChat(huffman.Default, packet.NewPacket(p.masks.chat.Packed))
+	if err != nil {
+		t.Fatalf("unpackChat() error = %v", err)
+	}
+	return text, true
+}
+
+func TestPlayer_PublicChat(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name   string
+		setup  func(p *Player)
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "said",
+			text:   "hello world",
+			want:   "hello world",
+			wantOK: true,
+		},
+		{
+			name: "muted",
+			setup: func(p *Player) {
+				p.Muted = true
+				p.MutedUntil = now.Add(time.Hour)
+			},
+			text: "hello world",
+		},
+		{
+			name: "mute expired",
+			setup: func(p *Player) {
+				p.Muted = true
+				p.MutedUntil = now.Add(-time.Second)
+			},
+			text:   "hello world",
+			want:   "hello world",
+			wantOK: true,
+		},
+		{
+			name: "filtered",
+			setup: func(p *Player) {
+				p.World.ChatFilter = func(p *Player, text string) (string, bool) {
+					return strings.ReplaceAll(text, "darn", "****"), true
+				}
+			},
+			text:   "darn it",
+			want:   "**** it",
+			wantOK: true,
+		},
+		{
+			name: "dropped by the filter",
+			setup: func(p *Player) {
+				p.World.ChatFilter = func(p *Player, text string) (string, bool) {
+					return "", false
+				}
+			},
+			text: "buy gold",
+		},
+		{
+			name: "too fast",
+			setup: func(p *Player) {
+				for i := 0; i < chatRateLimit; i++ {
+					p.chatTimes = append(p.chatTimes, now.Add(-time.Second))
+				}
+			},
+			text: "hello world",
+		},
+		{
+			name: "earlier messages forgotten",
+			setup: func(p *Player) {
+				for i := 0; i < chatRateLimit; i++ {
+					p.chatTimes = append(p.chatTimes, now.Add(-chatRateWindow))
+				}
+			},
+			text:   "hello world",
+			want:   "hello world",
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newConnectedTestPlayer(1)
+			p.World = newTestWorld()
+			if tt.setup != nil {
+				tt.setup(p)
+			}
+
+			p.PublicChat(PublicMessage{Text: tt.text}, now)
+
+			got, ok := chatText(t, p)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("chat = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// receive puts a packet from the client in p's input buffer, for
+// ProcessIn to read.
+func receive(p *Player, opcode uint8, data []byte) {
+	buf := []byte{opcode}
+	if util.ClientProtLengths[opcode] == 255 {
+		buf = append(buf, uint8(len(data)))
+	}
+	buf = append(buf, data...)
+
+	p.Client.Server.BufferIn = append(p.Client.Server.BufferIn[:p.Client.BufferInOffset], buf...)
+	p.Client.BufferInOffset += len(buf)
+}
+
+func TestPlayer_ProcessIn_MessagePublic(t *testing.T) {
+	packed, err := packChat(huffman.Default, "hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, muted := range []bool{false, true} {
+		p := newConnectedTestPlayer(1)
+		p.World = newTestWorld()
+		if muted {
+			p.Muted = true
+			p.MutedUntil = time.Now().Add(time.Hour)
+		}
+
+		receive(p, util.ClientProtMessagePublic, append([]byte{0, 0}, packed...))
+		p.ProcessIn()
+
+		got, ok := chatText(t, p)
+		if want := !muted; ok != want || ok && got != "hello world" {
+			t.Errorf("muted %v: chat = %q, %v, want %v", muted, got, ok, want)
+		}
+	}
+}
+
+func TestPlayer_modIcon(t *testing.T) {
+	tests := []struct {
+		name           string
+		staffModLevel  uint8
+		playerModLevel uint8
+		want           int
+	}{
+		{name: "player", want: 0},
+		{name: "player moderator", playerModLevel: 1, want: 1},
+		{name: "staff moderator", staffModLevel: 1, want: 1},
+		{name: "jagex moderator", staffModLevel: 2, playerModLevel: 1, want: 2},
+		{name: "administrator", staffModLevel: 3, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPlayer(nil)
+			p.StaffModLevel = tt.staffModLevel
+			p.PlayerModLevel = tt.playerModLevel
+			if got := p.modIcon(); got != tt.want {
+				t.Errorf("modIcon() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
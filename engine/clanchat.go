@@ -0,0 +1,508 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// clan ranks, which the owner gives to their friends
+const (
+	ClanRankAnyone     = -1
+	ClanRankFriend     = 0
+	ClanRankRecruit    = 1
+	ClanRankCorporal   = 2
+	ClanRankSergeant   = 3
+	ClanRankLieutenant = 4
+	ClanRankCaptain    = 5
+	ClanRankGeneral    = 6
+	ClanRankOwner      = 7
+	// ClanRankAdmin is the rank of staff, in every channel.
+	ClanRankAdmin = 127
+)
+
+const (
+	maxClanMembers = 100
+	// how long a player kicked from a channel can't rejoin it
+	clanKickDuration = time.Hour
+)
+
+var errNoChannel = errors.New("no such channel")
+
+// ClanSettings is how the owner has set up their channel. It's kept by the
+// owner even while the channel is disabled.
+type ClanSettings struct {
+	// Name is the channel name, or empty if the channel is disabled.
+	Name     string `json:"name"`
+	JoinRank int    `json:"joinRank"`
+	TalkRank int    `json:"talkRank"`
+	KickRank int    `json:"kickRank"`
+	// Ranks holds the rank given to each friend, by their name in base 37.
+	Ranks map[uint64]int `json:"ranks,omitempty"`
+}
+
+// NewClanSettings returns the settings of a channel that hasn't been set
+// up: disabled, open to anyone and with only the owner able to kick.
+func NewClanSettings() *ClanSettings {
+	return &ClanSettings{
+		JoinRank: ClanRankAnyone,
+		TalkRank: ClanRankAnyone,
+		KickRank: ClanRankOwner,
+	}
+}
+
+// clanChannel is a channel with players in it.
+type clanChannel struct {
+	// the owner's name in base 37
+	key       uint64
+	ownerName string
+	// owner is nil while the owner is logged out, when ownerFriends is the
+	// friend list they logged out with.
+	owner        *Player
+	ownerFriends []string
+	settings     *ClanSettings
+	members      []*Player
+	// when each player kicked from the channel can rejoin it, by their name
+	// in base 37
+	kicked map[uint64]time.Time
+}
+
+// hasFriend reports whether name is on the owner's friend list.
+func (c *clanChannel) hasFriend(name string) bool {
+	if c.owner != nil {
+		return c.owner.HasFriend(name)
+	}
+	return indexName(c.ownerFriends, name) != -1
+}
+
+// rank returns the rank of p in the channel.
+func (c *clanChannel) rank(p *Player) int {
+	switch {
+	case p.StaffModLevel >= 2:
+		return ClanRankAdmin
+	case util.ToBase37(p.Username) == c.key:
+		return ClanRankOwner
+	case !c.hasFriend(p.Username):
+		return ClanRankAnyone
+	}
+	if rank, ok := c.settings.Ranks[util.ToBase37(p.Username)]; ok {
+		return rank
+	}
+	return ClanRankFriend
+}
+
+func (c *clanChannel) member(name string) *Player {
+	for _, v := range c.members {
+		if sameName(v.Username, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func (c *clanChannel) remove(p *Player) {
+	c.members = slices.DeleteFunc(c.members, func(v *Player) bool {
+		return v == p
+	})
+	p.channel = nil
+}
+
+// update sends every member the channel's member list.
+func (c *clanChannel) update() {
+	for _, v := range c.members {
+		v.sendClanChannel(c)
+	}
+}
+
+// decodeClanName decodes the CLAN_JOINCHAT_LEAVECHAT and CLAN_KICKUSER
+// payloads, which are a name in base 37.
+func decodeClanName(buf *packet.Packet) (name uint64, err error) {
+	defer recoverDecode(&err)
+
+	return buf.G8(), nil
+}
+
+// decodeFriendSetRank decodes FRIEND_SETRANK.
+// TODO: confirm the field order against a 578 client
+func decodeFriendSetRank(buf *packet.Packet) (name string, rank int, err error) {
+	defer recoverDecode(&err)
+
+	name = buf.GJStr()
+	rank = int(buf.G1())
+	if rank > ClanRankGeneral {
+		return "", 0, fmt.Errorf("bad clan rank %d", rank)
+	}
+	return name, rank, nil
+}
+
+// channel returns the channel owned by the player whose name in base 37 is
+// key, opening it if nobody is in it yet. Settings of a logged out owner are
+// read from their save.
+func (w *World) channel(p *Player, key uint64) (*clanChannel, error) {
+	if c, ok := w.channels[key]; ok {
+		return c, nil
+	}
+
+	c := &clanChannel{key: key, kicked: make(map[uint64]time.Time)}
+	if owner, ok := w.findPlayer37(key); ok {
+		c.ownerName = owner.Username
+		c.owner = owner
+		c.settings = owner.clan
+	} else {
+		name := util.FromBase37(key)
+		save, err := LoadPlayerSave(p.Client.Server.savePath(name))
+		if err != nil {
+			return nil, err
+		}
+		c.ownerName = util.ToTitleCase(strings.ReplaceAll(name, "_", " "))
+		c.ownerFriends = save.Friends
+		c.settings = save.Clan
+	}
+	if c.settings == nil || c.settings.Name == "" {
+		return nil, errNoChannel
+	}
+
+	if w.channels == nil {
+		w.channels = make(map[uint64]*clanChannel)
+	}
+	w.channels[key] = c
+	return c, nil
+}
+
+// findPlayer37 returns the player logged in with the name that is key in
+// base 37.
+func (w *World) findPlayer37(key uint64) (*Player, bool) {
+	for _, v := range w.Players {
+		if v != nil && util.ToBase37(v.Username) == key {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// JoinClanChannel puts the player in the channel of the player whose name
+// in base 37 is owner.
+func (p *Player) JoinClanChannel(owner uint64, now time.Time) {
+	if p.channel != nil {
+		p.MessageGame("You are already in a channel.", MessageTypeGame, "", "")
+		return
+	}
+
+	p.MessageGame("Attempting to join channel...", MessageTypeGame, "", "")
+	c, err := p.World.channel(p, owner)
+	if err != nil {
+		if !errors.Is(err, errNoChannel) {
+			p.Client.Server.Logger.Warn("could not open channel", "owner", util.FromBase37(owner), "error", err)
+		}
+		p.MessageGame("The channel you tried to join does not exist.", MessageTypeGame, "", "")
+		p.World.closeEmptyChannel(owner)
+		return
+	}
+
+	rank := c.rank(p)
+	switch {
+	case now.Before(c.kicked[util.ToBase37(p.Username)]) && rank != ClanRankAdmin:
+		p.MessageGame("You are temporarily blocked from joining this channel.", MessageTypeGame, "", "")
+	case rank < c.settings.JoinRank:
+		p.MessageGame("You do not have a high enough rank to join this channel.", MessageTypeGame, "", "")
+	case len(c.members) >= maxClanMembers:
+		p.MessageGame("The channel is full.", MessageTypeGame, "", "")
+	default:
+		c.members = append(c.members, p)
+		p.channel = c
+		p.MessageGame("Now talking in clan channel "+c.settings.Name, MessageTypeGame, "", "")
+		p.MessageGame("To talk, start each line of chat with the / symbol.", MessageTypeGame, "", "")
+		c.update()
+		return
+	}
+	p.World.closeEmptyChannel(owner)
+}
+
+// LeaveClanChannel takes the player out of the channel they're in.
+func (p *Player) LeaveClanChannel() {
+	c := p.channel
+	if c == nil {
+		return
+	}
+	c.remove(p)
+	p.sendClanChannel(nil)
+	p.MessageGame("You have left the channel.", MessageTypeGame, "", "")
+
+	c.update()
+	p.World.closeEmptyChannel(c.key)
+}
+
+// closeEmptyChannel forgets the channel of owner if nobody is in it.
+func (w *World) closeEmptyChannel(owner uint64) {
+	if c, ok := w.channels[owner]; ok && len(c.members) == 0 {
+		delete(w.channels, owner)
+	}
+}
+
+// KickClanMember kicks the member called name out of the player's channel,
+// blocking them from rejoining for a while.
+func (p *Player) KickClanMember(name string, now time.Time) {
+	c := p.channel
+	if c == nil {
+		return
+	}
+	target := c.member(name)
+	if target == nil {
+		return
+	}
+
+	rank := c.rank(p)
+	if rank < c.settings.KickRank || rank <= c.rank(target) {
+		p.MessageGame("You do not have a high enough rank to kick in this channel.", MessageTypeGame, "", "")
+		return
+	}
+
+	c.remove(target)
+	c.kicked[util.ToBase37(target.Username)] = now.Add(clanKickDuration)
+	target.sendClanChannel(nil)
+	target.MessageGame("You have been kicked from the channel.", MessageTypeGame, "", "")
+	c.update()
+	p.World.closeEmptyChannel(c.key)
+}
+
+// ClanChat says text in the player's channel.
+func (p *Player) ClanChat(text string, now time.Time) {
+	c := p.channel
+	if c == nil {
+		p.MessageGame("You are not in a channel.", MessageTypeGame, "", "")
+		return
+	}
+	if p.IsMuted(now) {
+		p.MessageGame("You have been muted and can't talk in clan channels.", MessageTypeGame, "", "")
+		return
+	}
+	if c.rank(p) < c.settings.TalkRank {
+		p.MessageGame("You do not have a high enough rank to talk in this channel.", MessageTypeGame, "", "")
+		return
+	}
+	if !p.chatAllowed(now) {
+		p.MessageGame("You're sending messages too quickly.", MessageTypeGame, "", "")
+		return
+	}
+
+	if filter := p.World.ChatFilter; filter != nil {
+		var ok bool
+		text, ok = filter(p, text)
+		if !ok {
+			return
+		}
+	}
+
+	packed, err := packChat(p.World.huffman(), text)
+	if err != nil {
+		p.Client.Server.Logger.Warn("could not pack chat", "username", p.Username, "error", err)
+		return
+	}
+
+	p.World.messageID++
+	for _, v := range c.members {
+		if !v.IsIgnoring(p.Username) {
+			v.sendMessageClanChannel(c, p, p.World.messageID, packed)
+		}
+	}
+}
+
+// clanSettings returns the player's channel settings, setting them up if
+// they don't have any yet.
+func (p *Player) clanSettings() *ClanSettings {
+	if p.clan == nil {
+		p.clan = NewClanSettings()
+	}
+	return p.clan
+}
+
+// SetClanSettings changes the name and rank thresholds of the player's
+// channel. An empty name disables it. Members that can't join any more are
+// kicked out.
+func (p *Player) SetClanSettings(name string, joinRank int, talkRank int, kickRank int) {
+	settings := p.clanSettings()
+	settings.Name = name
+	settings.JoinRank = joinRank
+	settings.TalkRank = talkRank
+	settings.KickRank = kickRank
+
+	c, ok := p.World.channels[util.ToBase37(p.Username)]
+	if !ok {
+		return
+	}
+	for _, v := range slices.Clone(c.members) {
+		if name == "" || c.rank(v) < joinRank {
+			c.remove(v)
+			v.sendClanChannel(nil)
+			v.MessageGame("You have been removed from the channel.", MessageTypeGame, "", "")
+		}
+	}
+	c.update()
+	p.World.closeEmptyChannel(c.key)
+}
+
+// SetClanRank gives the player's friend called name a rank in the player's
+// channel.
+func (p *Player) SetClanRank(name string, rank int) {
+	i := indexName(p.social.friends, name)
+	if i == -1 {
+		return
+	}
+	name = p.social.friends[i]
+
+	settings := p.clanSettings()
+	if rank == ClanRankFriend {
+		delete(settings.Ranks, util.ToBase37(name))
+	} else {
+		if settings.Ranks == nil {
+			settings.Ranks = make(map[uint64]int)
+		}
+		settings.Ranks[util.ToBase37(name)] = rank
+	}
+	p.sendFriend(name)
+
+	if c, ok := p.World.channels[util.ToBase37(p.Username)]; ok && c.member(name) != nil {
+		c.update()
+	}
+}
+
+// friendRank returns the rank the player has given their friend called
+// name.
+func (p *Player) friendRank(name string) int {
+	if p.clan == nil {
+		return ClanRankFriend
+	}
+	return p.clan.Ranks[util.ToBase37(name)]
+}
+
+// loadClan takes over the player's channel when they log in, if it's open.
+func (p *Player) loadClan() {
+	if c, ok := p.World.channels[util.ToBase37(p.Username)]; ok {
+		c.owner = p
+		c.ownerFriends = nil
+		p.clan = c.settings
+	}
+}
+
+// unloadClan takes the player out of their channel when they log out, and
+// leaves their own channel running without them.
+func (p *Player) unloadClan() {
+	if c := p.channel; c != nil {
+		c.remove(p)
+		c.update()
+		p.World.closeEmptyChannel(c.key)
+	}
+	if c, ok := p.World.channels[util.ToBase37(p.Username)]; ok && c.owner == p {
+		c.owner = nil
+		c.ownerFriends = slices.Clone(p.social.friends)
+	}
+}
+
+// sendClanChannel sends the members of c, or that the player isn't in a
+// channel if c is nil.
+// TODO: confirm the layout against a 578 client
+func (p *Player) sendClanChannel(c *clanChannel) {
+	var response packet.Packet
+	response.P1(util.ServerProtUpdateClanChannel)
+	response.P2(0)
+	start := response.Len()
+
+	if c != nil {
+		response.PJStr(c.ownerName)
+		response.P1(0) // no display name
+		response.P8(util.ToBase37(c.settings.Name))
+		response.P1(uint8(c.settings.KickRank))
+		response.P1(uint8(len(c.members)))
+		for _, v := range c.members {
+			response.PJStr(v.Username)
+			response.P1(0) // no display name
+			response.P2(uint16(v.worldID()))
+			response.P1(uint8(c.rank(v)))
+			response.PJStr(fmt.Sprintf("World %d", v.worldID()))
+		}
+	}
+
+	response.PSize2(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// sendMessageClanChannel sends a message said in c by from. id is unique
+// to the message, so the client can tell repeats apart.
+// TODO: confirm the layout against a 578 client
+func (p *Player) sendMessageClanChannel(c *clanChannel, from *Player, id uint64, packed []byte) {
+	var response packet.Packet
+	response.P1(util.ServerProtMessageClanChannel)
+	response.P1(0)
+	start := response.Len()
+
+	response.P1(0) // no display name
+	response.PJStr(from.Username)
+	response.P8(util.ToBase37(c.settings.Name))
+	response.P2(uint16(id >> 24))
+	response.P3(uint32(id & 0xffffff))
+	response.P1(uint8(from.modIcon()))
+	response.PData(packed, len(packed))
+
+	response.PSize1(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// clan interfaces
+// TODO: confirm the components against a 578 client
+const (
+	ifClanTab   = 589
+	ifClanSetup = 590
+)
+
+// clanRankOptions holds the rank picked by each option of the clan setup
+// rank menus.
+var clanRankOptions = []int{
+	ClanRankAnyone,
+	ClanRankFriend,
+	ClanRankRecruit,
+	ClanRankCorporal,
+	ClanRankSergeant,
+	ClanRankLieutenant,
+	ClanRankCaptain,
+	ClanRankGeneral,
+	ClanRankOwner,
+}
+
+func init() {
+	RegisterButton(ifClanTab, 9, func(p *Player, click ButtonClick) {
+		p.OpenFrameSub(SlotMain, ifClanSetup, 0)
+	})
+
+	RegisterButtons(ifClanSetup, func(p *Player, click ButtonClick) {
+		settings := *p.clanSettings()
+		if click.Component == 22 {
+			// TODO: ask for a name once there are string dialogs
+			if click.Option == 1 {
+				settings.Name = p.Username
+			} else {
+				settings.Name = ""
+			}
+		} else {
+			if click.Option < 1 || click.Option > len(clanRankOptions) {
+				return
+			}
+			rank := clanRankOptions[click.Option-1]
+			switch click.Component {
+			case 23:
+				settings.JoinRank = rank
+			case 24:
+				settings.TalkRank = rank
+			case 25:
+				settings.KickRank = max(rank, ClanRankRecruit)
+			default:
+				return
+			}
+		}
+		p.SetClanSettings(settings.Name, settings.JoinRank, settings.TalkRank, settings.KickRank)
+	})
+}
@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+// clanMembers returns the names in the channel the player is in.
+func clanMembers(p *Player) []string {
+	if p.channel == nil {
+		return nil
+	}
+	var names []string
+	for _, v := range p.channel.members {
+		names = append(names, v.Username)
+	}
+	return names
+}
+
+func TestPlayer_JoinClanChannel(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name  string
+		setup func(owner *Player, bob *Player)
+		want  []string
+	}{
+		{
+			name: "open to anyone",
+			want: []string{"Zezima", "Bob"},
+		},
+		{
+			name: "not set up",
+			setup: func(owner *Player, bob *Player) {
+				owner.clan = nil
+			},
+		},
+		{
+			name: "disabled",
+			setup: func(owner *Player, bob *Player) {
+				owner.clan.Name = ""
+			},
+		},
+		{
+			name: "friends only, not a friend",
+			setup: func(owner *Player, bob *Player) {
+				owner.clan.JoinRank = ClanRankFriend
+			},
+			want: []string{"Zezima"},
+		},
+		{
+			name: "recruits only, a friend",
+			setup: func(owner *Player, bob *Player) {
+				owner.clan.JoinRank = ClanRankRecruit
+				owner.social.friends = []string{"Bob"}
+			},
+			want: []string{"Zezima"},
+		},
+		{
+			name: "recruits only, a recruit",
+			setup: func(owner *Player, bob *Player) {
+				owner.clan.JoinRank = ClanRankRecruit
+				owner.social.friends = []string{"Bob"}
+				owner.SetClanRank("bob", ClanRankRecruit)
+			},
+			want: []string{"Zezima", "Bob"},
+		},
+		{
+			name: "only the owner, staff",
+			setup: func(owner *Player, bob *Player) {
+				owner.clan.JoinRank = ClanRankOwner
+				bob.StaffModLevel = 2
+			},
+			want: []string{"Zezima", "Bob"},
+		},
+		{
+			name: "kicked",
+			setup: func(owner *Player, bob *Player) {
+				owner.JoinClanChannel(util.ToBase37("Zezima"), now)
+				owner.channel.kicked[util.ToBase37("Bob")] = now.Add(time.Minute)
+			},
+			want: []string{"Zezima"},
+		},
+		{
+			name: "kick expired",
+			setup: func(owner *Player, bob *Player) {
+				owner.JoinClanChannel(util.ToBase37("Zezima"), now)
+				owner.channel.kicked[util.ToBase37("Bob")] = now
+			},
+			want: []string{"Zezima", "Bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			owner := addSocialTestPlayer(w, "Zezima")
+			bob := addSocialTestPlayer(w, "Bob")
+			owner.clan = NewClanSettings()
+			owner.clan.Name = "Zezima"
+			if tt.setup != nil {
+				tt.setup(owner, bob)
+			}
+			if owner.channel == nil && owner.clan != nil && owner.clan.Name != "" {
+				owner.JoinClanChannel(util.ToBase37("Zezima"), now)
+			}
+
+			bob.JoinClanChannel(util.ToBase37("zezima"), now)
+
+			if got := clanMembers(owner); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_JoinClanChannel_offlineOwner(t *testing.T) {
+	w := newTestWorld()
+	bob := addSocialTestPlayer(w, "Bob")
+	bob.Client.Server.SaveDir = t.TempDir()
+
+	save := PlayerSave{
+		Friends: []string{"Bob"},
+		Clan:    &ClanSettings{Name: "Lumbridge", JoinRank: ClanRankFriend, KickRank: ClanRankOwner},
+	}
+	if err := util.WriteJSON(filepath.Join(bob.Client.Server.SaveDir, "durial_321.json"), save); err != nil {
+		t.Fatal(err)
+	}
+
+	bob.JoinClanChannel(util.ToBase37("Durial 321"), time.Now())
+	if got, want := clanMembers(bob), []string{"Bob"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("members = %v, want %v", got, want)
+	}
+	if got, want := bob.channel.ownerName, "Durial 321"; got != want {
+		t.Errorf("ownerName = %q, want %q", got, want)
+	}
+
+	bob.LeaveClanChannel()
+	if len(w.channels) != 0 {
+		t.Errorf("channels = %v after everyone left, want none", w.channels)
+	}
+}
+
+func TestPlayer_KickClanMember(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name     string
+		kickRank int
+		kicker   string
+		target   string
+		want     []string
+	}{
+		{
+			name:     "owner kicks a guest",
+			kickRank: ClanRankOwner,
+			kicker:   "Zezima",
+			target:   "Bob",
+			want:     []string{"Zezima", "Alice"},
+		},
+		{
+			name:     "captain kicks a guest",
+			kickRank: ClanRankCaptain,
+			kicker:   "Alice",
+			target:   "bob",
+			want:     []string{"Zezima", "Alice"},
+		},
+		{
+			name:     "captain can't kick when only the owner can",
+			kickRank: ClanRankOwner,
+			kicker:   "Alice",
+			target:   "Bob",
+			want:     []string{"Zezima", "Alice", "Bob"},
+		},
+		{
+			name:     "captain can't kick the owner",
+			kickRank: ClanRankCaptain,
+			kicker:   "Alice",
+			target:   "Zezima",
+			want:     []string{"Zezima", "Alice", "Bob"},
+		},
+		{
+			name:     "guest can't kick",
+			kickRank: ClanRankAnyone,
+			kicker:   "Bob",
+			target:   "Alice",
+			want:     []string{"Zezima", "Alice", "Bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			owner := addSocialTestPlayer(w, "Zezima")
+			alice := addSocialTestPlayer(w, "Alice")
+			bob := addSocialTestPlayer(w, "Bob")
+			owner.social.friends = []string{"Alice"}
+			owner.SetClanRank("Alice", ClanRankCaptain)
+			owner.SetClanSettings("Zezima", ClanRankAnyone, ClanRankAnyone, tt.kickRank)
+			for _, v := range []*Player{owner, alice, bob} {
+				v.JoinClanChannel(util.ToBase37("Zezima"), now)
+			}
+
+			kicker, _ := w.FindPlayer(tt.kicker)
+			kicker.KickClanMember(tt.target, now)
+
+			if got := clanMembers(owner); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_ClanChat(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name     string
+		talkRank int
+		ignored  bool
+		text     string
+		wantSent []int
+	}{
+		{
+			name:     "said",
+			talkRank: ClanRankAnyone,
+			text:     "/hello",
+			wantSent: []int{util.ServerProtMessageClanChannel},
+		},
+		{
+			name:     "not a clan message",
+			talkRank: ClanRankAnyone,
+			text:     "hello",
+		},
+		{
+			name:     "ignored",
+			talkRank: ClanRankAnyone,
+			ignored:  true,
+			text:     "/hello",
+		},
+		{
+			name:     "rank too low",
+			talkRank: ClanRankFriend,
+			text:     "/hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			owner := addSocialTestPlayer(w, "Zezima")
+			bob := addSocialTestPlayer(w, "Bob")
+			owner.SetClanSettings("Zezima", ClanRankAnyone, tt.talkRank, ClanRankOwner)
+			owner.JoinClanChannel(util.ToBase37("Zezima"), now)
+			bob.JoinClanChannel(util.ToBase37("Zezima"), now)
+			if tt.ignored {
+				owner.social.ignores = []string{"Bob"}
+			}
+			sent(owner)
+
+			bob.PublicChat(PublicMessage{Text: tt.text}, now)
+
+			if got := sent(owner); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent to the owner = %v, want %v", got, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestPlayer_SetClanSettings(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	w := newTestWorld()
+	owner := addSocialTestPlayer(w, "Zezima")
+	bob := addSocialTestPlayer(w, "Bob")
+	owner.SetClanSettings("Zezima", ClanRankAnyone, ClanRankAnyone, ClanRankOwner)
+	owner.JoinClanChannel(util.ToBase37("Zezima"), now)
+	bob.JoinClanChannel(util.ToBase37("Zezima"), now)
+
+	owner.SetClanSettings("Zezima", ClanRankFriend, ClanRankAnyone, ClanRankOwner)
+	if got, want := clanMembers(owner), []string{"Zezima"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("members = %v after raising the join rank, want %v", got, want)
+	}
+	if bob.channel != nil {
+		t.Errorf("bob is still in a channel")
+	}
+
+	owner.SetClanSettings("", ClanRankFriend, ClanRankAnyone, ClanRankOwner)
+	if owner.channel != nil || len(w.channels) != 0 {
+		t.Errorf("the channel is still open after disabling it")
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"math/rand"
 	"net"
 	"strconv"
+	"time"
 
+	"github.com/zsrv/rt5-server-go/login"
 	"github.com/zsrv/rt5-server-go/util"
 	"github.com/zsrv/rt5-server-go/util/isaacrandom"
 	"github.com/zsrv/rt5-server-go/util/packet"
@@ -99,6 +101,15 @@ func (c *Client) handleNew() {
 		//checksum, err := c.BufferInRaw.G4B() // TODO: G4B make any diff here or no?
 		checksum := c.BufferInRaw.G4()
 
+		list, err := c.Server.Login.WorldList()
+		if err != nil {
+			c.Server.Logger.Error("could not fetch world list", "error", err)
+			c.WriteRawSocket([]byte{util.WlProtOutReject})
+			c.Socket.Close()
+			c.State = ClientStateClosed
+			return
+		}
+
 		c.WriteRawSocket([]byte{util.WlProtOutSuccess})
 		c.State = ClientStateWL
 
@@ -109,20 +120,26 @@ func (c *Client) handleNew() {
 
 		response.P1(1) // encoding a world list update
 
-		if checksum != util.WorldListChecksum {
+		if checksum != list.Checksum {
 			response.P1(1) // encoding all information about the world list (countries, size of list, etc.)
 
-			wlraw := util.WorldListRaw.Bytes()
-			response.PData(wlraw, len(wlraw))
+			response.PData(list.Raw, len(list.Raw))
 
-			response.P4(util.WorldListChecksum)
+			response.P4(list.Checksum)
 		} else {
 			response.P1(0) // not encoding any world list information, just updating the player counts
 		}
 
-		for _, world := range util.WorldList {
-			response.PSmart(uint16(world.ID - util.MinID))
-			response.P2(uint16(world.Players))
+		// sent on every fetch, so the client's periodic refresh keeps the counts current
+		for _, world := range list.Players {
+			players := world.Players
+			if world.ID == c.Server.WorldParams.ID {
+				// our own count is always known exactly
+				players = c.Server.World.PlayerCount()
+			}
+
+			response.PSmart(uint16(world.ID - list.MinID))
+			response.P2(uint16(players))
 		}
 
 		response.PSize2(response.Len() - start)
@@ -139,14 +156,21 @@ func (c *Client) handleNew() {
 
 	case util.LoginProtCreateLogProgress:
 		c.Server.Logger.Debug("handleNew(): case LoginProtCreateLogProgress")
-		day := c.BufferInRaw.G1()
-		month := c.BufferInRaw.G1()
-		year := c.BufferInRaw.G2()
-		country := c.BufferInRaw.G2()
+		progress, err := decodeCreateProgress(&c.BufferInRaw)
+		if err != nil {
+			c.Server.Logger.Error("could not decode account creation progress", "error", err)
+			c.State = ClientStateClosed
+			return
+		}
 
-		c.Server.Logger.Debug("progress", "year", year, "month", month, "day", day, "country", country)
+		c.Server.Logger.Debug("progress", "year", progress.Year, "month", progress.Month, "day", progress.Day, "country", progress.Country)
 
-		c.WriteRawSocket([]byte{2})
+		code := login.ValidateDateOfBirth(progress.Day, progress.Month, progress.Year, time.Now())
+		if code == util.CreateProtOutSuccess {
+			code = login.ValidateCountry(progress.Country)
+		}
+
+		c.WriteRawSocket([]byte{code})
 
 	case util.LoginProtCreateCheckName:
 		c.Server.Logger.Debug("handleNew(): case LoginProtCreateCheckName")
@@ -154,14 +178,21 @@ func (c *Client) handleNew() {
 		username := util.FromBase37(usernameBase37)
 		c.Server.Logger.Debug("decoded username", "username", username)
 
-		// success:
-		c.WriteRawSocket([]byte{2})
+		code, names, err := c.Server.Login.CheckName(username)
+		if err != nil {
+			c.Server.Logger.Error("login service error", "error", err)
+			code = util.CreateProtOutServerBusy
+		}
+
+		if code != util.CreateProtOutUsernameSuggestion {
+			c.WriteRawSocket([]byte{code})
+			break
+		}
 
 		// suggested names:
 		var response packet.Packet
-		response.P1(21)
+		response.P1(code)
 
-		names := []string{"test", "test2"}
 		response.P1(uint8(len(names)))
 		for _, v := range names {
 			response.P8(util.ToBase37(v))
@@ -177,90 +208,28 @@ func (c *Client) handleNew() {
 		c.BufferInRaw.GData(newBuf, int(length))
 		c.BufferInRaw = *packet.NewPacket(newBuf)
 
-		revision := c.BufferInRaw.G2()
-
-		decrypted, err := c.BufferInRaw.RSADec()
+		req, err := decodeCreateAccount(&c.BufferInRaw)
 		if err != nil {
-			// TODO: make an error wrapper that logs the error and closes the client connection?
-			// check my notes for this
-			c.Server.Logger.Error("rsa decryption error", "error", err)
-		}
-
-		rsaMagic := decrypted.G1()
-		if rsaMagic != 10 {
-			// TODO: read failure
-			c.Server.Logger.Error("rsaMagic read failure", "rsaMagic", rsaMagic)
+			c.Server.Logger.Error("could not decode account creation", "error", err)
+			c.State = ClientStateClosed
+			return
 		}
+		req.Address = remoteHost(c.Socket)
 
-		key := make([]uint32, 4)
-		optIn := decrypted.G2()
-
-		usernameBase37 := decrypted.G8()
-		username := util.FromBase37(usernameBase37)
-
-		key1 := decrypted.G4()
-		key[0] = key1
-
-		password := decrypted.GJStr()
-
-		key2 := decrypted.G4()
-		key[1] = key2
-
-		affiliate := decrypted.G2()
-
-		day := decrypted.G1()
-
-		month := decrypted.G1()
-
-		key3 := decrypted.G4()
-		key[2] = key3
-
-		year := decrypted.G2()
-
-		country := decrypted.G2()
-
-		key4 := decrypted.G4()
-		key[3] = key4
-
-		extra := packet.NewPacket(c.BufferInRaw.Bytes())
-		extra.TinyDec(0, key, extra.Len())
+		c.Server.Logger.Debug("account creation values",
+			"optIn", req.OptIn, "username", req.Username, "affiliate", req.Affiliate,
+			"day", req.Day, "month", req.Month, "year", req.Year, "country", req.Country,
+			"email", req.Email)
 
-		email := extra.GJStr()
+		code, err := c.Server.Login.CreateAccount(req)
+		if err != nil {
+			c.Server.Logger.Error("login service error", "error", err)
+			if code == 0 {
+				code = util.CreateProtOutServerBusy
+			}
+		}
 
-		c.Server.Logger.Debug("account creation values",
-			"revision", revision, "optIn", optIn, "username", username, "password", password,
-			"affiliate", affiliate, "day", day, "month", month, "year", year, "country", country,
-			"email", email)
-
-		c.WriteRawSocket([]byte{2})
-
-		// 0 - unexpected response
-		// 1 - could not display video ad
-		// 2 - success
-		// 3 - invalid username/password
-		// 4 - account is banned
-		// 5 - account is logged in
-		// 6 - client out of date
-		// 7 - world is full
-		// 8 - login server offline
-		// 9 - too many connections
-		// 10 - bad session id
-		// 11 - weak password
-		// 12 - f2p account, p2p world
-		// 13 - could not login
-		// 14 - server is updating
-		// 15 - reconnecting
-		// 16 - too many login attempts
-		// 17 - p2p area, f2p world
-		// 18 - account locked
-		// 19 - members beta
-		// 20 - invalid login server
-		// 21 - moving worlds
-		// 22 - malformed login packet
-		// 23 - no reply from login server
-		// 24 - error loading profile
-		// 26 - mac address banned
-		// 27 - service unavailable
+		c.WriteRawSocket([]byte{code})
 
 	default:
 		c.Server.Logger.Warn("unknown opcode", "opcode", opcode)
@@ -417,6 +386,25 @@ func (c *Client) handleLogin() {
 		"username", username, "password", password,
 	)
 
+	auth, err := c.Server.Login.Login(login.Request{
+		WorldID:      c.Server.WorldParams.ID,
+		Username:     username,
+		Password:     password,
+		Address:      remoteHost(c.Socket),
+		UID:          uid,
+		Reconnecting: opcode == util.LoginProtWorldReconnect,
+	})
+	if err != nil {
+		c.Server.Logger.Error("login service error", "error", err)
+		c.rejectLogin(login.ResponseCode(err))
+		return
+	}
+	if auth.Code != util.LoginProtOutSuccess && auth.Code != util.LoginProtOutReconnecting {
+		c.Server.Logger.Debug("login rejected", "username", username, "code", auth.Code)
+		c.rejectLogin(auth.Code)
+		return
+	}
+
 	c.RandomIn = isaacrandom.NewIsaacRandom(key)
 	for i := 0; i < 4; i++ {
 		key[i] += 50
@@ -429,38 +417,77 @@ func (c *Client) handleLogin() {
 	}
 	player.WindowMode = windowMode
 	player.Username = util.ToTitleCase(username)
+	player.StaffModLevel = auth.StaffModLevel
+	player.PlayerModLevel = auth.PlayerModLevel
+	player.Address = remoteHost(c.Socket)
+	player.UID = uid
+	player.Muted = auth.Muted
+	player.MutedUntil = auth.MutedUntil
+
+	save, err := LoadPlayerSave(c.Server.savePath(player.Username))
+	if err != nil {
+		// better to turn them away than to overwrite their save later
+		c.Server.Login.Logout(c.Server.WorldParams.ID, username)
+		c.Server.Logger.Error("could not load player save", "username", player.Username, "error", err)
+		c.rejectLogin(util.LoginProtOutErrorLoadingProfile)
+		return
+	}
+	player.Restore(save)
 	c.Player = player
 
-	c.Server.World.RegisterPlayer(player)
+	if !c.Server.World.RegisterPlayer(player) {
+		c.Server.Login.Logout(c.Server.WorldParams.ID, username)
+		c.Player = nil
+		c.rejectLogin(util.LoginProtOutWorldFull)
+		return
+	}
 	c.BufferStart = c.Player.ID * 30000
 
 	var response packet.Packet
-	if opcode == util.LoginProtWorldReconnect {
-		response.P1(15)
-	} else {
-		response.P1(2)
-	}
+	response.P1(auth.Code)
 
 	if opcode == util.LoginProtWorldConnect {
-		response.P1(0)                 // staff mod level
-		response.P1(0)                 // player mod level
-		response.P1(0)                 // player underage
-		response.P1(0)                 // parentalChatConsent
-		response.P1(0)                 // parentalAdvertConsent
-		response.P1(0)                 // mapQuickChat
-		response.P2(uint16(player.ID)) // selfId
-		response.P1(0)                 // MouseRecorder
-		response.P1(1)                 // mapMembers
+		response.P1(auth.StaffModLevel)  // staff mod level
+		response.P1(auth.PlayerModLevel) // player mod level
+		response.P1(0)                   // player underage
+		response.P1(0)                   // parentalChatConsent
+		response.P1(0)                   // parentalAdvertConsent
+		response.P1(0)                   // mapQuickChat
+		response.P2(uint16(player.ID))   // selfId
+		response.P1(0)                   // MouseRecorder
+		if auth.Members {
+			response.P1(1) // mapMembers
+		} else {
+			response.P1(0) // mapMembers
+		}
 	}
 
 	c.WriteRawSocket(response.Bytes())
 
 	c.State = ClientStateGame
 	c.Server.World.AddPlayer(player)
+	c.Server.notifyWorldChanged()
 
 	c.Server.Logger.Debug("login complete")
 }
 
+// rejectLogin sends a login response code and closes the connection.
+func (c *Client) rejectLogin(code uint8) {
+	c.WriteRawSocket([]byte{code})
+	c.Socket.Close()
+	c.State = ClientStateClosed
+}
+
+// remoteHost returns the IP address of the other end of socket.
+func remoteHost(socket net.Conn) string {
+	addr := socket.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
 func (c *Client) handleGame() {
 	c.Server.Logger.Debug("entered handleGame()")
 	// TODO: is there a Packet func that does the stuff being done to data here?
@@ -478,31 +505,30 @@ func (c *Client) handleGame() {
 		opcode := data[offset]
 		offset++
 
-		length := util.ClientProtLengths[opcode]
+		length := int(util.ClientProtLengths[opcode])
 
 		if length == 255 {
-			length = data[offset]
+			length = int(data[offset])
 			offset += 1
 		} else if length == 254 {
-			// TODO: adjusted this
-			length = uint8(uint16(data[offset])<<8 | uint16(data[offset+1]))
+			length = int(data[offset])<<8 | int(data[offset+1])
 			offset += 2
 		}
 
-		if int(length) > 30000-c.BufferInOffset {
+		if length > 30000-c.BufferInOffset {
 			c.Server.Logger.Error("packet overflow for this tick")
 			return // TODO: close conn
 		}
 
 		if c.PacketCount[opcode]+1 > 10 {
-			offset += int(length)
+			offset += length
 			continue
 		}
 
 		c.PacketCount[opcode] += 1
 
-		slicex := data[start : offset+int(length)]
-		offset += int(length)
+		slicex := data[start : offset+length]
+		offset += length
 
 		copy(c.Server.BufferIn[c.BufferStart+c.BufferInOffset:], slicex)
 		c.BufferInOffset += len(slicex)
@@ -530,21 +556,21 @@ func (c *Client) DecodeIn() []DecodedData {
 	for offset < c.BufferInOffset {
 		opcode := c.Server.BufferIn[c.BufferStart+offset]
 		offset += 1
-		length := util.ClientProtLengths[opcode]
+		length := int(util.ClientProtLengths[opcode])
 		if length == 255 {
-			length = c.Server.BufferIn[c.BufferStart+offset]
+			length = int(c.Server.BufferIn[c.BufferStart+offset])
 			offset += 1
 		} else if length == 254 {
-			length = c.Server.BufferIn[c.BufferStart+offset]<<8 | c.Server.BufferIn[c.BufferStart+offset+1]
+			length = int(c.Server.BufferIn[c.BufferStart+offset])<<8 | int(c.Server.BufferIn[c.BufferStart+offset+1])
 			offset += 2
 		}
 
 		decoded = append(decoded, DecodedData{
 			ID:   opcode,
-			Data: *packet.NewPacket(c.Server.BufferIn[c.BufferStart+offset : c.BufferStart+offset+int(length)]),
+			Data: *packet.NewPacket(c.Server.BufferIn[c.BufferStart+offset : c.BufferStart+offset+length]),
 		})
 
-		offset += int(length)
+		offset += length
 	}
 
 	return decoded
@@ -595,6 +621,11 @@ type NetOutData struct {
 }
 
 func (c *Client) Queue(data []byte, encrypt bool) {
+	if encrypt && !SendUnconfirmed && util.ServerProtUnconfirmed[data[0]] {
+		c.Server.Logger.Debug("not sending unconfirmed packet", "opcode", data[0])
+		return
+	}
+
 	c.NetOut = append(c.NetOut, NetOutData{
 		Data:    data,
 		Encrypt: encrypt,
@@ -0,0 +1,62 @@
+// Package collision holds the collision flags of every tile in the world,
+// which the pathfinder uses to decide where players and NPCs can go.
+package collision
+
+// Flags set on a tile. The wall flags mark the side of the tile a wall is on;
+// a wall between two tiles is flagged on both of them.
+const (
+	WallNorthWest = 0x1
+	WallNorth     = 0x2
+	WallNorthEast = 0x4
+	WallEast      = 0x8
+	WallSouthEast = 0x10
+	WallSouth     = 0x20
+	WallSouthWest = 0x40
+	WallWest      = 0x80
+
+	// Loc is set on every tile covered by a solid loc.
+	Loc = 0x100
+
+	// the same walls, set when they also block projectiles
+	WallNorthWestProjectile = WallNorthWest << projectileShift
+	WallNorthProjectile     = WallNorth << projectileShift
+	WallNorthEastProjectile = WallNorthEast << projectileShift
+	WallEastProjectile      = WallEast << projectileShift
+	WallSouthEastProjectile = WallSouthEast << projectileShift
+	WallSouthProjectile     = WallSouth << projectileShift
+	WallSouthWestProjectile = WallSouthWest << projectileShift
+	WallWestProjectile      = WallWest << projectileShift
+	LocProjectile           = 0x20000
+
+	FloorDecoration = 0x40000
+	// Floor is set on tiles that can't be walked on at all, such as water.
+	Floor = 0x200000
+
+	// Blocked is every flag that stops anything entering a tile, whichever
+	// side it comes from. The client's route finder also checks 0x80000 and
+	// 0x1000000 here.
+	// TODO: confirm what sets 0x80000 and 0x1000000
+	Blocked = Floor | 0x80000 | 0x1000000
+)
+
+// projectileShift turns a wall flag into its projectile blocking variant.
+const projectileShift = 9
+
+// Masks checked on the tile being entered when moving in each direction:
+// the tile must not be blocked or have a wall on the side being entered from.
+const (
+	BlockWest      = Blocked | Loc | WallEast
+	BlockEast      = Blocked | Loc | WallWest
+	BlockSouth     = Blocked | Loc | WallNorth
+	BlockNorth     = Blocked | Loc | WallSouth
+	BlockSouthWest = Blocked | Loc | WallNorth | WallNorthEast | WallEast
+	BlockSouthEast = Blocked | Loc | WallNorth | WallWest | WallNorthWest
+	BlockNorthWest = Blocked | Loc | WallEast | WallSouth | WallSouthEast
+	BlockNorthEast = Blocked | Loc | WallWest | WallSouth | WallSouthWest
+)
+
+// Flags is a source of collision flags.
+type Flags interface {
+	// Flags returns the collision flags of the tile x, z on plane.
+	Flags(x int, z int, plane int) int
+}
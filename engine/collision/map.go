@@ -0,0 +1,186 @@
+package collision
+
+import (
+	"sync"
+)
+
+// mapsquare is the collision flags of one 64x64 mapsquare on all 4 planes.
+type mapsquare [4][64 * 64]int32
+
+// Map holds the collision flags of the world, one mapsquare at a time.
+// Tiles in mapsquares that were never touched have no flags.
+type Map struct {
+	mu         sync.RWMutex
+	mapsquares map[int]*mapsquare
+}
+
+func NewMap() *Map {
+	return &Map{
+		mapsquares: make(map[int]*mapsquare),
+	}
+}
+
+func mapsquareID(x int, z int) int {
+	return (x>>6)<<8 | z>>6
+}
+
+func (m *Map) Flags(x int, z int, plane int) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	square, ok := m.mapsquares[mapsquareID(x, z)]
+	if !ok {
+		return 0
+	}
+	return int(square[plane][(x&63)<<6|z&63])
+}
+
+// Add sets flags on the tile x, z.
+func (m *Map) Add(x int, z int, plane int, flags int) {
+	m.change(x, z, plane, flags, true)
+}
+
+// Remove clears flags from the tile x, z.
+func (m *Map) Remove(x int, z int, plane int, flags int) {
+	m.change(x, z, plane, flags, false)
+}
+
+func (m *Map) change(x int, z int, plane int, flags int, add bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := mapsquareID(x, z)
+	square, ok := m.mapsquares[id]
+	if !ok {
+		if !add {
+			return
+		}
+		square = new(mapsquare)
+		m.mapsquares[id] = square
+	}
+
+	tile := &square[plane][(x&63)<<6|z&63]
+	if add {
+		*tile |= int32(flags)
+	} else {
+		*tile &^= int32(flags)
+	}
+}
+
+// Clear drops the flags of the mapsquare containing the tile x, z, so that
+// it can be loaded again.
+func (m *Map) Clear(x int, z int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mapsquares, mapsquareID(x, z))
+}
+
+// AddFloor flags the tile x, z as impossible to walk on.
+func (m *Map) AddFloor(x int, z int, plane int) {
+	m.Add(x, z, plane, Floor)
+}
+
+// RemoveFloor undoes AddFloor.
+func (m *Map) RemoveFloor(x int, z int, plane int) {
+	m.Remove(x, z, plane, Floor)
+}
+
+// AddLoc flags the sizeX by sizeZ tiles covered by a solid loc whose south
+// west corner is x, z.
+func (m *Map) AddLoc(x int, z int, plane int, sizeX int, sizeZ int, blocksProjectiles bool) {
+	m.changeLoc(x, z, plane, sizeX, sizeZ, blocksProjectiles, true)
+}
+
+// RemoveLoc undoes AddLoc.
+func (m *Map) RemoveLoc(x int, z int, plane int, sizeX int, sizeZ int, blocksProjectiles bool) {
+	m.changeLoc(x, z, plane, sizeX, sizeZ, blocksProjectiles, false)
+}
+
+func (m *Map) changeLoc(x int, z int, plane int, sizeX int, sizeZ int, blocksProjectiles bool, add bool) {
+	flags := Loc
+	if blocksProjectiles {
+		flags |= LocProjectile
+	}
+
+	for tx := x; tx < x+sizeX; tx++ {
+		for tz := z; tz < z+sizeZ; tz++ {
+			m.change(tx, tz, plane, flags, add)
+		}
+	}
+}
+
+// AddWall flags a wall loc of the given shape and rotation on the tile x, z,
+// and the matching side of the tiles next to it.
+func (m *Map) AddWall(x int, z int, plane int, shape int, rotation int, blocksProjectiles bool) {
+	m.changeWall(x, z, plane, shape, rotation, blocksProjectiles, true)
+}
+
+// RemoveWall undoes AddWall.
+func (m *Map) RemoveWall(x int, z int, plane int, shape int, rotation int, blocksProjectiles bool) {
+	m.changeWall(x, z, plane, shape, rotation, blocksProjectiles, false)
+}
+
+// wall shapes, the same as loc shapes
+const (
+	WallStraight       = 0
+	WallDiagonalCorner = 1
+	WallL              = 2
+	WallSquareCorner   = 3
+)
+
+func (m *Map) changeWall(x int, z int, plane int, shape int, rotation int, blocksProjectiles bool, add bool) {
+	for _, v := range wallFlags(x, z, shape, rotation) {
+		flags := v.flags
+		if blocksProjectiles {
+			flags |= flags << projectileShift
+		}
+		m.change(v.x, v.z, plane, flags, add)
+	}
+}
+
+type tileFlags struct {
+	x, z  int
+	flags int
+}
+
+// wallFlags returns the flags set by a wall, on its own tile and the tiles
+// on the other side of it.
+func wallFlags(x int, z int, shape int, rotation int) []tileFlags {
+	switch shape {
+	case WallStraight:
+		switch rotation & 3 {
+		case 0:
+			return []tileFlags{{x, z, WallWest}, {x - 1, z, WallEast}}
+		case 1:
+			return []tileFlags{{x, z, WallNorth}, {x, z + 1, WallSouth}}
+		case 2:
+			return []tileFlags{{x, z, WallEast}, {x + 1, z, WallWest}}
+		default:
+			return []tileFlags{{x, z, WallSouth}, {x, z - 1, WallNorth}}
+		}
+	case WallDiagonalCorner, WallSquareCorner:
+		switch rotation & 3 {
+		case 0:
+			return []tileFlags{{x, z, WallNorthWest}, {x - 1, z + 1, WallSouthEast}}
+		case 1:
+			return []tileFlags{{x, z, WallNorthEast}, {x + 1, z + 1, WallSouthWest}}
+		case 2:
+			return []tileFlags{{x, z, WallSouthEast}, {x + 1, z - 1, WallNorthWest}}
+		default:
+			return []tileFlags{{x, z, WallSouthWest}, {x - 1, z - 1, WallNorthEast}}
+		}
+	case WallL:
+		switch rotation & 3 {
+		case 0:
+			return []tileFlags{{x, z, WallWest | WallNorth}, {x - 1, z, WallEast}, {x, z + 1, WallSouth}}
+		case 1:
+			return []tileFlags{{x, z, WallNorth | WallEast}, {x, z + 1, WallSouth}, {x + 1, z, WallWest}}
+		case 2:
+			return []tileFlags{{x, z, WallEast | WallSouth}, {x + 1, z, WallWest}, {x, z - 1, WallNorth}}
+		default:
+			return []tileFlags{{x, z, WallSouth | WallWest}, {x, z - 1, WallNorth}, {x - 1, z, WallEast}}
+		}
+	}
+	return nil
+}
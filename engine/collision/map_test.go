@@ -0,0 +1,100 @@
+package collision
+
+import (
+	"testing"
+)
+
+func TestMap_AddWall(t *testing.T) {
+	type tile struct {
+		x, z  int
+		flags int
+	}
+	tests := []struct {
+		name              string
+		shape             int
+		rotation          int
+		blocksProjectiles bool
+		want              []tile
+	}{
+		{
+			name:     "straight west",
+			shape:    WallStraight,
+			rotation: 0,
+			want:     []tile{{100, 100, WallWest}, {99, 100, WallEast}},
+		},
+		{
+			name:     "straight north",
+			shape:    WallStraight,
+			rotation: 1,
+			want:     []tile{{100, 100, WallNorth}, {100, 101, WallSouth}},
+		},
+		{
+			name:     "diagonal corner north east",
+			shape:    WallDiagonalCorner,
+			rotation: 1,
+			want:     []tile{{100, 100, WallNorthEast}, {101, 101, WallSouthWest}},
+		},
+		{
+			name:     "L south west",
+			shape:    WallL,
+			rotation: 3,
+			want:     []tile{{100, 100, WallSouth | WallWest}, {100, 99, WallNorth}, {99, 100, WallEast}},
+		},
+		{
+			name:              "blocks projectiles",
+			shape:             WallStraight,
+			rotation:          2,
+			blocksProjectiles: true,
+			want:              []tile{{100, 100, WallEast | WallEastProjectile}, {101, 100, WallWest | WallWestProjectile}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMap()
+			m.AddWall(100, 100, 1, tt.shape, tt.rotation, tt.blocksProjectiles)
+
+			for _, v := range tt.want {
+				if got := m.Flags(v.x, v.z, 1); got != v.flags {
+					t.Errorf("Flags(%v, %v) = %#x, want %#x", v.x, v.z, got, v.flags)
+				}
+			}
+			if got := m.Flags(100, 100, 0); got != 0 {
+				t.Errorf("Flags() on another plane = %#x, want 0", got)
+			}
+
+			m.RemoveWall(100, 100, 1, tt.shape, tt.rotation, tt.blocksProjectiles)
+			for _, v := range tt.want {
+				if got := m.Flags(v.x, v.z, 1); got != 0 {
+					t.Errorf("Flags(%v, %v) after RemoveWall() = %#x, want 0", v.x, v.z, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMap_AddLoc(t *testing.T) {
+	m := NewMap()
+
+	// straddles a mapsquare border
+	m.AddLoc(63, 63, 0, 2, 2, false)
+	m.AddFloor(64, 64, 0)
+
+	for _, v := range [][2]int{{63, 63}, {64, 63}, {63, 64}} {
+		if got := m.Flags(v[0], v[1], 0); got != Loc {
+			t.Errorf("Flags(%v, %v) = %#x, want %#x", v[0], v[1], got, Loc)
+		}
+	}
+	if got := m.Flags(64, 64, 0); got != Loc|Floor {
+		t.Errorf("Flags(64, 64) = %#x, want %#x", got, Loc|Floor)
+	}
+
+	m.RemoveLoc(63, 63, 0, 2, 2, false)
+	if got := m.Flags(64, 64, 0); got != Floor {
+		t.Errorf("Flags(64, 64) after RemoveLoc() = %#x, want %#x", got, Floor)
+	}
+
+	m.Clear(64, 64)
+	if got := m.Flags(64, 64, 0); got != 0 {
+		t.Errorf("Flags(64, 64) after Clear() = %#x, want 0", got)
+	}
+}
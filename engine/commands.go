@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// CommandLevel is who may use a command.
+type CommandLevel int
+
+const (
+	CommandLevelPlayer CommandLevel = iota
+	// CommandLevelPlayerMod is player moderators and staff.
+	CommandLevelPlayerMod
+	// CommandLevelMod is staff with a staff mod level of 1 or more.
+	CommandLevelMod
+	// CommandLevelAdmin is staff with a staff mod level of 2 or more.
+	CommandLevelAdmin
+)
+
+// commandLevel returns the level of commands the player may use, from the
+// mod levels they logged in with.
+func (p *Player) commandLevel() CommandLevel {
+	switch {
+	case p.StaffModLevel >= 2:
+		return CommandLevelAdmin
+	case p.StaffModLevel >= 1:
+		return CommandLevelMod
+	case p.PlayerModLevel >= 1:
+		return CommandLevelPlayerMod
+	}
+	return CommandLevelPlayer
+}
+
+// ArgType is the kind of value a command argument takes.
+type ArgType int
+
+const (
+	ArgInt ArgType = iota
+	ArgString
+	// ArgRest takes the rest of the line, spaces and all.
+	ArgRest
+)
+
+// CommandArg is an argument of a command.
+type CommandArg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+}
+
+// CommandArgs holds the arguments a command was run with, by name.
+// Optional arguments that weren't given are missing.
+type CommandArgs map[string]any
+
+// Int returns the int argument called name, or def if it wasn't given.
+func (a CommandArgs) Int(name string, def int) int {
+	if v, ok := a[name].(int); ok {
+		return v
+	}
+	return def
+}
+
+// String returns the string argument called name, or "" if it wasn't
+// given.
+func (a CommandArgs) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+// Has reports whether the argument called name was given.
+func (a CommandArgs) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// Command is a developer console command, run with CLIENT_CHEAT.
+type Command struct {
+	Name  string
+	Args  []CommandArg
+	Help  string
+	Level CommandLevel
+	Run   func(p *Player, args CommandArgs)
+}
+
+// Usage returns how the command is written, such as ::tele <x> <z> [plane].
+func (c *Command) Usage() string {
+	usage := "::" + c.Name
+	for _, v := range c.Args {
+		if v.Optional {
+			usage += " [" + v.Name + "]"
+		} else {
+			usage += " <" + v.Name + ">"
+		}
+	}
+	return usage
+}
+
+// parse parses the words after the command's name into its arguments.
+func (c *Command) parse(words []string) (CommandArgs, error) {
+	args := make(CommandArgs)
+	for i, v := range c.Args {
+		if i >= len(words) {
+			if !v.Optional {
+				return nil, fmt.Errorf("missing %s", v.Name)
+			}
+			break
+		}
+
+		switch v.Type {
+		case ArgInt:
+			n, err := strconv.Atoi(words[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number, not %q", v.Name, words[i])
+			}
+			args[v.Name] = n
+		case ArgString:
+			args[v.Name] = words[i]
+		case ArgRest:
+			args[v.Name] = strings.Join(words[i:], " ")
+			return args, nil
+		}
+	}
+	if len(words) > len(c.Args) {
+		return nil, errors.New("too many arguments")
+	}
+	return args, nil
+}
+
+// commands holds every command, by name.
+var commands = map[string]*Command{}
+
+// RegisterCommand adds a command, replacing any with the same name.
+func RegisterCommand(c Command) {
+	commands[c.Name] = &c
+}
+
+// decodeClientCheat decodes CLIENT_CHEAT.
+func decodeClientCheat(buf *packet.Packet) (line string, err error) {
+	defer recoverDecode(&err)
+
+	_ = buf.G1() // tele
+	return buf.GJStr(), nil
+}
+
+// RunCommand runs the command line typed by the player, if they may use
+// it.
+func (p *Player) RunCommand(line string) {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return
+	}
+
+	name := strings.ToLower(words[0])
+	c, ok := commands[name]
+	if !ok || p.commandLevel() < c.Level {
+		p.Console("Unknown command: " + name)
+		return
+	}
+
+	args, err := c.parse(words[1:])
+	if err != nil {
+		p.Console(fmt.Sprintf("%s. Usage: %s", err, c.Usage()))
+		return
+	}
+	p.Client.Server.Logger.Debug("command", "username", p.Username, "line", line)
+	c.Run(p, args)
+}
+
+// Console shows msg in the player's developer console.
+func (p *Player) Console(msg string) {
+	p.MessageGame(msg, MessageTypeDevConsole, "", "")
+}
+
+// availableCommands returns the commands the player may use, by name.
+func (p *Player) availableCommands() []*Command {
+	var available []*Command
+	for _, v := range commands {
+		if p.commandLevel() >= v.Level {
+			available = append(available, v)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].Name < available[j].Name
+	})
+	return available
+}
+
+func init() {
+	RegisterCommand(Command{
+		Name: "help",
+		Args: []CommandArg{{Name: "command", Type: ArgString, Optional: true}},
+		Help: "Lists the commands you can use, or explains one.",
+		Run: func(p *Player, args CommandArgs) {
+			if args.Has("command") {
+				c, ok := commands[strings.ToLower(args.String("command"))]
+				if !ok || p.commandLevel() < c.Level {
+					p.Console("Unknown command: " + args.String("command"))
+					return
+				}
+				p.Console(c.Usage())
+				p.Console(c.Help)
+				return
+			}
+			for _, v := range p.availableCommands() {
+				p.Console(v.Usage() + " - " + v.Help)
+			}
+		},
+	})
+
+	RegisterCommand(Command{
+		Name: "logout",
+		Help: "Logs you out.",
+		Run: func(p *Player, args CommandArgs) {
+			p.Logout()
+		},
+	})
+
+	for name, v := range moderationCommands {
+		name := name
+		args := []CommandArg{{Name: "target", Type: ArgString}}
+		help := fmt.Sprintf("Places a %s. Durations are written like 30m, 12h or 7d.", v.Kind)
+		if v.Pardon {
+			help = fmt.Sprintf("Lifts a %s.", v.Kind)
+		} else {
+			args = append(args,
+				CommandArg{Name: "duration", Type: ArgString, Optional: true},
+				CommandArg{Name: "reason", Type: ArgRest, Optional: true})
+		}
+
+		RegisterCommand(Command{
+			Name:  name,
+			Args:  args,
+			Help:  help,
+			Level: v.Level,
+			Run: func(p *Player, args CommandArgs) {
+				p.Moderate(name, args.String("target"), strings.Fields(args.String("duration")+" "+args.String("reason")))
+			},
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// consoleLines returns the dev console messages queued for p, and forgets
+// everything queued.
+func consoleLines(p *Player) []string {
+	var lines []string
+	for _, v := range p.Client.NetOut {
+		buf := packet.NewPacket(v.Data)
+		if buf.G1() != util.ServerProtMessageGame {
+			continue
+		}
+		buf.G1() // size
+		if buf.GSmart() != MessageTypeDevConsole {
+			continue
+		}
+		buf.G4()
+		buf.G1()
+		lines = append(lines, buf.GJStr())
+	}
+	p.Client.NetOut = nil
+	return lines
+}
+
+func TestCommand_parse(t *testing.T) {
+	c := &Command{
+		Name: "test",
+		Args: []CommandArg{
+			{Name: "id", Type: ArgInt},
+			{Name: "name", Type: ArgString, Optional: true},
+			{Name: "rest", Type: ArgRest, Optional: true},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		words   []string
+		want    CommandArgs
+		wantErr bool
+	}{
+		{
+			name:  "required only",
+			words: []string{"5"},
+			want:  CommandArgs{"id": 5},
+		},
+		{
+			name:  "negative",
+			words: []string{"-1"},
+			want:  CommandArgs{"id": -1},
+		},
+		{
+			name:  "all",
+			words: []string{"5", "bob", "the", "rest"},
+			want:  CommandArgs{"id": 5, "name": "bob", "rest": "the rest"},
+		},
+		{
+			name:    "missing",
+			words:   nil,
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			words:   []string{"five"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.parse(tt.words)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (&Command{Name: "pos"}).parse([]string{"1"}); err == nil {
+		t.Errorf("parse() of too many arguments succeeded")
+	}
+	if got, want := c.Usage(), "::test <id> [name] [rest]"; got != want {
+		t.Errorf("Usage() = %q, want %q", got, want)
+	}
+}
+
+func TestPlayer_RunCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		staffModLevel uint8
+		line          string
+		wantLines     []string
+		wantPos       [3]int
+	}{
+		{
+			name:      "pos",
+			line:      "pos",
+			wantLines: []string{"3222, 3218, 0: mapsquare 50_50, zone 402_402, local 22_18"},
+			wantPos:   [3]int{3222, 3218, 0},
+		},
+		{
+			name:          "tele",
+			staffModLevel: 2,
+			line:          "TELE 3200 3400 1",
+			wantPos:       [3]int{3200, 3400, 1},
+		},
+		{
+			name:          "tele on the same plane",
+			staffModLevel: 2,
+			line:          "tele 3200 3400",
+			wantPos:       [3]int{3200, 3400, 0},
+		},
+		{
+			name:          "tele off the map",
+			staffModLevel: 2,
+			line:          "tele -1 3400",
+			wantLines:     []string{"That tile is off the map."},
+			wantPos:       [3]int{3222, 3218, 0},
+		},
+		{
+			name:          "bad arguments",
+			staffModLevel: 2,
+			line:          "tele 3200",
+			wantLines:     []string{"missing z. Usage: ::tele <x> <z> [plane]"},
+			wantPos:       [3]int{3222, 3218, 0},
+		},
+		{
+			name:      "not allowed",
+			line:      "tele 3200 3400",
+			wantLines: []string{"Unknown command: tele"},
+			wantPos:   [3]int{3222, 3218, 0},
+		},
+		{
+			name:      "unknown",
+			line:      "fly",
+			wantLines: []string{"Unknown command: fly"},
+			wantPos:   [3]int{3222, 3218, 0},
+		},
+		{
+			name:          "varp",
+			staffModLevel: 2,
+			line:          "varp 1000 7",
+			wantLines:     []string{"varp 1000 = 7"},
+			wantPos:       [3]int{3222, 3218, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newConnectedTestPlayer(1)
+			p.World = newTestWorld()
+			p.Pos = util.NewPosition(3222, 3218, 0)
+			p.StaffModLevel = tt.staffModLevel
+
+			p.RunCommand(tt.line)
+
+			if got := consoleLines(p); !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("console = %q, want %q", got, tt.wantLines)
+			}
+			if got := [3]int{p.Pos.X, p.Pos.Z, p.Pos.Plane}; got != tt.wantPos {
+				t.Errorf("position = %v, want %v", got, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestPlayer_availableCommands(t *testing.T) {
+	tests := []struct {
+		name          string
+		staffModLevel uint8
+		command       string
+		want          bool
+	}{
+		{name: "player can log out", command: "logout", want: true},
+		{name: "player can't mute", command: "mute"},
+		{name: "mod can mute", staffModLevel: 1, command: "mute", want: true},
+		{name: "mod can't ban", staffModLevel: 1, command: "ban"},
+		{name: "admin can ban", staffModLevel: 2, command: "ban", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPlayer(nil)
+			p.StaffModLevel = tt.staffModLevel
+
+			got := false
+			for _, v := range p.availableCommands() {
+				got = got || v.Name == tt.command
+			}
+			if got != tt.want {
+				t.Errorf("can use %s = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
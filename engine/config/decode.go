@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ScriptType is a script type char, such as 'i' for an int or 's' for a
+// string.
+type ScriptType rune
+
+func (t ScriptType) MarshalText() ([]byte, error) {
+	return []byte(string(t)), nil
+}
+
+// decodeOpcodes reads a type's opcodes with decode until the 0 that ends
+// them.
+func decodeOpcodes(kind string, id int, data []byte, decode func(opcode uint8, buf *packet.Packet) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s %d is truncated: %v", kind, id, r)
+		}
+	}()
+
+	buf := packet.NewPacket(data)
+	for {
+		opcode := buf.G1()
+		if opcode == 0 {
+			return nil
+		}
+		if err := decode(opcode, buf); err != nil {
+			return fmt.Errorf("%s %d: %w", kind, id, err)
+		}
+	}
+}
+
+// decodeParams reads the param map that ends most config types.
+func decodeParams(buf *packet.Packet) map[int]any {
+	count := int(buf.G1())
+	params := make(map[int]any, count)
+	for i := 0; i < count; i++ {
+		isString := buf.G1() == 1
+		key := int(buf.G3())
+		if isString {
+			params[key] = buf.GJStr()
+		} else {
+			params[key] = int(int32(buf.G4()))
+		}
+	}
+	return params
+}
+
+// g2Null reads a 2 byte id, with 0xffff as -1.
+func g2Null(buf *packet.Packet) int {
+	v := int(buf.G2())
+	if v == 0xffff {
+		return -1
+	}
+	return v
+}
+
+// g2Signed reads a signed 2 byte value.
+func g2Signed(buf *packet.Packet) int {
+	return int(int16(buf.G2()))
+}
+
+// skipRecolours skips a count and that many pairs of 2 byte values, as used
+// for recolours and retextures.
+func skipRecolours(buf *packet.Packet) {
+	count := int(buf.G1())
+	buf.Next(4 * count)
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+func TestDecode_SmallTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		decode  func(id int, data []byte) (any, error)
+		data    []byte
+		want    any
+		wantErr bool
+	}{
+		{
+			name:   "enum",
+			decode: func(id int, data []byte) (any, error) { return DecodeEnumType(id, data) },
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(1)
+				buf.P1('i')
+				buf.P1(2)
+				buf.P1('s')
+				buf.P1(3)
+				buf.PJStr("none")
+				buf.P1(5)
+				buf.P2(2)
+				buf.P4(1)
+				buf.PJStr("one")
+				buf.P4(uint32(0xffffffff))
+				buf.PJStr("minus one")
+			}),
+			want: &EnumType{
+				ID: 1, KeyType: 'i', ValueType: 's', DefaultString: "none",
+				Values: map[int]any{1: "one", -1: "minus one"},
+			},
+		},
+		{
+			name:   "seq",
+			decode: func(id int, data []byte) (any, error) { return DecodeSeqType(id, data) },
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(1)
+				buf.P2(2)
+				buf.P2(4)
+				buf.P2(5)
+				buf.P2(10)
+				buf.P2(11)
+				buf.P2(300)
+				buf.P2(300)
+				buf.P1(5)
+				buf.P1(8)
+				buf.P1(13)
+				buf.P2(2)
+				buf.P1(0)
+				buf.P1(2)
+				buf.P3(1)
+				buf.P2(2)
+				buf.P1(14)
+			}),
+			want: func() *SeqType {
+				s := newSeqType(1)
+				s.Delays = []int{4, 5}
+				s.Frames = []int{300<<16 | 10, 300<<16 | 11}
+				s.Priority = 8
+				return s
+			}(),
+		},
+		{
+			name:   "spot anim",
+			decode: func(id int, data []byte) (any, error) { return DecodeSpotAnimType(id, data) },
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(1)
+				buf.P2(1000)
+				buf.P1(2)
+				buf.P2(0xffff)
+				buf.P1(4)
+				buf.P2(64)
+				buf.P1(41)
+				buf.P1(1)
+				buf.P4(0)
+			}),
+			want: func() *SpotAnimType {
+				s := newSpotAnimType(1)
+				s.Model = 1000
+				s.ResizeH = 64
+				return s
+			}(),
+		},
+		{
+			name:   "shop stock",
+			decode: func(id int, data []byte) (any, error) { return DecodeInvType(id, data) },
+			data:   []byte{2, 0, 40, 4, 1, 0x07, 0xd2, 0, 5, 0},
+			want:   &InvType{ID: 1, Size: 40, StockObjs: []int{2002}, StockCounts: []int{5}},
+		},
+		{
+			name:   "struct",
+			decode: func(id int, data []byte) (any, error) { return DecodeStructType(id, data) },
+			data:   []byte{249, 1, 1, 0, 0, 9, 'a', 0, 0},
+			want:   &StructType{ID: 1, Params: map[int]any{9: "a"}},
+		},
+		{
+			name:    "unknown varbit opcode",
+			decode:  func(id int, data []byte) (any, error) { return DecodeVarbitType(id, data) },
+			data:    []byte{2, 0},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.decode(1, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decode error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptType_MarshalText(t *testing.T) {
+	got, err := json.Marshal(EnumType{KeyType: 'i', ValueType: 's'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ID":0,"KeyType":"i","ValueType":"s","DefaultInt":0,"DefaultString":"","Values":null}`
+	if string(got) != want {
+		t.Errorf("json.Marshal() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveEnumTypes is the cache archive enums are stored in, 256 to a group.
+const ArchiveEnumTypes = 17
+
+// EnumType is a map from int keys to int or string values, for scripts.
+type EnumType struct {
+	ID        int
+	KeyType   ScriptType
+	ValueType ScriptType
+
+	DefaultInt    int
+	DefaultString string
+	// Values holds ints, or strings if ValueType is 's'.
+	Values map[int]any
+}
+
+func newEnumType(id int) *EnumType {
+	return &EnumType{
+		ID:            id,
+		DefaultString: "null",
+		Values:        make(map[int]any),
+	}
+}
+
+// DecodeEnumType decodes the enum id from its file in the cache.
+func DecodeEnumType(id int, data []byte) (*EnumType, error) {
+	enum := newEnumType(id)
+	if err := decodeOpcodes("enum", id, data, enum.decode); err != nil {
+		return nil, err
+	}
+	return enum, nil
+}
+
+func (e *EnumType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 1:
+		e.KeyType = ScriptType(buf.G1())
+	case 2:
+		e.ValueType = ScriptType(buf.G1())
+	case 3:
+		e.DefaultString = buf.GJStr()
+	case 4:
+		e.DefaultInt = int(int32(buf.G4()))
+	case 5, 6:
+		count := int(buf.G2())
+		for i := 0; i < count; i++ {
+			key := int(int32(buf.G4()))
+			if opcode == 5 {
+				e.Values[key] = buf.GJStr()
+			} else {
+				e.Values[key] = int(int32(buf.G4()))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
+
+// Int returns the int value for key, or the default if there isn't one.
+func (e *EnumType) Int(key int) int {
+	if v, ok := e.Values[key].(int); ok {
+		return v
+	}
+	return e.DefaultInt
+}
+
+// String returns the string value for key, or the default if there isn't
+// one.
+func (e *EnumType) String(key int) string {
+	if v, ok := e.Values[key].(string); ok {
+		return v
+	}
+	return e.DefaultString
+}
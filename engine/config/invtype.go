@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// InvType is the definition of an inventory, such as a player's backpack or
+// a shop's stock.
+type InvType struct {
+	ID   int
+	Size int
+	// StockObjs and StockCounts are what a shop starts with.
+	StockObjs   []int
+	StockCounts []int
+}
+
+// DecodeInvType decodes the inv id from its file in the cache.
+func DecodeInvType(id int, data []byte) (*InvType, error) {
+	inv := &InvType{ID: id}
+	if err := decodeOpcodes("inv", id, data, inv.decode); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (i *InvType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 2:
+		i.Size = int(buf.G2())
+	case 4:
+		count := int(buf.G1())
+		i.StockObjs = make([]int, count)
+		i.StockCounts = make([]int, count)
+		for j := 0; j < count; j++ {
+			i.StockObjs[j] = int(buf.G2())
+			i.StockCounts[j] = int(buf.G2())
+		}
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
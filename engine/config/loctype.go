@@ -0,0 +1,201 @@
+// Package config decodes the type definitions in the cache's config
+// archives.
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveLocTypes is the cache archive loc types are stored in, 256 to a
+// group.
+const ArchiveLocTypes = 16
+
+// LocType is the definition of a loc (a scenery object).
+type LocType struct {
+	ID   int
+	Name string
+
+	// the size of the loc in tiles, before rotation
+	Width  int
+	Length int
+
+	// BlockWalk is how the loc blocks movement: 0 doesn't, 1 blocks
+	// movement but not interaction, 2 blocks both.
+	BlockWalk int
+	// BlockRange is set if the loc blocks projectiles.
+	BlockRange bool
+	// BreakRouteFinding is set on locs the client's route finder should
+	// treat as solid even though they don't block walking.
+	BreakRouteFinding bool
+	// Active is 1 if the loc can be interacted with, 0 if it can't and -1
+	// if the client should decide from its models and ops.
+	Active int
+
+	// ForceApproach blocks approaching the loc from the sides it flags.
+	ForceApproach int
+	Ops           [5]string
+	Members       bool
+
+	// MultiVarbit and MultiVarp pick which of MultiLocs the loc is shown as
+	// to a player, -1 if unused.
+	MultiVarbit int
+	MultiVarp   int
+	MultiLocs   []int
+
+	Anim int
+
+	Params map[int]any
+}
+
+func newLocType(id int) *LocType {
+	return &LocType{
+		ID:          id,
+		Name:        "null",
+		Width:       1,
+		Length:      1,
+		BlockWalk:   2,
+		BlockRange:  true,
+		Active:      -1,
+		MultiVarbit: -1,
+		MultiVarp:   -1,
+		Anim:        -1,
+	}
+}
+
+// DecodeLocType decodes the loc type id from its file in the cache.
+func DecodeLocType(id int, data []byte) (*LocType, error) {
+	loc := newLocType(id)
+	if err := decodeOpcodes("loc", id, data, loc.decode); err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
+
+// decode reads a single opcode. Opcodes the server has no use for are read
+// and thrown away, but every one has to be known to find the next.
+// TODO: confirm the opcodes against a 578 client, these are from later ones
+func (l *LocType) decode(opcode uint8, buf *packet.Packet) error {
+	switch {
+	case opcode == 1 || opcode == 5:
+		// models and the shapes they're for
+		count := int(buf.G1())
+		for i := 0; i < count; i++ {
+			buf.G1() // shape
+			models := int(buf.G1())
+			buf.Next(2 * models)
+		}
+	case opcode == 2:
+		l.Name = buf.GJStr()
+	case opcode == 14:
+		l.Width = int(buf.G1())
+	case opcode == 15:
+		l.Length = int(buf.G1())
+	case opcode == 17:
+		l.BlockWalk = 0
+		l.BlockRange = false
+	case opcode == 18:
+		l.BlockRange = false
+	case opcode == 19:
+		l.Active = int(buf.G1())
+	case opcode == 21, opcode == 22, opcode == 23, opcode == 62, opcode == 64,
+		opcode == 73, opcode == 82, opcode == 88, opcode == 89, opcode == 94,
+		opcode == 97, opcode == 98, opcode == 103, opcode == 105:
+		// flags for how the loc is drawn
+	case opcode == 24:
+		l.Anim = int(buf.G2())
+		if l.Anim == 0xffff {
+			l.Anim = -1
+		}
+	case opcode == 27:
+		l.BlockWalk = 1
+	case opcode == 28, opcode == 29, opcode == 39, opcode == 75, opcode == 81,
+		opcode == 101, opcode == 104:
+		buf.G1()
+	case opcode >= 30 && opcode < 35:
+		l.Ops[opcode-30] = buf.GJStr()
+		if l.Ops[opcode-30] == "Hidden" || l.Ops[opcode-30] == "hidden" {
+			l.Ops[opcode-30] = ""
+		}
+	case opcode == 40, opcode == 41:
+		// recolours and retextures
+		count := int(buf.G1())
+		buf.Next(4 * count)
+	case opcode == 42:
+		count := int(buf.G1())
+		buf.Next(count)
+	case opcode == 60, opcode == 65, opcode == 66, opcode == 67, opcode == 68,
+		opcode == 70, opcode == 71, opcode == 72, opcode == 93, opcode == 95,
+		opcode == 102, opcode == 107:
+		buf.G2()
+	case opcode == 69:
+		l.ForceApproach = int(buf.G1())
+	case opcode == 74:
+		l.BreakRouteFinding = true
+	case opcode == 77 || opcode == 92:
+		l.MultiVarbit = int(buf.G2())
+		if l.MultiVarbit == 0xffff {
+			l.MultiVarbit = -1
+		}
+		l.MultiVarp = int(buf.G2())
+		if l.MultiVarp == 0xffff {
+			l.MultiVarp = -1
+		}
+		last := -1
+		if opcode == 92 {
+			last = int(buf.G2())
+			if last == 0xffff {
+				last = -1
+			}
+		}
+		count := int(buf.G1())
+		l.MultiLocs = make([]int, count+2)
+		for i := 0; i <= count; i++ {
+			l.MultiLocs[i] = int(buf.G2())
+			if l.MultiLocs[i] == 0xffff {
+				l.MultiLocs[i] = -1
+			}
+		}
+		l.MultiLocs[count+1] = last
+	case opcode == 78:
+		// background sound and its range
+		buf.G2()
+		buf.G1()
+	case opcode == 79:
+		// random sounds
+		buf.G2()
+		buf.G2()
+		buf.G1()
+		count := int(buf.G1())
+		buf.Next(2 * count)
+	case opcode == 91:
+		l.Members = true
+	case opcode == 99 || opcode == 100:
+		// cursors
+		buf.G1()
+		buf.G2()
+	case opcode == 106:
+		// random animations and their weights
+		count := int(buf.G1())
+		buf.Next(3 * count)
+	case opcode >= 150 && opcode < 155:
+		// members only ops, which free worlds hide
+		l.Ops[opcode-150] = buf.GJStr()
+	case opcode == 160:
+		count := int(buf.G1())
+		buf.Next(2 * count)
+	case opcode == 249:
+		l.Params = decodeParams(buf)
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
+
+// LocTypes loads loc types from the cache as they're asked for.
+type LocTypes = Types[LocType]
+
+func NewLocTypes(source Source) *LocTypes {
+	return newArchiveTypes("loc", source, ArchiveLocTypes, 8, DecodeLocType)
+}
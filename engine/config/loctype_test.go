@@ -0,0 +1,139 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+func TestDecodeLocType(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *LocType
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			data: []byte{0},
+			want: newLocType(1),
+		},
+		{
+			name: "door",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(1) // models
+				buf.P1(1)
+				buf.P1(0)
+				buf.P1(2)
+				buf.P2(100)
+				buf.P2(101)
+				buf.P1(2)
+				buf.PJStr("Door")
+				buf.P1(30)
+				buf.PJStr("Open")
+				buf.P1(31)
+				buf.PJStr("Hidden")
+				buf.P1(40) // recolours
+				buf.P1(1)
+				buf.P2(1)
+				buf.P2(2)
+				buf.P1(69)
+				buf.P1(5)
+				buf.P1(24)
+				buf.P2(0xffff)
+				buf.P1(249)
+				buf.P1(2)
+				buf.P1(0)
+				buf.P3(10)
+				buf.P4(uint32(0xffffffff))
+				buf.P1(1)
+				buf.P3(11)
+				buf.PJStr("key")
+			}),
+			want: func() *LocType {
+				l := newLocType(1)
+				l.Name = "Door"
+				l.Ops[0] = "Open"
+				l.ForceApproach = 5
+				l.Params = map[int]any{10: -1, 11: "key"}
+				return l
+			}(),
+		},
+		{
+			name: "table",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(14)
+				buf.P1(2)
+				buf.P1(15)
+				buf.P1(3)
+				buf.P1(18)
+				buf.P1(74)
+				buf.P1(19)
+				buf.P1(1)
+				buf.P1(91)
+			}),
+			want: func() *LocType {
+				l := newLocType(1)
+				l.Width = 2
+				l.Length = 3
+				l.BlockRange = false
+				l.BreakRouteFinding = true
+				l.Active = 1
+				l.Members = true
+				return l
+			}(),
+		},
+		{
+			name: "not solid",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(17)
+			}),
+			want: func() *LocType {
+				l := newLocType(1)
+				l.BlockWalk = 0
+				l.BlockRange = false
+				return l
+			}(),
+		},
+		{
+			name: "multiloc",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(92)
+				buf.P2(0xffff)
+				buf.P2(300)
+				buf.P2(9)
+				buf.P1(1)
+				buf.P2(7)
+				buf.P2(0xffff)
+			}),
+			want: func() *LocType {
+				l := newLocType(1)
+				l.MultiVarp = 300
+				l.MultiLocs = []int{7, -1, 9}
+				return l
+			}(),
+		},
+		{
+			name:    "unknown opcode",
+			data:    []byte{200, 0},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    []byte{14},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeLocType(1, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeLocType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeLocType() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveNPCTypes is the cache archive NPC types are stored in, 128 to a
+// group.
+const ArchiveNPCTypes = 18
+
+// NPCType is the definition of an NPC.
+type NPCType struct {
+	ID   int
+	Name string
+
+	// Size is how many tiles wide and long the NPC is.
+	Size        int
+	CombatLevel int
+	Ops         [5]string
+	// Active is unset on NPCs that can't be interacted with at all.
+	Active bool
+	// Minimap is set if the NPC is shown as a dot on the minimap.
+	Minimap  bool
+	HeadIcon int
+
+	// the render anims (walk, run, stand and so on), -1 if unset
+	BAS int
+
+	// MultiVarbit and MultiVarp pick which of MultiNPCs the NPC is shown as
+	// to a player, -1 if unused.
+	MultiVarbit int
+	MultiVarp   int
+	MultiNPCs   []int
+
+	Params map[int]any
+}
+
+func newNPCType(id int) *NPCType {
+	return &NPCType{
+		ID:          id,
+		Name:        "null",
+		Size:        1,
+		CombatLevel: -1,
+		Active:      true,
+		Minimap:     true,
+		HeadIcon:    -1,
+		BAS:         -1,
+		MultiVarbit: -1,
+		MultiVarp:   -1,
+	}
+}
+
+// DecodeNPCType decodes the NPC type id from its file in the cache.
+func DecodeNPCType(id int, data []byte) (*NPCType, error) {
+	npc := newNPCType(id)
+	if err := decodeOpcodes("npc", id, data, npc.decode); err != nil {
+		return nil, err
+	}
+	return npc, nil
+}
+
+// TODO: confirm the opcodes against a 578 client, these are from later ones
+func (n *NPCType) decode(opcode uint8, buf *packet.Packet) error {
+	switch {
+	case opcode == 1, opcode == 60:
+		// models and chat head models
+		count := int(buf.G1())
+		buf.Next(2 * count)
+	case opcode == 2:
+		n.Name = buf.GJStr()
+	case opcode == 12:
+		n.Size = int(buf.G1())
+	case opcode >= 30 && opcode < 35:
+		n.Ops[opcode-30] = buf.GJStr()
+		if n.Ops[opcode-30] == "Hidden" || n.Ops[opcode-30] == "hidden" {
+			n.Ops[opcode-30] = ""
+		}
+	case opcode == 40, opcode == 41:
+		skipRecolours(buf)
+	case opcode == 42:
+		count := int(buf.G1())
+		buf.Next(count)
+	case opcode == 93:
+		n.Minimap = false
+	case opcode == 95:
+		n.CombatLevel = int(buf.G2())
+	case opcode == 97, opcode == 98, opcode == 103, opcode == 122, opcode == 123,
+		opcode == 137:
+		// scale, turn speed, health bar and icon height, attack cursor
+		buf.G2()
+	case opcode == 99, opcode == 109, opcode == 111:
+		// flags for how the NPC is drawn
+	case opcode == 100, opcode == 101, opcode == 119, opcode == 125,
+		opcode == 128:
+		// lighting, walk flags, respawn direction and speed
+		buf.G1()
+	case opcode == 102:
+		n.HeadIcon = int(buf.G2())
+	case opcode == 106 || opcode == 118:
+		n.MultiVarbit = g2Null(buf)
+		n.MultiVarp = g2Null(buf)
+		last := -1
+		if opcode == 118 {
+			last = g2Null(buf)
+		}
+		count := int(buf.G1())
+		n.MultiNPCs = make([]int, count+2)
+		for i := 0; i <= count; i++ {
+			n.MultiNPCs[i] = g2Null(buf)
+		}
+		n.MultiNPCs[count+1] = last
+	case opcode == 107:
+		n.Active = false
+	case opcode == 113:
+		// shadow colours
+		buf.G2()
+		buf.G2()
+	case opcode == 114:
+		// shadow modifiers
+		buf.G1()
+		buf.G1()
+	case opcode == 121:
+		// model offsets
+		count := int(buf.G1())
+		buf.Next(4 * count)
+	case opcode == 127:
+		n.BAS = g2Null(buf)
+	case opcode == 134:
+		// idle, crawl, walk and run sounds, and their range
+		buf.Next(9)
+	case opcode == 135, opcode == 136:
+		// cursors
+		buf.G1()
+		buf.G2()
+	case opcode == 249:
+		n.Params = decodeParams(buf)
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+func TestDecodeNPCType(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *NPCType
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			data: []byte{0},
+			want: newNPCType(1),
+		},
+		{
+			name: "guard",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(1)
+				buf.P1(2)
+				buf.P2(100)
+				buf.P2(101)
+				buf.P1(2)
+				buf.PJStr("Guard")
+				buf.P1(12)
+				buf.P1(2)
+				buf.P1(31)
+				buf.PJStr("Attack")
+				buf.P1(95)
+				buf.P2(21)
+				buf.P1(121)
+				buf.P1(1)
+				buf.P1(0)
+				buf.P1(1)
+				buf.P1(2)
+				buf.P1(3)
+				buf.P1(127)
+				buf.P2(1426)
+				buf.P1(134)
+				for i := 0; i < 9; i++ {
+					buf.P1(0)
+				}
+				buf.P1(93)
+			}),
+			want: func() *NPCType {
+				n := newNPCType(1)
+				n.Name = "Guard"
+				n.Size = 2
+				n.Ops[1] = "Attack"
+				n.CombatLevel = 21
+				n.BAS = 1426
+				n.Minimap = false
+				return n
+			}(),
+		},
+		{
+			name: "multinpc",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(106)
+				buf.P2(50)
+				buf.P2(0xffff)
+				buf.P1(1)
+				buf.P2(0xffff)
+				buf.P2(8)
+				buf.P1(107)
+			}),
+			want: func() *NPCType {
+				n := newNPCType(1)
+				n.MultiVarbit = 50
+				n.MultiNPCs = []int{-1, 8, -1}
+				n.Active = false
+				return n
+			}(),
+		},
+		{
+			name:    "unknown opcode",
+			data:    []byte{200, 0},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    []byte{95, 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeNPCType(1, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeNPCType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeNPCType() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveObjTypes is the cache archive obj types are stored in, 256 to a
+// group.
+const ArchiveObjTypes = 19
+
+// ObjType is the definition of an obj (an item).
+type ObjType struct {
+	ID   int
+	Name string
+
+	// Stackable is set if any number of the obj take a single inventory
+	// slot.
+	Stackable bool
+	Cost      int
+	Members   bool
+	// Tradeable is set if the obj can be sold on the Grand Exchange.
+	Tradeable bool
+	Team      int
+
+	// Ops are shown when the obj is on the ground, IOps when it's in an
+	// inventory.
+	Ops  [5]string
+	IOps [5]string
+
+	// CertLink is the obj's noted form, or the obj it's a note of if
+	// CertTemplate is set. Both are -1 if unused.
+	CertLink     int
+	CertTemplate int
+	// LentLink and LentTemplate are the same for the lent form.
+	LentLink     int
+	LentTemplate int
+
+	// CountObjs and CountCos give the obj shown for a stack of at least
+	// CountCos[i], such as coins.
+	CountObjs []int
+	CountCos  []int
+
+	// the models shown when the obj is worn, -1 if unused
+	ManWear    int
+	ManWear2   int
+	ManWear3   int
+	WomanWear  int
+	WomanWear2 int
+	WomanWear3 int
+
+	Params map[int]any
+}
+
+func newObjType(id int) *ObjType {
+	return &ObjType{
+		ID:           id,
+		Name:         "null",
+		Cost:         1,
+		Ops:          [5]string{2: "Take"},
+		IOps:         [5]string{4: "Drop"},
+		CertLink:     -1,
+		CertTemplate: -1,
+		LentLink:     -1,
+		LentTemplate: -1,
+		ManWear:      -1,
+		ManWear2:     -1,
+		ManWear3:     -1,
+		WomanWear:    -1,
+		WomanWear2:   -1,
+		WomanWear3:   -1,
+	}
+}
+
+// DecodeObjType decodes the obj type id from its file in the cache.
+func DecodeObjType(id int, data []byte) (*ObjType, error) {
+	obj := newObjType(id)
+	if err := decodeOpcodes("obj", id, data, obj.decode); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// TODO: confirm the opcodes against a 578 client, these are from later ones
+func (o *ObjType) decode(opcode uint8, buf *packet.Packet) error {
+	switch {
+	case opcode == 1, opcode == 4, opcode == 5, opcode == 6, opcode == 7,
+		opcode == 8, opcode == 90, opcode == 91, opcode == 92, opcode == 93,
+		opcode == 95, opcode == 110, opcode == 111, opcode == 112:
+		// the model, how it's drawn in inventories, and chat heads
+		buf.G2()
+	case opcode == 2:
+		o.Name = buf.GJStr()
+	case opcode == 11:
+		o.Stackable = true
+	case opcode == 12:
+		o.Cost = int(int32(buf.G4()))
+	case opcode == 16:
+		o.Members = true
+	case opcode == 18:
+		// the stack size at which the obj stops being shown as one
+		buf.G2()
+	case opcode == 23:
+		o.ManWear = g2Null(buf)
+	case opcode == 24:
+		o.ManWear2 = g2Null(buf)
+	case opcode == 25:
+		o.WomanWear = g2Null(buf)
+	case opcode == 26:
+		o.WomanWear2 = g2Null(buf)
+	case opcode >= 30 && opcode < 35:
+		o.Ops[opcode-30] = buf.GJStr()
+		if o.Ops[opcode-30] == "Hidden" || o.Ops[opcode-30] == "hidden" {
+			o.Ops[opcode-30] = ""
+		}
+	case opcode >= 35 && opcode < 40:
+		o.IOps[opcode-35] = buf.GJStr()
+	case opcode == 40, opcode == 41:
+		skipRecolours(buf)
+	case opcode == 42:
+		count := int(buf.G1())
+		buf.Next(count)
+	case opcode == 65:
+		o.Tradeable = true
+	case opcode == 78:
+		o.ManWear3 = g2Null(buf)
+	case opcode == 79:
+		o.WomanWear3 = g2Null(buf)
+	case opcode == 96:
+		// a dummy obj, hidden from searches
+		buf.G1()
+	case opcode == 97:
+		o.CertLink = g2Null(buf)
+	case opcode == 98:
+		o.CertTemplate = g2Null(buf)
+	case opcode >= 100 && opcode < 110:
+		if o.CountObjs == nil {
+			o.CountObjs = make([]int, 10)
+			o.CountCos = make([]int, 10)
+		}
+		o.CountObjs[opcode-100] = int(buf.G2())
+		o.CountCos[opcode-100] = int(buf.G2())
+	case opcode == 113, opcode == 114:
+		// ambient light and contrast
+		buf.G1()
+	case opcode == 115:
+		o.Team = int(buf.G1())
+	case opcode == 121:
+		o.LentLink = g2Null(buf)
+	case opcode == 122:
+		o.LentTemplate = g2Null(buf)
+	case opcode == 125, opcode == 126, opcode == 127, opcode == 128:
+		// offsets of the worn models
+		buf.Next(3)
+	case opcode == 129, opcode == 130:
+		// cursors
+		buf.G1()
+		buf.G2()
+	case opcode == 132:
+		// quests the obj needs
+		count := int(buf.G1())
+		buf.Next(2 * count)
+	case opcode == 134:
+		// pick size
+		buf.G1()
+	case opcode == 249:
+		o.Params = decodeParams(buf)
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
+
+// Noted reports whether the obj is the noted form of another.
+func (o *ObjType) Noted() bool {
+	return o.CertTemplate != -1
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// encodeOpcodes returns a type's file, with the opcodes fn writes.
+func encodeOpcodes(fn func(buf *packet.Packet)) []byte {
+	var buf packet.Packet
+	fn(&buf)
+	buf.P1(0)
+	return buf.Bytes()
+}
+
+func TestDecodeObjType(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *ObjType
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			data: []byte{0},
+			want: newObjType(1),
+		},
+		{
+			name: "whip",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(1)
+				buf.P2(5412)
+				buf.P1(2)
+				buf.PJStr("Abyssal whip")
+				buf.P1(7)
+				buf.P2(uint16(0xfffe))
+				buf.P1(12)
+				buf.P4(120001)
+				buf.P1(16)
+				buf.P1(65)
+				buf.P1(23)
+				buf.P2(5409)
+				buf.P1(25)
+				buf.P2(5409)
+				buf.P1(35)
+				buf.PJStr("Wield")
+				buf.P1(40)
+				buf.P1(1)
+				buf.P2(10)
+				buf.P2(20)
+				buf.P1(97)
+				buf.P2(4152)
+				buf.P1(125)
+				buf.P1(0)
+				buf.P1(1)
+				buf.P1(2)
+				buf.P1(132)
+				buf.P1(1)
+				buf.P2(3)
+			}),
+			want: func() *ObjType {
+				o := newObjType(1)
+				o.Name = "Abyssal whip"
+				o.Cost = 120001
+				o.Members = true
+				o.Tradeable = true
+				o.ManWear = 5409
+				o.WomanWear = 5409
+				o.IOps[0] = "Wield"
+				o.CertLink = 4152
+				return o
+			}(),
+		},
+		{
+			name: "coins",
+			data: encodeOpcodes(func(buf *packet.Packet) {
+				buf.P1(11)
+				buf.P1(101)
+				buf.P2(996)
+				buf.P2(2)
+				buf.P1(30)
+				buf.PJStr("Hidden")
+				buf.P1(249)
+				buf.P1(1)
+				buf.P1(0)
+				buf.P3(5)
+				buf.P4(7)
+			}),
+			want: func() *ObjType {
+				o := newObjType(1)
+				o.Stackable = true
+				o.CountObjs = []int{0, 996, 0, 0, 0, 0, 0, 0, 0, 0}
+				o.CountCos = []int{0, 2, 0, 0, 0, 0, 0, 0, 0, 0}
+				o.Params = map[int]any{5: 7}
+				return o
+			}(),
+		},
+		{
+			name:    "unknown opcode",
+			data:    []byte{200, 0},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    []byte{12, 0, 0},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeObjType(1, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeObjType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeObjType() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ParamType is the definition of a param, a value that other config types
+// can set.
+type ParamType struct {
+	ID            int
+	Type          ScriptType
+	DefaultInt    int
+	DefaultString string
+	// AutoDisable is unset on params that stay set on objs' noted forms.
+	AutoDisable bool
+}
+
+func newParamType(id int) *ParamType {
+	return &ParamType{
+		ID:          id,
+		AutoDisable: true,
+	}
+}
+
+// DecodeParamType decodes the param id from its file in the cache.
+func DecodeParamType(id int, data []byte) (*ParamType, error) {
+	param := newParamType(id)
+	if err := decodeOpcodes("param", id, data, param.decode); err != nil {
+		return nil, err
+	}
+	return param, nil
+}
+
+func (p *ParamType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 1:
+		p.Type = ScriptType(buf.G1())
+	case 2:
+		p.DefaultInt = int(int32(buf.G4()))
+	case 4:
+		p.AutoDisable = false
+	case 5:
+		p.DefaultString = buf.GJStr()
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
+
+// IsString reports whether the param holds a string.
+func (p *ParamType) IsString() bool {
+	return p.Type == 's'
+}
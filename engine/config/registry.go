@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ArchiveConfig is the cache archive holding the smaller config types, a
+// group per kind.
+const ArchiveConfig = 2
+
+// groups of ArchiveConfig
+// TODO: confirm against a 578 client
+const (
+	GroupInvTypes    = 5
+	GroupParamTypes  = 11
+	GroupStructTypes = 26
+)
+
+// Registry holds every kind of config type.
+type Registry struct {
+	Objs      *Types[ObjType]
+	NPCs      *Types[NPCType]
+	Locs      *LocTypes
+	Enums     *Types[EnumType]
+	Structs   *Types[StructType]
+	Params    *Types[ParamType]
+	Seqs      *Types[SeqType]
+	SpotAnims *Types[SpotAnimType]
+	Varbits   *Types[VarbitType]
+	Invs      *Types[InvType]
+}
+
+func NewRegistry(source Source) *Registry {
+	return &Registry{
+		Objs:      newArchiveTypes("obj", source, ArchiveObjTypes, 8, DecodeObjType),
+		NPCs:      newArchiveTypes("npc", source, ArchiveNPCTypes, 7, DecodeNPCType),
+		Locs:      NewLocTypes(source),
+		Enums:     newArchiveTypes("enum", source, ArchiveEnumTypes, 8, DecodeEnumType),
+		Structs:   newGroupTypes("struct", source, GroupStructTypes, DecodeStructType),
+		Params:    newGroupTypes("param", source, GroupParamTypes, DecodeParamType),
+		Seqs:      newArchiveTypes("seq", source, ArchiveSeqTypes, 7, DecodeSeqType),
+		SpotAnims: newArchiveTypes("spotanim", source, ArchiveSpotAnimTypes, 8, DecodeSpotAnimType),
+		Varbits:   newArchiveTypes("varbit", source, ArchiveVarbitTypes, 10, DecodeVarbitType),
+		Invs:      newGroupTypes("inv", source, GroupInvTypes, DecodeInvType),
+	}
+}
+
+// anyTypes is a Types of any kind.
+type anyTypes interface {
+	Load() error
+	Count() int
+	Failed() []error
+	get(id int) (any, error)
+	all() []any
+}
+
+func (r *Registry) kinds() map[string]anyTypes {
+	return map[string]anyTypes{
+		"obj":      r.Objs,
+		"npc":      r.NPCs,
+		"loc":      r.Locs,
+		"enum":     r.Enums,
+		"struct":   r.Structs,
+		"param":    r.Params,
+		"seq":      r.Seqs,
+		"spotanim": r.SpotAnims,
+		"varbit":   r.Varbits,
+		"inv":      r.Invs,
+	}
+}
+
+// Kinds returns the names of the kinds of config type, sorted.
+func (r *Registry) Kinds() []string {
+	var names []string
+	for name := range r.kinds() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load loads every config type, and returns how many of each kind there are.
+// Types that can't be decoded are left out; Failed says which.
+func (r *Registry) Load() (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, name := range r.Kinds() {
+		types := r.kinds()[name]
+		if err := types.Load(); err != nil {
+			return nil, err
+		}
+		counts[name] = types.Count()
+	}
+
+	r.linkCerts()
+	return counts, nil
+}
+
+// Failed returns the errors of the config types that couldn't be decoded,
+// by kind.
+func (r *Registry) Failed() []error {
+	var errs []error
+	for _, name := range r.Kinds() {
+		errs = append(errs, r.kinds()[name].Failed()...)
+	}
+	return errs
+}
+
+// linkCerts fills in noted and lent objs from the objs they're forms of,
+// as they only say which template to draw them with.
+func (r *Registry) linkCerts() {
+	for _, obj := range r.Objs.All() {
+		var link *ObjType
+		if obj.CertTemplate != -1 {
+			link, _ = r.Objs.Get(obj.CertLink)
+		} else if obj.LentTemplate != -1 {
+			link, _ = r.Objs.Get(obj.LentLink)
+		}
+		if link == nil {
+			continue
+		}
+
+		obj.Name = link.Name
+		obj.Members = link.Members
+		if obj.CertTemplate != -1 {
+			obj.Cost = link.Cost
+			obj.Stackable = true
+		} else {
+			obj.Cost = 0
+			obj.IOps = link.IOps
+			obj.IOps[4] = "Discard"
+			obj.Params = link.Params
+		}
+	}
+}
+
+// Get returns the config type id of the kind called name.
+func (r *Registry) Get(name string, id int) (any, error) {
+	types, ok := r.kinds()[name]
+	if !ok {
+		return nil, fmt.Errorf("no config type kind %q", name)
+	}
+	return types.get(id)
+}
+
+// All returns every loaded config type of the kind called name, in id
+// order.
+func (r *Registry) All(name string) ([]any, error) {
+	types, ok := r.kinds()[name]
+	if !ok {
+		return nil, fmt.Errorf("no config type kind %q", name)
+	}
+	return types.all(), nil
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/cache"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// fakeSource holds files by archive and group.
+type fakeSource map[int]map[int]map[int][]byte
+
+func (s fakeSource) ReferenceTable(archive int) (*cache.ReferenceTable, error) {
+	groups, ok := s[archive]
+	if !ok {
+		return nil, fmt.Errorf("no archive %d", archive)
+	}
+	table := &cache.ReferenceTable{Groups: make(map[int]*cache.GroupEntry)}
+	for id, files := range groups {
+		entry := &cache.GroupEntry{ID: id}
+		for file := range files {
+			entry.Files = append(entry.Files, file)
+		}
+		table.Groups[id] = entry
+	}
+	return table, nil
+}
+
+func (s fakeSource) Files(archive int, group int) (map[int][]byte, error) {
+	files, ok := s[archive][group]
+	if !ok {
+		return nil, fmt.Errorf("no group %d in archive %d", group, archive)
+	}
+	return files, nil
+}
+
+func named(name string) []byte {
+	return encodeOpcodes(func(buf *packet.Packet) {
+		buf.P1(2)
+		buf.PJStr(name)
+	})
+}
+
+func newTestSource() fakeSource {
+	return fakeSource{
+		ArchiveObjTypes: {
+			0: {
+				1: encodeOpcodes(func(buf *packet.Packet) {
+					buf.P1(2)
+					buf.PJStr("Bronze dagger")
+					buf.P1(12)
+					buf.P4(10)
+				}),
+				2: encodeOpcodes(func(buf *packet.Packet) {
+					buf.P1(97)
+					buf.P2(1)
+					buf.P1(98)
+					buf.P2(799)
+				}),
+			},
+			3: {
+				1: named("Abyssal whip"),
+			},
+		},
+		ArchiveNPCTypes: {
+			1: {
+				2: named("Hans"),
+			},
+		},
+		ArchiveVarbitTypes: {
+			0: {
+				5: {1, 0, 44, 3, 6, 0},
+			},
+		},
+		ArchiveConfig: {
+			GroupParamTypes: {
+				4: {1, 's', 5, 'x', 0, 0},
+			},
+		},
+	}
+}
+
+func TestTypes_Get(t *testing.T) {
+	r := NewRegistry(newTestSource())
+
+	tests := []struct {
+		name     string
+		get      func() (any, error)
+		wantName string
+		wantID   int
+		wantErr  bool
+	}{
+		{
+			name:     "obj in the first group",
+			get:      func() (any, error) { return r.Objs.Get(1) },
+			wantName: "Bronze dagger",
+			wantID:   1,
+		},
+		{
+			name:     "obj in a later group",
+			get:      func() (any, error) { return r.Objs.Get(3<<8 | 1) },
+			wantName: "Abyssal whip",
+			wantID:   3<<8 | 1,
+		},
+		{
+			name:     "npc, 128 to a group",
+			get:      func() (any, error) { return r.NPCs.Get(130) },
+			wantName: "Hans",
+			wantID:   130,
+		},
+		{
+			name:    "missing from a loaded group",
+			get:     func() (any, error) { return r.Objs.Get(3) },
+			wantErr: true,
+		},
+		{
+			name:    "missing group",
+			get:     func() (any, error) { return r.Objs.Get(1 << 8) },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			v := reflect.ValueOf(got).Elem()
+			if name := v.FieldByName("Name").String(); name != tt.wantName {
+				t.Errorf("Name = %v, want %v", name, tt.wantName)
+			}
+			if id := int(v.FieldByName("ID").Int()); id != tt.wantID {
+				t.Errorf("ID = %v, want %v", id, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestRegistry_Load(t *testing.T) {
+	source := newTestSource()
+	// every kind needs its archive or group to load
+	for _, archive := range []int{ArchiveLocTypes, ArchiveEnumTypes, ArchiveSeqTypes, ArchiveSpotAnimTypes} {
+		source[archive] = map[int]map[int][]byte{}
+	}
+	source[ArchiveConfig][GroupStructTypes] = map[int][]byte{}
+	source[ArchiveConfig][GroupInvTypes] = map[int][]byte{93: {2, 0, 28, 0}}
+
+	r := NewRegistry(source)
+	counts, err := r.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	wantCounts := map[string]int{
+		"obj": 3, "npc": 1, "loc": 0, "enum": 0, "struct": 0,
+		"param": 1, "seq": 0, "spotanim": 0, "varbit": 1, "inv": 1,
+	}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("Load() = %v, want %v", counts, wantCounts)
+	}
+
+	// the note takes its name and cost from the dagger
+	note, err := r.Objs.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Name != "Bronze dagger" || note.Cost != 10 || !note.Stackable || !note.Noted() {
+		t.Errorf("note = %+v, want a stackable Bronze dagger costing 10", note)
+	}
+
+	varbit, err := r.Get("varbit", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&VarbitType{ID: 5, Varp: 44, LSB: 3, MSB: 6}); !reflect.DeepEqual(varbit, want) {
+		t.Errorf("Get(varbit, 5) = %+v, want %+v", varbit, want)
+	}
+
+	param, _ := r.Params.Get(4)
+	if param.Type != 's' || param.DefaultString != "x" || !param.IsString() {
+		t.Errorf("param = %+v", param)
+	}
+
+	all, err := r.All("obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, v := range all {
+		ids = append(ids, v.(*ObjType).ID)
+	}
+	if want := []int{1, 2, 3<<8 | 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("All(obj) ids = %v, want %v", ids, want)
+	}
+
+	if _, err := r.Get("widget", 1); err == nil {
+		t.Errorf("Get() of an unknown kind succeeded")
+	}
+}
+
+func TestRegistry_Load_Failed(t *testing.T) {
+	source := newTestSource()
+	for _, archive := range []int{ArchiveLocTypes, ArchiveEnumTypes, ArchiveSeqTypes, ArchiveSpotAnimTypes} {
+		source[archive] = map[int]map[int][]byte{}
+	}
+	source[ArchiveConfig][GroupStructTypes] = map[int][]byte{}
+	source[ArchiveConfig][GroupInvTypes] = map[int][]byte{}
+	// an opcode the decoder doesn't know
+	source[ArchiveNPCTypes][1][3] = []byte{200, 0}
+
+	r := NewRegistry(source)
+	counts, err := r.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if counts["npc"] != 1 {
+		t.Errorf("Load() npcs = %v, want 1", counts["npc"])
+	}
+
+	if failed := r.Failed(); len(failed) != 1 {
+		t.Errorf("Failed() = %v, want one error", failed)
+	}
+	if _, err := r.NPCs.Get(131); err == nil {
+		t.Errorf("Get() of the skipped npc didn't fail")
+	}
+	if _, err := r.NPCs.Get(130); err != nil {
+		t.Errorf("Get() of the npc beside it error = %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveSeqTypes is the cache archive seqs are stored in, 128 to a group.
+const ArchiveSeqTypes = 20
+
+// SeqType is the definition of a seq (an animation).
+type SeqType struct {
+	ID int
+	// Delays holds how long each frame is shown, in client cycles.
+	Delays []int
+	// Frames holds each frame, as its frame group <<16 | its file.
+	Frames []int
+
+	ReplayOff   int
+	ReplayCount int
+	Priority    int
+	// the objs held in each hand while the seq plays, -1 to keep the worn
+	// ones and 0 for none
+	RightHand int
+	LeftHand  int
+	// what happens when the mover moves during the seq: 0 carries on, 1
+	// pauses it and 2 stops it; -1 decides from WalkMerge
+	PreAnimMove  int
+	PostAnimMove int
+	ReplaceMode  int
+	WalkMerge    []int
+}
+
+func newSeqType(id int) *SeqType {
+	return &SeqType{
+		ID:           id,
+		ReplayOff:    -1,
+		ReplayCount:  99,
+		Priority:     5,
+		RightHand:    -1,
+		LeftHand:     -1,
+		PreAnimMove:  -1,
+		PostAnimMove: -1,
+		ReplaceMode:  2,
+	}
+}
+
+// DecodeSeqType decodes the seq id from its file in the cache.
+func DecodeSeqType(id int, data []byte) (*SeqType, error) {
+	seq := newSeqType(id)
+	if err := decodeOpcodes("seq", id, data, seq.decode); err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
+
+// TODO: confirm the opcodes against a 578 client, these are from later ones
+func (s *SeqType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 1:
+		count := int(buf.G2())
+		s.Delays = make([]int, count)
+		s.Frames = make([]int, count)
+		for i := range s.Delays {
+			s.Delays[i] = int(buf.G2())
+		}
+		for i := range s.Frames {
+			s.Frames[i] = int(buf.G2())
+		}
+		for i := range s.Frames {
+			s.Frames[i] |= int(buf.G2()) << 16
+		}
+	case 2:
+		s.ReplayOff = g2Null(buf)
+	case 3:
+		count := int(buf.G1())
+		s.WalkMerge = make([]int, count)
+		for i := range s.WalkMerge {
+			s.WalkMerge[i] = int(buf.G1())
+		}
+	case 4, 14, 15, 16, 18:
+		// flags for how the seq is drawn
+	case 5:
+		s.Priority = int(buf.G1())
+	case 6:
+		s.RightHand = int(buf.G2())
+	case 7:
+		s.LeftHand = int(buf.G2())
+	case 8:
+		s.ReplayCount = int(buf.G1())
+	case 9:
+		s.PreAnimMove = int(buf.G1())
+	case 10:
+		s.PostAnimMove = int(buf.G1())
+	case 11:
+		s.ReplaceMode = int(buf.G1())
+	case 12:
+		// interface frames, and their groups
+		count := int(buf.G1())
+		buf.Next(4 * count)
+	case 13:
+		// sounds played on each frame
+		count := int(buf.G2())
+		for i := 0; i < count; i++ {
+			sounds := int(buf.G1())
+			if sounds > 0 {
+				buf.G3()
+				buf.Next(2 * (sounds - 1))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
+
+// Duration returns how many client cycles the seq takes to play once.
+func (s *SeqType) Duration() int {
+	total := 0
+	for _, delay := range s.Delays {
+		total += delay
+	}
+	return total
+}
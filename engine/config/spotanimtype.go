@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveSpotAnimTypes is the cache archive spot anims are stored in, 256
+// to a group.
+const ArchiveSpotAnimTypes = 21
+
+// SpotAnimType is the definition of a spot anim (a graphic), a model
+// played in one place for the length of a seq.
+type SpotAnimType struct {
+	ID    int
+	Model int
+	Seq   int
+	// the scale of the model, in 128ths
+	ResizeH  int
+	ResizeV  int
+	Rotation int
+}
+
+func newSpotAnimType(id int) *SpotAnimType {
+	return &SpotAnimType{
+		ID:      id,
+		Seq:     -1,
+		ResizeH: 128,
+		ResizeV: 128,
+	}
+}
+
+// DecodeSpotAnimType decodes the spot anim id from its file in the cache.
+func DecodeSpotAnimType(id int, data []byte) (*SpotAnimType, error) {
+	spotAnim := newSpotAnimType(id)
+	if err := decodeOpcodes("spotanim", id, data, spotAnim.decode); err != nil {
+		return nil, err
+	}
+	return spotAnim, nil
+}
+
+// TODO: confirm the opcodes against a 578 client, these are from later ones
+func (s *SpotAnimType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 1:
+		s.Model = int(buf.G2())
+	case 2:
+		s.Seq = g2Null(buf)
+	case 4:
+		s.ResizeH = int(buf.G2())
+	case 5:
+		s.ResizeV = int(buf.G2())
+	case 6:
+		s.Rotation = int(buf.G2())
+	case 7, 8:
+		// ambient light and contrast
+		buf.G1()
+	case 9, 10:
+		// flags for how the spot anim is drawn
+	case 40, 41:
+		skipRecolours(buf)
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// StructType is a set of params, for scripts.
+type StructType struct {
+	ID     int
+	Params map[int]any
+}
+
+// DecodeStructType decodes the struct id from its file in the cache.
+func DecodeStructType(id int, data []byte) (*StructType, error) {
+	s := &StructType{ID: id}
+	if err := decodeOpcodes("struct", id, data, s.decode); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *StructType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 249:
+		s.Params = decodeParams(buf)
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
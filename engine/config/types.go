@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zsrv/rt5-server-go/util/cache"
+)
+
+// Source is where config types are read from, usually a *cache.Cache.
+type Source interface {
+	ReferenceTable(archive int) (*cache.ReferenceTable, error)
+	Files(archive int, group int) (map[int][]byte, error)
+}
+
+// Types loads the config types of one kind from a Source, a group at a time,
+// as they're asked for.
+type Types[T any] struct {
+	// Name is what the types are called, for errors.
+	Name string
+
+	source  Source
+	archive int
+	// group is the group every type is stored in, or -1 if they're spread
+	// over the archive with the low bits of the id picking the file.
+	group  int
+	bits   int
+	decode func(id int, data []byte) (*T, error)
+
+	mu     sync.Mutex
+	types  map[int]*T
+	loaded map[int]bool
+	// failed holds the types that couldn't be decoded, which are skipped
+	// so one bad type doesn't stop the rest loading
+	failed map[int]error
+}
+
+// newArchiveTypes returns types spread over archive, 1<<bits to a group.
+func newArchiveTypes[T any](name string, source Source, archive int, bits int, decode func(int, []byte) (*T, error)) *Types[T] {
+	return &Types[T]{
+		Name:    name,
+		source:  source,
+		archive: archive,
+		group:   -1,
+		bits:    bits,
+		decode:  decode,
+		types:   make(map[int]*T),
+		loaded:  make(map[int]bool),
+		failed:  make(map[int]error),
+	}
+}
+
+// newGroupTypes returns types stored in a single group of the config
+// archive, with the file id as the type id.
+func newGroupTypes[T any](name string, source Source, group int, decode func(int, []byte) (*T, error)) *Types[T] {
+	t := newArchiveTypes(name, source, ArchiveConfig, 0, decode)
+	t.group = group
+	return t
+}
+
+// location returns the group type id is stored in and the id of its first
+// file's type.
+func (t *Types[T]) location(id int) (group int, base int) {
+	if t.group >= 0 {
+		return t.group, 0
+	}
+	return id >> t.bits, id &^ (1<<t.bits - 1)
+}
+
+// Get returns the type id, loading its group if it isn't loaded yet.
+func (t *Types[T]) Get(id int) (*T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if v, ok := t.types[id]; ok {
+		return v, nil
+	}
+
+	group, base := t.location(id)
+	if err := t.loadGroup(group, base); err != nil {
+		return nil, err
+	}
+
+	if err, ok := t.failed[id]; ok {
+		return nil, err
+	}
+	v, ok := t.types[id]
+	if !ok {
+		return nil, fmt.Errorf("no %s %d", t.Name, id)
+	}
+	return v, nil
+}
+
+// Load loads every type in the cache.
+func (t *Types[T]) Load() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.group >= 0 {
+		return t.loadGroup(t.group, 0)
+	}
+
+	table, err := t.source.ReferenceTable(t.archive)
+	if err != nil {
+		return err
+	}
+	for group := range table.Groups {
+		if err := t.loadGroup(group, group<<t.bits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Types[T]) loadGroup(group int, base int) error {
+	if t.loaded[group] {
+		return nil
+	}
+
+	files, err := t.source.Files(t.archive, group)
+	if err != nil {
+		return fmt.Errorf("%s group %d: %w", t.Name, group, err)
+	}
+	for file, data := range files {
+		id := base | file
+		v, err := t.decode(id, data)
+		if err != nil {
+			t.failed[id] = fmt.Errorf("%s %d: %w", t.Name, id, err)
+			continue
+		}
+		t.types[id] = v
+	}
+	t.loaded[group] = true
+	return nil
+}
+
+// All returns the types loaded so far, in id order.
+func (t *Types[T]) All() []*T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]int, 0, len(t.types))
+	for id := range t.types {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	all := make([]*T, len(ids))
+	for i, id := range ids {
+		all[i] = t.types[id]
+	}
+	return all
+}
+
+// Count returns how many types are loaded.
+func (t *Types[T]) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.types)
+}
+
+// Failed returns the errors of the types that couldn't be decoded, in id
+// order.
+func (t *Types[T]) Failed() []error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]int, 0, len(t.failed))
+	for id := range t.failed {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		errs[i] = t.failed[id]
+	}
+	return errs
+}
+
+// get and all let a Registry look types up without knowing what they are.
+func (t *Types[T]) get(id int) (any, error) {
+	return t.Get(id)
+}
+
+func (t *Types[T]) all() []any {
+	types := t.All()
+	all := make([]any, len(types))
+	for i, v := range types {
+		all[i] = v
+	}
+	return all
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// ArchiveVarbitTypes is the cache archive varbits are stored in, 1024 to a
+// group.
+const ArchiveVarbitTypes = 22
+
+// VarbitType is the definition of a varbit, a range of bits within a varp.
+type VarbitType struct {
+	ID   int
+	Varp int
+	// the bits of Varp the varbit is, from LSB to MSB inclusive
+	LSB int
+	MSB int
+}
+
+// DecodeVarbitType decodes the varbit id from its file in the cache.
+func DecodeVarbitType(id int, data []byte) (*VarbitType, error) {
+	varbit := &VarbitType{ID: id}
+	if err := decodeOpcodes("varbit", id, data, varbit.decode); err != nil {
+		return nil, err
+	}
+	return varbit, nil
+}
+
+func (v *VarbitType) decode(opcode uint8, buf *packet.Packet) error {
+	switch opcode {
+	case 1:
+		v.Varp = int(buf.G2())
+		v.LSB = int(buf.G1())
+		v.MSB = int(buf.G1())
+	default:
+		return fmt.Errorf("unknown opcode %d", opcode)
+	}
+	return nil
+}
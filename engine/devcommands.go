@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// developer commands
+func init() {
+	RegisterCommand(Command{
+		Name: "pos",
+		Help: "Shows where you are.",
+		Run: func(p *Player, args CommandArgs) {
+			pos := p.Pos
+			p.Console(fmt.Sprintf("%d, %d, %d: mapsquare %d_%d, zone %d_%d, local %d_%d",
+				pos.X, pos.Z, pos.Plane, pos.X>>6, pos.Z>>6, pos.X>>3, pos.Z>>3, pos.X&0x3f, pos.Z&0x3f))
+		},
+	})
+
+	RegisterCommand(Command{
+		Name: "players",
+		Help: "Lists the players on this world.",
+		Run: func(p *Player, args CommandArgs) {
+			var names []string
+			for _, v := range p.World.Players {
+				if v != nil {
+					names = append(names, v.Username)
+				}
+			}
+			sort.Strings(names)
+
+			if len(names) == 1 {
+				p.Console("There is 1 player online: " + names[0])
+			} else {
+				p.Console(fmt.Sprintf("There are %d players online: %s", len(names), strings.Join(names, ", ")))
+			}
+		},
+	})
+
+	RegisterCommand(Command{
+		Name: "tele",
+		Args: []CommandArg{
+			{Name: "x", Type: ArgInt},
+			{Name: "z", Type: ArgInt},
+			{Name: "plane", Type: ArgInt, Optional: true},
+		},
+		Help:  "Teleports you to a tile.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			x, z, plane := args.Int("x", 0), args.Int("z", 0), args.Int("plane", p.Pos.Plane)
+			if x < 0 || z < 0 || x >= 16384 || z >= 16384 || plane < 0 || plane > 3 {
+				p.Console("That tile is off the map.")
+				return
+			}
+			p.Teleport(x, z, plane)
+		},
+	})
+
+	RegisterCommand(Command{
+		Name:  "npc",
+		Args:  []CommandArg{{Name: "id", Type: ArgInt}},
+		Help:  "Spawns an NPC where you stand.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			spawn := NPCSpawn{Type: args.Int("id", 0), X: p.Pos.X, Z: p.Pos.Z, Plane: p.Pos.Plane}
+			if err := p.World.SpawnNPCs([]NPCSpawn{spawn}); err != nil {
+				p.Console(err.Error())
+			}
+		},
+	})
+
+	RegisterCommand(Command{
+		Name:  "anim",
+		Args:  []CommandArg{{Name: "id", Type: ArgInt}},
+		Help:  "Plays a seq on you, or stops the current one with -1.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			p.Anim(args.Int("id", -1), 0)
+		},
+	})
+
+	RegisterCommand(Command{
+		Name:  "gfx",
+		Args:  []CommandArg{{Name: "id", Type: ArgInt}, {Name: "height", Type: ArgInt, Optional: true}},
+		Help:  "Plays a spot anim on you.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			p.SpotAnim(args.Int("id", -1), args.Int("height", 0), 0)
+		},
+	})
+
+	RegisterCommand(Command{
+		Name:  "interface",
+		Args:  []CommandArg{{Name: "id", Type: ArgInt}},
+		Help:  "Opens an interface in the main window, or closes it with -1.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			if id := args.Int("id", -1); id == -1 {
+				p.CloseFrameSub(SlotMain)
+			} else {
+				p.OpenFrameSub(SlotMain, id, 0)
+			}
+		},
+	})
+
+	RegisterCommand(Command{
+		Name:  "varp",
+		Args:  []CommandArg{{Name: "id", Type: ArgInt}, {Name: "value", Type: ArgInt, Optional: true}},
+		Help:  "Shows a varp, or sets it.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			id := args.Int("id", 0)
+			if args.Has("value") {
+				p.SetVarp(id, args.Int("value", 0))
+			}
+			p.Console(fmt.Sprintf("varp %d = %d", id, p.Varp(id)))
+		},
+	})
+
+	RegisterCommand(Command{
+		Name:  "reload",
+		Help:  "Reloads the config types and NPC spawns.",
+		Level: CommandLevelAdmin,
+		Run: func(p *Player, args CommandArgs) {
+			counts, err := p.World.Reload()
+			if err != nil {
+				p.Console("Could not reload: " + err.Error())
+				return
+			}
+			for _, err := range p.World.Config.Failed() {
+				p.Client.Server.Logger.Warn("skipped config type", "error", err)
+			}
+			p.Client.Server.Logger.Info("reloaded config types", "counts", counts, "username", p.Username)
+			p.Console("Reloaded.")
+		},
+	})
+}
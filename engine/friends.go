@@ -0,0 +1,405 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/huffman"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+const (
+	maxFriends = 200
+	maxIgnores = 100
+)
+
+// chat filter modes, set from the buttons under the chat box
+const (
+	ChatModeOn      = 0
+	ChatModeFriends = 1
+	ChatModeOff     = 2
+	// ChatModeHide is only used for public chat.
+	ChatModeHide = 3
+)
+
+// friend list states sent with ServerProtFriendListStatus
+const (
+	friendListLoading    = 0
+	friendListConnecting = 1
+	friendListLoaded     = 2
+)
+
+// ChatModes are the player's chat filter settings.
+type ChatModes struct {
+	Public  int `json:"public"`
+	Private int `json:"private"`
+	Trade   int `json:"trade"`
+}
+
+// PrivateMessage is a private message sent by a client.
+type PrivateMessage struct {
+	To   string
+	Text string
+}
+
+// social is who the player is friends with and ignoring.
+type social struct {
+	friends []string
+	ignores []string
+	modes   ChatModes
+}
+
+// decodeName decodes the FRIENDLIST_ADD, FRIENDLIST_DEL, IGNORELIST_ADD
+// and IGNORELIST_DEL payloads, which are just the name of a player.
+func decodeName(buf *packet.Packet) (name string, err error) {
+	defer recoverDecode(&err)
+
+	name = buf.GJStr()
+	if util.ToBase37(name) == 0 {
+		return "", fmt.Errorf("bad name %q", name)
+	}
+	return name, nil
+}
+
+// decodeMessagePrivate decodes MESSAGE_PRIVATE.
+func decodeMessagePrivate(codec *huffman.Huffman, buf *packet.Packet) (msg PrivateMessage, err error) {
+	defer recoverDecode(&err)
+
+	msg.To = buf.GJStr()
+	msg.Text, err = unpackChat(codec, buf)
+	return msg, err
+}
+
+// decodeChatSetMode decodes CHAT_SETMODE.
+func decodeChatSetMode(buf *packet.Packet) (modes ChatModes, err error) {
+	defer recoverDecode(&err)
+
+	modes.Public = int(buf.G1())
+	modes.Private = int(buf.G1())
+	modes.Trade = int(buf.G1())
+	if modes.Public > ChatModeHide || modes.Private > ChatModeOff || modes.Trade > ChatModeOff {
+		return ChatModes{}, fmt.Errorf("bad chat modes %+v", modes)
+	}
+	return modes, nil
+}
+
+// sameName reports whether a and b are the same player's name, the way the
+// client compares them.
+func sameName(a string, b string) bool {
+	return util.ToBase37(a) == util.ToBase37(b)
+}
+
+func indexName(names []string, name string) int {
+	return slices.IndexFunc(names, func(v string) bool {
+		return sameName(v, name)
+	})
+}
+
+// HasFriend reports whether name is on the player's friend list.
+func (p *Player) HasFriend(name string) bool {
+	return indexName(p.social.friends, name) != -1
+}
+
+// IsIgnoring reports whether name is on the player's ignore list.
+func (p *Player) IsIgnoring(name string) bool {
+	return indexName(p.social.ignores, name) != -1
+}
+
+// ChatModes returns the player's chat filter settings.
+func (p *Player) ChatModes() ChatModes {
+	return p.social.modes
+}
+
+// visibleTo reports whether the player shows as online on viewer's friend
+// list, and so can be sent private messages by them.
+func (p *Player) visibleTo(viewer *Player) bool {
+	if p.IsIgnoring(viewer.Username) {
+		return false
+	}
+	switch p.social.modes.Private {
+	case ChatModeOn:
+		return true
+	case ChatModeFriends:
+		return p.HasFriend(viewer.Username)
+	}
+	return false
+}
+
+// worldID returns the world the player is on.
+func (p *Player) worldID() int {
+	return p.Client.Server.WorldParams.ID
+}
+
+// friendWorld returns the world the player's friend called name is on, or 0
+// if they're offline or hidden from the player.
+func (p *Player) friendWorld(name string) int {
+	friend, ok := p.World.FindPlayer(name)
+	if !ok || !friend.Loaded || !friend.visibleTo(p) {
+		return 0
+	}
+	return friend.worldID()
+}
+
+// AddFriend puts name on the player's friend list.
+func (p *Player) AddFriend(name string) {
+	switch {
+	case sameName(name, p.Username):
+		p.MessageGame("You can't add yourself to your own friend list.", MessageTypeGame, "", "")
+		return
+	case p.HasFriend(name):
+		p.MessageGame(fmt.Sprintf("%s is already on your friend list.", name), MessageTypeGame, "", "")
+		return
+	case p.IsIgnoring(name):
+		p.MessageGame(fmt.Sprintf("Please remove %s from your ignore list first.", name), MessageTypeGame, "", "")
+		return
+	case len(p.social.friends) >= maxFriends:
+		p.MessageGame("Your friend list is full.", MessageTypeGame, "", "")
+		return
+	}
+
+	if friend, ok := p.World.FindPlayer(name); ok {
+		name = friend.Username
+	}
+	p.social.friends = append(p.social.friends, name)
+	p.sendFriend(name)
+
+	if p.social.modes.Private == ChatModeFriends {
+		// the player has just appeared to them
+		p.World.notifyFriend(p, name)
+	}
+}
+
+// RemoveFriend takes name off the player's friend list.
+func (p *Player) RemoveFriend(name string) {
+	i := indexName(p.social.friends, name)
+	if i == -1 {
+		return
+	}
+	name = p.social.friends[i]
+	p.social.friends = slices.Delete(p.social.friends, i, i+1)
+
+	if p.social.modes.Private == ChatModeFriends {
+		p.World.notifyFriend(p, name)
+	}
+}
+
+// AddIgnore puts name on the player's ignore list.
+func (p *Player) AddIgnore(name string) {
+	switch {
+	case sameName(name, p.Username):
+		p.MessageGame("You can't add yourself to your own ignore list.", MessageTypeGame, "", "")
+		return
+	case p.IsIgnoring(name):
+		p.MessageGame(fmt.Sprintf("%s is already on your ignore list.", name), MessageTypeGame, "", "")
+		return
+	case p.HasFriend(name):
+		p.MessageGame(fmt.Sprintf("Please remove %s from your friend list first.", name), MessageTypeGame, "", "")
+		return
+	case len(p.social.ignores) >= maxIgnores:
+		p.MessageGame("Your ignore list is full.", MessageTypeGame, "", "")
+		return
+	}
+
+	if ignored, ok := p.World.FindPlayer(name); ok {
+		name = ignored.Username
+	}
+	p.social.ignores = append(p.social.ignores, name)
+	p.sendIgnoreList()
+	p.World.notifyFriend(p, name)
+}
+
+// RemoveIgnore takes name off the player's ignore list.
+func (p *Player) RemoveIgnore(name string) {
+	i := indexName(p.social.ignores, name)
+	if i == -1 {
+		return
+	}
+	name = p.social.ignores[i]
+	p.social.ignores = slices.Delete(p.social.ignores, i, i+1)
+	p.World.notifyFriend(p, name)
+}
+
+// SetChatModes changes the player's chat filter settings, showing or hiding
+// them on other players' friend lists to match.
+func (p *Player) SetChatModes(modes ChatModes) {
+	private := p.social.modes.Private
+	p.social.modes = modes
+	p.sendChatModes()
+
+	if modes.Private != private {
+		p.World.notifyFriends(p)
+	}
+}
+
+// PrivateChat sends a private message to a player on the player's friend
+// list.
+func (p *Player) PrivateChat(msg PrivateMessage, now time.Time) {
+	if p.IsMuted(now) {
+		p.MessageGame("You have been muted and can't send private messages.", MessageTypeGame, "", "")
+		return
+	}
+
+	to, ok := p.World.FindPlayer(msg.To)
+	if !ok || !to.Loaded || !p.HasFriend(msg.To) || !to.visibleTo(p) {
+		p.MessageGame("That player is currently offline.", MessageTypeGame, "", "")
+		return
+	}
+	if !p.chatAllowed(now) {
+		p.MessageGame("You're sending messages too quickly.", MessageTypeGame, "", "")
+		return
+	}
+
+	text := msg.Text
+	if filter := p.World.ChatFilter; filter != nil {
+		text, ok = filter(p, text)
+		if !ok {
+			return
+		}
+	}
+
+	packed, err := packChat(p.World.huffman(), text)
+	if err != nil {
+		p.Client.Server.Logger.Warn("could not pack chat", "username", p.Username, "error", err)
+		return
+	}
+
+	if p.social.modes.Private == ChatModeOff {
+		// messaging someone turns private chat back on, so they can reply
+		p.SetChatModes(ChatModes{Public: p.social.modes.Public, Private: ChatModeFriends, Trade: p.social.modes.Trade})
+	}
+
+	p.World.messageID++
+	to.sendMessagePrivate(p, p.World.messageID, packed)
+	p.sendMessagePrivateEcho(to.Username, packed)
+}
+
+// loadSocial sends the player's chat modes, friends and ignores when they
+// log in, and shows them as online to their friends.
+func (p *Player) loadSocial() {
+	p.sendChatModes()
+	p.sendFriendListStatus(friendListLoading)
+	p.sendIgnoreList()
+	for _, v := range p.social.friends {
+		p.sendFriend(v)
+	}
+	p.sendFriendListStatus(friendListLoaded)
+
+	p.World.notifyFriends(p)
+}
+
+// notifyFriend updates player's entry on the friend list of the player
+// called name, if they're online and have player as a friend.
+func (w *World) notifyFriend(player *Player, name string) {
+	friend, ok := w.FindPlayer(name)
+	if ok && friend != player && friend.Loaded && friend.HasFriend(player.Username) {
+		friend.sendFriend(player.Username)
+	}
+}
+
+// notifyFriends updates player's entry on the friend list of everyone who
+// has them as a friend, after they log in or out or change who can see
+// them.
+func (w *World) notifyFriends(player *Player) {
+	for _, v := range w.Players {
+		if v != nil && v != player && v.Loaded && v.HasFriend(player.Username) {
+			v.sendFriend(player.Username)
+		}
+	}
+}
+
+// sendFriend sends the world the friend called name is on.
+// TODO: confirm the layout against a 578 client
+func (p *Player) sendFriend(name string) {
+	world := p.friendWorld(name)
+
+	var response packet.Packet
+	response.P1(util.ServerProtUpdateFriendList)
+	response.P1(0)
+	start := response.Len()
+
+	response.P1(0) // not a name change
+	response.PJStr(name)
+	response.PJStr("") // previous name
+	response.P2(uint16(world))
+	response.P1(uint8(p.friendRank(name)))
+	if world != 0 {
+		response.PJStr(fmt.Sprintf("World %d", world))
+	}
+
+	response.PSize1(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// sendIgnoreList sends the whole ignore list.
+// TODO: confirm the layout against a 578 client
+func (p *Player) sendIgnoreList() {
+	var response packet.Packet
+	response.P1(util.ServerProtUpdateIgnoreList)
+	response.P2(0)
+	start := response.Len()
+
+	response.P1(uint8(len(p.social.ignores)))
+	for _, v := range p.social.ignores {
+		response.PJStr(v)
+		response.PJStr("") // previous name
+	}
+
+	response.PSize2(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+func (p *Player) sendFriendListStatus(status int) {
+	var response packet.Packet
+	response.P1(util.ServerProtFriendListStatus)
+	response.P1(uint8(status))
+	p.Client.Queue(response.Bytes(), true)
+}
+
+func (p *Player) sendChatModes() {
+	var response packet.Packet
+	response.P1(util.ServerProtChatFilterSettings)
+	response.P1(uint8(p.social.modes.Public))
+	response.P1(uint8(p.social.modes.Trade))
+	p.Client.Queue(response.Bytes(), true)
+
+	response = packet.Packet{}
+	response.P1(util.ServerProtChatFilterSettingsPrivateChat)
+	response.P1(uint8(p.social.modes.Private))
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// sendMessagePrivate sends a private message from another player. id is
+// unique to the message, so the client can tell repeats apart.
+// TODO: confirm the layout against a 578 client
+func (p *Player) sendMessagePrivate(from *Player, id uint64, packed []byte) {
+	var response packet.Packet
+	response.P1(util.ServerProtMessagePrivate)
+	response.P1(0)
+	start := response.Len()
+
+	response.P1(0) // no display name
+	response.PJStr(from.Username)
+	response.P2(uint16(id >> 24))
+	response.P3(uint32(id & 0xffffff))
+	response.P1(uint8(from.modIcon()))
+	response.PData(packed, len(packed))
+
+	response.PSize1(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// sendMessagePrivateEcho shows the player a private message they sent.
+func (p *Player) sendMessagePrivateEcho(to string, packed []byte) {
+	var response packet.Packet
+	response.P1(util.ServerProtMessagePrivateEcho)
+	response.P1(0)
+	start := response.Len()
+
+	response.PJStr(to)
+	response.PData(packed, len(packed))
+
+	response.PSize1(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
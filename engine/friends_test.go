@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// addSocialTestPlayer adds a connected player called name to w, on world 1.
+func addSocialTestPlayer(w *World, name string) *Player {
+	p := addTestPlayer(w, 3200, 3200, 0)
+	p.Client = &Client{Server: &Server{Logger: *util.NewLogger(), WorldParams: util.WorldParameters{ID: 1}}}
+	p.Username = name
+	return p
+}
+
+// sentFriends returns the world sent for each friend list entry queued for
+// p, and forgets everything queued.
+func sentFriends(p *Player) map[string]int {
+	friends := make(map[string]int)
+	for _, v := range p.Client.NetOut {
+		buf := packet.NewPacket(v.Data)
+		if buf.G1() != util.ServerProtUpdateFriendList {
+			continue
+		}
+		buf.G1() // size
+		buf.G1() // name change
+		name := buf.GJStr()
+		buf.GJStr()
+		friends[name] = int(buf.G2())
+	}
+	p.Client.NetOut = nil
+	return friends
+}
+
+func Test_decodeChatSetMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    ChatModes
+		wantErr bool
+	}{
+		{
+			name: "all on",
+			data: []byte{0, 0, 0},
+			want: ChatModes{},
+		},
+		{
+			name: "hide public, friends only private, trade off",
+			data: []byte{3, 1, 2},
+			want: ChatModes{Public: ChatModeHide, Private: ChatModeFriends, Trade: ChatModeOff},
+		},
+		{
+			name:    "hide private",
+			data:    []byte{0, 3, 0},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    []byte{0, 0},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeChatSetMode(packet.NewPacket(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeChatSetMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeChatSetMode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_friendWorld(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(zezima *Player)
+		want  int
+	}{
+		{
+			name: "private chat on",
+			want: 1,
+		},
+		{
+			name: "private chat off",
+			setup: func(zezima *Player) {
+				zezima.social.modes.Private = ChatModeOff
+			},
+			want: 0,
+		},
+		{
+			name: "friends only, not a friend",
+			setup: func(zezima *Player) {
+				zezima.social.modes.Private = ChatModeFriends
+			},
+			want: 0,
+		},
+		{
+			name: "friends only, a friend",
+			setup: func(zezima *Player) {
+				zezima.social.modes.Private = ChatModeFriends
+				zezima.social.friends = []string{"Bob"}
+			},
+			want: 1,
+		},
+		{
+			name: "ignoring them",
+			setup: func(zezima *Player) {
+				zezima.social.ignores = []string{"bob"}
+			},
+			want: 0,
+		},
+		{
+			name: "logged out",
+			setup: func(zezima *Player) {
+				zezima.World.RemovePlayer(*zezima.Client)
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			bob := addSocialTestPlayer(w, "Bob")
+			zezima := addSocialTestPlayer(w, "Zezima")
+			zezima.Client.Player = zezima
+			if tt.setup != nil {
+				tt.setup(zezima)
+			}
+
+			if got := bob.friendWorld("zezima"); got != tt.want {
+				t.Errorf("friendWorld() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_AddFriend(t *testing.T) {
+	tests := []struct {
+		name        string
+		friends     []string
+		ignores     []string
+		add         string
+		wantFriends []string
+	}{
+		{
+			name:        "online",
+			add:         "zezima",
+			wantFriends: []string{"Zezima"},
+		},
+		{
+			name:        "offline",
+			friends:     []string{"Zezima"},
+			add:         "Durial321",
+			wantFriends: []string{"Zezima", "Durial321"},
+		},
+		{
+			name:        "already a friend",
+			friends:     []string{"Zezima"},
+			add:         "ZEZIMA",
+			wantFriends: []string{"Zezima"},
+		},
+		{
+			name:    "ignored",
+			ignores: []string{"Zezima"},
+			add:     "Zezima",
+		},
+		{
+			name: "themselves",
+			add:  "bob",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			bob := addSocialTestPlayer(w, "Bob")
+			addSocialTestPlayer(w, "Zezima")
+			bob.social.friends = tt.friends
+			bob.social.ignores = tt.ignores
+
+			bob.AddFriend(tt.add)
+
+			if !reflect.DeepEqual(bob.social.friends, tt.wantFriends) {
+				t.Errorf("friends = %v, want %v", bob.social.friends, tt.wantFriends)
+			}
+		})
+	}
+}
+
+func TestPlayer_ProcessIn_Unconfirmed(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		SendUnconfirmed = enabled
+		w := newTestWorld()
+		bob := addSocialTestPlayer(w, "Bob")
+
+		receive(bob, util.ClientProtFriendListAdd, append([]byte("Zezima"), 0))
+		bob.ProcessIn()
+
+		if got := len(bob.social.friends) == 1; got != enabled {
+			t.Errorf("unconfirmed packets %v: friends = %v", enabled, bob.social.friends)
+		}
+	}
+	SendUnconfirmed = true
+}
+
+func TestPlayer_PrivateChat(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name      string
+		setup     func(bob *Player, zezima *Player)
+		to        string
+		wantSent  []int
+		wantMoved bool
+	}{
+		{
+			name:     "sent",
+			to:       "zezima",
+			wantSent: []int{util.ServerProtMessagePrivate},
+		},
+		{
+			name: "not a friend",
+			setup: func(bob *Player, zezima *Player) {
+				bob.social.friends = nil
+			},
+			to: "zezima",
+		},
+		{
+			name: "offline",
+			to:   "Durial321",
+		},
+		{
+			name: "ignored",
+			setup: func(bob *Player, zezima *Player) {
+				zezima.social.ignores = []string{"Bob"}
+			},
+			to: "zezima",
+		},
+		{
+			name: "muted",
+			setup: func(bob *Player, zezima *Player) {
+				bob.Muted = true
+			},
+			to: "zezima",
+		},
+		{
+			name: "private chat off",
+			setup: func(bob *Player, zezima *Player) {
+				bob.social.modes.Private = ChatModeOff
+			},
+			to:        "zezima",
+			wantSent:  []int{util.ServerProtMessagePrivate},
+			wantMoved: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			bob := addSocialTestPlayer(w, "Bob")
+			zezima := addSocialTestPlayer(w, "Zezima")
+			bob.social.friends = []string{"Zezima", "Durial321"}
+			if tt.setup != nil {
+				tt.setup(bob, zezima)
+			}
+
+			bob.PrivateChat(PrivateMessage{To: tt.to, Text: "hi"}, now)
+
+			if got := sent(zezima); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent to zezima = %v, want %v", got, tt.wantSent)
+			}
+			if got := bob.social.modes.Private == ChatModeFriends; got != tt.wantMoved {
+				t.Errorf("private chat switched to friends = %v, want %v", got, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestWorld_notifyFriends(t *testing.T) {
+	w := newTestWorld()
+	bob := addSocialTestPlayer(w, "Bob")
+	bob.social.friends = []string{"Zezima"}
+	zezima := addSocialTestPlayer(w, "Zezima")
+	zezima.Client.Player = zezima
+
+	zezima.loadSocial()
+	if got, want := sentFriends(bob), map[string]int{"Zezima": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after logging in, bob was sent %v, want %v", got, want)
+	}
+
+	zezima.SetChatModes(ChatModes{Private: ChatModeFriends})
+	if got, want := sentFriends(bob), map[string]int{"Zezima": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after hiding, bob was sent %v, want %v", got, want)
+	}
+
+	zezima.AddFriend("Bob")
+	if got, want := sentFriends(bob), map[string]int{"Zezima": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after adding bob, bob was sent %v, want %v", got, want)
+	}
+
+	w.RemovePlayer(*zezima.Client)
+	if got, want := sentFriends(bob), map[string]int{"Zezima": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after logging out, bob was sent %v, want %v", got, want)
+	}
+}
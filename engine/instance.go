@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/engine/maps"
+)
+
+// Instances are built in slots of instanceSize by instanceSize mapsquares,
+// east of maps.InstanceMapsquareX. The bottom row is left empty, so that the
+// build area around a player in an instance never goes below 0.
+const (
+	instanceSize    = 2
+	instanceZones   = instanceSize * 8
+	instanceColumns = (256 - maps.InstanceMapsquareX) / instanceSize
+	instanceRows    = 256/instanceSize - 1
+	maxInstances    = instanceColumns * instanceRows
+)
+
+// RegionZone is a zone of the static map copied into an instance.
+type RegionZone struct {
+	// X and Z are any tile in the zone.
+	X     int
+	Z     int
+	Plane int
+	// Rotation is how many times the zone is turned clockwise.
+	Rotation int
+}
+
+// Instance is a private copy of parts of the map, such as a boss room or a
+// player's house, built from zones of the static map. It's freed when the
+// last player inside leaves.
+type Instance struct {
+	ID int
+	// X and Z are the south west tile of the instance.
+	X int
+	Z int
+
+	world *World
+	// the zones copied into the instance, by plane and zone
+	zones [4][instanceZones][instanceZones]*RegionZone
+	// the players inside
+	players map[*Player]bool
+}
+
+// NewInstance allocates an empty instance.
+func (w *World) NewInstance() (*Instance, error) {
+	if w.instances == nil {
+		w.instances = make(map[int]*Instance)
+	}
+
+	for id := 0; id < maxInstances; id++ {
+		if _, ok := w.instances[id]; ok {
+			continue
+		}
+
+		in := &Instance{
+			ID:      id,
+			X:       (maps.InstanceMapsquareX + id%instanceColumns*instanceSize) << 6,
+			Z:       (1 + id/instanceColumns*instanceSize) << 6,
+			world:   w,
+			players: make(map[*Player]bool),
+		}
+		in.clear()
+		w.instances[id] = in
+		return in, nil
+	}
+	return nil, errors.New("no free instances")
+}
+
+// freeInstance drops an instance and everything built in it.
+func (w *World) freeInstance(in *Instance) {
+	in.clear()
+	delete(w.instances, in.ID)
+}
+
+// clear drops the collision, locs and zones of the instance's mapsquares.
+func (in *Instance) clear() {
+	for x := 0; x < instanceSize; x++ {
+		for z := 0; z < instanceSize; z++ {
+			in.world.Collision.Clear(in.X+x<<6, in.Z+z<<6)
+			if in.world.Maps != nil {
+				in.world.Maps.ClearLocs(in.X+x<<6, in.Z+z<<6)
+			}
+		}
+	}
+	for id, v := range in.world.zones {
+		if in.Contains(v.X<<3, v.Z<<3) {
+			delete(in.world.zones, id)
+		}
+	}
+}
+
+// CopyZone copies a zone of the static map into the instance, at zoneX,
+// zoneZ zones from its south west corner.
+func (in *Instance) CopyZone(zoneX int, zoneZ int, plane int, zone RegionZone) error {
+	if zoneX < 0 || zoneZ < 0 || zoneX >= instanceZones || zoneZ >= instanceZones || plane < 0 || plane > 3 {
+		return fmt.Errorf("zone %d, %d, %d is outside the instance", zoneX, zoneZ, plane)
+	}
+	zone.Rotation &= 3
+	in.zones[plane][zoneX][zoneZ] = &zone
+
+	if in.world.Maps == nil {
+		return nil
+	}
+	return in.world.Maps.CopyZone(in.X+zoneX<<3, in.Z+zoneZ<<3, plane, zone.X, zone.Z, zone.Plane, zone.Rotation)
+}
+
+// CopyArea copies the width by length zones of the static map from the tile
+// x, z, on every plane and as they are, into the instance's south west
+// corner.
+func (in *Instance) CopyArea(x int, z int, width int, length int) error {
+	var errs []error
+	for plane := 0; plane < 4; plane++ {
+		for zoneX := 0; zoneX < width; zoneX++ {
+			for zoneZ := 0; zoneZ < length; zoneZ++ {
+				zone := RegionZone{X: x + zoneX<<3, Z: z + zoneZ<<3, Plane: plane}
+				if err := in.CopyZone(zoneX, zoneZ, plane, zone); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// zone returns what's copied into the zone at zoneX, zoneZ of the whole
+// map, if it's in the instance.
+func (in *Instance) zone(zoneX int, zoneZ int, plane int) *RegionZone {
+	zoneX -= in.X >> 3
+	zoneZ -= in.Z >> 3
+	if zoneX < 0 || zoneZ < 0 || zoneX >= instanceZones || zoneZ >= instanceZones {
+		return nil
+	}
+	return in.zones[plane][zoneX][zoneZ]
+}
+
+// Contains reports whether the tile x, z is in the instance.
+func (in *Instance) Contains(x int, z int) bool {
+	return x >= in.X && z >= in.Z && x < in.X+instanceZones<<3 && z < in.Z+instanceZones<<3
+}
+
+// Instance returns the instance the player is in, or nil if they're on the
+// static map.
+func (p *Player) Instance() *Instance {
+	return p.instance
+}
+
+// EnterInstance teleports the player to x, z tiles from the south west
+// corner of an instance, on plane.
+func (p *Player) EnterInstance(in *Instance, x int, z int, plane int) {
+	if p.instance != in {
+		p.leaveInstance()
+		p.instance = in
+		in.players[p] = true
+	}
+	p.Teleport(in.X+x, in.Z+z, plane)
+}
+
+// LeaveInstance teleports the player out of their instance to x, z on
+// plane.
+func (p *Player) LeaveInstance(x int, z int, plane int) {
+	p.leaveInstance()
+	p.Teleport(x, z, plane)
+}
+
+// leaveInstance takes the player out of their instance, freeing it if they
+// were the last one inside.
+func (p *Player) leaveInstance() {
+	in := p.instance
+	if in == nil {
+		return
+	}
+	p.instance = nil
+
+	delete(in.players, p)
+	if len(in.players) == 0 {
+		in.world.freeInstance(in)
+	}
+}
@@ -0,0 +1,242 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/maps"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+type sentRegion struct {
+	ZoneX int
+	ZoneZ int
+	// the palette entries sent, by plane and zone within the build area
+	Zones map[[3]int]int
+	Keys  int
+}
+
+// sentRegions returns the REBUILD_REGIONs queued for p, and forgets every
+// packet queued.
+func sentRegions(p *Player) []sentRegion {
+	var regions []sentRegion
+	for _, v := range p.Client.NetOut {
+		buf := packet.NewPacket(v.Data)
+		if buf.G1() != util.ServerProtRebuildRegion {
+			continue
+		}
+		buf.G2() // size
+		region := sentRegion{ZoneX: int(buf.G2Alt1()), ZoneZ: int(buf.G2()), Zones: make(map[[3]int]int)}
+		size := util.BuildArea[buf.G1()] >> 3
+		buf.G1Alt2()
+
+		bits := &bitReader{buf: buf.Bytes()}
+		for plane := 0; plane < 4; plane++ {
+			for x := 0; x < size; x++ {
+				for z := 0; z < size; z++ {
+					if bits.bits(1) == 1 {
+						region.Zones[[3]int{plane, x, z}] = bits.bits(26)
+					}
+				}
+			}
+		}
+		region.Keys = (buf.Len() - (bits.offset+7)/8) / 16
+		regions = append(regions, region)
+	}
+	p.Client.NetOut = nil
+	return regions
+}
+
+func TestWorld_NewInstance(t *testing.T) {
+	w := newTestWorld()
+
+	a, err := w.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := w.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.X != maps.InstanceMapsquareX<<6 || a.Z != 64 {
+		t.Errorf("first instance at %d, %d, want %d, 64", a.X, a.Z, maps.InstanceMapsquareX<<6)
+	}
+	if b.X != a.X+128 || b.Z != a.Z {
+		t.Errorf("second instance at %d, %d, want %d, %d", b.X, b.Z, a.X+128, a.Z)
+	}
+	if a.Contains(b.X, b.Z) || !a.Contains(a.X+127, a.Z+127) || a.Contains(a.X, a.Z-1) {
+		t.Errorf("Contains() overlaps another instance")
+	}
+
+	// the last instance goes in the top right corner, under the top row of
+	// mapsquares, which is left over after the empty bottom row
+	for i := 2; i < maxInstances-1; i++ {
+		if _, err := w.NewInstance(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last, err := w.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.X+127 != 16383 || last.Z+127 != 16319 {
+		t.Errorf("last instance ends at %d, %d, want 16383, 16319", last.X+127, last.Z+127)
+	}
+	if _, err := w.NewInstance(); err == nil {
+		t.Errorf("NewInstance() with none free didn't fail")
+	}
+
+	// a freed instance is reused, without what was built in it
+	w.Collision.AddFloor(a.X+5, a.Z+5, 0)
+	w.freeInstance(a)
+	reused, err := w.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused.X != a.X || reused.Z != a.Z {
+		t.Errorf("NewInstance() at %d, %d, want the freed %d, %d", reused.X, reused.Z, a.X, a.Z)
+	}
+	if got := w.Collision.Flags(a.X+5, a.Z+5, 0); got != 0 {
+		t.Errorf("freed instance still has flags %#x", got)
+	}
+}
+
+func TestInstance_CopyZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		zoneX   int
+		zoneZ   int
+		plane   int
+		wantErr bool
+	}{
+		{name: "corner", zoneX: 0, zoneZ: 0},
+		{name: "opposite corner", zoneX: 15, zoneZ: 15, plane: 3},
+		{name: "west of the instance", zoneX: -1, zoneZ: 0, wantErr: true},
+		{name: "north of the instance", zoneX: 0, zoneZ: 16, wantErr: true},
+		{name: "no such plane", zoneX: 0, zoneZ: 0, plane: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := newTestWorld().NewInstance()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			zone := RegionZone{X: 3200, Z: 3200, Plane: 1, Rotation: 5}
+			err = in.CopyZone(tt.zoneX, tt.zoneZ, tt.plane, zone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CopyZone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := in.zone(in.X>>3+tt.zoneX, in.Z>>3+tt.zoneZ, tt.plane)
+			if want := (RegionZone{X: 3200, Z: 3200, Plane: 1, Rotation: 1}); got == nil || *got != want {
+				t.Errorf("zone() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPlayer_EnterInstance(t *testing.T) {
+	p := newBuildAreaTestPlayer(3200, 3200)
+	in, err := p.World.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := in.CopyArea(3200, 3200, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.CopyZone(2, 0, 0, RegionZone{X: 2900, Z: 3300, Rotation: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	p.EnterInstance(in, 4, 4, 0)
+	p.Tick()
+	if p.Instance() != in || p.Pos.X != in.X+4 || p.Pos.Z != in.Z+4 || p.MoveType != MoveTeleport {
+		t.Fatalf("player at %v, MoveType %v, after EnterInstance()", p.Pos.ToString(), p.MoveType)
+	}
+
+	regions := sentRegions(p)
+	if len(regions) != 1 {
+		t.Fatalf("sent %v, want one REBUILD_REGION", regions)
+	}
+	region := regions[0]
+	if region.ZoneX != in.X>>3 || region.ZoneZ != in.Z>>3 {
+		t.Errorf("sent zone %d, %d, want %d, %d", region.ZoneX, region.ZoneZ, in.X>>3, in.Z>>3)
+	}
+	// the player's zone is in the middle of the 13x13 zone build area
+	want := map[[3]int]int{
+		{0, 6, 6}: 0<<24 | 400<<14 | 400<<3,
+		{1, 6, 6}: 1<<24 | 400<<14 | 400<<3,
+		{2, 6, 6}: 2<<24 | 400<<14 | 400<<3,
+		{3, 6, 6}: 3<<24 | 400<<14 | 400<<3,
+		{0, 7, 6}: 0<<24 | 401<<14 | 400<<3,
+		{1, 7, 6}: 1<<24 | 401<<14 | 400<<3,
+		{2, 7, 6}: 2<<24 | 401<<14 | 400<<3,
+		{3, 7, 6}: 3<<24 | 401<<14 | 400<<3,
+		{0, 8, 6}: 0<<24 | 362<<14 | 412<<3 | 3<<1,
+	}
+	if len(region.Zones) != len(want) {
+		t.Errorf("sent %d zones, want %d", len(region.Zones), len(want))
+	}
+	for k, v := range want {
+		if got := region.Zones[k]; got != v {
+			t.Errorf("zone %v = %#x, want %#x", k, got, v)
+		}
+	}
+	// one key for each mapsquare copied from
+	if region.Keys != 2 {
+		t.Errorf("sent %d keys, want 2", region.Keys)
+	}
+
+	// walking around the instance doesn't rebuild it
+	p.Teleport(in.X+8, in.Z+8, 1)
+	p.Tick()
+	if got := sent(p); len(got) != 0 {
+		t.Errorf("sent %v moving in the instance", got)
+	}
+
+	p.LeaveInstance(3200, 3200, 0)
+	p.Tick()
+	if got := sentRebuilds(p); len(got) != 1 || got[0].ZoneX != 400 || got[0].ZoneZ != 400 {
+		t.Errorf("sent %v leaving the instance, want a REBUILD_NORMAL", got)
+	}
+	if p.Instance() != nil || len(p.World.instances) != 0 {
+		t.Errorf("instance wasn't freed when the last player left")
+	}
+}
+
+func TestPlayer_leaveInstance(t *testing.T) {
+	w := newTestWorld()
+	a := addSocialTestPlayer(w, "a")
+	b := addSocialTestPlayer(w, "b")
+	in, err := w.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.CopyArea(3200, 3200, 1, 1)
+	w.Collision.Add(in.X, in.Z, 0, collision.Loc)
+
+	a.EnterInstance(in, 1, 1, 0)
+	b.EnterInstance(in, 2, 2, 0)
+
+	// entering again doesn't count twice
+	a.EnterInstance(in, 3, 3, 0)
+	a.LeaveInstance(3200, 3200, 0)
+	if _, ok := w.instances[in.ID]; !ok {
+		t.Fatalf("instance freed with a player still inside")
+	}
+
+	b.Client.Player = b
+	w.RemovePlayer(*b.Client)
+	if _, ok := w.instances[in.ID]; ok {
+		t.Errorf("instance not freed when the last player logged out")
+	}
+	if got := w.Collision.Flags(in.X, in.Z, 0); got != 0 {
+		t.Errorf("freed instance still has flags %#x", got)
+	}
+}
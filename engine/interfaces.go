@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// the game frames, the top level interfaces everything else is opened in
+const (
+	FrameFixed     = 548
+	FrameResizable = 746
+)
+
+// SubFlagsFrame are the flags the game frame's own subs are opened with.
+// TODO: work out what the bits mean
+const SubFlagsFrame = 3
+
+// FrameSlot is a component of the game frame. The same slot is a different
+// component in the fixed and resizable frames.
+type FrameSlot int
+
+const (
+	SlotChatOptions FrameSlot = iota
+	SlotChatBox
+	// SlotMain is where modal interfaces, like the bank, are opened.
+	SlotMain
+	// SlotTab0 is the first of the side tabs, see SlotTab.
+	SlotTab0
+)
+
+// tabCount is how many side tabs the frame has.
+const tabCount = 17
+
+// SlotTab returns the slot of side tab tab.
+func SlotTab(tab int) FrameSlot {
+	return SlotTab0 + FrameSlot(tab)
+}
+
+// frameComponent returns the component of frame that slot is.
+// TODO: confirm SlotMain
+func frameComponent(frame int, slot FrameSlot) int {
+	resizable := frame == FrameResizable
+	switch {
+	case slot >= SlotTab0:
+		if resizable {
+			return 33 + int(slot-SlotTab0)
+		}
+		return 152 + int(slot-SlotTab0)
+	case slot == SlotChatOptions:
+		if resizable {
+			return 15
+		}
+		return 20
+	case slot == SlotChatBox:
+		if resizable {
+			return 18
+		}
+		return 142
+	default:
+		if resizable {
+			return 6
+		}
+		return 11
+	}
+}
+
+// frameSlot returns the slot component is in frame, if it's one.
+func frameSlot(frame int, component int) (FrameSlot, bool) {
+	for slot := SlotChatOptions; slot < SlotTab0+tabCount; slot++ {
+		if frameComponent(frame, slot) == component {
+			return slot, true
+		}
+	}
+	return 0, false
+}
+
+// ComponentHash packs an interface and one of its components into one int,
+// the way the client refers to components.
+func ComponentHash(iface int, component int) int {
+	return iface<<16 | component
+}
+
+// openSub is an interface opened in a component of another.
+type openSub struct {
+	ID    int
+	Flags int
+}
+
+// ifEvents is a range of a component's subcomponents that have had their
+// events set.
+type ifEvents struct {
+	From, To int
+	Mask     int
+}
+
+// interfaces is what the player has open.
+type interfaces struct {
+	// top is the top level interface, or -1.
+	top int
+	// subs holds the interfaces opened in components, by ComponentHash of
+	// the component.
+	subs map[int]openSub
+	// events holds the events set on components, by ComponentHash.
+	events map[int][]ifEvents
+}
+
+func newInterfaces() interfaces {
+	return interfaces{
+		top:    -1,
+		subs:   make(map[int]openSub),
+		events: make(map[int][]ifEvents),
+	}
+}
+
+// Frame returns the game frame for the player's window mode.
+func (p *Player) Frame() int {
+	if p.IsClientResizable() {
+		return FrameResizable
+	}
+	return FrameFixed
+}
+
+// TopInterface returns the open top level interface, or -1.
+func (p *Player) TopInterface() int {
+	return p.ifs.top
+}
+
+// OpenedSub returns the interface open in a component, if there is one.
+func (p *Player) OpenedSub(parent int, component int) (int, bool) {
+	sub, ok := p.ifs.subs[ComponentHash(parent, component)]
+	return sub.ID, ok
+}
+
+// IsInterfaceOpen reports whether iface is open anywhere.
+func (p *Player) IsInterfaceOpen(iface int) bool {
+	if p.ifs.top == iface {
+		return true
+	}
+	for _, sub := range p.ifs.subs {
+		if sub.ID == iface {
+			return true
+		}
+	}
+	return false
+}
+
+// nextVerifyID returns the verify id for the next IF_* packet, which the
+// client checks them against.
+func (p *Player) nextVerifyID() uint16 {
+	id := p.VerifyID
+	p.VerifyID++
+	return uint16(id)
+}
+
+func (p *Player) queueIf(name string, response *packet.Packet) {
+	respBytes := response.Bytes()
+	util.DebugfBytes(&p.Client.Server.Logger, name+" queue", respBytes)
+	p.Client.Queue(respBytes, true)
+}
+
+// OpenTop opens iface as the top level interface, closing the old one and
+// everything in it.
+func (p *Player) OpenTop(iface int) {
+	if p.ifs.top != -1 && p.ifs.top != iface {
+		p.forgetInterface(p.ifs.top)
+	}
+	p.sendOpenTop(iface)
+}
+
+func (p *Player) sendOpenTop(iface int) {
+	p.ifs.top = iface
+
+	var response packet.Packet
+	response.P1(util.ServerProtIfOpenTop)
+	response.P1(0)
+	response.IP2(uint16(iface))
+	response.IP2(p.nextVerifyID())
+	p.queueIf("OpenTop()", &response)
+}
+
+// OpenSub opens iface in a component of parent, replacing whatever was
+// open there.
+func (p *Player) OpenSub(parent int, component int, iface int, flags int) {
+	hash := ComponentHash(parent, component)
+	if old, ok := p.ifs.subs[hash]; ok && old.ID != iface {
+		p.forgetInterface(old.ID)
+	}
+	p.ifs.subs[hash] = openSub{ID: iface, Flags: flags}
+
+	var response packet.Packet
+	response.P1(util.ServerProtIfOpenSub)
+	response.P2Alt2(p.nextVerifyID())
+	response.P1Alt3(uint8(flags))
+	response.P2Alt1(uint16(component))
+	response.P2Alt1(uint16(parent))
+	response.P2(uint16(iface))
+	p.queueIf("OpenSub()", &response)
+}
+
+// OpenFrameSub opens iface in a slot of the game frame.
+func (p *Player) OpenFrameSub(slot FrameSlot, iface int, flags int) {
+	frame := p.Frame()
+	p.OpenSub(frame, frameComponent(frame, slot), iface, flags)
+}
+
+// CloseSub closes whatever is open in a component of parent.
+func (p *Player) CloseSub(parent int, component int) {
+	hash := ComponentHash(parent, component)
+	sub, ok := p.ifs.subs[hash]
+	if !ok {
+		return
+	}
+	delete(p.ifs.subs, hash)
+	p.forgetInterface(sub.ID)
+
+	var response packet.Packet
+	response.P1(util.ServerProtIfCloseSub)
+	response.P4(uint32(hash))
+	response.P2(p.nextVerifyID())
+	p.queueIf("CloseSub()", &response)
+}
+
+// CloseFrameSub closes whatever is open in a slot of the game frame.
+func (p *Player) CloseFrameSub(slot FrameSlot) {
+	frame := p.Frame()
+	p.CloseSub(frame, frameComponent(frame, slot))
+}
+
+// MoveSub moves the interface open in one component to another, keeping
+// its state.
+func (p *Player) MoveSub(fromParent int, fromComponent int, toParent int, toComponent int) {
+	from := ComponentHash(fromParent, fromComponent)
+	to := ComponentHash(toParent, toComponent)
+	sub, ok := p.ifs.subs[from]
+	if !ok {
+		return
+	}
+	delete(p.ifs.subs, from)
+	if old, ok := p.ifs.subs[to]; ok {
+		p.forgetInterface(old.ID)
+	}
+	p.ifs.subs[to] = sub
+
+	var response packet.Packet
+	response.P1(util.ServerProtIfMoveSub)
+	response.P4(uint32(from))
+	response.P4(uint32(to))
+	response.P2(p.nextVerifyID())
+	p.queueIf("MoveSub()", &response)
+}
+
+// forgetInterface forgets what was open in and set on iface, which the
+// client has closed.
+func (p *Player) forgetInterface(iface int) {
+	for hash, sub := range p.ifs.subs {
+		if hash>>16 == iface {
+			delete(p.ifs.subs, hash)
+			p.forgetInterface(sub.ID)
+		}
+	}
+	for hash := range p.ifs.events {
+		if hash>>16 == iface {
+			delete(p.ifs.events, hash)
+		}
+	}
+}
+
+// SetWindowMode changes the player's window mode, moving everything to the
+// other game frame if it changes between fixed and resizable.
+func (p *Player) SetWindowMode(mode uint8) {
+	oldFrame := p.Frame()
+	p.WindowMode = mode
+	newFrame := p.Frame()
+	if oldFrame == newFrame || p.ifs.top != oldFrame {
+		return
+	}
+
+	// the client keeps the subs of the old frame open until they're moved
+	// to the new one, but its events go with it
+	events := make(map[FrameSlot][]ifEvents)
+	for hash, set := range p.ifs.events {
+		if hash>>16 != oldFrame {
+			continue
+		}
+		if slot, ok := frameSlot(oldFrame, hash&0xffff); ok {
+			events[slot] = set
+		}
+		delete(p.ifs.events, hash)
+	}
+
+	p.sendOpenTop(newFrame)
+	for slot := SlotChatOptions; slot < SlotTab0+tabCount; slot++ {
+		p.MoveSub(oldFrame, frameComponent(oldFrame, slot), newFrame, frameComponent(newFrame, slot))
+		for _, set := range events[slot] {
+			p.IfSetEvents(newFrame, frameComponent(newFrame, slot), set.From, set.To, set.Mask)
+		}
+	}
+
+	// anything else on the old frame is gone
+	for hash, sub := range p.ifs.subs {
+		if hash>>16 == oldFrame {
+			delete(p.ifs.subs, hash)
+			p.forgetInterface(sub.ID)
+		}
+	}
+}
+
+// IfSetText sets the text of a component.
+func (p *Player) IfSetText(iface int, component int, text string) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetText)
+	response.P2(0)
+	start := response.Len() // offset
+
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.PJStr(text)
+	response.P2(p.nextVerifyID())
+
+	response.PSize2(response.Len() - start)
+	p.queueIf("IfSetText()", &response)
+}
+
+// IfSetHide shows or hides a component.
+func (p *Player) IfSetHide(iface int, component int, hidden bool) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetHide)
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.P1(uint8(boolBit(hidden)))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetHide()", &response)
+}
+
+// IfSetModel shows a model in a component.
+func (p *Player) IfSetModel(iface int, component int, model int) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetModel)
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.P2(uint16(model))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetModel()", &response)
+}
+
+// IfSetAnim plays seq on the model in a component. -1 stops it.
+func (p *Player) IfSetAnim(iface int, component int, seq int) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetAnim)
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.P2(uint16(seq))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetAnim()", &response)
+}
+
+// IfSetObject shows count of obj in a component.
+func (p *Player) IfSetObject(iface int, component int, obj int, count int) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetObject)
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.P2(uint16(obj))
+	response.P4(uint32(count))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetObject()", &response)
+}
+
+// IfSetPosition moves a component to x, y within its parent.
+func (p *Player) IfSetPosition(iface int, component int, x int, y int) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetPosition)
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.P2(uint16(x))
+	response.P2(uint16(y))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetPosition()", &response)
+}
+
+// IfSetColour sets the colour of a component, as RGB with 5 bits each.
+func (p *Player) IfSetColour(iface int, component int, colour int) {
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetColour)
+	response.P4(uint32(ComponentHash(iface, component)))
+	response.P2(uint16(colour))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetColour()", &response)
+}
+
+// IfSetEvents sets which events, such as which ops can be clicked, the
+// subcomponents from to to of a component send. The events of a whole
+// component are set with -1 for both.
+func (p *Player) IfSetEvents(iface int, component int, from int, to int, mask int) {
+	hash := ComponentHash(iface, component)
+	set := p.ifs.events[hash]
+	for i := range set {
+		if set[i].From == from && set[i].To == to {
+			set = append(set[:i], set[i+1:]...)
+			break
+		}
+	}
+	p.ifs.events[hash] = append(set, ifEvents{From: from, To: to, Mask: mask})
+
+	var response packet.Packet
+	response.P1(util.ServerProtIfSetEvents)
+	response.P4(uint32(hash))
+	response.P2(uint16(from))
+	response.P2(uint16(to))
+	response.P4(uint32(mask))
+	response.P2(p.nextVerifyID())
+	p.queueIf("IfSetEvents()", &response)
+}
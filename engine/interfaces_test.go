@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// newConnectedTestPlayer returns a player with a client that keeps what's
+// queued for it.
+func newConnectedTestPlayer(windowMode uint8) *Player {
+	p := NewPlayer(&Client{Server: &Server{Logger: *util.NewLogger()}})
+	p.WindowMode = windowMode
+	return p
+}
+
+// sent returns the opcodes of the packets queued for p, and forgets them.
+func sent(p *Player) []int {
+	var opcodes []int
+	for _, v := range p.Client.NetOut {
+		opcodes = append(opcodes, int(v.Data[0]))
+	}
+	p.Client.NetOut = nil
+	return opcodes
+}
+
+func TestPlayer_OpenSub(t *testing.T) {
+	p := newConnectedTestPlayer(1)
+	p.OpenTop(p.Frame())
+	p.OpenTab(3, 149)
+	p.OpenFrameSub(SlotMain, 600, 0)
+	p.OpenSub(600, 2, 601, 1)
+	p.IfSetEvents(601, 1, 0, 27, 0x1e)
+
+	if got := sent(p); !reflect.DeepEqual(got, []int{
+		util.ServerProtIfOpenTop, util.ServerProtIfOpenSub, util.ServerProtIfOpenSub,
+		util.ServerProtIfOpenSub, util.ServerProtIfSetEvents,
+	}) {
+		t.Errorf("sent %v", got)
+	}
+	if id, ok := p.OpenedSub(FrameFixed, 155); !ok || id != 149 {
+		t.Errorf("OpenedSub(tab 3) = %v, %v, want 149", id, ok)
+	}
+
+	// replacing the main interface closes the one inside it
+	p.OpenFrameSub(SlotMain, 700, 0)
+	if p.IsInterfaceOpen(600) || p.IsInterfaceOpen(601) || !p.IsInterfaceOpen(700) {
+		t.Errorf("main interface not replaced: %+v", p.ifs.subs)
+	}
+	if len(p.ifs.events) != 0 {
+		t.Errorf("events of a closed interface kept: %+v", p.ifs.events)
+	}
+
+	sent(p)
+	p.CloseFrameSub(SlotMain)
+	p.CloseFrameSub(SlotMain)
+	if got := sent(p); !reflect.DeepEqual(got, []int{util.ServerProtIfCloseSub}) {
+		t.Errorf("CloseFrameSub() twice sent %v, want one close", got)
+	}
+	if p.IsInterfaceOpen(700) {
+		t.Errorf("IsInterfaceOpen() after closing = true")
+	}
+}
+
+func TestPlayer_OpenSub_Unconfirmed(t *testing.T) {
+	SendUnconfirmed = false
+	t.Cleanup(func() { SendUnconfirmed = true })
+
+	p := newConnectedTestPlayer(1)
+	p.OpenSub(600, 2, 601, 1)
+	p.IfSetEvents(601, 1, 0, 27, 0x1e)
+
+	// the events are still tracked, only the packet is left out
+	if got := sent(p); !reflect.DeepEqual(got, []int{util.ServerProtIfOpenSub}) {
+		t.Errorf("sent %v, want only IF_OPENSUB", got)
+	}
+	if len(p.ifs.events) != 1 {
+		t.Errorf("events = %+v, want one", p.ifs.events)
+	}
+}
+
+func TestPlayer_SetWindowMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  uint8
+		wantFrame int
+		wantSent  []int
+	}{
+		{
+			name: "fixed to resizable",
+			from: 1, to: 2,
+			wantFrame: FrameResizable,
+			wantSent: []int{
+				util.ServerProtIfOpenTop,
+				util.ServerProtIfMoveSub, util.ServerProtIfMoveSub, util.ServerProtIfMoveSub,
+				util.ServerProtIfSetEvents,
+			},
+		},
+		{
+			name: "resizable to fixed",
+			from: 2, to: 1,
+			wantFrame: FrameFixed,
+			wantSent: []int{
+				util.ServerProtIfOpenTop,
+				util.ServerProtIfMoveSub, util.ServerProtIfMoveSub, util.ServerProtIfMoveSub,
+				util.ServerProtIfSetEvents,
+			},
+		},
+		{
+			name: "resizable to fullscreen",
+			from: 2, to: 3,
+			wantFrame: FrameResizable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newConnectedTestPlayer(tt.from)
+			oldFrame := p.Frame()
+			p.OpenTop(oldFrame)
+			p.OpenFrameSub(SlotChatBox, 752, SubFlagsFrame)
+			p.OpenFrameSub(SlotTab(3), 149, SubFlagsFrame)
+			p.OpenFrameSub(SlotMain, 600, 0)
+			p.OpenSub(600, 2, 601, 1)
+			p.IfSetEvents(oldFrame, frameComponent(oldFrame, SlotTab(3)), -1, -1, 2)
+			sent(p)
+
+			p.SetWindowMode(tt.to)
+
+			if got := sent(p); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent %v, want %v", got, tt.wantSent)
+			}
+			if p.TopInterface() != tt.wantFrame {
+				t.Errorf("TopInterface() = %v, want %v", p.TopInterface(), tt.wantFrame)
+			}
+			for slot, want := range map[FrameSlot]int{SlotChatBox: 752, SlotTab(3): 149, SlotMain: 600} {
+				if id, ok := p.OpenedSub(tt.wantFrame, frameComponent(tt.wantFrame, slot)); !ok || id != want {
+					t.Errorf("slot %v has %v, %v, want %v", slot, id, ok, want)
+				}
+			}
+			if id, ok := p.OpenedSub(600, 2); !ok || id != 601 {
+				t.Errorf("interface inside the main one lost")
+			}
+			if len(p.ifs.subs) != 4 {
+				t.Errorf("subs = %+v, want 4", p.ifs.subs)
+			}
+			wantEvents := map[int][]ifEvents{
+				ComponentHash(tt.wantFrame, frameComponent(tt.wantFrame, SlotTab(3))): {{From: -1, To: -1, Mask: 2}},
+			}
+			if !reflect.DeepEqual(p.ifs.events, wantEvents) {
+				t.Errorf("events = %+v, want %+v", p.ifs.events, wantEvents)
+			}
+		})
+	}
+}
+
+func TestPlayer_IfSetText(t *testing.T) {
+	p := newConnectedTestPlayer(1)
+	p.VerifyID = 7
+	p.IfSetText(320, 4, "Hello")
+
+	buf := packet.NewPacket(p.Client.NetOut[0].Data)
+	if opcode := buf.G1(); opcode != util.ServerProtIfSetText {
+		t.Errorf("opcode = %v", opcode)
+	}
+	if size := int(buf.G2()); size != buf.Len() {
+		t.Errorf("size = %v, want %v", size, buf.Len())
+	}
+	if hash := buf.G4(); hash != 320<<16|4 {
+		t.Errorf("component = %x", hash)
+	}
+	if text := buf.GJStr(); text != "Hello" {
+		t.Errorf("text = %v", text)
+	}
+	if verify := buf.G2(); verify != 7 || p.VerifyID != 8 {
+		t.Errorf("verify id = %v, next %v", verify, p.VerifyID)
+	}
+}
+
+func Test_frameSlot(t *testing.T) {
+	for _, frame := range []int{FrameFixed, FrameResizable} {
+		for slot := SlotChatOptions; slot < SlotTab0+tabCount; slot++ {
+			if got, ok := frameSlot(frame, frameComponent(frame, slot)); !ok || got != slot {
+				t.Errorf("frameSlot(%v, frameComponent(%v)) = %v, %v", frame, slot, got, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package maps loads the collision flags of the world from the terrain and
+// loc files in the cache's maps archive.
+package maps
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// Tile settings read from a terrain file.
+const (
+	// TileBlocked is set on tiles that can't be walked on, such as water.
+	TileBlocked = 0x1
+	// TileBridge is set on plane 1 of tiles under a bridge: everything on
+	// the tile is really a plane lower, so the bridge can be walked on from
+	// plane 0.
+	TileBridge = 0x2
+)
+
+// Terrain is the tile settings of a mapsquare, by plane, x and z.
+type Terrain [4][64][64]uint8
+
+// plane returns the plane collision for something on the tile x, z is
+// flagged on, which is lowered under bridges. It's -1 for the plane below
+// plane 0.
+func (t *Terrain) plane(x int, z int, plane int) int {
+	if t[1][x][z]&TileBridge != 0 {
+		return plane - 1
+	}
+	return plane
+}
+
+// DecodeTerrain decodes a terrain (m) file. Only the tile settings are kept;
+// heights, underlays and overlays are for the client to draw.
+func DecodeTerrain(data []byte) (terrain *Terrain, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			terrain = nil
+			err = fmt.Errorf("terrain is truncated: %v", r)
+		}
+	}()
+
+	terrain = new(Terrain)
+	buf := packet.NewPacket(data)
+	for plane := 0; plane < 4; plane++ {
+		for x := 0; x < 64; x++ {
+			for z := 0; z < 64; z++ {
+				for {
+					opcode := buf.G1()
+					if opcode == 0 {
+						// the height is worked out from the tiles around it
+						break
+					} else if opcode == 1 {
+						buf.G1() // height
+						break
+					} else if opcode <= 49 {
+						buf.G1() // overlay, with its shape and rotation in opcode
+					} else if opcode <= 81 {
+						terrain[plane][x][z] = opcode - 49
+					}
+					// anything higher is the underlay
+				}
+			}
+		}
+	}
+	return terrain, nil
+}
+
+// Loc is a loc placed by a loc (l) file, on a tile in its mapsquare.
+type Loc struct {
+	ID       int
+	X        int
+	Z        int
+	Plane    int
+	Shape    int
+	Rotation int
+}
+
+// DecodeLocs decodes a decrypted loc (l) file. The locs are grouped by id,
+// each with the positions of its copies, with both the ids and the positions
+// stored as the difference from the last.
+func DecodeLocs(data []byte) (locs []Loc, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			locs = nil
+			err = fmt.Errorf("locs are truncated: %v", r)
+		}
+	}()
+
+	buf := packet.NewPacket(data)
+	id := -1
+	for {
+		idOffset := int(buf.GSmart())
+		if idOffset == 0 {
+			break
+		}
+		id += idOffset
+
+		pos := 0
+		for {
+			posOffset := int(buf.GSmart())
+			if posOffset == 0 {
+				break
+			}
+			pos += posOffset - 1
+
+			info := int(buf.G1())
+			locs = append(locs, Loc{
+				ID:       id,
+				X:        pos >> 6 & 0x3f,
+				Z:        pos & 0x3f,
+				Plane:    pos >> 12,
+				Shape:    info >> 2,
+				Rotation: info & 0x3,
+			})
+		}
+	}
+	return locs, nil
+}
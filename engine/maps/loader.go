@@ -0,0 +1,338 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+// ArchiveMaps is the cache archive holding the terrain and loc files, named
+// m<x>_<z> and l<x>_<z> after their mapsquare.
+const ArchiveMaps = 5
+
+// LoadRadius is how far from a player mapsquares are loaded, enough to cover
+// the 104x104 tile build area the client has loaded around them.
+const LoadRadius = 52
+
+// loc shapes, by how they're flagged
+const (
+	shapeWallMax          = 3
+	shapeWallDiagonal     = 9
+	shapeNormalLocMin     = 10
+	shapeNormalLocMax     = 21
+	shapeGroundDecoration = 22
+)
+
+// the world is 256 mapsquares wide and high
+const mapsquareCount = 256
+
+// InstanceMapsquareX is the first column of mapsquares kept for instances.
+// Nothing in the cache is this far east, so they're never loaded; their
+// collision is built from copies of zones elsewhere, by CopyZone.
+const InstanceMapsquareX = 128
+
+// Source is where map files are read from, normally a *cache.Cache.
+type Source interface {
+	GroupID(archive int, name string) (int, bool, error)
+	Read(archive int, group int, key []int32) ([]byte, error)
+}
+
+// LocTypes gives the definitions of locs, normally a *config.LocTypes.
+type LocTypes interface {
+	Get(id int) (*config.LocType, error)
+}
+
+// Loader flags mapsquares on a collision map the first time something comes
+// near them.
+type Loader struct {
+	Source    Source
+	LocTypes  LocTypes
+	Collision *collision.Map
+
+	// Key returns the XTEA key of a mapsquare's loc file.
+	Key func(mapsquareX int, mapsquareZ int) ([]int32, bool)
+
+	mu     sync.Mutex
+	loaded map[int]bool
+	// the locs placed by loc files and copied zones, by zone
+	locs map[int][]Loc
+}
+
+func NewLoader(source Source, locTypes LocTypes, collision *collision.Map) *Loader {
+	return &Loader{
+		Source:    source,
+		LocTypes:  locTypes,
+		Collision: collision,
+		Key: func(mapsquareX int, mapsquareZ int) ([]int32, bool) {
+			xtea, ok := util.GetXTEA(mapsquareX, mapsquareZ)
+			return xtea.Key, ok
+		},
+		loaded: make(map[int]bool),
+		locs:   make(map[int][]Loc),
+	}
+}
+
+// LoadAround loads every mapsquare within LoadRadius tiles of x, z that
+// isn't loaded yet.
+func (l *Loader) LoadAround(x int, z int) error {
+	var errs []error
+	for mapsquareX := (x - LoadRadius) >> 6; mapsquareX <= (x+LoadRadius)>>6; mapsquareX++ {
+		for mapsquareZ := (z - LoadRadius) >> 6; mapsquareZ <= (z+LoadRadius)>>6; mapsquareZ++ {
+			if err := l.Load(mapsquareX, mapsquareZ); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Loaded reports whether a mapsquare has been loaded.
+func (l *Loader) Loaded(mapsquareX int, mapsquareZ int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.loaded[mapsquareX<<8|mapsquareZ]
+}
+
+// Load flags a mapsquare's terrain and locs, unless it's been loaded
+// already. A mapsquare that fails to load isn't tried again, so an error
+// is only reported once.
+func (l *Loader) Load(mapsquareX int, mapsquareZ int) error {
+	if mapsquareX < 0 || mapsquareZ < 0 || mapsquareX >= InstanceMapsquareX || mapsquareZ >= mapsquareCount {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := mapsquareX<<8 | mapsquareZ
+	if l.loaded[id] {
+		return nil
+	}
+	l.loaded[id] = true
+
+	baseX := mapsquareX << 6
+	baseZ := mapsquareZ << 6
+	l.Collision.Clear(baseX, baseZ)
+
+	terrain, locs, err := l.read(mapsquareX, mapsquareZ)
+	if terrain == nil {
+		return err
+	}
+	l.flagTerrain(baseX, baseZ, terrain)
+	if err != nil {
+		return err
+	}
+	return l.flagLocs(baseX, baseZ, terrain, locs)
+}
+
+// read reads a mapsquare's terrain and locs. The terrain is nil if the
+// mapsquare has no files, and is returned without locs if only they can't
+// be read.
+func (l *Loader) read(mapsquareX int, mapsquareZ int) (*Terrain, []Loc, error) {
+	group, ok, err := l.Source.GroupID(ArchiveMaps, fmt.Sprintf("m%d_%d", mapsquareX, mapsquareZ))
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapsquare %d, %d: %w", mapsquareX, mapsquareZ, err)
+	}
+	if !ok {
+		// most of the world is empty ocean with no files at all
+		return nil, nil, nil
+	}
+	data, err := l.Source.Read(ArchiveMaps, group, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapsquare %d, %d terrain: %w", mapsquareX, mapsquareZ, err)
+	}
+	terrain, err := DecodeTerrain(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapsquare %d, %d: %w", mapsquareX, mapsquareZ, err)
+	}
+
+	group, ok, err = l.Source.GroupID(ArchiveMaps, fmt.Sprintf("l%d_%d", mapsquareX, mapsquareZ))
+	if err != nil || !ok {
+		return terrain, nil, err
+	}
+	key, ok := l.Key(mapsquareX, mapsquareZ)
+	if !ok {
+		return terrain, nil, fmt.Errorf("mapsquare %d, %d: no loc key", mapsquareX, mapsquareZ)
+	}
+	data, err = l.Source.Read(ArchiveMaps, group, key)
+	if err != nil {
+		return terrain, nil, fmt.Errorf("mapsquare %d, %d locs: %w", mapsquareX, mapsquareZ, err)
+	}
+	locs, err := DecodeLocs(data)
+	if err != nil {
+		return terrain, nil, fmt.Errorf("mapsquare %d, %d: %w", mapsquareX, mapsquareZ, err)
+	}
+	return terrain, locs, nil
+}
+
+func (l *Loader) flagTerrain(baseX int, baseZ int, terrain *Terrain) {
+	for plane := 0; plane < 4; plane++ {
+		for x := 0; x < 64; x++ {
+			for z := 0; z < 64; z++ {
+				if terrain[plane][x][z]&TileBlocked == 0 {
+					continue
+				}
+				if p := terrain.plane(x, z, plane); p >= 0 {
+					l.Collision.AddFloor(baseX+x, baseZ+z, p)
+				}
+			}
+		}
+	}
+}
+
+func (l *Loader) flagLocs(baseX int, baseZ int, terrain *Terrain, locs []Loc) error {
+	var errs []error
+	for _, v := range locs {
+		l.placeLoc(Loc{ID: v.ID, X: baseX + v.X, Z: baseZ + v.Z, Plane: v.Plane, Shape: v.Shape, Rotation: v.Rotation})
+
+		plane := terrain.plane(v.X, v.Z, v.Plane)
+		if plane < 0 {
+			continue
+		}
+
+		locType, err := l.LocTypes.Get(v.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		AddLoc(l.Collision, locType, baseX+v.X, baseZ+v.Z, plane, v.Shape, v.Rotation)
+	}
+	return errors.Join(errs...)
+}
+
+// zoneID returns the ID of the zone containing the tile x, z.
+func zoneID(x int, z int) int {
+	return (x>>3)<<11 | z>>3
+}
+
+// placeLoc remembers a loc placed by the map, with its position in the
+// world. l.mu must be held.
+func (l *Loader) placeLoc(loc Loc) {
+	if l.locs == nil {
+		l.locs = make(map[int][]Loc)
+	}
+	id := zoneID(loc.X, loc.Z)
+	l.locs[id] = append(l.locs[id], loc)
+}
+
+// PlaceLoc adds a loc to the static map, flagging it as if a loc file had
+// placed it there. Its mapsquare is loaded first, so that loading it later
+// doesn't clear the loc's flags.
+func (l *Loader) PlaceLoc(loc Loc) error {
+	if err := l.Load(loc.X>>6, loc.Z>>6); err != nil {
+		return err
+	}
+	locType, err := l.LocTypes.Get(loc.ID)
+	if err != nil {
+		return err
+	}
+	AddLoc(l.Collision, locType, loc.X, loc.Z, loc.Plane, loc.Shape, loc.Rotation)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.placeLoc(loc)
+	return nil
+}
+
+// Locs returns the locs the map places on the tile x, z on plane, which is
+// the level they're drawn on, before any are added or removed in game.
+func (l *Loader) Locs(x int, z int, plane int) []Loc {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var locs []Loc
+	for _, v := range l.locs[zoneID(x, z)] {
+		if v.X == x && v.Z == z && v.Plane == plane {
+			locs = append(locs, v)
+		}
+	}
+	return locs
+}
+
+// ClearLocs forgets the locs placed in the mapsquare containing the tile x,
+// z, such as when an instance is freed.
+func (l *Loader) ClearLocs(x int, z int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for zoneX := x &^ 63; zoneX < x&^63+64; zoneX += 8 {
+		for zoneZ := z &^ 63; zoneZ < z&^63+64; zoneZ += 8 {
+			delete(l.locs, zoneID(zoneX, zoneZ))
+		}
+	}
+}
+
+// Loc layers. A tile has at most one loc on each, so adding another
+// replaces it.
+const (
+	LayerWall             = 0
+	LayerWallDecoration   = 1
+	LayerGround           = 2
+	LayerGroundDecoration = 3
+)
+
+// LocLayer returns the layer locs of a shape go on.
+func LocLayer(shape int) int {
+	switch {
+	case shape <= shapeWallMax:
+		return LayerWall
+	case shape < shapeWallDiagonal:
+		return LayerWallDecoration
+	case shape < shapeGroundDecoration:
+		return LayerGround
+	}
+	return LayerGroundDecoration
+}
+
+// AddLoc flags a loc of the given type, shape and rotation on the collision
+// map, the same way the client does.
+func AddLoc(m *collision.Map, locType *config.LocType, x int, z int, plane int, shape int, rotation int) {
+	changeLoc(m, locType, x, z, plane, shape, rotation, true)
+}
+
+// RemoveLoc clears the flags AddLoc set for the same loc.
+func RemoveLoc(m *collision.Map, locType *config.LocType, x int, z int, plane int, shape int, rotation int) {
+	changeLoc(m, locType, x, z, plane, shape, rotation, false)
+}
+
+func changeLoc(m *collision.Map, locType *config.LocType, x int, z int, plane int, shape int, rotation int, add bool) {
+	if locType.BlockWalk == 0 {
+		return
+	}
+
+	switch {
+	case shape <= shapeWallMax:
+		if add {
+			m.AddWall(x, z, plane, shape, rotation, locType.BlockRange)
+		} else {
+			m.RemoveWall(x, z, plane, shape, rotation, locType.BlockRange)
+		}
+	case shape == shapeWallDiagonal || shape >= shapeNormalLocMin && shape <= shapeNormalLocMax:
+		width, length := locType.Width, locType.Length
+		if rotation&1 == 1 {
+			width, length = length, width
+		}
+		if add {
+			m.AddLoc(x, z, plane, width, length, locType.BlockRange)
+		} else {
+			m.RemoveLoc(x, z, plane, width, length, locType.BlockRange)
+		}
+	case shape == shapeGroundDecoration:
+		// only ground decorations that can be interacted with are flagged
+		if locType.Active != 1 {
+			return
+		}
+		if add {
+			m.Add(x, z, plane, collision.FloorDecoration)
+		} else {
+			m.Remove(x, z, plane, collision.FloorDecoration)
+		}
+	}
+	// wall decorations don't block anything
+}
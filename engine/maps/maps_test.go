@@ -0,0 +1,509 @@
+package maps
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/util/cache"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+type tile struct {
+	x, z, plane int
+}
+
+// encodeTerrain encodes a terrain file with the given tile settings. Every
+// tile gets an underlay and an overlay too, which should be skipped.
+func encodeTerrain(settings map[tile]uint8) []byte {
+	var buf packet.Packet
+	for plane := 0; plane < 4; plane++ {
+		for x := 0; x < 64; x++ {
+			for z := 0; z < 64; z++ {
+				buf.P1(82) // underlay
+				buf.P1(2)  // overlay
+				buf.P1(7)
+				if v, ok := settings[tile{x, z, plane}]; ok {
+					buf.P1(49 + v)
+				}
+				if x%2 == 0 {
+					buf.P1(1) // height
+					buf.P1(10)
+				} else {
+					buf.P1(0)
+				}
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// encodeLocs encodes a loc file, which must be sorted by id and then
+// position.
+func encodeLocs(locs []Loc) []byte {
+	var buf packet.Packet
+	lastID := -1
+	for i := 0; i < len(locs); {
+		id := locs[i].ID
+		buf.PSmart(uint16(id - lastID))
+		lastID = id
+
+		lastPos := 0
+		for ; i < len(locs) && locs[i].ID == id; i++ {
+			v := locs[i]
+			pos := v.Plane<<12 | v.X<<6 | v.Z
+			buf.PSmart(uint16(pos - lastPos + 1))
+			lastPos = pos
+			buf.P1(uint8(v.Shape<<2 | v.Rotation))
+		}
+		buf.PSmart(0)
+	}
+	buf.PSmart(0)
+	return buf.Bytes()
+}
+
+func TestDecodeTerrain(t *testing.T) {
+	settings := map[tile]uint8{
+		{0, 0, 0}:   TileBlocked,
+		{63, 63, 3}: TileBlocked,
+		{10, 20, 1}: TileBridge,
+	}
+	data := encodeTerrain(settings)
+
+	got, err := DecodeTerrain(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for plane := 0; plane < 4; plane++ {
+		for x := 0; x < 64; x++ {
+			for z := 0; z < 64; z++ {
+				if want := settings[tile{x, z, plane}]; got[plane][x][z] != want {
+					t.Errorf("DecodeTerrain() tile %d, %d, %d = %d, want %d", x, z, plane, got[plane][x][z], want)
+				}
+			}
+		}
+	}
+
+	if _, err := DecodeTerrain(data[:len(data)/2]); err == nil {
+		t.Errorf("DecodeTerrain() of a truncated file didn't fail")
+	}
+}
+
+func TestDecodeLocs(t *testing.T) {
+	tests := []struct {
+		name string
+		locs []Loc
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "one",
+			locs: []Loc{{ID: 1276, X: 5, Z: 9, Plane: 0, Shape: 10, Rotation: 2}},
+		},
+		{
+			name: "several of each",
+			locs: []Loc{
+				{ID: 0, X: 0, Z: 0, Plane: 0, Shape: 0, Rotation: 0},
+				{ID: 0, X: 63, Z: 63, Plane: 3, Shape: 22, Rotation: 3},
+				{ID: 200, X: 1, Z: 2, Plane: 0, Shape: 2, Rotation: 1},
+				{ID: 200, X: 1, Z: 3, Plane: 0, Shape: 2, Rotation: 1},
+				{ID: 30000, X: 40, Z: 4, Plane: 2, Shape: 9, Rotation: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeLocs(encodeLocs(tt.locs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.locs) {
+				t.Errorf("DecodeLocs() = %v, want %v", got, tt.locs)
+			}
+		})
+	}
+
+	if _, err := DecodeLocs([]byte{5, 3}); err == nil {
+		t.Errorf("DecodeLocs() of a truncated file didn't fail")
+	}
+}
+
+// fakeSource serves map files by name, as if from archive 5.
+type fakeSource struct {
+	files map[string][]byte
+	keys  map[string][]int32
+	reads int
+}
+
+func (s *fakeSource) GroupID(archive int, name string) (int, bool, error) {
+	var names []string
+	for k := range s.files {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for i, v := range names {
+		if v == name {
+			return i, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (s *fakeSource) Read(archive int, group int, key []int32) ([]byte, error) {
+	s.reads++
+
+	var names []string
+	for k := range s.files {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	name := names[group]
+
+	// the files are stored encrypted, as in the cache
+	container, err := cache.Compress(cache.CompressionGzip, s.files[name], s.keys[name])
+	if err != nil {
+		return nil, err
+	}
+	return cache.Decompress(container, key)
+}
+
+type fakeLocTypes map[int]*config.LocType
+
+func (t fakeLocTypes) Get(id int) (*config.LocType, error) {
+	if v, ok := t[id]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("no loc %d", id)
+}
+
+func TestLoader_Load(t *testing.T) {
+	const (
+		mapsquareX = 50
+		mapsquareZ = 50
+		baseX      = mapsquareX << 6
+		baseZ      = mapsquareZ << 6
+	)
+	key := []int32{11, 22, 33, 44}
+
+	wall := &config.LocType{ID: 1, Width: 1, Length: 1, BlockWalk: 2, BlockRange: true}
+	table := &config.LocType{ID: 2, Width: 2, Length: 1, BlockWalk: 2}
+	rug := &config.LocType{ID: 3, Width: 1, Length: 1, BlockWalk: 0}
+	lever := &config.LocType{ID: 4, Width: 1, Length: 1, BlockWalk: 1, Active: 1}
+	locTypes := fakeLocTypes{1: wall, 2: table, 3: rug, 4: lever}
+
+	source := &fakeSource{
+		files: map[string][]byte{
+			"m50_50": encodeTerrain(map[tile]uint8{
+				{1, 1, 0}:   TileBlocked,
+				{30, 30, 1}: TileBridge | TileBlocked,
+				{30, 30, 2}: TileBlocked,
+			}),
+			"l50_50": encodeLocs([]Loc{
+				{ID: 1, X: 5, Z: 5, Plane: 0, Shape: 0, Rotation: 0},
+				{ID: 2, X: 10, Z: 10, Plane: 0, Shape: 10, Rotation: 1},
+				{ID: 2, X: 30, Z: 30, Plane: 1, Shape: 10, Rotation: 0},
+				{ID: 3, X: 20, Z: 20, Plane: 0, Shape: 22, Rotation: 0},
+				{ID: 4, X: 21, Z: 20, Plane: 0, Shape: 22, Rotation: 0},
+			}),
+		},
+		keys: map[string][]int32{"l50_50": key},
+	}
+
+	m := collision.NewMap()
+	l := NewLoader(source, locTypes, m)
+	l.Key = func(x int, z int) ([]int32, bool) {
+		return key, x == mapsquareX && z == mapsquareZ
+	}
+
+	if err := l.Load(mapsquareX, mapsquareZ); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		tile  tile
+		flags int
+	}{
+		{name: "blocked tile", tile: tile{1, 1, 0}, flags: collision.Floor},
+		{name: "open tile", tile: tile{2, 1, 0}, flags: 0},
+		{name: "bridge", tile: tile{30, 30, 1}, flags: collision.Floor},
+		{name: "under a bridge", tile: tile{30, 30, 0}, flags: collision.Loc | collision.Floor},
+		{name: "wall", tile: tile{5, 5, 0}, flags: collision.WallWest | collision.WallWestProjectile},
+		{name: "other side of the wall", tile: tile{4, 5, 0}, flags: collision.WallEast | collision.WallEastProjectile},
+		{name: "rotated loc", tile: tile{10, 11, 0}, flags: collision.Loc},
+		{name: "past the rotated loc", tile: tile{11, 10, 0}, flags: 0},
+		{name: "loc that doesn't block", tile: tile{20, 20, 0}, flags: 0},
+		{name: "interactable ground decoration", tile: tile{21, 20, 0}, flags: collision.FloorDecoration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Flags(baseX+tt.tile.x, baseZ+tt.tile.z, tt.tile.plane); got != tt.flags {
+				t.Errorf("Flags() = %#x, want %#x", got, tt.flags)
+			}
+		})
+	}
+
+	wantLocs := []Loc{{ID: 2, X: baseX + 10, Z: baseZ + 10, Plane: 0, Shape: 10, Rotation: 1}}
+	if got := l.Locs(baseX+10, baseZ+10, 0); !reflect.DeepEqual(got, wantLocs) {
+		t.Errorf("Locs() = %v, want %v", got, wantLocs)
+	}
+	if got := l.Locs(baseX+10, baseZ+10, 1); len(got) != 0 {
+		t.Errorf("Locs() on plane 1 = %v, want none", got)
+	}
+	l.ClearLocs(baseX+63, baseZ)
+	if got := l.Locs(baseX+10, baseZ+10, 0); len(got) != 0 {
+		t.Errorf("Locs() after ClearLocs() = %v, want none", got)
+	}
+
+	// loaded mapsquares aren't read again
+	reads := source.reads
+	if err := l.LoadAround(baseX+32, baseZ+32); err != nil {
+		t.Fatal(err)
+	}
+	if source.reads != reads {
+		t.Errorf("LoadAround() read a loaded mapsquare again")
+	}
+	// the mapsquares either side are within LoadRadius, but no further
+	if !l.Loaded(mapsquareX+1, mapsquareZ-1) || l.Loaded(mapsquareX+2, mapsquareZ) {
+		t.Errorf("Loaded() = %v, %v, want true, false", l.Loaded(mapsquareX+1, mapsquareZ-1), l.Loaded(mapsquareX+2, mapsquareZ))
+	}
+}
+
+func TestLoader_Load_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string][]byte
+		key     bool
+		wantErr bool
+	}{
+		{
+			name:  "empty mapsquare",
+			files: map[string][]byte{},
+		},
+		{
+			name: "no key",
+			files: map[string][]byte{
+				"m50_50": encodeTerrain(nil),
+				"l50_50": encodeLocs(nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown loc",
+			files: map[string][]byte{
+				"m50_50": encodeTerrain(nil),
+				"l50_50": encodeLocs([]Loc{{ID: 99}}),
+			},
+			key:     true,
+			wantErr: true,
+		},
+		{
+			name: "bad terrain",
+			files: map[string][]byte{
+				"m50_50": {1},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLoader(&fakeSource{files: tt.files}, fakeLocTypes{}, collision.NewMap())
+			l.Key = func(int, int) ([]int32, bool) {
+				return nil, tt.key
+			}
+
+			err := l.Load(50, 50)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// a failed mapsquare isn't tried again
+			if err := l.Load(50, 50); err != nil {
+				t.Errorf("Load() again error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoader_CopyZone(t *testing.T) {
+	wall := &config.LocType{ID: 1, Width: 1, Length: 1, BlockWalk: 2}
+	table := &config.LocType{ID: 2, Width: 2, Length: 1, BlockWalk: 2}
+	key := []int32{11, 22, 33, 44}
+	source := &fakeSource{
+		files: map[string][]byte{
+			"m50_50": encodeTerrain(map[tile]uint8{
+				{9, 8, 0}:  TileBlocked,
+				{9, 8, 1}:  TileBlocked,
+				{30, 8, 0}: TileBlocked,
+			}),
+			// the zone copied is the one from 8, 8 to 15, 15
+			"l50_50": encodeLocs([]Loc{
+				{ID: 1, X: 8, Z: 8, Plane: 0, Shape: 0, Rotation: 0},
+				{ID: 2, X: 10, Z: 12, Plane: 0, Shape: 10, Rotation: 0},
+				{ID: 2, X: 20, Z: 12, Plane: 0, Shape: 10, Rotation: 0},
+				{ID: 2, X: 10, Z: 12, Plane: 1, Shape: 10, Rotation: 0},
+			}),
+		},
+		keys: map[string][]int32{"l50_50": key},
+	}
+	const (
+		srcX = 50<<6 + 8
+		srcZ = 50<<6 + 8
+		dstX = InstanceMapsquareX << 6
+		dstZ = 8
+	)
+
+	tests := []struct {
+		name     string
+		rotation int
+		flags    map[tile]int
+	}{
+		{
+			name:     "not rotated",
+			rotation: 0,
+			flags: map[tile]int{
+				{1, 0, 0}:  collision.Floor,
+				{0, 0, 0}:  collision.WallWest,
+				{-1, 0, 0}: collision.WallEast,
+				{2, 4, 0}:  collision.Loc,
+				{3, 4, 0}:  collision.Loc,
+			},
+		},
+		{
+			name:     "turned once",
+			rotation: 1,
+			flags: map[tile]int{
+				{0, 6, 0}: collision.Floor,
+				{0, 7, 0}: collision.WallNorth,
+				{0, 8, 0}: collision.WallSouth,
+				{4, 4, 0}: collision.Loc,
+				{4, 5, 0}: collision.Loc,
+			},
+		},
+		{
+			name:     "turned twice",
+			rotation: 2,
+			flags: map[tile]int{
+				{6, 7, 0}: collision.Floor,
+				{7, 7, 0}: collision.WallEast,
+				{8, 7, 0}: collision.WallWest,
+				{4, 3, 0}: collision.Loc,
+				{5, 3, 0}: collision.Loc,
+			},
+		},
+		{
+			name:     "turned three times",
+			rotation: 3,
+			flags: map[tile]int{
+				{7, 1, 0}:  collision.Floor,
+				{7, 0, 0}:  collision.WallSouth,
+				{7, -1, 0}: collision.WallNorth,
+				{3, 2, 0}:  collision.Loc,
+				{3, 3, 0}:  collision.Loc,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := collision.NewMap()
+			l := NewLoader(source, fakeLocTypes{1: wall, 2: table}, m)
+			l.Key = func(int, int) ([]int32, bool) {
+				return key, true
+			}
+
+			if err := l.CopyZone(dstX, dstZ, 0, srcX, srcZ, 0, tt.rotation); err != nil {
+				t.Fatal(err)
+			}
+			for x := -1; x <= 8; x++ {
+				for z := -1; z <= 8; z++ {
+					for plane := 0; plane < 2; plane++ {
+						if got, want := m.Flags(dstX+x, dstZ+z, plane), tt.flags[tile{x, z, plane}]; got != want {
+							t.Errorf("Flags() of %d, %d, %d = %#x, want %#x", x, z, plane, got, want)
+						}
+					}
+				}
+			}
+		})
+	}
+
+	// the copied locs are where they were rotated to
+	l := NewLoader(source, fakeLocTypes{1: wall, 2: table}, collision.NewMap())
+	l.Key = func(int, int) ([]int32, bool) {
+		return key, true
+	}
+	if err := l.CopyZone(dstX, dstZ, 0, srcX, srcZ, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	wantLocs := []Loc{{ID: 2, X: dstX + 4, Z: dstZ + 4, Plane: 0, Shape: 10, Rotation: 1}}
+	if got := l.Locs(dstX+4, dstZ+4, 0); !reflect.DeepEqual(got, wantLocs) {
+		t.Errorf("Locs() = %v, want %v", got, wantLocs)
+	}
+
+	// instanced mapsquares are left alone by Load
+	m := collision.NewMap()
+	l = NewLoader(source, fakeLocTypes{1: wall, 2: table}, m)
+	l.Key = func(int, int) ([]int32, bool) {
+		return key, true
+	}
+	if err := l.CopyZone(dstX, dstZ, 2, srcX, srcZ, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.LoadAround(dstX, dstZ); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Flags(dstX+2, dstZ+4, 2); got != collision.Loc {
+		t.Errorf("Flags() of the copied table after LoadAround() = %#x, want %#x", got, collision.Loc)
+	}
+	if got := m.Flags(dstX+1, dstZ, 2); got != collision.Floor {
+		t.Errorf("Flags() of the copied floor after LoadAround() = %#x, want %#x", got, collision.Floor)
+	}
+}
+
+func TestLocLayer(t *testing.T) {
+	tests := []struct {
+		shape int
+		want  int
+	}{
+		{shape: 0, want: LayerWall},
+		{shape: 3, want: LayerWall},
+		{shape: 4, want: LayerWallDecoration},
+		{shape: 8, want: LayerWallDecoration},
+		{shape: 9, want: LayerGround},
+		{shape: 10, want: LayerGround},
+		{shape: 21, want: LayerGround},
+		{shape: 22, want: LayerGroundDecoration},
+	}
+	for _, tt := range tests {
+		if got := LocLayer(tt.shape); got != tt.want {
+			t.Errorf("LocLayer(%d) = %d, want %d", tt.shape, got, tt.want)
+		}
+	}
+}
+
+func TestLoader_PlaceLoc(t *testing.T) {
+	wall := &config.LocType{ID: 1, Width: 1, Length: 1, BlockWalk: 2}
+	m := collision.NewMap()
+	l := NewLoader(&fakeSource{files: map[string][]byte{"m50_50": encodeTerrain(nil)}}, fakeLocTypes{1: wall}, m)
+
+	loc := Loc{ID: 1, X: 50<<6 + 3, Z: 50<<6 + 4, Plane: 0, Shape: 0, Rotation: 1}
+	if err := l.PlaceLoc(loc); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.PlaceLoc(Loc{ID: 2, X: loc.X, Z: loc.Z}); err == nil {
+		t.Errorf("PlaceLoc() of an unknown loc didn't fail")
+	}
+
+	// loading the mapsquare again doesn't clear it
+	if err := l.Load(50, 50); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Flags(loc.X, loc.Z, 0); got != collision.WallNorth {
+		t.Errorf("Flags() = %#x, want %#x", got, collision.WallNorth)
+	}
+	if got := l.Locs(loc.X, loc.Z, 0); !reflect.DeepEqual(got, []Loc{loc}) {
+		t.Errorf("Locs() = %v, want %v", got, []Loc{loc})
+	}
+}
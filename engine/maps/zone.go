@@ -0,0 +1,121 @@
+package maps
+
+import (
+	"errors"
+)
+
+// CopyZone flags a copy of the 8x8 zone at srcX, srcZ on srcPlane onto the
+// zone at dstX, dstZ on dstPlane, turned clockwise rotation times, the same
+// way the client builds a dynamic region. The destination should be empty,
+// such as a freshly cleared instance.
+func (l *Loader) CopyZone(dstX int, dstZ int, dstPlane int, srcX int, srcZ int, srcPlane int, rotation int) error {
+	dstX, dstZ = dstX&^7, dstZ&^7
+	rotation &= 3
+
+	terrain, locs, err := l.read(srcX>>6, srcZ>>6)
+	if terrain == nil {
+		return err
+	}
+
+	// the zone's corner within its mapsquare
+	baseX, baseZ := srcX&0x38, srcZ&0x38
+	for x := 0; x < 8; x++ {
+		for z := 0; z < 8; z++ {
+			if terrain[srcPlane][baseX+x][baseZ+z]&TileBlocked == 0 {
+				continue
+			}
+			if plane := terrain.plane(baseX+x, baseZ+z, dstPlane); plane >= 0 {
+				l.Collision.AddFloor(dstX+rotateTileX(x, z, rotation), dstZ+rotateTileZ(x, z, rotation), plane)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, v := range locs {
+		if v.Plane != srcPlane || v.X&^7 != baseX || v.Z&^7 != baseZ {
+			continue
+		}
+		plane := terrain.plane(v.X, v.Z, dstPlane)
+		if plane < 0 {
+			continue
+		}
+
+		locType, err := l.LocTypes.Get(v.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		x := dstX + rotateLocX(v.X&7, v.Z&7, rotation, locType.Width, locType.Length, v.Rotation)
+		z := dstZ + rotateLocZ(v.X&7, v.Z&7, rotation, locType.Width, locType.Length, v.Rotation)
+		AddLoc(l.Collision, locType, x, z, plane, v.Shape, (v.Rotation+rotation)&3)
+
+		l.mu.Lock()
+		l.placeLoc(Loc{ID: v.ID, X: x, Z: z, Plane: dstPlane, Shape: v.Shape, Rotation: (v.Rotation + rotation) & 3})
+		l.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// rotateTileX returns where the tile x, z of a zone ends up along x when the
+// zone is turned clockwise rotation times.
+func rotateTileX(x int, z int, rotation int) int {
+	switch rotation {
+	case 1:
+		return z
+	case 2:
+		return 7 - x
+	case 3:
+		return 7 - z
+	}
+	return x
+}
+
+// rotateTileZ is rotateTileX along z.
+func rotateTileZ(x int, z int, rotation int) int {
+	switch rotation {
+	case 1:
+		return 7 - x
+	case 2:
+		return 7 - z
+	case 3:
+		return x
+	}
+	return z
+}
+
+// rotateLocX returns where the south west corner of a loc on the tile x, z
+// of a zone ends up along x when the zone is turned clockwise rotation
+// times, which depends on how big the loc is as placed.
+func rotateLocX(x int, z int, rotation int, width int, length int, locRotation int) int {
+	if locRotation&1 == 1 {
+		width, length = length, width
+	}
+	switch rotation {
+	case 1:
+		return z
+	case 2:
+		return 7 - x - (width - 1)
+	case 3:
+		return 7 - z - (length - 1)
+	}
+	return x
+}
+
+// rotateLocZ is rotateLocX along z.
+func rotateLocZ(x int, z int, rotation int, width int, length int, locRotation int) int {
+	if locRotation&1 == 1 {
+		width, length = length, width
+	}
+	switch rotation {
+	case 1:
+		return 7 - x - (width - 1)
+	case 2:
+		return 7 - z - (length - 1)
+	case 3:
+		return x
+	}
+	return z
+}
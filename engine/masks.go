@@ -0,0 +1,330 @@
+package engine
+
+import (
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// Player update masks, flagging what follows in a player's update block.
+// Masks above 0xff need the extended flag and a second flag byte.
+// TODO: confirm the bits and the order against a 578 client
+const (
+	MaskAppearance     = 0x1
+	MaskChat           = 0x2
+	MaskFaceEntity     = 0x4
+	MaskAnim           = 0x8
+	MaskFaceCoord      = 0x10
+	MaskHit            = 0x20
+	maskExtended       = 0x40
+	MaskSpotAnim       = 0x80
+	MaskForcedChat     = 0x100
+	MaskForcedMovement = 0x200
+	MaskTempMoveType   = 0x400
+	MaskHit2           = 0x800
+)
+
+// confirmedMasks are the masks known to be read the same way by a 578
+// client. The others are only sent with SendUnconfirmed.
+const confirmedMasks = MaskAppearance
+
+// SendUnconfirmed sends the update masks and packets whose layout hasn't
+// been checked against a 578 client, and handles the client packets that
+// haven't been. Without it they're left out, so a client isn't sent
+// something it could misread and a packet isn't taken for another. It's
+// only meant for development.
+var SendUnconfirmed = false
+
+// maskOrder is the order the client reads the masks in.
+var maskOrder = []int{
+	MaskForcedMovement,
+	MaskSpotAnim,
+	MaskAnim,
+	MaskForcedChat,
+	MaskChat,
+	MaskFaceEntity,
+	MaskAppearance,
+	MaskFaceCoord,
+	MaskHit,
+	MaskHit2,
+	MaskTempMoveType,
+}
+
+// FaceNone stops a player facing anything.
+const FaceNone = 0xffff
+
+// the face entity index of a player is offset so it can't be mistaken for
+// an NPC's
+const faceEntityPlayer = 0x8000
+
+// Hit splat types
+const (
+	HitBlock   = 0
+	HitNormal  = 1
+	HitPoison  = 2
+	HitDisease = 3
+)
+
+// Hit is a splat shown over a player.
+type Hit struct {
+	Damage int
+	Type   int
+}
+
+// ChatMessage is a line of public chat, with the text already packed by
+// the chat codec.
+type ChatMessage struct {
+	// Colour and Effects are the options the player chose in the client.
+	Colour  int
+	Effects int
+	// ModIcon is the crown shown next to the player's name.
+	ModIcon int
+	Packed  []byte
+}
+
+// ForcedMovement slides a player between two tiles, such as over an agility
+// obstacle. The tiles are relative to where the player is.
+type ForcedMovement struct {
+	StartX, StartZ int
+	EndX, EndZ     int
+	// the client cycles (20ms) the slide to each tile takes
+	StartCycles int
+	EndCycles   int
+	// Direction is the way the player faces while moving.
+	Direction int
+}
+
+// masks holds the update masks set on a player this tick, and the blocks
+// encoded from them.
+type masks struct {
+	flags int
+
+	anim, animDelay                         int
+	spotAnim, spotAnimHeight, spotAnimDelay int
+	forcedChat                              string
+	chat                                    ChatMessage
+	faceEntity                              int
+	faceX, faceZ                            int
+	hits                                    []Hit
+	forcedMovement                          ForcedMovement
+	tempMoveType                            int
+
+	// update blocks already encoded this tick, by the masks they hold, so
+	// each one is only encoded once however many players see it
+	blocks map[int][]byte
+}
+
+// Anim plays the seq id, after delay client cycles. -1 stops the current
+// one.
+func (p *Player) Anim(id int, delay int) {
+	p.masks.anim = id
+	p.masks.animDelay = delay
+	p.setMask(MaskAnim)
+}
+
+// SpotAnim plays the spot anim id height units above the player, after
+// delay client cycles.
+func (p *Player) SpotAnim(id int, height int, delay int) {
+	p.masks.spotAnim = id
+	p.masks.spotAnimHeight = height
+	p.masks.spotAnimDelay = delay
+	p.setMask(MaskSpotAnim)
+}
+
+// Say makes the player say text over their head, without it going into
+// anyone's chat box.
+func (p *Player) Say(text string) {
+	p.masks.forcedChat = text
+	p.setMask(MaskForcedChat)
+}
+
+// Chat shows a public chat message over the player and in the chat box of
+// everyone who can see them.
+func (p *Player) Chat(message ChatMessage) {
+	p.masks.chat = message
+	p.setMask(MaskChat)
+}
+
+// FaceEntity turns the player to follow another player (see FacePlayer),
+// an NPC by index, or nothing with FaceNone.
+func (p *Player) FaceEntity(index int) {
+	p.masks.faceEntity = index
+	p.setMask(MaskFaceEntity)
+}
+
+// FacePlayer turns the player to follow other.
+func (p *Player) FacePlayer(other *Player) {
+	p.FaceEntity(other.ID + faceEntityPlayer)
+}
+
+// FaceCoord turns the player towards the tile x, z.
+func (p *Player) FaceCoord(x int, z int) {
+	p.masks.faceX = x
+	p.masks.faceZ = z
+	p.setMask(MaskFaceCoord)
+}
+
+// Hit shows a hit splat over the player, with their health bar. Up to two
+// can be shown each tick; any more are dropped.
+func (p *Player) Hit(damage int, hitType int) {
+	p.masks.hit(Hit{Damage: damage, Type: hitType}, MaskHit, MaskHit2)
+}
+
+// ForceMove slides the player along movement.
+func (p *Player) ForceMove(movement ForcedMovement) {
+	p.masks.forcedMovement = movement
+	p.setMask(MaskForcedMovement)
+}
+
+// TempMoveType tells the client how the player moves this tick, such as
+// walking when they'd run, without changing their run setting.
+func (p *Player) TempMoveType(moveType int) {
+	p.masks.tempMoveType = moveType
+	p.setMask(MaskTempMoveType)
+}
+
+func (p *Player) setMask(mask int) {
+	p.masks.set(mask)
+}
+
+// resetMasks clears the masks at the end of a tick.
+func (p *Player) resetMasks() {
+	p.masks.reset()
+}
+
+func (p *Player) needsMaskUpdate() bool {
+	return p.masks.flags != 0
+}
+
+func (m *masks) set(mask int) {
+	m.flags |= mask
+	m.blocks = nil
+}
+
+func (m *masks) reset() {
+	m.flags = 0
+	m.hits = m.hits[:0]
+	m.blocks = nil
+}
+
+// hit adds a hit splat, flagged with first or second depending on how many
+// there are already.
+func (m *masks) hit(hit Hit, first int, second int) {
+	switch len(m.hits) {
+	case 0:
+		m.set(first)
+	case 1:
+		m.set(second)
+	default:
+		return
+	}
+	m.hits = append(m.hits, hit)
+}
+
+// block returns the update block holding flags, encoding it with encode the
+// first time it's asked for this tick.
+func (m *masks) block(flags int, encode func(flags int) []byte) []byte {
+	block, ok := m.blocks[flags]
+	if !ok {
+		block = encode(flags)
+		if m.blocks == nil {
+			m.blocks = make(map[int][]byte)
+		}
+		m.blocks[flags] = block
+	}
+	return block
+}
+
+// AppendUpdateBlock writes the player's update block for observer, with
+// their appearance whether or not it changed if the observer has only just
+// added them.
+func (p *Player) AppendUpdateBlock(buf *packet.Packet, observer *Player, added bool) {
+	flags := p.masks.flags
+	if added {
+		flags |= MaskAppearance
+	}
+	if observer == p {
+		// the client shows its own chat as it's sent
+		flags &^= MaskChat
+	}
+	if !SendUnconfirmed {
+		flags &= confirmedMasks
+	}
+
+	block := p.masks.block(flags, p.encodeUpdateBlock)
+	buf.PData(block, len(block))
+}
+
+func (p *Player) encodeUpdateBlock(flags int) []byte {
+	var buf packet.Packet
+
+	if flags > 0xff {
+		buf.P1(uint8(flags | maskExtended))
+		buf.P1(uint8(flags >> 8))
+	} else {
+		buf.P1(uint8(flags))
+	}
+
+	m := &p.masks
+	for _, mask := range maskOrder {
+		if flags&mask == 0 {
+			continue
+		}
+
+		switch mask {
+		case MaskAppearance:
+			buf.P1Alt3(uint8(p.Appearance.Len()))
+			buf.PData(p.Appearance.Bytes(), p.Appearance.Len())
+		case MaskChat:
+			buf.P2(uint16(m.chat.Colour<<8 | m.chat.Effects))
+			buf.P1(uint8(m.chat.ModIcon))
+			buf.P1(uint8(len(m.chat.Packed)))
+			buf.PData(m.chat.Packed, len(m.chat.Packed))
+		case MaskFaceEntity:
+			buf.P2(uint16(m.faceEntity))
+		case MaskAnim:
+			buf.P2(uint16(m.anim))
+			buf.P1(uint8(m.animDelay))
+		case MaskFaceCoord:
+			buf.P2(uint16(m.faceX*2 + 1))
+			buf.P2(uint16(m.faceZ*2 + 1))
+		case MaskHit, MaskHit2:
+			hit := m.hits[0]
+			if mask == MaskHit2 {
+				hit = m.hits[1]
+			}
+			buf.PSmart(uint16(hit.Damage))
+			buf.P1(uint8(hit.Type))
+			if mask == MaskHit {
+				buf.P1(uint8(p.healthBar()))
+			}
+		case MaskSpotAnim:
+			buf.P2(uint16(m.spotAnim))
+			buf.P4(uint32(m.spotAnimHeight<<16 | m.spotAnimDelay&0xffff))
+		case MaskForcedChat:
+			buf.PJStr(m.forcedChat)
+		case MaskForcedMovement:
+			movement := m.forcedMovement
+			buf.P1(uint8(movement.StartX))
+			buf.P1(uint8(movement.StartZ))
+			buf.P1(uint8(movement.EndX))
+			buf.P1(uint8(movement.EndZ))
+			buf.P2(uint16(movement.StartCycles))
+			buf.P2(uint16(movement.EndCycles))
+			buf.P1(uint8(movement.Direction))
+		case MaskTempMoveType:
+			buf.P1(uint8(m.tempMoveType))
+		}
+	}
+	return buf.Bytes()
+}
+
+// healthBar returns how full the player's health bar is, out of 255.
+func (p *Player) healthBar() int {
+	return healthBar(p.Health, p.MaxHealth)
+}
+
+func healthBar(health int, maxHealth int) int {
+	if maxHealth <= 0 {
+		return 0
+	}
+	return min(max(health*255/maxHealth, 0), 255)
+}
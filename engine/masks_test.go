@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+func TestMain(m *testing.M) {
+	// the tests check the unconfirmed masks and packets are encoded
+	// right, the gate is tested on its own
+	SendUnconfirmed = true
+	os.Exit(m.Run())
+}
+
+// updateBlock is an update block as the client reads it.
+type updateBlock struct {
+	Flags      int
+	Appearance []byte
+	Chat       *ChatMessage
+	FaceEntity int
+	Anim       [2]int
+	FaceCoord  [2]int
+	Hits       []Hit
+	HealthBar  int
+	SpotAnim   [3]int
+	ForcedChat string
+	Movement   *ForcedMovement
+	MoveType   int
+}
+
+// decodeUpdateBlock reads an update block, in maskOrder.
+func decodeUpdateBlock(buf *packet.Packet) updateBlock {
+	var b updateBlock
+
+	b.Flags = int(buf.G1())
+	if b.Flags&maskExtended != 0 {
+		b.Flags = b.Flags&^maskExtended | int(buf.G1())<<8
+	}
+
+	for _, mask := range maskOrder {
+		if b.Flags&mask == 0 {
+			continue
+		}
+
+		switch mask {
+		case MaskAppearance:
+			b.Appearance = make([]byte, buf.G1Alt3())
+			buf.GData(b.Appearance, len(b.Appearance))
+		case MaskChat:
+			options := int(buf.G2())
+			b.Chat = &ChatMessage{Colour: options >> 8, Effects: options & 0xff, ModIcon: int(buf.G1())}
+			b.Chat.Packed = make([]byte, buf.G1())
+			buf.GData(b.Chat.Packed, len(b.Chat.Packed))
+		case MaskFaceEntity:
+			b.FaceEntity = int(buf.G2())
+		case MaskAnim:
+			b.Anim = [2]int{int(buf.G2()), int(buf.G1())}
+		case MaskFaceCoord:
+			b.FaceCoord = [2]int{int(buf.G2()), int(buf.G2())}
+		case MaskHit, MaskHit2:
+			b.Hits = append(b.Hits, Hit{Damage: int(buf.GSmart()), Type: int(buf.G1())})
+			if mask == MaskHit {
+				b.HealthBar = int(buf.G1())
+			}
+		case MaskSpotAnim:
+			id := int(buf.G2())
+			v := int(buf.G4())
+			b.SpotAnim = [3]int{id, v >> 16, v & 0xffff}
+		case MaskForcedChat:
+			b.ForcedChat = buf.GJStr()
+		case MaskForcedMovement:
+			b.Movement = &ForcedMovement{
+				StartX: int(buf.G1B()), StartZ: int(buf.G1B()),
+				EndX: int(buf.G1B()), EndZ: int(buf.G1B()),
+				StartCycles: int(buf.G2()), EndCycles: int(buf.G2()),
+				Direction: int(buf.G1()),
+			}
+		case MaskTempMoveType:
+			b.MoveType = int(buf.G1())
+		}
+	}
+	return b
+}
+
+func TestPlayer_AppendUpdateBlock(t *testing.T) {
+	chat := ChatMessage{Colour: 3, Effects: 2, ModIcon: 1, Packed: []byte{9, 8, 7}}
+
+	tests := []struct {
+		name  string
+		set   func(p *Player, other *Player)
+		added bool
+		self  bool
+		want  updateBlock
+	}{
+		{
+			name: "nothing",
+			set:  func(p *Player, other *Player) {},
+			want: updateBlock{},
+		},
+		{
+			name:  "appearance for an added player",
+			set:   func(p *Player, other *Player) {},
+			added: true,
+			want:  updateBlock{Flags: MaskAppearance, Appearance: []byte{1, 2, 3}},
+		},
+		{
+			name: "anim",
+			set:  func(p *Player, other *Player) { p.Anim(866, 5) },
+			want: updateBlock{Flags: MaskAnim, Anim: [2]int{866, 5}},
+		},
+		{
+			name: "stop anim",
+			set:  func(p *Player, other *Player) { p.Anim(-1, 0) },
+			want: updateBlock{Flags: MaskAnim, Anim: [2]int{0xffff, 0}},
+		},
+		{
+			name: "spot anim",
+			set:  func(p *Player, other *Player) { p.SpotAnim(86, 100, 30) },
+			want: updateBlock{Flags: MaskSpotAnim, SpotAnim: [3]int{86, 100, 30}},
+		},
+		{
+			name: "face player",
+			set:  func(p *Player, other *Player) { p.FacePlayer(other) },
+			want: updateBlock{Flags: MaskFaceEntity, FaceEntity: 0x8000 + 2},
+		},
+		{
+			name: "face coord",
+			set:  func(p *Player, other *Player) { p.FaceCoord(3200, 3201) },
+			want: updateBlock{Flags: MaskFaceCoord, FaceCoord: [2]int{6401, 6403}},
+		},
+		{
+			name: "chat",
+			set:  func(p *Player, other *Player) { p.Chat(chat) },
+			want: updateBlock{Flags: MaskChat, Chat: &chat},
+		},
+		{
+			name: "own chat isn't sent back",
+			set:  func(p *Player, other *Player) { p.Chat(chat) },
+			self: true,
+			want: updateBlock{},
+		},
+		{
+			name: "hits",
+			set: func(p *Player, other *Player) {
+				p.Health = 5
+				p.Hit(3, HitNormal)
+				p.Hit(0, HitBlock)
+				p.Hit(9, HitPoison)
+			},
+			want: updateBlock{
+				Flags:     MaskHit | MaskHit2,
+				Hits:      []Hit{{Damage: 3, Type: HitNormal}, {Damage: 0, Type: HitBlock}},
+				HealthBar: 127,
+			},
+		},
+		{
+			name: "forced chat, movement and move type need the extended flag",
+			set: func(p *Player, other *Player) {
+				p.Say("Ow!")
+				p.ForceMove(ForcedMovement{StartX: -1, EndX: 2, EndZ: -3, StartCycles: 30, EndCycles: 60, Direction: 1})
+				p.TempMoveType(MoveWalk)
+				p.Anim(1, 0)
+			},
+			want: updateBlock{
+				Flags:      MaskForcedChat | MaskForcedMovement | MaskTempMoveType | MaskAnim,
+				ForcedChat: "Ow!",
+				Movement:   &ForcedMovement{StartX: -1, EndX: 2, EndZ: -3, StartCycles: 30, EndCycles: 60, Direction: 1},
+				MoveType:   MoveWalk,
+				Anim:       [2]int{1, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			p := addTestPlayer(w, 3200, 3200, 0)
+			other := addTestPlayer(w, 3201, 3200, 0)
+			tt.set(p, other)
+
+			observer := other
+			if tt.self {
+				observer = p
+			}
+			var buf packet.Packet
+			p.AppendUpdateBlock(&buf, observer, tt.added)
+
+			got := decodeUpdateBlock(&buf)
+			if buf.Len() != 0 {
+				t.Errorf("%d bytes left over", buf.Len())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AppendUpdateBlock() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_AppendUpdateBlock_Cached(t *testing.T) {
+	w := newTestWorld()
+	p := addTestPlayer(w, 3200, 3200, 0)
+	a := addTestPlayer(w, 3201, 3200, 0)
+	b := addTestPlayer(w, 3202, 3200, 0)
+
+	p.Anim(1, 0)
+
+	var first, second packet.Packet
+	p.AppendUpdateBlock(&first, a, false)
+	p.AppendUpdateBlock(&second, b, false)
+	if !reflect.DeepEqual(first.Bytes(), second.Bytes()) {
+		t.Errorf("observers got different blocks")
+	}
+	if len(p.masks.blocks) != 1 {
+		t.Errorf("%d blocks encoded, want 1", len(p.masks.blocks))
+	}
+
+	// a mask set after the block was encoded has to be in the next one
+	p.Say("hi")
+	var third packet.Packet
+	p.AppendUpdateBlock(&third, a, false)
+	if got := decodeUpdateBlock(&third); got.ForcedChat != "hi" {
+		t.Errorf("block after Say() = %+v", got)
+	}
+
+	p.resetMasks()
+	if p.needsMaskUpdate() || len(p.masks.blocks) != 0 {
+		t.Errorf("masks left after resetMasks()")
+	}
+}
+
+func TestPlayer_AppendUpdateBlock_Unconfirmed(t *testing.T) {
+	SendUnconfirmed = false
+	t.Cleanup(func() { SendUnconfirmed = true })
+
+	w := newTestWorld()
+	p := addTestPlayer(w, 3200, 3200, 0)
+	other := addTestPlayer(w, 3201, 3200, 0)
+	p.Anim(866, 0)
+	p.Say("hi")
+
+	var buf packet.Packet
+	p.AppendUpdateBlock(&buf, other, true)
+	got := decodeUpdateBlock(&buf)
+	if want := (updateBlock{Flags: MaskAppearance, Appearance: []byte{1, 2, 3}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("AppendUpdateBlock() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/login"
+)
+
+// ModerationCommand is a staff command that places or lifts a sanction.
+type ModerationCommand struct {
+	Kind   login.SanctionKind
+	Pardon bool
+	// Level is who may use the command.
+	Level CommandLevel
+}
+
+// moderationCommands maps commands to the sanctions they manage. Names with
+// spaces are written with underscores.
+//
+//	::ban <name> [duration] [reason]
+//	::ipban <name|address> [duration] [reason]
+//	::uidban <name|uid> [duration] [reason]
+//	::unban <name>
+//
+// Durations are written like 30m, 12h or 7d; sanctions without one are
+// permanent.
+var moderationCommands = map[string]ModerationCommand{
+	"ban":      {Kind: login.SanctionBan, Level: CommandLevelAdmin},
+	"unban":    {Kind: login.SanctionBan, Pardon: true, Level: CommandLevelAdmin},
+	"mute":     {Kind: login.SanctionMute, Level: CommandLevelMod},
+	"unmute":   {Kind: login.SanctionMute, Pardon: true, Level: CommandLevelMod},
+	"lock":     {Kind: login.SanctionLock, Level: CommandLevelAdmin},
+	"unlock":   {Kind: login.SanctionLock, Pardon: true, Level: CommandLevelAdmin},
+	"ipban":    {Kind: login.SanctionAddressBan, Level: CommandLevelAdmin},
+	"unipban":  {Kind: login.SanctionAddressBan, Pardon: true, Level: CommandLevelAdmin},
+	"uidban":   {Kind: login.SanctionUIDBan, Level: CommandLevelAdmin},
+	"unuidban": {Kind: login.SanctionUIDBan, Pardon: true, Level: CommandLevelAdmin},
+}
+
+// Moderate runs the moderation command cmd issued by the player against
+// name. The login service is asked off the tick, and the outcome is applied
+// to any affected players on this world on the tick after it answers. args
+// are the duration and reason of a new sanction.
+func (p *Player) Moderate(cmd string, name string, args []string) {
+	command, ok := moderationCommands[cmd]
+	if !ok {
+		return
+	}
+
+	target, err := p.sanctionTarget(command.Kind, name)
+	if err != nil {
+		p.Console(err.Error())
+		return
+	}
+
+	server := p.Client.Server
+
+	if command.Pardon {
+		go func() {
+			found, err := server.Login.Pardon(command.Kind, target)
+			p.World.runNextTick(func() {
+				p.pardoned(command.Kind, name, target, found, err)
+			})
+		}()
+		return
+	}
+
+	now := time.Now()
+	sanction := login.Sanction{
+		Kind:   command.Kind,
+		Target: target,
+		Issuer: p.Username,
+		Issued: now,
+	}
+
+	if len(args) > 0 {
+		if d, err := parseSanctionDuration(args[0]); err == nil {
+			sanction.Expires = now.Add(d)
+			args = args[1:]
+		}
+	}
+	sanction.Reason = strings.Join(args, " ")
+
+	go func() {
+		err := server.Login.Sanction(sanction)
+		p.World.runNextTick(func() {
+			p.sanctioned(sanction, name, err)
+		})
+	}()
+}
+
+// sanctioned applies a sanction the player placed against name once the
+// login service has answered with err.
+func (p *Player) sanctioned(sanction login.Sanction, name string, err error) {
+	server := p.Client.Server
+	if err != nil {
+		server.Logger.Error("could not place sanction", "kind", sanction.Kind, "target", sanction.Target, "error", err)
+		p.Console("The login server could not be reached.")
+		return
+	}
+	server.Logger.Info("sanction placed", "kind", sanction.Kind, "target", sanction.Target,
+		"issuer", p.Username, "expires", sanction.Expires, "reason", sanction.Reason)
+
+	p.World.enforce(sanction)
+
+	until := "permanently"
+	if !sanction.Permanent() {
+		until = "until " + sanction.Expires.UTC().Format("2006-01-02 15:04 MST")
+	}
+	p.Console(fmt.Sprintf("Placed a %s on %s %s.", sanction.Kind, name, until))
+}
+
+// pardoned applies a sanction the player lifted from name once the login
+// service has answered.
+func (p *Player) pardoned(kind login.SanctionKind, name string, target string, found bool, err error) {
+	server := p.Client.Server
+	if err != nil {
+		server.Logger.Error("could not lift sanction", "kind", kind, "target", target, "error", err)
+		p.Console("The login server could not be reached.")
+		return
+	}
+	if !found {
+		p.Console(fmt.Sprintf("%s has no %s.", name, kind))
+		return
+	}
+
+	if kind == login.SanctionMute {
+		if muted, ok := p.World.FindPlayer(target); ok {
+			muted.Muted = false
+			muted.MessageGame("You have been unmuted.", MessageTypeGame, "", "")
+		}
+	}
+	p.Console(fmt.Sprintf("Lifted the %s on %s.", kind, name))
+}
+
+// sanctionTarget resolves a command argument to the target of a sanction,
+// looking up the address or uid of an online player for address and uid
+// bans.
+func (p *Player) sanctionTarget(kind login.SanctionKind, arg string) (string, error) {
+	switch kind {
+	case login.SanctionAddressBan:
+		if net.ParseIP(arg) != nil {
+			return arg, nil
+		}
+		target, ok := p.World.FindPlayer(arg)
+		if !ok {
+			return "", errors.New(arg + " is not online and is not an IP address.")
+		}
+		return target.Address, nil
+	case login.SanctionUIDBan:
+		if uid, err := hex.DecodeString(arg); err == nil && len(uid) == 24 {
+			return arg, nil
+		}
+		target, ok := p.World.FindPlayer(arg)
+		if !ok {
+			return "", errors.New(arg + " is not online and is not a uid.")
+		}
+		return login.UIDTarget(target.UID), nil
+	default:
+		return arg, nil
+	}
+}
+
+// enforce applies a sanction that was just placed to the players it affects
+// on this world. Banned and locked players are kicked.
+func (w *World) enforce(s login.Sanction) {
+	for _, v := range w.Players {
+		if v == nil {
+			continue
+		}
+
+		switch s.Kind {
+		case login.SanctionBan, login.SanctionLock:
+			if strings.EqualFold(v.Username, s.Target) {
+				v.Kick()
+			}
+		case login.SanctionMute:
+			if strings.EqualFold(v.Username, s.Target) {
+				v.Muted = true
+				v.MutedUntil = s.Expires
+				v.MessageGame("You have been muted.", MessageTypeGame, "", "")
+			}
+		case login.SanctionAddressBan:
+			if v.Address == s.Target {
+				v.Kick()
+			}
+		case login.SanctionUIDBan:
+			if login.UIDTarget(v.UID) == s.Target {
+				v.Kick()
+			}
+		}
+	}
+}
+
+// parseSanctionDuration parses a sanction duration such as 30m, 12h or 7d.
+func parseSanctionDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
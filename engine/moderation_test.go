@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/login"
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+func Test_parseSanctionDuration(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "30m", want: 30 * time.Minute},
+		{s: "12h", want: 12 * time.Hour},
+		{s: "7d", want: 7 * 24 * time.Hour},
+		{s: "1h30m", want: 90 * time.Minute},
+		{s: "0d", wantErr: true},
+		{s: "-1h", wantErr: true},
+		{s: "d", wantErr: true},
+		{s: "spamming", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseSanctionDuration(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSanctionDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSanctionDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_IsMuted(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		player Player
+		want   bool
+	}{
+		{name: "not muted", player: Player{}, want: false},
+		{name: "permanent", player: Player{Muted: true}, want: true},
+		{name: "until later", player: Player{Muted: true, MutedUntil: now.Add(time.Minute)}, want: true},
+		{name: "expired", player: Player{Muted: true, MutedUntil: now.Add(-time.Minute)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.player.IsMuted(now); got != tt.want {
+				t.Errorf("IsMuted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newModerationTestPlayer returns a player logged in as username to w,
+// whose server uses service for logins.
+func newModerationTestPlayer(w *World, service *login.Local, username string) *Player {
+	p := addTestPlayer(w, 3200, 3200, 0)
+	p.Client = &Client{Server: &Server{Logger: *util.NewLogger(), Login: service}}
+	p.Username = username
+	return p
+}
+
+// waitQueued waits for work to be handed to the world's next tick, then
+// runs it.
+func waitQueued(t *testing.T, w *World) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.queuedLock.Lock()
+		n := len(w.queued)
+		w.queuedLock.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("nothing was queued for the next tick")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	w.runQueued()
+}
+
+func TestPlayer_Moderate(t *testing.T) {
+	w := newTestWorld()
+	service := login.NewLocal(nil)
+	mod := newModerationTestPlayer(w, service, "mod")
+	bob := newModerationTestPlayer(w, service, "bob")
+	zezima := newModerationTestPlayer(w, service, "zezima")
+
+	mod.Moderate("mute", "Bob", []string{"1h", "spam"})
+	if bob.Muted {
+		t.Fatalf("bob was muted before the login service answered")
+	}
+	waitQueued(t, w)
+	if !bob.IsMuted(time.Now()) {
+		t.Errorf("bob isn't muted after the login service answered")
+	}
+	if lines := consoleLines(mod); len(lines) != 1 || !strings.HasPrefix(lines[0], "Placed a mute on Bob until ") {
+		t.Errorf("console = %q, want the mute confirmed", lines)
+	}
+
+	mod.Moderate("unmute", "bob", nil)
+	waitQueued(t, w)
+	if bob.Muted {
+		t.Errorf("bob is still muted after unmute")
+	}
+
+	mod.Moderate("ban", "zezima", nil)
+	waitQueued(t, w)
+	if !zezima.kicked {
+		t.Errorf("zezima wasn't kicked when banned")
+	}
+	if got := sent(zezima); len(got) == 0 || got[len(got)-1] != util.ServerProtLogout {
+		t.Errorf("zezima was sent %v, want LOGOUT last", got)
+	}
+	if bob.kicked || mod.kicked {
+		t.Errorf("players other than zezima were kicked")
+	}
+}
@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"github.com/zsrv/rt5-server-go/engine/pathfinding"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// movement types sent for a player in the GPI active player section
+const (
+	MoveNone     = 0
+	MoveWalk     = 1
+	MoveRun      = 2
+	MoveTeleport = 3
+)
+
+// Run energy is kept in hundredths of a percent, the same as the client
+// displays it.
+const (
+	RunEnergyMax = 10000
+
+	// energy used for each tick spent running
+	runEnergyDrain = 67
+	// energy restored for each tick spent not running, before the agility
+	// bonus
+	runEnergyRestore = 8
+)
+
+// walkDirections holds the tile delta for each 3 bit walk direction.
+var walkDirections = [8][2]int{
+	{-1, -1}, {0, -1}, {1, -1},
+	{-1, 0}, {1, 0},
+	{-1, 1}, {0, 1}, {1, 1},
+}
+
+// runDirections holds the tile delta for each 4 bit run direction.
+var runDirections = [16][2]int{
+	{-2, -2}, {-1, -2}, {0, -2}, {1, -2}, {2, -2},
+	{-2, -1}, {2, -1},
+	{-2, 0}, {2, 0},
+	{-2, 1}, {2, 1},
+	{-2, 2}, {-1, 2}, {0, 2}, {1, 2}, {2, 2},
+}
+
+// walkDirection returns the walk direction for a one tile move, or -1 if
+// there isn't one.
+func walkDirection(dx int, dz int) int {
+	for i, v := range walkDirections {
+		if v[0] == dx && v[1] == dz {
+			return i
+		}
+	}
+	return -1
+}
+
+// runDirection returns the run direction for a two tile move, or -1 if there
+// isn't one.
+func runDirection(dx int, dz int) int {
+	for i, v := range runDirections {
+		if v[0] == dx && v[1] == dz {
+			return i
+		}
+	}
+	return -1
+}
+
+// Step is a tile on a player's path.
+type Step struct {
+	X int
+	Z int
+}
+
+// MoveClick is a MOVE_GAMECLICK or MOVE_MINIMAPCLICK request to walk to a
+// tile.
+type MoveClick struct {
+	X int
+	Z int
+	// Ctrl is set if the player held ctrl while clicking, which runs if
+	// they would walk and walks if they would run.
+	Ctrl bool
+}
+
+// decodeMoveClick decodes the MOVE_GAMECLICK payload, which
+// MOVE_MINIMAPCLICK starts with too.
+func decodeMoveClick(buf *packet.Packet) (click MoveClick, err error) {
+	defer recoverDecode(&err)
+
+	click.Ctrl = buf.G1Alt1() != 0
+	click.X = int(buf.G2())
+	click.Z = int(buf.G2Alt1())
+	return click, nil
+}
+
+// WalkTo replaces the player's path with a route to the tile x, z, or as
+// close to it as they can get.
+func (p *Player) WalkTo(x int, z int, ctrl bool) {
+	route := p.World.PathFinder.FindPath(p.World.Collision, p.Pos.X, p.Pos.Z, p.Pos.Plane, 1,
+		pathfinding.TileDestination(x, z), true)
+
+	p.Steps = routeSteps(p.Pos.X, p.Pos.Z, route.Waypoints)
+	p.RunPath = p.Running != ctrl
+	p.interaction = nil
+}
+
+// Teleport moves the player straight to x, z on plane. If that's outside
+// the middle of their build area, it's rebuilt around them on the next tick.
+func (p *Player) Teleport(x int, z int, plane int) {
+	p.LastPos.Clone(p.Pos)
+	p.Pos.X = x
+	p.Pos.Z = z
+	p.Pos.Plane = plane
+	p.Placement = true
+	p.Steps = nil
+	p.interaction = nil
+}
+
+// SetRunning switches the player's run setting, along with whether they're
+// running the rest of the current path.
+func (p *Player) SetRunning(running bool) {
+	p.Running = running
+	p.RunPath = running
+	p.SetVarp(VarpRunning, boolBit(running))
+}
+
+// routeSteps returns every tile walked along a route's waypoints, starting
+// from the tile after x, z.
+func routeSteps(x int, z int, waypoints []pathfinding.Point) []Step {
+	var steps []Step
+	for _, v := range waypoints {
+		steps = append(steps, naivePath(x, z, v.X, v.Z)...)
+		x, z = v.X, v.Z
+	}
+	return steps
+}
+
+// naivePath returns the steps from one tile to another, moving diagonally
+// until lined up and then straight, ignoring anything in the way. The tiles
+// between two waypoints are always on such a path.
+func naivePath(fromX int, fromZ int, toX int, toZ int) []Step {
+	var steps []Step
+
+	x, z := fromX, fromZ
+	for x != toX || z != toZ {
+		x += sign(toX - x)
+		z += sign(toZ - z)
+		steps = append(steps, Step{X: x, Z: z})
+	}
+	return steps
+}
+
+func sign(v int) int {
+	if v < 0 {
+		return -1
+	} else if v > 0 {
+		return 1
+	}
+	return 0
+}
+
+// ProcessMovement moves the player along their path for this tick, a tile
+// when walking or two when running, and sets MoveType and MoveDirection for
+// the GPI.
+func (p *Player) ProcessMovement() {
+	p.MoveType = MoveNone
+	p.MoveDirection = 0
+
+	if p.Placement {
+		// teleported, so LastPos is where they came from
+		p.MoveType = MoveTeleport
+		return
+	}
+
+	p.LastPos.Clone(p.Pos)
+	if len(p.Steps) == 0 {
+		p.restoreRunEnergy()
+		return
+	}
+
+	p.takeStep()
+
+	if p.RunPath && len(p.Steps) > 0 && p.RunEnergy >= runEnergyDrain {
+		p.takeStep()
+		p.RunEnergy -= runEnergyDrain
+		if p.RunEnergy < runEnergyDrain {
+			// out of energy, so run is switched off
+			p.SetRunning(false)
+		}
+	} else {
+		p.restoreRunEnergy()
+	}
+
+	dx := p.Pos.X - p.LastPos.X
+	dz := p.Pos.Z - p.LastPos.Z
+	if dir := runDirection(dx, dz); dir != -1 {
+		p.MoveType = MoveRun
+		p.MoveDirection = dir
+	} else if dir := walkDirection(dx, dz); dir != -1 {
+		// running around a corner can end up a single tile away
+		p.MoveType = MoveWalk
+		p.MoveDirection = dir
+	}
+}
+
+func (p *Player) takeStep() {
+	step := p.Steps[0]
+	p.Steps = p.Steps[1:]
+
+	p.Pos.X = step.X
+	p.Pos.Z = step.Z
+}
+
+func (p *Player) restoreRunEnergy() {
+	// TODO: add the agility bonus once skills exist
+	p.RunEnergy = min(p.RunEnergy+runEnergyRestore, RunEnergyMax)
+}
+
+// putMovement writes the movement part of the player's GPI active player
+// entry.
+func (p *Player) putMovement(buf *packet.PacketBit) {
+	buf.PBit(2, p.MoveType)
+	switch p.MoveType {
+	case MoveWalk:
+		buf.PBit(3, p.MoveDirection)
+	case MoveRun:
+		buf.PBit(4, p.MoveDirection)
+	case MoveTeleport:
+		dx := p.Pos.X - p.LastPos.X
+		dz := p.Pos.Z - p.LastPos.Z
+		plane := (p.Pos.Plane - p.LastPos.Plane) & 0x3
+
+		if dx >= -15 && dx <= 15 && dz >= -15 && dz <= 15 {
+			buf.PBit(1, 0)
+			buf.PBit(12, plane<<10|(dx&0x1f)<<5|dz&0x1f)
+		} else {
+			buf.PBit(1, 1)
+			buf.PBit(30, plane<<28|(dx&0x3fff)<<14|dz&0x3fff)
+		}
+	}
+}
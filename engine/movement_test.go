@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/pathfinding"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// bitReader reads the bit-packed sections of a packet the way the client
+// does.
+type bitReader struct {
+	buf    []byte
+	offset int
+}
+
+func (r *bitReader) bits(n int) int {
+	value := 0
+	for i := 0; i < n; i++ {
+		b := r.buf[r.offset>>3] >> (7 - r.offset&7) & 1
+		value = value<<1 | int(b)
+		r.offset++
+	}
+	return value
+}
+
+// newTestWorld returns a world that isn't ticking, with no collision.
+func newTestWorld() *World {
+	return &World{
+		Players:    make([]*Player, 2046),
+		NPCs:       make([]*NPC, maxNPCs),
+		Collision:  collision.NewMap(),
+		PathFinder: pathfinding.NewPathFinder(),
+	}
+}
+
+func newTestPlayer(x int, z int) *Player {
+	p := NewPlayer(nil)
+	p.World = newTestWorld()
+	p.Pos = util.NewPosition(x, z, 0)
+	p.Appearance = new(packet.Packet)
+	p.Loaded = true
+	p.World.AddPlayer(p)
+	p.putInitGPI(new(packet.PacketBit))
+	return p
+}
+
+func Test_decodeMoveClick(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    MoveClick
+		wantErr bool
+	}{
+		{
+			name:    "walk",
+			payload: []byte{128, 0x0c, 0x5a, 0xa2, 0x0d},
+			want:    MoveClick{X: 3162, Z: 3490},
+		},
+		{
+			name:    "ctrl click",
+			payload: []byte{129, 0x0c, 0x5a, 0xa2, 0x0d},
+			want:    MoveClick{X: 3162, Z: 3490, Ctrl: true},
+		},
+		{
+			name: "minimap click",
+			payload: []byte{128, 0x0c, 0x5a, 0xa2, 0x0d,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			want: MoveClick{X: 3162, Z: 3490},
+		},
+		{
+			name:    "truncated",
+			payload: []byte{128, 0x0c, 0x5a},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMoveClick(packet.NewPacket(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeMoveClick() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want && !tt.wantErr {
+				t.Errorf("decodeMoveClick() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_routeSteps(t *testing.T) {
+	tests := []struct {
+		name      string
+		waypoints []pathfinding.Point
+		want      []Step
+	}{
+		{
+			name: "no waypoints",
+			want: nil,
+		},
+		{
+			name:      "diagonal then straight",
+			waypoints: []pathfinding.Point{{X: 1, Z: -1}, {X: 3, Z: -1}},
+			want:      []Step{{1, -1}, {2, -1}, {3, -1}},
+		},
+		{
+			name:      "around a corner",
+			waypoints: []pathfinding.Point{{X: 0, Z: 2}, {X: 2, Z: 2}, {X: 2, Z: 0}},
+			want:      []Step{{0, 1}, {0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeSteps(0, 0, tt.waypoints); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routeSteps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayer_WalkTo_Walls(t *testing.T) {
+	p := newTestPlayer(3200, 3200)
+
+	// a wall along the east side of the player's column, open at the north
+	for z := 3196; z <= 3202; z++ {
+		p.World.Collision.AddWall(3200, z, 0, collision.WallStraight, 2, false)
+	}
+
+	p.WalkTo(3201, 3200, false)
+
+	// the wall stops the player cutting the corner at either end
+	want := []Step{
+		{3200, 3201}, {3200, 3202}, {3200, 3203},
+		{3201, 3203}, {3201, 3202}, {3201, 3201}, {3201, 3200},
+	}
+	if !reflect.DeepEqual(p.Steps, want) {
+		t.Errorf("Steps = %v, want %v", p.Steps, want)
+	}
+}
+
+func TestPlayer_ProcessMovement(t *testing.T) {
+	type tick struct {
+		x, z      int
+		moveType  int
+		direction int
+	}
+	tests := []struct {
+		name      string
+		toX, toZ  int
+		running   bool
+		ctrl      bool
+		energy    int
+		ticks     []tick
+		wantSteps int
+	}{
+		{
+			name: "walk",
+			toX:  3, toZ: 3488,
+			energy: RunEnergyMax,
+			ticks: []tick{
+				{1, 3490, MoveWalk, 4},
+				{2, 3489, MoveWalk, 2},
+				{3, 3488, MoveWalk, 2},
+				{3, 3488, MoveNone, 0},
+			},
+		},
+		{
+			name: "run",
+			toX:  0, toZ: 3495,
+			running: true,
+			energy:  RunEnergyMax,
+			ticks: []tick{
+				{0, 3492, MoveRun, 13},
+				{0, 3494, MoveRun, 13},
+				{0, 3495, MoveWalk, 6},
+			},
+		},
+		{
+			name: "ctrl click runs while walking",
+			toX:  -4, toZ: 3490,
+			ctrl:   true,
+			energy: RunEnergyMax,
+			ticks: []tick{
+				{-2, 3490, MoveRun, 7},
+				{-4, 3490, MoveRun, 7},
+			},
+		},
+		{
+			name: "run around a corner",
+			toX:  2, toZ: 3491,
+			running: true,
+			energy:  RunEnergyMax,
+			ticks: []tick{
+				{2, 3491, MoveRun, 10},
+			},
+		},
+		{
+			name: "out of energy",
+			toX:  0, toZ: 3496,
+			running: true,
+			energy:  runEnergyDrain,
+			ticks: []tick{
+				{0, 3492, MoveRun, 13},
+				{0, 3493, MoveWalk, 6},
+			},
+			wantSteps: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlayer(0, 3490)
+			p.Running = tt.running
+			p.RunEnergy = tt.energy
+			p.WalkTo(tt.toX, tt.toZ, tt.ctrl)
+
+			for i, want := range tt.ticks {
+				p.ProcessMovement()
+
+				if p.Pos.X != want.x || p.Pos.Z != want.z {
+					t.Fatalf("tick %d: position = %v, want (%v, %v)", i, p.Pos.ToString(), want.x, want.z)
+				}
+				if p.MoveType != want.moveType || p.MoveDirection != want.direction {
+					t.Errorf("tick %d: movement = %v %v, want %v %v", i, p.MoveType, p.MoveDirection, want.moveType, want.direction)
+				}
+
+				// the GPI entry must move the client's copy of the player
+				// the same way
+				var buf packet.PacketBit
+				p.ProcessActivePlayers(&buf, new(packet.Packet), true)
+
+				r := bitReader{buf: buf.Bytes()}
+				if want.moveType == MoveNone {
+					if r.bits(1) != 0 {
+						t.Errorf("tick %d: GPI has an update, want none", i)
+					}
+					continue
+				}
+				if r.bits(1) != 1 || r.bits(1) != 0 {
+					t.Fatalf("tick %d: GPI update flags wrong", i)
+				}
+				moveType := r.bits(2)
+				var delta [2]int
+				switch moveType {
+				case MoveWalk:
+					delta = walkDirections[r.bits(3)]
+				case MoveRun:
+					delta = runDirections[r.bits(4)]
+				default:
+					t.Fatalf("tick %d: GPI movement type = %v", i, moveType)
+				}
+				if p.LastPos.X+delta[0] != want.x || p.LastPos.Z+delta[1] != want.z {
+					t.Errorf("tick %d: GPI moves %v from %v, want (%v, %v)", i, delta, p.LastPos.ToString(), want.x, want.z)
+				}
+			}
+
+			if len(p.Steps) != tt.wantSteps {
+				t.Errorf("steps left = %v, want %v", len(p.Steps), tt.wantSteps)
+			}
+		})
+	}
+}
+
+func TestPlayer_RunEnergy(t *testing.T) {
+	p := newTestPlayer(0, 0)
+	p.Running = true
+	p.RunEnergy = 1000
+
+	p.WalkTo(0, 10, false)
+	for i := 0; i < 5; i++ {
+		p.ProcessMovement()
+	}
+	if want := 1000 - 5*runEnergyDrain; p.RunEnergy != want {
+		t.Errorf("RunEnergy after running = %v, want %v", p.RunEnergy, want)
+	}
+
+	p.RunEnergy = RunEnergyMax - 1
+	p.ProcessMovement()
+	if p.RunEnergy != RunEnergyMax {
+		t.Errorf("RunEnergy while standing = %v, want %v", p.RunEnergy, RunEnergyMax)
+	}
+}
@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"math/rand"
+
+	"github.com/zsrv/rt5-server-go/engine/pathfinding"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// maxNPCs is how many NPCs the world can hold. The client reads NPC indices
+// in 15 bits, with the last one ending the list.
+const maxNPCs = 32767
+
+// NPC update masks, flagging what follows in an NPC's update block.
+// TODO: confirm the bits and the order against a 578 client
+const (
+	NPCMaskHit        = 0x1
+	NPCMaskHit2       = 0x2
+	NPCMaskFaceEntity = 0x4
+	NPCMaskAnim       = 0x8
+	NPCMaskSpotAnim   = 0x10
+	NPCMaskForcedChat = 0x20
+	NPCMaskFaceCoord  = 0x40
+)
+
+// npcMaskOrder is the order the client reads the NPC masks in.
+var npcMaskOrder = []int{
+	NPCMaskSpotAnim,
+	NPCMaskAnim,
+	NPCMaskForcedChat,
+	NPCMaskFaceEntity,
+	NPCMaskFaceCoord,
+	NPCMaskHit,
+	NPCMaskHit2,
+}
+
+// npcWanderChance is the chance each tick, one in this many, that an idle
+// NPC sets off somewhere new.
+const npcWanderChance = 8
+
+// NPCSpawn is where an NPC is put when the world starts.
+type NPCSpawn struct {
+	Type  int `json:"type"`
+	X     int `json:"x"`
+	Z     int `json:"z"`
+	Plane int `json:"plane"`
+	// Wander is how far from its spawn the NPC walks around, or 0 if it
+	// stays put.
+	Wander int `json:"wander"`
+	// Direction is the way the NPC faces, as a walk direction.
+	Direction int `json:"direction"`
+}
+
+// LoadNPCSpawns reads a JSON array of spawns from path.
+func LoadNPCSpawns(path string) ([]NPCSpawn, error) {
+	var spawns []NPCSpawn
+	err := util.ReadJSON(path, &spawns)
+	return spawns, err
+}
+
+type NPC struct {
+	// ID is the NPC's index in the world.
+	ID   int
+	Type int
+	// Size is how many tiles wide and long the NPC is.
+	Size int
+
+	World *World
+
+	Spawn   *util.Position
+	Wander  int
+	LastPos *util.Position
+	Pos     *util.Position
+	// Direction is the way the NPC faces when it's added to a client.
+	Direction int
+
+	// the tile the NPC is wandering to, if it is
+	wanderX, wanderZ int
+	wandering        bool
+
+	// Placement is set on the tick the NPC is teleported.
+	Placement bool
+	// the movement made this tick, for NPC_INFO
+	MoveType      int
+	MoveDirection int
+
+	Health    int
+	MaxHealth int
+
+	masks masks
+}
+
+func NewNPC(spawn NPCSpawn) *NPC {
+	return &NPC{
+		Type: spawn.Type,
+		Size: 1,
+
+		Spawn:     util.NewPosition(spawn.X, spawn.Z, spawn.Plane),
+		Wander:    spawn.Wander,
+		LastPos:   util.NewPosition(spawn.X, spawn.Z, spawn.Plane),
+		Pos:       util.NewPosition(spawn.X, spawn.Z, spawn.Plane),
+		Direction: spawn.Direction,
+
+		Health:    10,
+		MaxHealth: 10,
+	}
+}
+
+// Tick moves the NPC.
+func (n *NPC) Tick() {
+	n.MoveType = MoveNone
+	n.MoveDirection = 0
+
+	if n.Placement {
+		n.MoveType = MoveTeleport
+		return
+	}
+	n.LastPos.Clone(n.Pos)
+
+	if !n.wandering {
+		if n.Wander <= 0 || rand.Intn(npcWanderChance) != 0 {
+			return
+		}
+		n.wanderX = n.Spawn.X + rand.Intn(n.Wander*2+1) - n.Wander
+		n.wanderZ = n.Spawn.Z + rand.Intn(n.Wander*2+1) - n.Wander
+		n.wandering = true
+	}
+
+	dx, dz, ok := pathfinding.DumbStep(n.World.Collision, n.Pos.X, n.Pos.Z, n.Pos.Plane, n.Size, n.wanderX, n.wanderZ)
+	if !ok {
+		// there, or stuck
+		n.wandering = false
+		return
+	}
+	n.Pos.X += dx
+	n.Pos.Z += dz
+	n.MoveType = MoveWalk
+	n.MoveDirection = walkDirection(dx, dz)
+}
+
+// Anim plays the seq id, after delay client cycles. -1 stops the current
+// one.
+func (n *NPC) Anim(id int, delay int) {
+	n.masks.anim = id
+	n.masks.animDelay = delay
+	n.masks.set(NPCMaskAnim)
+}
+
+// SpotAnim plays the spot anim id height units above the NPC, after delay
+// client cycles.
+func (n *NPC) SpotAnim(id int, height int, delay int) {
+	n.masks.spotAnim = id
+	n.masks.spotAnimHeight = height
+	n.masks.spotAnimDelay = delay
+	n.masks.set(NPCMaskSpotAnim)
+}
+
+// Say makes the NPC say text over its head.
+func (n *NPC) Say(text string) {
+	n.masks.forcedChat = text
+	n.masks.set(NPCMaskForcedChat)
+}
+
+// FaceEntity turns the NPC to follow a player (offset as by FacePlayer),
+// another NPC by index, or nothing with FaceNone.
+func (n *NPC) FaceEntity(index int) {
+	n.masks.faceEntity = index
+	n.masks.set(NPCMaskFaceEntity)
+}
+
+// FacePlayer turns the NPC to follow p.
+func (n *NPC) FacePlayer(p *Player) {
+	n.FaceEntity(p.ID + faceEntityPlayer)
+}
+
+// FaceCoord turns the NPC towards the tile x, z.
+func (n *NPC) FaceCoord(x int, z int) {
+	n.masks.faceX = x
+	n.masks.faceZ = z
+	n.masks.set(NPCMaskFaceCoord)
+}
+
+// Hit shows a hit splat over the NPC, with its health bar. Up to two can be
+// shown each tick; any more are dropped.
+func (n *NPC) Hit(damage int, hitType int) {
+	n.masks.hit(Hit{Damage: damage, Type: hitType}, NPCMaskHit, NPCMaskHit2)
+}
+
+func (n *NPC) needsMaskUpdate() bool {
+	return n.masks.flags != 0
+}
+
+// AppendUpdateBlock writes the NPC's update block, which is the same for
+// every observer.
+func (n *NPC) AppendUpdateBlock(buf *packet.Packet) {
+	block := n.masks.block(n.masks.flags, n.encodeUpdateBlock)
+	buf.PData(block, len(block))
+}
+
+func (n *NPC) encodeUpdateBlock(flags int) []byte {
+	var buf packet.Packet
+	buf.P1(uint8(flags))
+
+	m := &n.masks
+	for _, mask := range npcMaskOrder {
+		if flags&mask == 0 {
+			continue
+		}
+
+		switch mask {
+		case NPCMaskSpotAnim:
+			buf.P2(uint16(m.spotAnim))
+			buf.P4(uint32(m.spotAnimHeight<<16 | m.spotAnimDelay&0xffff))
+		case NPCMaskAnim:
+			buf.P2(uint16(m.anim))
+			buf.P1(uint8(m.animDelay))
+		case NPCMaskForcedChat:
+			buf.PJStr(m.forcedChat)
+		case NPCMaskFaceEntity:
+			buf.P2(uint16(m.faceEntity))
+		case NPCMaskFaceCoord:
+			buf.P2(uint16(m.faceX*2 + 1))
+			buf.P2(uint16(m.faceZ*2 + 1))
+		case NPCMaskHit, NPCMaskHit2:
+			hit := m.hits[0]
+			if mask == NPCMaskHit2 {
+				hit = m.hits[1]
+			}
+			buf.PSmart(uint16(hit.Damage))
+			buf.P1(uint8(hit.Type))
+			if mask == NPCMaskHit {
+				buf.P1(uint8(healthBar(n.Health, n.MaxHealth)))
+			}
+		}
+	}
+	return buf.Bytes()
+}
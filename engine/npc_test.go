@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNPC_Tick_Wander(t *testing.T) {
+	w := newTestWorld()
+	n := NewNPC(NPCSpawn{Type: 1, X: 3200, Z: 3200, Wander: 3})
+	w.AddNPC(n)
+
+	// a blocked tile next to the spawn
+	w.Collision.AddFloor(3201, 3200, 0)
+
+	moved := false
+	for i := 0; i < 1000; i++ {
+		n.Tick()
+
+		if n.MoveType == MoveWalk {
+			moved = true
+			dir := walkDirections[n.MoveDirection]
+			if n.LastPos.X+dir[0] != n.Pos.X || n.LastPos.Z+dir[1] != n.Pos.Z {
+				t.Fatalf("tick %d: moved from %v to %v, direction %v", i, n.LastPos.ToString(), n.Pos.ToString(), n.MoveDirection)
+			}
+		}
+		if !n.Spawn.Near(n.Pos, n.Wander) {
+			t.Fatalf("tick %d: wandered to %v, more than %d from %v", i, n.Pos.ToString(), n.Wander, n.Spawn.ToString())
+		}
+		if n.Pos.X == 3201 && n.Pos.Z == 3200 {
+			t.Fatalf("tick %d: walked onto a blocked tile", i)
+		}
+	}
+	if !moved {
+		t.Errorf("never moved")
+	}
+}
+
+func TestNPC_Tick_NoWander(t *testing.T) {
+	w := newTestWorld()
+	n := NewNPC(NPCSpawn{Type: 1, X: 3200, Z: 3200})
+	w.AddNPC(n)
+
+	for i := 0; i < 100; i++ {
+		n.Tick()
+		if n.MoveType != MoveNone {
+			t.Fatalf("tick %d: move type = %v, want none", i, n.MoveType)
+		}
+	}
+}
+
+func TestLoadNPCSpawns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "npcs.json")
+	config := `[
+		{"type": 0, "x": 3222, "z": 3222, "wander": 5},
+		{"type": 520, "x": 3212, "z": 3246, "plane": 1, "direction": 6}
+	]`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadNPCSpawns(path)
+	if err != nil {
+		t.Fatalf("LoadNPCSpawns() error = %v", err)
+	}
+	want := []NPCSpawn{
+		{Type: 0, X: 3222, Z: 3222, Wander: 5},
+		{Type: 520, X: 3212, Z: 3246, Plane: 1, Direction: 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadNPCSpawns() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWorld_AddNPC(t *testing.T) {
+	w := newTestWorld()
+	a := NewNPC(NPCSpawn{})
+	b := NewNPC(NPCSpawn{})
+	w.AddNPC(a)
+	w.AddNPC(b)
+	w.RemoveNPC(a)
+
+	c := NewNPC(NPCSpawn{})
+	if !w.AddNPC(c) {
+		t.Fatalf("AddNPC() = false")
+	}
+	if c.ID != 0 || w.GetNPC(0) != c || w.GetNPC(1) != b {
+		t.Errorf("index not reused: c.ID = %v", c.ID)
+	}
+	if w.GetNPC(-1) != nil || w.GetNPC(maxNPCs) != nil {
+		t.Errorf("GetNPC() out of range returned an NPC")
+	}
+}
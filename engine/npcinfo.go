@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+const (
+	// maxLocalNPCs caps the NPCs a client has at once, as it reads the
+	// count in 8 bits.
+	maxLocalNPCs = 255
+	// the index that ends the list of added NPCs
+	npcListEnd = 32767
+)
+
+// npcInfo is what a player's client knows about the NPCs around them.
+type npcInfo struct {
+	// local holds the NPCs the client has, in the order it has them.
+	local []*NPC
+	// isLocal holds the indices of the NPCs in local.
+	isLocal map[int]bool
+}
+
+// SendNPCInfo queues NPC_INFO, which moves the NPCs around the player on the
+// client.
+func (p *Player) SendNPCInfo() {
+	var response packet.PacketBit
+	response.P1(util.ServerProtNPCInfo)
+	response.P2(0)
+	start := response.Len() // offset
+
+	payload := p.encodeNPCInfo()
+	response.PData(payload, len(payload))
+
+	response.PSize2(response.Len() - start) // offset
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// canSeeNPC reports whether n is close enough to be sent to the player. Its
+// position is sent in 5 bits each way, relative to the player.
+func (p *Player) canSeeNPC(n *NPC) bool {
+	return n.Pos.Plane == p.Pos.Plane && p.Pos.Near(n.Pos, viewDistance)
+}
+
+// encodeNPCInfo returns the NPC_INFO payload for this tick: an update for
+// each NPC the client has, the NPCs that came into view, then the update
+// blocks of every NPC flagged for one, in the order they were flagged.
+func (p *Player) encodeNPCInfo() []byte {
+	info := &p.npcs
+	if info.isLocal == nil {
+		info.isLocal = make(map[int]bool)
+	}
+
+	var buf packet.PacketBit
+	var updateBlock packet.Packet
+
+	buf.AccessBits()
+	buf.PBit(8, len(info.local))
+
+	kept := info.local[:0]
+	for _, n := range info.local {
+		if p.World.GetNPC(n.ID) != n || !p.canSeeNPC(n) || n.MoveType == MoveTeleport {
+			// removed, and added again next tick if it's still in view
+			buf.PBit(1, 1)
+			buf.PBit(2, 3)
+			delete(info.isLocal, n.ID)
+			continue
+		}
+		kept = append(kept, n)
+
+		maskUpdate := n.needsMaskUpdate()
+		if n.MoveType == MoveWalk {
+			buf.PBit(1, 1)
+			buf.PBit(2, 1)
+			buf.PBit(3, n.MoveDirection)
+			buf.PBit(1, boolBit(maskUpdate))
+		} else if maskUpdate {
+			buf.PBit(1, 1)
+			buf.PBit(2, 0)
+		} else {
+			buf.PBit(1, 0)
+		}
+		if maskUpdate {
+			n.AppendUpdateBlock(&updateBlock)
+		}
+	}
+	info.local = kept
+
+	// TODO: look NPCs up by zone instead of checking every one
+	for _, n := range p.World.NPCs {
+		if len(info.local) >= maxLocalNPCs {
+			break
+		}
+		if n == nil || info.isLocal[n.ID] || !p.canSeeNPC(n) || n.MoveType == MoveTeleport {
+			continue
+		}
+
+		maskUpdate := n.needsMaskUpdate()
+		buf.PBit(15, n.ID)
+		buf.PBit(3, n.Direction)
+		buf.PBit(1, boolBit(maskUpdate))
+		buf.PBit(5, (n.Pos.Z-p.Pos.Z)&0x1f)
+		buf.PBit(5, (n.Pos.X-p.Pos.X)&0x1f)
+		buf.PBit(1, 1) // forget any path the client had for it
+		buf.PBit(14, n.Type)
+		if maskUpdate {
+			n.AppendUpdateBlock(&updateBlock)
+		}
+
+		info.local = append(info.local, n)
+		info.isLocal[n.ID] = true
+	}
+	buf.PBit(15, npcListEnd)
+	buf.AccessBytes()
+
+	x := updateBlock.Bytes()
+	buf.PData(x, len(x))
+	return buf.Bytes()
+}
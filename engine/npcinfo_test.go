@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// npcBlock is an NPC update block as the client reads it.
+type npcBlock struct {
+	Flags      int
+	Hits       []Hit
+	HealthBar  int
+	FaceEntity int
+	Anim       [2]int
+	SpotAnim   [3]int
+	ForcedChat string
+	FaceCoord  [2]int
+}
+
+// decodeNPCUpdateBlock reads an NPC update block, in npcMaskOrder.
+func decodeNPCUpdateBlock(buf *packet.Packet) npcBlock {
+	var b npcBlock
+
+	b.Flags = int(buf.G1())
+	for _, mask := range npcMaskOrder {
+		if b.Flags&mask == 0 {
+			continue
+		}
+
+		switch mask {
+		case NPCMaskSpotAnim:
+			id := int(buf.G2())
+			v := int(buf.G4())
+			b.SpotAnim = [3]int{id, v >> 16, v & 0xffff}
+		case NPCMaskAnim:
+			b.Anim = [2]int{int(buf.G2()), int(buf.G1())}
+		case NPCMaskForcedChat:
+			b.ForcedChat = buf.GJStr()
+		case NPCMaskFaceEntity:
+			b.FaceEntity = int(buf.G2())
+		case NPCMaskFaceCoord:
+			b.FaceCoord = [2]int{int(buf.G2()), int(buf.G2())}
+		case NPCMaskHit, NPCMaskHit2:
+			b.Hits = append(b.Hits, Hit{Damage: int(buf.GSmart()), Type: int(buf.G1())})
+			if mask == NPCMaskHit {
+				b.HealthBar = int(buf.G1())
+			}
+		}
+	}
+	return b
+}
+
+// npcClient decodes NPC_INFO the way the client does, keeping its own copy
+// of the NPCs around the player.
+type npcClient struct {
+	local []int
+	// positions and types of the NPCs the client has, by index
+	x, z  map[int]int
+	types map[int]int
+	// the update blocks read in the last packet, by index
+	blocks map[int]npcBlock
+}
+
+func newNPCClient() *npcClient {
+	return &npcClient{x: map[int]int{}, z: map[int]int{}, types: map[int]int{}}
+}
+
+// read decodes an NPC_INFO payload sent to observer.
+func (c *npcClient) read(observer *Player, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	r := bitReader{buf: payload}
+	c.blocks = map[int]npcBlock{}
+	var flagged []int
+
+	count := r.bits(8)
+	if count > len(c.local) {
+		return fmt.Errorf("count %d, but the client has %d NPCs", count, len(c.local))
+	}
+	var kept []int
+	for _, index := range c.local[:count] {
+		if r.bits(1) == 0 {
+			kept = append(kept, index)
+			continue
+		}
+
+		switch r.bits(2) {
+		case 0:
+			flagged = append(flagged, index)
+		case 1:
+			delta := walkDirections[r.bits(3)]
+			c.x[index] += delta[0]
+			c.z[index] += delta[1]
+			if r.bits(1) == 1 {
+				flagged = append(flagged, index)
+			}
+		case 2:
+			return fmt.Errorf("NPC %d runs", index)
+		case 3:
+			delete(c.x, index)
+			delete(c.z, index)
+			delete(c.types, index)
+			continue
+		}
+		kept = append(kept, index)
+	}
+	c.local = kept
+
+	for {
+		index := r.bits(15)
+		if index == npcListEnd {
+			break
+		}
+		_ = r.bits(3) // direction
+		masked := r.bits(1) == 1
+		dz := signed(r.bits(5), 5)
+		dx := signed(r.bits(5), 5)
+		_ = r.bits(1) // clear path
+		c.types[index] = r.bits(14)
+		c.x[index] = observer.Pos.X + dx
+		c.z[index] = observer.Pos.Z + dz
+		c.local = append(c.local, index)
+		if masked {
+			flagged = append(flagged, index)
+		}
+	}
+
+	buf := packet.NewPacket(payload[(r.offset+7)/8:])
+	for _, index := range flagged {
+		c.blocks[index] = decodeNPCUpdateBlock(buf)
+	}
+	if buf.Len() != 0 {
+		return fmt.Errorf("%d bytes left over", buf.Len())
+	}
+	return nil
+}
+
+// check fails t if the client's NPCs aren't where the server has them.
+func (c *npcClient) check(t *testing.T, w *World) {
+	t.Helper()
+
+	for _, index := range c.local {
+		n := w.GetNPC(index)
+		if n == nil {
+			t.Errorf("client has NPC %d, which isn't in the world", index)
+			continue
+		}
+		if c.x[index] != n.Pos.X || c.z[index] != n.Pos.Z || c.types[index] != n.Type {
+			t.Errorf("client has NPC %d as type %d at (%d, %d), want type %d at (%d, %d)",
+				index, c.types[index], c.x[index], c.z[index], n.Type, n.Pos.X, n.Pos.Z)
+		}
+	}
+}
+
+// stepNPC moves n one tile, as its Tick would.
+func stepNPC(n *NPC, dx int, dz int) {
+	n.LastPos.Clone(n.Pos)
+	n.Pos.X += dx
+	n.Pos.Z += dz
+	n.MoveType = MoveWalk
+	n.MoveDirection = walkDirection(dx, dz)
+}
+
+func TestPlayer_encodeNPCInfo(t *testing.T) {
+	type tick struct {
+		do         func(w *World, npcs []*NPC)
+		wantLocal  []int
+		wantBlocks map[int]npcBlock
+	}
+	tests := []struct {
+		name   string
+		spawns []NPCSpawn
+		ticks  []tick
+	}{
+		{
+			name: "added in view only",
+			spawns: []NPCSpawn{
+				{Type: 1, X: 3205, Z: 3195},
+				{Type: 2, X: 3216, Z: 3200},
+				{Type: 3, X: 3200, Z: 3200, Plane: 1},
+				{Type: 4, X: 3185, Z: 3215},
+			},
+			ticks: []tick{
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{0, 3}},
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{0, 3}},
+			},
+		},
+		{
+			name:   "added with masks",
+			spawns: []NPCSpawn{{Type: 50, X: 3201, Z: 3201}},
+			ticks: []tick{
+				{
+					do:         func(w *World, npcs []*NPC) { npcs[0].Say("Hello") },
+					wantLocal:  []int{0},
+					wantBlocks: map[int]npcBlock{0: {Flags: NPCMaskForcedChat, ForcedChat: "Hello"}},
+				},
+			},
+		},
+		{
+			name:   "walks, then out of view",
+			spawns: []NPCSpawn{{Type: 7, X: 3214, Z: 3200}},
+			ticks: []tick{
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{0}},
+				{
+					do: func(w *World, npcs []*NPC) {
+						stepNPC(npcs[0], 1, -1)
+						npcs[0].Anim(808, 0)
+					},
+					wantLocal:  []int{0},
+					wantBlocks: map[int]npcBlock{0: {Flags: NPCMaskAnim, Anim: [2]int{808, 0}}},
+				},
+				{do: func(w *World, npcs []*NPC) { stepNPC(npcs[0], 1, 0) }, wantLocal: nil},
+				{do: func(w *World, npcs []*NPC) { stepNPC(npcs[0], -1, 0) }, wantLocal: []int{0}},
+			},
+		},
+		{
+			name:   "mask without moving",
+			spawns: []NPCSpawn{{Type: 7, X: 3200, Z: 3199}},
+			ticks: []tick{
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{0}},
+				{
+					do: func(w *World, npcs []*NPC) {
+						npcs[0].Health = 0
+						npcs[0].Hit(10, HitNormal)
+						npcs[0].FaceCoord(3200, 3200)
+					},
+					wantLocal: []int{0},
+					wantBlocks: map[int]npcBlock{0: {
+						Flags:     NPCMaskHit | NPCMaskFaceCoord,
+						Hits:      []Hit{{Damage: 10, Type: HitNormal}},
+						FaceCoord: [2]int{6401, 6401},
+					}},
+				},
+			},
+		},
+		{
+			name:   "teleported",
+			spawns: []NPCSpawn{{Type: 7, X: 3200, Z: 3199}, {Type: 8, X: 3201, Z: 3199}},
+			ticks: []tick{
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{0, 1}},
+				{
+					do: func(w *World, npcs []*NPC) {
+						npcs[0].Pos.X = 3195
+						npcs[0].Placement = true
+						npcs[0].MoveType = MoveTeleport
+					},
+					wantLocal: []int{1},
+				},
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{1, 0}},
+			},
+		},
+		{
+			name:   "removed from the world",
+			spawns: []NPCSpawn{{Type: 7, X: 3200, Z: 3199}, {Type: 8, X: 3201, Z: 3199}},
+			ticks: []tick{
+				{do: func(w *World, npcs []*NPC) {}, wantLocal: []int{0, 1}},
+				{do: func(w *World, npcs []*NPC) { w.RemoveNPC(npcs[1]) }, wantLocal: []int{0}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWorld()
+			p := addTestPlayer(w, 3200, 3200, 0)
+			if err := w.SpawnNPCs(tt.spawns); err != nil {
+				t.Fatal(err)
+			}
+			var npcs []*NPC
+			for i := range tt.spawns {
+				npcs = append(npcs, w.GetNPC(i))
+			}
+
+			c := newNPCClient()
+			for i, tick := range tt.ticks {
+				tick.do(w, npcs)
+
+				if err := c.read(p, p.encodeNPCInfo()); err != nil {
+					t.Fatalf("tick %d: %v", i, err)
+				}
+				c.check(t, w)
+				if !reflect.DeepEqual(c.local, tick.wantLocal) {
+					t.Errorf("tick %d: local NPCs = %v, want %v", i, c.local, tick.wantLocal)
+				}
+				wantBlocks := tick.wantBlocks
+				if wantBlocks == nil {
+					wantBlocks = map[int]npcBlock{}
+				}
+				if !reflect.DeepEqual(c.blocks, wantBlocks) {
+					t.Errorf("tick %d: update blocks = %+v, want %+v", i, c.blocks, wantBlocks)
+				}
+
+				for _, n := range npcs {
+					n.MoveType = MoveNone
+					n.Placement = false
+					n.masks.reset()
+				}
+			}
+		})
+	}
+}
+
+func TestPlayer_encodeNPCInfo_Crowd(t *testing.T) {
+	w := newTestWorld()
+	p := addTestPlayer(w, 3200, 3200, 0)
+	var spawns []NPCSpawn
+	for i := 0; i < 300; i++ {
+		spawns = append(spawns, NPCSpawn{Type: i, X: 3190 + i%20, Z: 3190 + i/20})
+	}
+	if err := w.SpawnNPCs(spawns); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newNPCClient()
+	if err := c.read(p, p.encodeNPCInfo()); err != nil {
+		t.Fatal(err)
+	}
+	c.check(t, w)
+	if len(c.local) != maxLocalNPCs {
+		t.Errorf("client has %d NPCs, want %d", len(c.local), maxLocalNPCs)
+	}
+}
+
+func TestPlayer_SendNPCInfo_Unconfirmed(t *testing.T) {
+	SendUnconfirmed = false
+	t.Cleanup(func() { SendUnconfirmed = true })
+
+	p := newConnectedTestPlayer(1)
+	p.World = newTestWorld()
+	p.SendNPCInfo()
+	p.MessageGame("hi", MessageTypeGame, "", "")
+
+	if got := sent(p); !reflect.DeepEqual(got, []int{util.ServerProtMessageGame}) {
+		t.Errorf("sent %v, want only MESSAGE_GAME", got)
+	}
+}
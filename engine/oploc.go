@@ -0,0 +1,301 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/engine/maps"
+	"github.com/zsrv/rt5-server-go/engine/pathfinding"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// opLocOptions maps the OPLOC opcodes to the option they're for, from 1.
+// TODO: add OPLOC2-5 once their opcodes are known for 578
+var opLocOptions = map[int]int{
+	util.ClientProtOpLoc1: 1,
+}
+
+// LocClick is a click on one of a loc's options.
+type LocClick struct {
+	// X and Z are the south west tile of the loc.
+	X  int
+	Z  int
+	ID int
+	// Option is which of the loc's options was picked, from 1.
+	Option int
+	// Ctrl is set if the player held ctrl while clicking, as with
+	// MoveClick.
+	Ctrl bool
+}
+
+// decodeOpLoc decodes the OPLOC packets.
+// TODO: confirm the field order and byte orders against a 578 client
+func decodeOpLoc(opcode int, buf *packet.Packet) (click LocClick, err error) {
+	defer recoverDecode(&err)
+
+	option, ok := opLocOptions[opcode]
+	if !ok {
+		return LocClick{}, fmt.Errorf("%d isn't an OPLOC opcode", opcode)
+	}
+
+	click.X = int(buf.G2())
+	click.Z = int(buf.G2())
+	click.ID = int(buf.G2())
+	click.Ctrl = buf.G1() != 0
+	click.Option = option
+	return click, nil
+}
+
+// LocOp is an option of a loc being used, once the player has reached it.
+type LocOp struct {
+	Loc  maps.Loc
+	Type *config.LocType
+	// Option is which of the loc's options was picked, from 1.
+	Option int
+}
+
+// LocHandler handles an option of the locs it's registered for.
+type LocHandler func(p *Player, op LocOp)
+
+// locHandlers holds the handlers for the options of single locs, by
+// locOpKey, and locOptionHandlers those for options of any loc, by the
+// option's lower case text.
+var (
+	locHandlers       = map[int]LocHandler{}
+	locOptionHandlers = map[string]LocHandler{}
+)
+
+func locOpKey(id int, option int) int {
+	return id<<3 | option
+}
+
+// RegisterLoc sets the handler for an option of a loc, replacing any set
+// before.
+func RegisterLoc(id int, option int, handler LocHandler) {
+	locHandlers[locOpKey(id, option)] = handler
+}
+
+// RegisterLocOption sets the handler for the option with the given text,
+// such as "Open", on every loc. Handlers for single locs take precedence.
+func RegisterLocOption(option string, handler LocHandler) {
+	locOptionHandlers[strings.ToLower(option)] = handler
+}
+
+// locInteraction is a loc option the player is walking to use.
+type locInteraction struct {
+	op   LocOp
+	dest pathfinding.Destination
+}
+
+// locDestination returns where a route to use loc ends, which depends on
+// its shape, size and rotation the same way as in the client.
+func locDestination(loc maps.Loc, locType *config.LocType) pathfinding.Destination {
+	switch {
+	case loc.Shape <= collision.WallSquareCorner || loc.Shape == shapeWallDiagonal:
+		return pathfinding.Destination{Kind: pathfinding.ReachWall, X: loc.X, Z: loc.Z, Shape: loc.Shape, Rotation: loc.Rotation}
+	case loc.Shape < shapeWallDiagonal:
+		return pathfinding.Destination{Kind: pathfinding.ReachWallDecoration, X: loc.X, Z: loc.Z, Shape: loc.Shape, Rotation: loc.Rotation}
+	}
+
+	width, length := locType.Width, locType.Length
+	if loc.Rotation&1 == 1 {
+		width, length = length, width
+	}
+	blockAccess := locType.ForceApproach
+	if rotation := loc.Rotation & 3; rotation != 0 {
+		blockAccess = blockAccess<<rotation&0xf | blockAccess>>(4-rotation)
+	}
+	return pathfinding.Destination{
+		Kind:        pathfinding.ReachRectangle,
+		X:           loc.X,
+		Z:           loc.Z,
+		Width:       width,
+		Height:      length,
+		BlockAccess: blockAccess,
+	}
+}
+
+// shapeWallDiagonal is the loc shape of walls across a tile, which are
+// reached like walls but aren't flagged as them.
+const shapeWallDiagonal = 9
+
+// OpLoc walks the player to a loc to use one of its options, which happens
+// once they reach it. Clicks on locs that aren't there, or on options the
+// loc doesn't have, are ignored.
+func (p *Player) OpLoc(click LocClick) {
+	if p.World.Maps == nil {
+		return
+	}
+
+	var loc maps.Loc
+	found := false
+	for _, v := range p.World.Locs(click.X, click.Z, p.Pos.Plane) {
+		if v.ID == click.ID {
+			loc, found = v, true
+			break
+		}
+	}
+	if !found {
+		p.Client.Server.Logger.Debug("loc isn't there", "id", click.ID, "x", click.X, "z", click.Z, "plane", p.Pos.Plane)
+		return
+	}
+
+	locType, err := p.World.Maps.LocTypes.Get(loc.ID)
+	if err != nil {
+		p.Client.Server.Logger.Warn("unknown loc", "id", loc.ID, "error", err)
+		return
+	}
+	if click.Option < 1 || click.Option > len(locType.Ops) || locType.Ops[click.Option-1] == "" {
+		p.Client.Server.Logger.Debug("loc doesn't have the option", "id", loc.ID, "option", click.Option)
+		return
+	}
+
+	dest := locDestination(loc, locType)
+	route := p.World.PathFinder.FindPath(p.World.Collision, p.Pos.X, p.Pos.Z, p.Pos.Plane, 1, dest, true)
+	p.Steps = routeSteps(p.Pos.X, p.Pos.Z, route.Waypoints)
+	p.RunPath = p.Running != click.Ctrl
+	p.interaction = &locInteraction{op: LocOp{Loc: loc, Type: locType, Option: click.Option}, dest: dest}
+}
+
+// processInteraction uses the loc the player is walking to once they've
+// reached it, or gives up if they've stopped short of it.
+func (p *Player) processInteraction() {
+	in := p.interaction
+	if in == nil {
+		return
+	}
+
+	if !in.dest.Reached(p.World.Collision, p.Pos.X, p.Pos.Z, p.Pos.Plane, 1) {
+		if len(p.Steps) == 0 {
+			p.interaction = nil
+			p.MessageGame("I can't reach that!", MessageTypeGame, "", "")
+		}
+		return
+	}
+	p.interaction = nil
+	p.Steps = nil
+
+	// someone may have changed it while the player was on their way
+	stillThere := false
+	for _, v := range p.World.Locs(in.op.Loc.X, in.op.Loc.Z, in.op.Loc.Plane) {
+		if v == in.op.Loc {
+			stillThere = true
+			break
+		}
+	}
+	if !stillThere {
+		return
+	}
+
+	handler, ok := locHandlers[locOpKey(in.op.Loc.ID, in.op.Option)]
+	if !ok {
+		handler, ok = locOptionHandlers[strings.ToLower(in.op.Type.Ops[in.op.Option-1])]
+	}
+	if !ok {
+		p.Client.Server.Logger.Debug("unhandled loc", "id", in.op.Loc.ID, "option", in.op.Option)
+		p.MessageGame("Nothing interesting happens.", MessageTypeGame, "", "")
+		return
+	}
+	handler(p, in.op)
+}
+
+// doors maps the ids of closed doors to the open ones that replace them.
+// Doors that aren't here are swung open or shut as they are.
+var doors = map[int]int{
+	1530: 1531,
+}
+
+// RegisterDoor sets the loc that replaces the door closed when it's
+// opened, and the other way around.
+func RegisterDoor(closed int, open int) {
+	doors[closed] = open
+}
+
+// doorOffsets is how far a door moves when it's swung open from each
+// rotation, turning it clockwise onto the next tile's wall.
+var doorOffsets = [4][2]int{
+	{-1, 0},
+	{0, 1},
+	{1, 0},
+	{0, -1},
+}
+
+// openDoor swings a straight wall door open or shut, replacing it with its
+// other half from doors.
+func openDoor(p *Player, op LocOp, open bool) {
+	door := op.Loc
+	if door.Shape != collision.WallStraight {
+		p.MessageGame("Nothing interesting happens.", MessageTypeGame, "", "")
+		return
+	}
+
+	swung := door
+	if open {
+		if id, ok := doors[door.ID]; ok {
+			swung.ID = id
+		}
+		offset := doorOffsets[door.Rotation&3]
+		swung.X += offset[0]
+		swung.Z += offset[1]
+		swung.Rotation = (door.Rotation + 1) & 3
+	} else {
+		for closed, id := range doors {
+			if id == door.ID {
+				swung.ID = closed
+				break
+			}
+		}
+		swung.Rotation = (door.Rotation - 1) & 3
+		offset := doorOffsets[swung.Rotation]
+		swung.X -= offset[0]
+		swung.Z -= offset[1]
+	}
+
+	p.World.RemoveLoc(door)
+	p.World.AddLoc(swung)
+}
+
+// climb moves the player up or down a plane. Climbing down from the
+// surface goes into the dungeons, 6400 tiles north, and climbing up from
+// them comes back out.
+func climb(p *Player, up bool) {
+	x, z, plane := p.Pos.X, p.Pos.Z, p.Pos.Plane
+	switch {
+	case up && plane == 0 && z >= dungeonOffset:
+		z -= dungeonOffset
+	case up && plane < 3:
+		plane++
+	case !up && plane == 0 && z < dungeonOffset:
+		z += dungeonOffset
+	case !up && plane > 0:
+		plane--
+	default:
+		p.MessageGame("Nothing interesting happens.", MessageTypeGame, "", "")
+		return
+	}
+	p.Teleport(x, z, plane)
+}
+
+// dungeonOffset is how far north the dungeons are from the surface above
+// them.
+const dungeonOffset = 6400
+
+func init() {
+	RegisterLocOption("Open", func(p *Player, op LocOp) {
+		openDoor(p, op, true)
+	})
+	RegisterLocOption("Close", func(p *Player, op LocOp) {
+		openDoor(p, op, false)
+	})
+
+	// ladders and stairs
+	RegisterLocOption("Climb-up", func(p *Player, op LocOp) {
+		climb(p, true)
+	})
+	RegisterLocOption("Climb-down", func(p *Player, op LocOp) {
+		climb(p, false)
+	})
+}
@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/engine/maps"
+	"github.com/zsrv/rt5-server-go/engine/pathfinding"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+func Test_decodeOpLoc(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  int
+		payload []byte
+		want    LocClick
+		wantErr bool
+	}{
+		{
+			name:    "first option",
+			opcode:  util.ClientProtOpLoc1,
+			payload: []byte{0x0c, 0x8a, 0x0c, 0x80, 0x05, 0xfa, 0},
+			want:    LocClick{X: 3210, Z: 3200, ID: 1530, Option: 1},
+		},
+		{
+			name:    "with ctrl",
+			opcode:  util.ClientProtOpLoc1,
+			payload: []byte{0x0c, 0x8a, 0x0c, 0x80, 0x05, 0xfa, 1},
+			want:    LocClick{X: 3210, Z: 3200, ID: 1530, Option: 1, Ctrl: true},
+		},
+		{
+			name:    "truncated",
+			opcode:  util.ClientProtOpLoc1,
+			payload: []byte{0x0c, 0x8a, 0x0c},
+			wantErr: true,
+		},
+		{
+			name:    "not an OPLOC",
+			opcode:  util.ClientProtMoveGameClick,
+			payload: []byte{0x0c, 0x8a, 0x0c, 0x80, 0x05, 0xfa, 0},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeOpLoc(tt.opcode, packet.NewPacket(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeOpLoc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decodeOpLoc() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_locDestination(t *testing.T) {
+	table := &config.LocType{Width: 3, Length: 1, ForceApproach: pathfinding.BlockAccessNorth}
+
+	tests := []struct {
+		name    string
+		loc     maps.Loc
+		locType *config.LocType
+		want    pathfinding.Destination
+	}{
+		{
+			name:    "door",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 0, Rotation: 2},
+			locType: testDoor,
+			want:    pathfinding.Destination{Kind: pathfinding.ReachWall, X: 3210, Z: 3200, Shape: 0, Rotation: 2},
+		},
+		{
+			name:    "diagonal wall",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 9, Rotation: 1},
+			locType: testDoor,
+			want:    pathfinding.Destination{Kind: pathfinding.ReachWall, X: 3210, Z: 3200, Shape: 9, Rotation: 1},
+		},
+		{
+			name:    "wall decoration",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 4, Rotation: 3},
+			locType: testDoor,
+			want:    pathfinding.Destination{Kind: pathfinding.ReachWallDecoration, X: 3210, Z: 3200, Shape: 4, Rotation: 3},
+		},
+		{
+			name:    "ladder",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 10},
+			locType: testLadder,
+			want:    pathfinding.Destination{Kind: pathfinding.ReachRectangle, X: 3210, Z: 3200, Width: 1, Height: 1},
+		},
+		{
+			name:    "table",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 10},
+			locType: table,
+			want: pathfinding.Destination{Kind: pathfinding.ReachRectangle, X: 3210, Z: 3200, Width: 3, Height: 1,
+				BlockAccess: pathfinding.BlockAccessNorth},
+		},
+		{
+			name:    "table turned",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 10, Rotation: 1},
+			locType: table,
+			want: pathfinding.Destination{Kind: pathfinding.ReachRectangle, X: 3210, Z: 3200, Width: 1, Height: 3,
+				BlockAccess: pathfinding.BlockAccessEast},
+		},
+		{
+			name:    "table turned three times",
+			loc:     maps.Loc{X: 3210, Z: 3200, Shape: 11, Rotation: 3},
+			locType: table,
+			want: pathfinding.Destination{Kind: pathfinding.ReachRectangle, X: 3210, Z: 3200, Width: 1, Height: 3,
+				BlockAccess: pathfinding.BlockAccessWest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := locDestination(tt.loc, tt.locType); got != tt.want {
+				t.Errorf("locDestination() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newLocTestPlayer returns a loaded player on x, z in a world with only the
+// locs placed.
+func newLocTestPlayer(t *testing.T, x int, z int, locs ...maps.Loc) *Player {
+	t.Helper()
+
+	p := newBuildAreaTestPlayer(x, z)
+	useTestMaps(p.World)
+	for _, v := range locs {
+		if err := p.World.Maps.PlaceLoc(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+// tickUntilUsed ticks p until they've used the loc they clicked, failing if
+// it takes more than ticks ticks.
+func tickUntilUsed(t *testing.T, p *Player, ticks int) {
+	t.Helper()
+
+	for i := 0; i < ticks; i++ {
+		p.Tick()
+		p.Placement = false
+		if p.interaction == nil {
+			return
+		}
+	}
+	t.Fatalf("loc not used after %d ticks, at %s", ticks, p.Pos.ToString())
+}
+
+func TestPlayer_OpLoc(t *testing.T) {
+	door := maps.Loc{ID: 1530, X: 3210, Z: 3200, Shape: 0, Rotation: 0}
+	p := newLocTestPlayer(t, 3205, 3200, door)
+	w := p.World
+
+	p.OpLoc(LocClick{X: 3210, Z: 3200, ID: 1530, Option: 1})
+	tickUntilUsed(t, p, 10)
+	if p.Pos.X != 3209 || p.Pos.Z != 3200 {
+		t.Errorf("opened the door from %s, want 3209, 3200", p.Pos.ToString())
+	}
+
+	// the door swings onto the north wall of the tile west of it
+	open := maps.Loc{ID: 1531, X: 3209, Z: 3200, Shape: 0, Rotation: 1}
+	if got := w.Locs(3210, 3200, 0); len(got) != 0 {
+		t.Errorf("closed door still there: %v", got)
+	}
+	if got := w.Locs(3209, 3200, 0); !reflect.DeepEqual(got, []maps.Loc{open}) {
+		t.Errorf("Locs() = %v, want the open door", got)
+	}
+	if got := w.Collision.Flags(3209, 3200, 0); got != collision.WallNorth {
+		t.Errorf("Flags() = %#x, want WallNorth", got)
+	}
+	if !pathfinding.CanMove(w.Collision, 3209, 3200, 0, 1, 1, 0) {
+		t.Errorf("can't walk through the open door")
+	}
+
+	// and closing it puts it back
+	p.OpLoc(LocClick{X: 3209, Z: 3200, ID: 1531, Option: 1})
+	tickUntilUsed(t, p, 1)
+	if got := w.Locs(3210, 3200, 0); !reflect.DeepEqual(got, []maps.Loc{door}) {
+		t.Errorf("Locs() = %v, want the closed door", got)
+	}
+	if got := w.Locs(3209, 3200, 0); len(got) != 0 {
+		t.Errorf("open door still there: %v", got)
+	}
+	if pathfinding.CanMove(w.Collision, 3209, 3200, 0, 1, 1, 0) {
+		t.Errorf("can walk through the closed door")
+	}
+	sent(p)
+
+	// clicks on locs that aren't there, or options they don't have, are
+	// ignored
+	p.OpLoc(LocClick{X: 3209, Z: 3200, ID: 1531, Option: 1})
+	p.OpLoc(LocClick{X: 3210, Z: 3200, ID: 1530, Option: 2})
+	if p.interaction != nil {
+		t.Errorf("interaction = %+v, want none", p.interaction)
+	}
+
+	// walking away gives up on the loc
+	p.OpLoc(LocClick{X: 3210, Z: 3200, ID: 1530, Option: 1})
+	p.WalkTo(3200, 3200, false)
+	if p.interaction != nil {
+		t.Errorf("interaction = %+v after walking away, want none", p.interaction)
+	}
+}
+
+func TestPlayer_processInteraction(t *testing.T) {
+	door := maps.Loc{ID: 1530, X: 3210, Z: 3200, Shape: 0, Rotation: 0}
+	ladder := maps.Loc{ID: 1747, X: 3200, Z: 3210, Shape: 10}
+
+	tests := []struct {
+		name  string
+		setup func(p *Player)
+		click LocClick
+		// the door and ladder as they are afterwards
+		door    []maps.Loc
+		ladder  []maps.Loc
+		plane   int
+		message bool
+	}{
+		{
+			name:   "climb the ladder",
+			click:  LocClick{X: 3200, Z: 3210, ID: 1747, Option: 1},
+			door:   []maps.Loc{door},
+			ladder: []maps.Loc{ladder},
+			plane:  1,
+		},
+		{
+			name: "handler for the loc",
+			setup: func(p *Player) {
+				RegisterLoc(1530, 1, func(p *Player, op LocOp) {
+					p.World.RemoveLoc(op.Loc)
+				})
+			},
+			click:  LocClick{X: 3210, Z: 3200, ID: 1530, Option: 1},
+			ladder: []maps.Loc{ladder},
+		},
+		{
+			name: "door closed off",
+			setup: func(p *Player) {
+				p.World.Collision.Add(3209, 3200, 0, collision.Loc)
+				for z := 3199; z <= 3201; z++ {
+					p.World.Collision.Add(3210, z, 0, collision.Loc)
+				}
+			},
+			click:   LocClick{X: 3210, Z: 3200, ID: 1530, Option: 1},
+			door:    []maps.Loc{door},
+			ladder:  []maps.Loc{ladder},
+			message: true,
+		},
+		{
+			name: "ladder taken away on the way",
+			setup: func(p *Player) {
+				p.World.RemoveLoc(ladder)
+			},
+			click: LocClick{X: 3200, Z: 3210, ID: 1747, Option: 1},
+			door:  []maps.Loc{door},
+		},
+		{
+			name: "no handler",
+			setup: func(p *Player) {
+				delete(locOptionHandlers, "climb-up")
+			},
+			click:   LocClick{X: 3200, Z: 3210, ID: 1747, Option: 1},
+			door:    []maps.Loc{door},
+			ladder:  []maps.Loc{ladder},
+			message: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved, savedOptions := locHandlers, locOptionHandlers
+			locHandlers = make(map[int]LocHandler)
+			locOptionHandlers = make(map[string]LocHandler)
+			for k, v := range savedOptions {
+				locOptionHandlers[k] = v
+			}
+			defer func() { locHandlers, locOptionHandlers = saved, savedOptions }()
+
+			p := newLocTestPlayer(t, 3205, 3205, door, ladder)
+			p.OpLoc(tt.click)
+			if tt.setup != nil {
+				tt.setup(p)
+			}
+			sent(p)
+			tickUntilUsed(t, p, 15)
+
+			if got := p.World.Locs(3210, 3200, 0); !reflect.DeepEqual(got, tt.door) {
+				t.Errorf("door = %v, want %v", got, tt.door)
+			}
+			if got := p.World.Locs(3200, 3210, 0); !reflect.DeepEqual(got, tt.ladder) {
+				t.Errorf("ladder = %v, want %v", got, tt.ladder)
+			}
+			if p.Pos.Plane != tt.plane {
+				t.Errorf("on plane %d, want %d", p.Pos.Plane, tt.plane)
+			}
+			if got := slices.Contains(sent(p), util.ServerProtMessageGame); got != tt.message {
+				t.Errorf("sent a message = %v, want %v", got, tt.message)
+			}
+		})
+	}
+}
+
+func Test_climb(t *testing.T) {
+	tests := []struct {
+		name  string
+		pos   *util.Position
+		up    bool
+		want  *util.Position
+		moved bool
+	}{
+		{name: "up", pos: util.NewPosition(3200, 3200, 0), up: true, want: util.NewPosition(3200, 3200, 1), moved: true},
+		{name: "down", pos: util.NewPosition(3200, 3200, 2), want: util.NewPosition(3200, 3200, 1), moved: true},
+		{name: "into the dungeon", pos: util.NewPosition(3200, 3200, 0), want: util.NewPosition(3200, 9600, 0), moved: true},
+		{name: "out of the dungeon", pos: util.NewPosition(3200, 9600, 0), up: true, want: util.NewPosition(3200, 3200, 0), moved: true},
+		{name: "up from the top", pos: util.NewPosition(3200, 3200, 3), up: true, want: util.NewPosition(3200, 3200, 3)},
+		{name: "down in the dungeon", pos: util.NewPosition(3200, 9600, 0), want: util.NewPosition(3200, 9600, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBuildAreaTestPlayer(tt.pos.X, tt.pos.Z)
+			p.Pos.Plane = tt.pos.Plane
+
+			climb(p, tt.up)
+			if p.Pos.X != tt.want.X || p.Pos.Z != tt.want.Z || p.Pos.Plane != tt.want.Plane {
+				t.Errorf("climbed to %s, want %s", p.Pos.ToString(), tt.want.ToString())
+			}
+			if p.Placement != tt.moved {
+				t.Errorf("Placement = %v, want %v", p.Placement, tt.moved)
+			}
+		})
+	}
+}
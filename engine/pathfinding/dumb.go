@@ -0,0 +1,39 @@
+package pathfinding
+
+import (
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+// DumbStep returns the step a size by size mover whose south west tile is
+// x, z takes towards destX, destZ without searching: diagonally if it can,
+// otherwise along whichever axis isn't blocked. ok is false if the mover is
+// already there or can't get any closer.
+func DumbStep(flags collision.Flags, x int, z int, plane int, size int, destX int, destZ int) (dx int, dz int, ok bool) {
+	dx = sign(destX - x)
+	dz = sign(destZ - z)
+	if dx == 0 && dz == 0 {
+		return 0, 0, false
+	}
+
+	if CanMove(flags, x, z, plane, size, dx, dz) {
+		return dx, dz, true
+	}
+	if dx != 0 && dz != 0 {
+		if CanMove(flags, x, z, plane, size, dx, 0) {
+			return dx, 0, true
+		}
+		if CanMove(flags, x, z, plane, size, 0, dz) {
+			return 0, dz, true
+		}
+	}
+	return 0, 0, false
+}
+
+func sign(v int) int {
+	if v < 0 {
+		return -1
+	} else if v > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package pathfinding
+
+import (
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+// Masks checked on each tile a line enters, by the direction it's entered
+// in. A projectile is only stopped by walls and locs that block projectiles.
+const (
+	sightWest  = collision.WallEastProjectile | collision.LocProjectile
+	sightEast  = collision.WallWestProjectile | collision.LocProjectile
+	sightSouth = collision.WallNorthProjectile | collision.LocProjectile
+	sightNorth = collision.WallSouthProjectile | collision.LocProjectile
+)
+
+// HasLineOfSight reports whether a projectile can travel in a straight line
+// from srcX, srcZ to destX, destZ.
+func HasLineOfSight(flags collision.Flags, srcX int, srcZ int, plane int, destX int, destZ int) bool {
+	return rayCast(flags, srcX, srcZ, plane, destX, destZ, sightWest, sightEast, sightSouth, sightNorth)
+}
+
+// HasLineOfWalk reports whether srcX, srcZ to destX, destZ can be walked in
+// a straight line, as used for melee range.
+func HasLineOfWalk(flags collision.Flags, srcX int, srcZ int, plane int, destX int, destZ int) bool {
+	return rayCast(flags, srcX, srcZ, plane, destX, destZ,
+		collision.BlockWest, collision.BlockEast, collision.BlockSouth, collision.BlockNorth)
+}
+
+// rayCast follows the line from src to dest along its longer axis, checking
+// each tile as it's entered along that axis and again whenever the line
+// crosses into the next tile along the other. Positions on the shorter axis
+// are kept in 16.16 fixed point, starting from the middle of the tile.
+func rayCast(flags collision.Flags, srcX int, srcZ int, plane int, destX int, destZ int, west int, east int, south int, north int) bool {
+	if srcX == destX && srcZ == destZ {
+		return true
+	}
+
+	dx := destX - srcX
+	dz := destZ - srcZ
+	xFlags, zFlags := east, north
+	if dx < 0 {
+		xFlags = west
+	}
+	if dz < 0 {
+		zFlags = south
+	}
+
+	absX, absZ := dx*sign(dx), dz*sign(dz)
+	if absX > absZ {
+		scaledZ := srcZ<<16 + 0x8000
+		slope := dz << 16 / absX
+		for x := srcX; x != destX; {
+			x += sign(dx)
+			z := scaledZ >> 16
+			if flags.Flags(x, z, plane)&xFlags != 0 {
+				return false
+			}
+			scaledZ += slope
+			if next := scaledZ >> 16; next != z && flags.Flags(x, next, plane)&zFlags != 0 {
+				return false
+			}
+		}
+	} else {
+		scaledX := srcX<<16 + 0x8000
+		slope := dx << 16 / absZ
+		for z := srcZ; z != destZ; {
+			z += sign(dz)
+			x := scaledX >> 16
+			if flags.Flags(x, z, plane)&zFlags != 0 {
+				return false
+			}
+			scaledX += slope
+			if next := scaledX >> 16; next != x && flags.Flags(next, z, plane)&xFlags != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package pathfinding
+
+import (
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+func TestHasLineOfSight(t *testing.T) {
+	m := collision.NewMap()
+	// a wall that blocks projectiles on the west of 105, 100..102
+	for z := 100; z <= 102; z++ {
+		m.AddWall(105, z, 0, collision.WallStraight, 0, true)
+	}
+	// a fence that doesn't block projectiles, south of 100..102, 110
+	for x := 100; x <= 102; x++ {
+		m.AddWall(x, 110, 0, collision.WallStraight, 3, false)
+	}
+	// a solid loc that blocks projectiles, and water
+	m.AddLoc(100, 120, 0, 1, 1, true)
+	m.AddFloor(110, 120, 0)
+
+	tests := []struct {
+		name      string
+		src, dest Point
+		want      bool
+		wantWalk  bool
+	}{
+		{name: "same tile", src: Point{X: 100, Z: 100}, dest: Point{X: 100, Z: 100}, want: true, wantWalk: true},
+		{name: "open", src: Point{X: 90, Z: 90}, dest: Point{X: 97, Z: 94}, want: true, wantWalk: true},
+		{name: "through a wall", src: Point{X: 103, Z: 101}, dest: Point{X: 107, Z: 101}},
+		{name: "through a wall diagonally", src: Point{X: 102, Z: 99}, dest: Point{X: 107, Z: 102}},
+		{name: "through a wall the other way", src: Point{X: 107, Z: 101}, dest: Point{X: 103, Z: 101}},
+		{name: "past the end of a wall", src: Point{X: 103, Z: 103}, dest: Point{X: 107, Z: 103}, want: true, wantWalk: true},
+		{name: "over a fence", src: Point{X: 101, Z: 108}, dest: Point{X: 101, Z: 112}, want: true},
+		{name: "past a loc", src: Point{X: 100, Z: 118}, dest: Point{X: 100, Z: 122}},
+		{name: "over water", src: Point{X: 108, Z: 120}, dest: Point{X: 112, Z: 120}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasLineOfSight(m, tt.src.X, tt.src.Z, 0, tt.dest.X, tt.dest.Z); got != tt.want {
+				t.Errorf("HasLineOfSight() = %v, want %v", got, tt.want)
+			}
+			if got := HasLineOfWalk(m, tt.src.X, tt.src.Z, 0, tt.dest.X, tt.dest.Z); got != tt.wantWalk {
+				t.Errorf("HasLineOfWalk() = %v, want %v", got, tt.wantWalk)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// Package pathfinding finds the routes players and NPCs take across the
+// collision map.
+//
+// PathFinder is the client's "smart" route finder: a breadth first search of
+// the 128x128 tiles around the mover, which falls back to the closest tile
+// it can reach when the destination can't be reached. NPCs use DumbStep
+// instead, which just steps towards the target.
+package pathfinding
+
+import (
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+const (
+	// SearchSize is the width and height of the area searched, centred on
+	// the mover.
+	SearchSize = 128
+
+	// how far around the destination to look for an alternative, and the
+	// longest route to one that will be taken
+	alternativeRadius  = 10
+	alternativeMaxCost = 100
+
+	queueSize = 4096
+)
+
+// the direction a tile was entered from, stored in via
+const (
+	viaSouth = 0x1
+	viaWest  = 0x2
+	viaNorth = 0x4
+	viaEast  = 0x8
+)
+
+// Point is a tile in the world.
+type Point struct {
+	X int
+	Z int
+}
+
+// Route is the result of a search.
+type Route struct {
+	// Waypoints are the tiles the route turns at, ending with the last tile
+	// of the route. They don't include the mover's own tile.
+	Waypoints []Point
+	// Alternative is set if the destination couldn't be reached and the
+	// route goes to the closest tile that could be reached instead.
+	Alternative bool
+	// Success is set if a route was found, even an empty one.
+	Success bool
+}
+
+// PathFinder searches for routes. Its buffers are reused between searches,
+// so a PathFinder must not be used by more than one goroutine at a time.
+type PathFinder struct {
+	via      [SearchSize][SearchSize]int
+	distance [SearchSize][SearchSize]int
+	queueX   [queueSize]int
+	queueZ   [queueSize]int
+}
+
+func NewPathFinder() *PathFinder {
+	return &PathFinder{}
+}
+
+// FindPath searches for a route for a size by size mover whose south west
+// tile is srcX, srcZ to dest. If dest can't be reached and alternative is
+// set, the route goes as close to it as it can instead.
+func (pf *PathFinder) FindPath(flags collision.Flags, srcX int, srcZ int, plane int, size int, dest Destination, alternative bool) Route {
+	for x := range pf.via {
+		for z := range pf.via[x] {
+			pf.via[x][z] = 0
+			pf.distance[x][z] = 99999999
+		}
+	}
+
+	baseX := srcX - SearchSize/2
+	baseZ := srcZ - SearchSize/2
+
+	localX := srcX - baseX
+	localZ := srcZ - baseZ
+
+	pf.via[localX][localZ] = 99
+	pf.distance[localX][localZ] = 0
+
+	head, tail := 0, 0
+	pf.queueX[tail] = localX
+	pf.queueZ[tail] = localZ
+	tail++
+
+	found := false
+	for head != tail {
+		localX = pf.queueX[head]
+		localZ = pf.queueZ[head]
+		head = (head + 1) & (queueSize - 1)
+
+		x := baseX + localX
+		z := baseZ + localZ
+
+		if dest.Reached(flags, x, z, plane, size) {
+			found = true
+			break
+		}
+
+		cost := pf.distance[localX][localZ] + 1
+
+		for _, v := range searchOrder {
+			nextX := localX + v.dx
+			nextZ := localZ + v.dz
+			if nextX < 0 || nextZ < 0 || nextX+size > SearchSize || nextZ+size > SearchSize {
+				continue
+			}
+			if pf.via[nextX][nextZ] != 0 {
+				continue
+			}
+			if !CanMove(flags, x, z, plane, size, v.dx, v.dz) {
+				continue
+			}
+
+			pf.queueX[tail] = nextX
+			pf.queueZ[tail] = nextZ
+			tail = (tail + 1) & (queueSize - 1)
+			pf.via[nextX][nextZ] = v.via
+			pf.distance[nextX][nextZ] = cost
+		}
+	}
+
+	route := Route{Success: true}
+	if !found {
+		if !alternative {
+			return Route{}
+		}
+
+		var ok bool
+		localX, localZ, ok = pf.closest(baseX, baseZ, dest)
+		if !ok {
+			return Route{}
+		}
+		route.Alternative = true
+	}
+
+	route.Waypoints = pf.backtrack(baseX, baseZ, localX, localZ)
+	return route
+}
+
+// searchOrder is the order the neighbours of a tile are searched in, which
+// decides between routes of the same length.
+var searchOrder = []struct {
+	dx, dz int
+	via    int
+}{
+	{-1, 0, viaEast},
+	{1, 0, viaWest},
+	{0, -1, viaNorth},
+	{0, 1, viaSouth},
+	{-1, -1, viaNorth | viaEast},
+	{1, -1, viaNorth | viaWest},
+	{-1, 1, viaSouth | viaEast},
+	{1, 1, viaSouth | viaWest},
+}
+
+// closest returns the visited tile nearest to dest, preferring the shorter
+// route between tiles that are as near as each other.
+func (pf *PathFinder) closest(baseX int, baseZ int, dest Destination) (int, int, bool) {
+	width, height := dest.size()
+
+	bestCost := 1000
+	bestDistance := alternativeMaxCost
+	bestX, bestZ := 0, 0
+	found := false
+
+	destX := dest.X - baseX
+	destZ := dest.Z - baseZ
+
+	for x := destX - alternativeRadius; x <= destX+alternativeRadius; x++ {
+		for z := destZ - alternativeRadius; z <= destZ+alternativeRadius; z++ {
+			if x < 0 || z < 0 || x >= SearchSize || z >= SearchSize {
+				continue
+			}
+			if pf.distance[x][z] >= alternativeMaxCost {
+				continue
+			}
+
+			dx := 0
+			if x < destX {
+				dx = destX - x
+			} else if x > destX+width-1 {
+				dx = x - (destX + width - 1)
+			}
+			dz := 0
+			if z < destZ {
+				dz = destZ - z
+			} else if z > destZ+height-1 {
+				dz = z - (destZ + height - 1)
+			}
+
+			cost := dx*dx + dz*dz
+			if cost < bestCost || (cost == bestCost && pf.distance[x][z] < bestDistance) {
+				bestCost = cost
+				bestDistance = pf.distance[x][z]
+				bestX, bestZ = x, z
+				found = true
+			}
+		}
+	}
+	return bestX, bestZ, found
+}
+
+// backtrack follows via back from the end of the route to the mover,
+// returning the tiles the route turns at in the order they are walked.
+func (pf *PathFinder) backtrack(baseX int, baseZ int, x int, z int) []Point {
+	var waypoints []Point
+
+	last := -1
+	direction := pf.via[x][z]
+	for direction != 99 {
+		if direction != last {
+			waypoints = append(waypoints, Point{X: baseX + x, Z: baseZ + z})
+			last = direction
+		}
+
+		if direction&viaWest != 0 {
+			x--
+		} else if direction&viaEast != 0 {
+			x++
+		}
+		if direction&viaSouth != 0 {
+			z--
+		} else if direction&viaNorth != 0 {
+			z++
+		}
+		direction = pf.via[x][z]
+	}
+
+	// reverse into walking order
+	for i, j := 0, len(waypoints)-1; i < j; i, j = i+1, j-1 {
+		waypoints[i], waypoints[j] = waypoints[j], waypoints[i]
+	}
+	return waypoints
+}
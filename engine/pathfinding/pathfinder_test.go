@@ -0,0 +1,259 @@
+package pathfinding
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// the south west tile of every test map
+const (
+	mapBaseX = 3200
+	mapBaseZ = 3200
+)
+
+// testMap is a map read from testdata. Each character is a tile, with north
+// at the top:
+//
+//	.  open
+//	#  blocked floor
+//	L  solid loc
+//	|  wall on the west side of the tile
+//	_  wall on the south side of the tile
+//	+  walls on the west and south sides of the tile
+//	S  where the route starts
+//	D  where the route goes
+type testMap struct {
+	rows  []string
+	flags *collision.Map
+
+	src  Point
+	dest Point
+	// the south west tile and size of the locs on the map
+	loc          Point
+	locW, locH   int
+	width, depth int
+}
+
+func loadTestMap(t testing.TB, name string) *testMap {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", name+".map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &testMap{
+		rows:  strings.Split(strings.TrimSpace(string(content)), "\n"),
+		flags: collision.NewMap(),
+	}
+	m.depth = len(m.rows)
+	m.width = len(m.rows[0])
+
+	locMaxX, locMaxZ := -1, -1
+	m.loc = Point{X: 1 << 30, Z: 1 << 30}
+
+	for r, row := range m.rows {
+		for c, ch := range row {
+			x := mapBaseX + c
+			z := mapBaseZ + m.depth - 1 - r
+
+			switch ch {
+			case '#':
+				m.flags.AddFloor(x, z, 0)
+			case 'L':
+				m.flags.AddLoc(x, z, 0, 1, 1, true)
+				m.loc.X = min(m.loc.X, x)
+				m.loc.Z = min(m.loc.Z, z)
+				locMaxX = max(locMaxX, x)
+				locMaxZ = max(locMaxZ, z)
+			case '|':
+				m.flags.AddWall(x, z, 0, collision.WallStraight, 0, false)
+			case '_':
+				m.flags.AddWall(x, z, 0, collision.WallStraight, 3, false)
+			case '+':
+				m.flags.AddWall(x, z, 0, collision.WallStraight, 0, false)
+				m.flags.AddWall(x, z, 0, collision.WallStraight, 3, false)
+			case 'S':
+				m.src = Point{X: x, Z: z}
+			case 'D':
+				m.dest = Point{X: x, Z: z}
+			}
+		}
+	}
+
+	if locMaxX >= 0 {
+		m.locW = locMaxX - m.loc.X + 1
+		m.locH = locMaxZ - m.loc.Z + 1
+	}
+	return m
+}
+
+// render draws the route over the map, marking every tile walked with *.
+func (m *testMap) render(route Route) string {
+	grid := make([][]byte, len(m.rows))
+	for i, row := range m.rows {
+		grid[i] = []byte(row)
+	}
+
+	mark := func(x int, z int) {
+		c := x - mapBaseX
+		r := m.depth - 1 - (z - mapBaseZ)
+		if r >= 0 && r < m.depth && c >= 0 && c < m.width {
+			grid[r][c] = '*'
+		}
+	}
+
+	x, z := m.src.X, m.src.Z
+	for _, v := range route.Waypoints {
+		for x != v.X || z != v.Z {
+			x += sign(v.X - x)
+			z += sign(v.Z - z)
+			mark(x, z)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "success: %v\n", route.Success)
+	fmt.Fprintf(&sb, "alternative: %v\n", route.Alternative)
+	sb.WriteString("waypoints:")
+	for _, v := range route.Waypoints {
+		fmt.Fprintf(&sb, " (%d, %d)", v.X-mapBaseX, v.Z-mapBaseZ)
+	}
+	sb.WriteString("\n")
+	for _, row := range grid {
+		sb.Write(row)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func TestPathFinder_FindPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		golden      string
+		mapName     string
+		dest        func(m *testMap) Destination
+		alternative bool
+	}{
+		{
+			name:    "open",
+			mapName: "open",
+		},
+		{
+			name:    "around a wall",
+			mapName: "wall",
+		},
+		{
+			name:    "out of a room",
+			mapName: "room",
+		},
+		{
+			name:    "maze",
+			mapName: "maze",
+		},
+		{
+			name:        "unreachable with alternative",
+			golden:      "unreachable_alternative",
+			mapName:     "unreachable",
+			alternative: true,
+		},
+		{
+			name:    "unreachable",
+			mapName: "unreachable",
+		},
+		{
+			name:    "loc",
+			mapName: "loc",
+			dest: func(m *testMap) Destination {
+				return Destination{Kind: ReachRectangle, X: m.loc.X, Z: m.loc.Z, Width: m.locW, Height: m.locH}
+			},
+		},
+		{
+			name:    "loc blocked from the south and west",
+			golden:  "blocked_loc_side",
+			mapName: "blocked_loc_side",
+			dest: func(m *testMap) Destination {
+				return Destination{Kind: ReachRectangle, X: m.loc.X, Z: m.loc.Z, Width: m.locW, Height: m.locH,
+					BlockAccess: BlockAccessSouth | BlockAccessWest}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := loadTestMap(t, tt.mapName)
+
+			dest := TileDestination(m.dest.X, m.dest.Z)
+			if tt.dest != nil {
+				dest = tt.dest(m)
+			}
+
+			route := NewPathFinder().FindPath(m.flags, m.src.X, m.src.Z, 0, 1, dest, tt.alternative)
+			got := m.render(route)
+
+			golden := tt.golden
+			if golden == "" {
+				golden = tt.mapName
+			}
+			path := filepath.Join("testdata", golden+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("FindPath() route =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestPathFinder_Reuse(t *testing.T) {
+	pf := NewPathFinder()
+
+	maze := loadTestMap(t, "maze")
+	open := loadTestMap(t, "open")
+
+	first := pf.FindPath(open.flags, open.src.X, open.src.Z, 0, 1, TileDestination(open.dest.X, open.dest.Z), false)
+	pf.FindPath(maze.flags, maze.src.X, maze.src.Z, 0, 1, TileDestination(maze.dest.X, maze.dest.Z), false)
+	again := pf.FindPath(open.flags, open.src.X, open.src.Z, 0, 1, TileDestination(open.dest.X, open.dest.Z), false)
+
+	if open.render(first) != open.render(again) {
+		t.Errorf("FindPath() gave a different route after another search")
+	}
+}
+
+func BenchmarkPathFinder_FindPath(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		mapName string
+	}{
+		{name: "open", mapName: "open"},
+		{name: "maze", mapName: "maze"},
+		{name: "unreachable", mapName: "unreachable"},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			m := loadTestMap(b, bm.mapName)
+			pf := NewPathFinder()
+			dest := TileDestination(m.dest.X, m.dest.Z)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pf.FindPath(m.flags, m.src.X, m.src.Z, 0, 1, dest, true)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package pathfinding
+
+import (
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+// ReachKind is how a route decides it has reached its Destination.
+type ReachKind int
+
+const (
+	// ReachTile routes end on the destination tile.
+	ReachTile ReachKind = iota
+	// ReachRectangle routes end inside or next to the destination
+	// rectangle, such as a loc or an NPC.
+	ReachRectangle
+	// ReachWall routes end on a tile the wall can be used from.
+	ReachWall
+	// ReachWallDecoration routes end on a tile the wall decoration can be
+	// used from.
+	ReachWallDecoration
+)
+
+// BlockAccess flags stop a rectangle being reached from one of its sides.
+const (
+	BlockAccessNorth = 0x1
+	BlockAccessEast  = 0x2
+	BlockAccessSouth = 0x4
+	BlockAccessWest  = 0x8
+)
+
+// Destination is where a route is going.
+type Destination struct {
+	Kind ReachKind
+	X    int
+	Z    int
+
+	// the size of a ReachRectangle destination, 1 by 1 if zero
+	Width  int
+	Height int
+	// BlockAccess stops a ReachRectangle destination being reached from
+	// the sides it flags.
+	BlockAccess int
+
+	// the loc shape and rotation of a ReachWall or ReachWallDecoration
+	// destination
+	Shape    int
+	Rotation int
+}
+
+// TileDestination returns a destination that is reached by standing on it.
+func TileDestination(x int, z int) Destination {
+	return Destination{Kind: ReachTile, X: x, Z: z}
+}
+
+func (d Destination) size() (int, int) {
+	width, height := d.Width, d.Height
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	return width, height
+}
+
+// Reached reports whether a size by size mover whose south west tile is x, z
+// has reached the destination.
+func (d Destination) Reached(flags collision.Flags, x int, z int, plane int, size int) bool {
+	switch d.Kind {
+	case ReachRectangle:
+		width, height := d.size()
+		return ReachedRectangle(flags, x, z, plane, size, d.X, d.Z, width, height, d.BlockAccess)
+	case ReachWall:
+		if size != 1 {
+			return ReachedRectangle(flags, x, z, plane, size, d.X, d.Z, 1, 1, 0)
+		}
+		return ReachedWall(flags, x, z, plane, d.X, d.Z, d.Shape, d.Rotation)
+	case ReachWallDecoration:
+		if size != 1 {
+			return ReachedRectangle(flags, x, z, plane, size, d.X, d.Z, 1, 1, 0)
+		}
+		return ReachedWallDecoration(flags, x, z, plane, d.X, d.Z, d.Shape, d.Rotation)
+	default:
+		return x == d.X && z == d.Z
+	}
+}
+
+// ReachedRectangle reports whether a size by size mover whose south west
+// tile is x, z is inside or next to the rectangle, without a wall in the way
+// or the side being blocked by blockAccess. Diagonally next to the rectangle
+// doesn't count.
+func ReachedRectangle(flags collision.Flags, x int, z int, plane int, size int, destX int, destZ int, width int, height int, blockAccess int) bool {
+	maxX := x + size - 1
+	maxZ := z + size - 1
+	destMaxX := destX + width - 1
+	destMaxZ := destZ + height - 1
+
+	overlapX := x <= destMaxX && maxX >= destX
+	overlapZ := z <= destMaxZ && maxZ >= destZ
+
+	if overlapX && overlapZ {
+		return true
+	}
+
+	if overlapZ && maxX == destX-1 && blockAccess&BlockAccessWest == 0 {
+		// west of the rectangle
+		for tz := max(z, destZ); tz <= min(maxZ, destMaxZ); tz++ {
+			if flags.Flags(maxX, tz, plane)&collision.WallEast == 0 {
+				return true
+			}
+		}
+	}
+	if overlapZ && x == destMaxX+1 && blockAccess&BlockAccessEast == 0 {
+		// east of the rectangle
+		for tz := max(z, destZ); tz <= min(maxZ, destMaxZ); tz++ {
+			if flags.Flags(x, tz, plane)&collision.WallWest == 0 {
+				return true
+			}
+		}
+	}
+	if overlapX && maxZ == destZ-1 && blockAccess&BlockAccessSouth == 0 {
+		// south of the rectangle
+		for tx := max(x, destX); tx <= min(maxX, destMaxX); tx++ {
+			if flags.Flags(tx, maxZ, plane)&collision.WallNorth == 0 {
+				return true
+			}
+		}
+	}
+	if overlapX && z == destMaxZ+1 && blockAccess&BlockAccessNorth == 0 {
+		// north of the rectangle
+		for tx := max(x, destX); tx <= min(maxX, destMaxX); tx++ {
+			if flags.Flags(tx, z, plane)&collision.WallSouth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReachedWall reports whether a single tile mover on x, z can use the wall
+// of the given shape and rotation on destX, destZ.
+func ReachedWall(flags collision.Flags, x int, z int, plane int, destX int, destZ int, shape int, rotation int) bool {
+	if x == destX && z == destZ {
+		return true
+	}
+
+	tile := flags.Flags(x, z, plane)
+	west := x == destX-1 && z == destZ
+	east := x == destX+1 && z == destZ
+	south := x == destX && z == destZ-1
+	north := x == destX && z == destZ+1
+
+	switch shape {
+	case collision.WallStraight:
+		switch rotation & 3 {
+		case 0:
+			return west ||
+				north && tile&collision.BlockNorth == 0 ||
+				south && tile&collision.BlockSouth == 0
+		case 1:
+			return north ||
+				west && tile&collision.BlockWest == 0 ||
+				east && tile&collision.BlockEast == 0
+		case 2:
+			return east ||
+				north && tile&collision.BlockNorth == 0 ||
+				south && tile&collision.BlockSouth == 0
+		default:
+			return south ||
+				west && tile&collision.BlockWest == 0 ||
+				east && tile&collision.BlockEast == 0
+		}
+	case collision.WallL:
+		switch rotation & 3 {
+		case 0:
+			return west || north ||
+				east && tile&collision.BlockEast == 0 ||
+				south && tile&collision.BlockSouth == 0
+		case 1:
+			return north || east ||
+				west && tile&collision.BlockWest == 0 ||
+				south && tile&collision.BlockSouth == 0
+		case 2:
+			return east || south ||
+				west && tile&collision.BlockWest == 0 ||
+				north && tile&collision.BlockNorth == 0
+		default:
+			return south || west ||
+				east && tile&collision.BlockEast == 0 ||
+				north && tile&collision.BlockNorth == 0
+		}
+	case shapeWallDiagonal:
+		return north && tile&collision.WallSouth == 0 ||
+			south && tile&collision.WallNorth == 0 ||
+			west && tile&collision.WallEast == 0 ||
+			east && tile&collision.WallWest == 0
+	}
+	return false
+}
+
+// loc shapes that are only reached, never flagged as walls
+const (
+	shapeWallDecorationStraightOffset = 6
+	shapeWallDecorationDiagonalOffset = 7
+	shapeWallDecorationDiagonalBoth   = 8
+	shapeWallDiagonal                 = 9
+)
+
+// ReachedWallDecoration reports whether a single tile mover on x, z can use
+// the wall decoration of the given shape and rotation on destX, destZ.
+func ReachedWallDecoration(flags collision.Flags, x int, z int, plane int, destX int, destZ int, shape int, rotation int) bool {
+	if x == destX && z == destZ {
+		return true
+	}
+
+	tile := flags.Flags(x, z, plane)
+	west := x == destX-1 && z == destZ && tile&collision.WallEast == 0
+	east := x == destX+1 && z == destZ && tile&collision.WallWest == 0
+	south := x == destX && z == destZ-1 && tile&collision.WallNorth == 0
+	north := x == destX && z == destZ+1 && tile&collision.WallSouth == 0
+
+	switch shape {
+	case shapeWallDecorationStraightOffset, shapeWallDecorationDiagonalOffset:
+		if shape == shapeWallDecorationDiagonalOffset {
+			rotation += 2
+		}
+		switch rotation & 3 {
+		case 0:
+			return east || south
+		case 1:
+			return west || south
+		case 2:
+			return west || north
+		default:
+			return east || north
+		}
+	case shapeWallDecorationDiagonalBoth:
+		return north || south || west || east
+	}
+	return false
+}
+
+// CanMove reports whether a size by size mover whose south west tile is
+// x, z can take a step of dx, dz (each -1, 0 or 1).
+func CanMove(flags collision.Flags, x int, z int, plane int, size int, dx int, dz int) bool {
+	if size == 1 {
+		return canStep(flags, x, z, plane, dx, dz)
+	}
+
+	// every tile of a larger mover has to be able to make the same step
+	for tx := x; tx < x+size; tx++ {
+		for tz := z; tz < z+size; tz++ {
+			if !canStep(flags, tx, tz, plane, dx, dz) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func canStep(flags collision.Flags, x int, z int, plane int, dx int, dz int) bool {
+	switch {
+	case dx == -1 && dz == 0:
+		return flags.Flags(x-1, z, plane)&collision.BlockWest == 0
+	case dx == 1 && dz == 0:
+		return flags.Flags(x+1, z, plane)&collision.BlockEast == 0
+	case dx == 0 && dz == -1:
+		return flags.Flags(x, z-1, plane)&collision.BlockSouth == 0
+	case dx == 0 && dz == 1:
+		return flags.Flags(x, z+1, plane)&collision.BlockNorth == 0
+	case dx == -1 && dz == -1:
+		return flags.Flags(x-1, z-1, plane)&collision.BlockSouthWest == 0 &&
+			flags.Flags(x-1, z, plane)&collision.BlockWest == 0 &&
+			flags.Flags(x, z-1, plane)&collision.BlockSouth == 0
+	case dx == 1 && dz == -1:
+		return flags.Flags(x+1, z-1, plane)&collision.BlockSouthEast == 0 &&
+			flags.Flags(x+1, z, plane)&collision.BlockEast == 0 &&
+			flags.Flags(x, z-1, plane)&collision.BlockSouth == 0
+	case dx == -1 && dz == 1:
+		return flags.Flags(x-1, z+1, plane)&collision.BlockNorthWest == 0 &&
+			flags.Flags(x-1, z, plane)&collision.BlockWest == 0 &&
+			flags.Flags(x, z+1, plane)&collision.BlockNorth == 0
+	case dx == 1 && dz == 1:
+		return flags.Flags(x+1, z+1, plane)&collision.BlockNorthEast == 0 &&
+			flags.Flags(x+1, z, plane)&collision.BlockEast == 0 &&
+			flags.Flags(x, z+1, plane)&collision.BlockNorth == 0
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package pathfinding
+
+import (
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+)
+
+func TestReachedWall(t *testing.T) {
+	// a door on the west side of 10, 10, and a wall on the south side of
+	// 9, 11 that stops it being used from the north west
+	flags := collision.NewMap()
+	flags.AddWall(10, 10, 0, collision.WallStraight, 0, false)
+	flags.AddWall(10, 11, 0, collision.WallStraight, 3, false)
+
+	tests := []struct {
+		name  string
+		x, z  int
+		shape int
+		want  bool
+	}{
+		{name: "on the door", x: 10, z: 10, want: true},
+		{name: "in front of the door", x: 9, z: 10, want: true},
+		{name: "behind the door", x: 11, z: 10, want: false},
+		{name: "south of the door", x: 10, z: 9, want: true},
+		{name: "north of the door behind a wall", x: 10, z: 11, want: false},
+		{name: "diagonal", x: 9, z: 9, want: false},
+		{name: "L corner, east side", x: 11, z: 10, shape: collision.WallL, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReachedWall(flags, tt.x, tt.z, 0, 10, 10, tt.shape, 0); got != tt.want {
+				t.Errorf("ReachedWall() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReachedWallDecoration(t *testing.T) {
+	flags := collision.NewMap()
+
+	tests := []struct {
+		name     string
+		x, z     int
+		shape    int
+		rotation int
+		want     bool
+	}{
+		{name: "offset, east", x: 11, z: 10, shape: 6, want: true},
+		{name: "offset, south", x: 10, z: 9, shape: 6, want: true},
+		{name: "offset, west", x: 9, z: 10, shape: 6, want: false},
+		{name: "diagonal offset is turned", x: 9, z: 10, shape: 7, want: true},
+		{name: "diagonal both sides", x: 10, z: 11, shape: 8, want: true},
+		{name: "too far", x: 12, z: 10, shape: 8, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReachedWallDecoration(flags, tt.x, tt.z, 0, 10, 10, tt.shape, tt.rotation); got != tt.want {
+				t.Errorf("ReachedWallDecoration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReachedRectangle(t *testing.T) {
+	// a 2x2 loc at 10, 10 with a wall on its west side at 9, 10
+	flags := collision.NewMap()
+	flags.AddLoc(10, 10, 0, 2, 2, true)
+	flags.AddWall(10, 10, 0, collision.WallStraight, 0, false)
+
+	tests := []struct {
+		name        string
+		x, z        int
+		size        int
+		blockAccess int
+		want        bool
+	}{
+		{name: "inside", x: 11, z: 11, size: 1, want: true},
+		{name: "north", x: 10, z: 12, size: 1, want: true},
+		{name: "east", x: 12, z: 10, size: 1, want: true},
+		{name: "west behind a wall", x: 9, z: 10, size: 1, want: false},
+		{name: "west past the wall", x: 9, z: 11, size: 1, want: true},
+		{name: "diagonal", x: 12, z: 12, size: 1, want: false},
+		{name: "north blocked", x: 10, z: 12, size: 1, blockAccess: BlockAccessNorth, want: false},
+		{name: "large mover south", x: 9, z: 8, size: 2, want: true},
+		{name: "large mover diagonal", x: 8, z: 8, size: 2, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReachedRectangle(flags, tt.x, tt.z, 0, tt.size, 10, 10, 2, 2, tt.blockAccess); got != tt.want {
+				t.Errorf("ReachedRectangle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumbStep(t *testing.T) {
+	// a wall on the east side of 10, 10
+	flags := collision.NewMap()
+	flags.AddWall(10, 10, 0, collision.WallStraight, 2, false)
+
+	tests := []struct {
+		name         string
+		x, z         int
+		size         int
+		destX, destZ int
+		wantDX       int
+		wantDZ       int
+		wantOK       bool
+	}{
+		{name: "diagonal", x: 10, z: 10, size: 1, destX: 5, destZ: 5, wantDX: -1, wantDZ: -1, wantOK: true},
+		{name: "there already", x: 10, z: 10, size: 1, destX: 10, destZ: 10},
+		{name: "slides along a wall", x: 10, z: 10, size: 1, destX: 15, destZ: 15, wantDX: 0, wantDZ: 1, wantOK: true},
+		{name: "stuck behind a wall", x: 10, z: 10, size: 1, destX: 15, destZ: 10},
+		{name: "large mover blocked", x: 9, z: 9, size: 2, destX: 15, destZ: 9},
+		{name: "large mover free", x: 9, z: 11, size: 2, destX: 15, destZ: 11, wantDX: 1, wantDZ: 0, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dx, dz, ok := DumbStep(flags, tt.x, tt.z, 0, tt.size, tt.destX, tt.destZ)
+			if dx != tt.wantDX || dz != tt.wantDZ || ok != tt.wantOK {
+				t.Errorf("DumbStep() = %v, %v, %v, want %v, %v, %v", dx, dz, ok, tt.wantDX, tt.wantDZ, tt.wantOK)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package engine
 import (
 	"math"
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/zsrv/rt5-server-go/util"
@@ -28,18 +27,86 @@ type Player struct {
 	Loaded       bool
 	Loading      bool
 	Appearance   *packet.Packet
-	Placement    bool
-	VerifyID     int
+	// Placement is set on the tick the player is teleported.
+	Placement bool
+	VerifyID  int
 
 	ID         int
 	Username   string
 	WindowMode uint8
 
+	StaffModLevel  uint8
+	PlayerModLevel uint8
+	Address        string
+	UID            []byte
+
+	// Muted is set while the player may not talk in public chat, until
+	// MutedUntil (or for good, if MutedUntil is zero).
+	Muted      bool
+	MutedUntil time.Time
+	// when the player's recent chat messages were sent, for rate limiting
+	chatTimes []time.Time
+
 	World *World
 
+	// LastPos is where the player was at the start of the tick, before
+	// moving.
 	LastPos *util.Position
 
 	Pos *util.Position
+	// Origin is where the player stood when their build area was last
+	// built, which the client's map is centred on.
+	Origin *util.Position
+
+	// Steps is the path the player is walking, one tile per step.
+	Steps []Step
+	// Running is the player's run setting, and RunPath whether they are
+	// running along the current path.
+	Running bool
+	RunPath bool
+	// RunEnergy is in hundredths of a percent, up to RunEnergyMax. It's
+	// only kept on the server: the client's run orb doesn't show it.
+	// TODO: send it when it changes once the run energy packet is known
+	RunEnergy int
+
+	// the player's varps
+	vars vars
+	// the player's friends, ignores and chat modes
+	social social
+	// the settings of the player's clan channel, and the channel they're in
+	clan    *ClanSettings
+	channel *clanChannel
+	// the instance the player is in, and the one their build area was last
+	// built in
+	instance       *Instance
+	originInstance *Instance
+
+	// the movement made this tick, for the GPI
+	MoveType      int
+	MoveDirection int
+
+	// Health and MaxHealth are shown in the health bar under hit splats.
+	// TODO: take them from the hitpoints skill once skills exist
+	Health    int
+	MaxHealth int
+
+	// the update masks set this tick
+	masks masks
+
+	// the interfaces the player has open
+	ifs interfaces
+
+	// what the player's client knows about the players and NPCs around
+	// them
+	gpi  playerInfo
+	npcs npcInfo
+	// the zones in the player's build area, by ID
+	zones map[int]bool
+	// the loc the player is walking to use
+	interaction *locInteraction
+	// kicked is set once the player has been logged out by the server, to
+	// close their connection when this tick's packets have gone out
+	kicked bool
 }
 
 func NewPlayer(client *Client) *Player {
@@ -62,11 +129,22 @@ func NewPlayer(client *Client) *Player {
 
 		// make-over mage: 2925, 3323, 0
 		// varrock square: 3213, 3443
-		Pos: util.NewPosition(3162, 3490, 0),
+		Pos:    util.NewPosition(3162, 3490, 0),
+		Origin: util.NewPosition(0, 0, 0),
+
+		RunEnergy: RunEnergyMax,
+		vars:      newVars(),
+
+		ifs: newInterfaces(),
+
+		Health:    10,
+		MaxHealth: 10,
 	}
 }
 
 func (p *Player) Tick() {
+	p.loadMaps()
+
 	if !p.Loaded && !p.Loading {
 		p.Loading = true
 
@@ -75,19 +153,9 @@ func (p *Player) Tick() {
 			response.P2(0)
 			start := response.Len() // offset
 
-			// INIT_GPI
-
-			response.AccessBits()
-			response.PBit(30, p.Pos.HighRes())
-			p.LastPos.Clone(p.Pos)
-
-			for i := 1; i < 2048; i++ {
-				if p.ID == i {
-					continue
-				}
-				response.PBit(18, 0)
-			}
-			response.AccessBytes()
+			p.putInitGPI(&response)
+			// the client kept its build area
+			p.setOrigin()
 
 			response.PSize2(response.Len() - start)
 			respBytes := response.Bytes()
@@ -96,46 +164,12 @@ func (p *Player) Tick() {
 		} else if p.FirstLoad {
 			// TODO: something's wrong in here
 			var response packet.PacketBit
-			response.P1(98)
+			response.P1(util.ServerProtRebuildNormal)
 			response.P2(0)
 			start := response.Len()
 
-			// INIT_GPI
-
-			response.AccessBits()
-			response.PBit(30, p.Pos.HighRes())
-			p.LastPos.Clone(p.Pos)
-
-			for i := 1; i < 2048; i++ {
-				if p.ID == i {
-					continue
-				}
-				response.PBit(18, 0)
-			}
-			response.AccessBytes()
-
-			// REBUILD_NORMAL
-
-			response.IP2(uint16(p.Pos.ZoneX()))
-			response.P2(uint16(p.Pos.ZoneZ()))
-			response.P1(uint8(p.Pos.BAIndex))
-			response.P1Alt2(0)
-
-			for mapsquareX := (p.Pos.ZoneX() - (p.Pos.BASizeX >> 4)) >> 3; mapsquareX <= (p.Pos.ZoneX()+(p.Pos.BASizeX>>4))>>3; mapsquareX++ {
-				for mapsquareZ := (p.Pos.ZoneZ() - (p.Pos.BASizeZ >> 4)) >> 3; mapsquareZ <= (p.Pos.ZoneZ()+(p.Pos.BASizeZ>>4))>>3; mapsquareZ++ {
-					xtea, found := util.GetXTEA(mapsquareX, mapsquareZ)
-					if found {
-						for i := 0; i < len(xtea.Key); i++ {
-							// TODO: converting signed to unsigned!!
-							response.P4(uint32(xtea.Key[i]))
-						}
-					} else {
-						for i := 0; i < 4; i++ {
-							response.P4(0)
-						}
-					}
-				}
-			}
+			p.putInitGPI(&response)
+			p.putRebuildNormal(&response)
 
 			response.PSize2(response.Len() - start)
 			respBytes := response.Bytes()
@@ -144,12 +178,8 @@ func (p *Player) Tick() {
 		}
 
 		if p.FirstLoad {
-			if p.IsClientResizable() {
-				p.OpenGameFrame(746) // fixed?
-			} else {
-				p.OpenGameFrame(548) // resizable?
-			}
-			p.OpenChatBox(752)
+			p.OpenTop(p.Frame())
+			p.OpenChatBox()
 
 			p.OpenTab(0, 884)
 			p.OpenTab(1, 320)
@@ -172,6 +202,13 @@ func (p *Player) Tick() {
 			if !p.Reconnecting {
 				p.MessageGame("Welcome to RuneScape.", MessageTypeGame, "", "")
 			}
+			p.transmitVars()
+			p.loadClan()
+			p.loadSocial()
+		}
+
+		if p.Appearance == nil {
+			p.GenerateAppearance()
 		}
 
 		p.FirstLoad = false
@@ -179,84 +216,31 @@ func (p *Player) Tick() {
 		p.Loaded = true
 	}
 
-	// player info
 	if p.Loaded {
-		var response packet.PacketBit
-		var updateBlock packet.Packet
-
-		response.P1(72)
-		response.P2(0)
-		start := response.Len() // offset
-
-		p.ProcessActivePlayers(&response, &updateBlock, true)
-		p.ProcessActivePlayers(&response, &updateBlock, false)
-		p.ProcessInactivePlayers(&response, &updateBlock, true)
-		p.ProcessInactivePlayers(&response, &updateBlock, false)
-		x := updateBlock.Bytes()
-		response.PData(x, len(x))
-
-		response.PSize2(response.Len() - start) // offset
-		respBytes := response.Bytes()
-		//util.DebugfBytes(&p.Client.Server.Logger, "Tick() player info queue", respBytes)
-		p.Client.Queue(respBytes, true)
+		p.processInteraction()
+		p.ProcessMovement()
+		p.updateBuildArea()
 	}
 }
 
-func (p *Player) IsClientResizable() bool {
-	// 1 = fixed, 2 = resizable, 3 = fullscreen
-	return p.WindowMode > 1
-}
-
-func (p *Player) ProcessActivePlayers(buf *packet.PacketBit, updateBlock *packet.Packet, nsn0 bool) {
-	buf.AccessBits()
-	// TODO: this is supposed to loop, and "nsn0" is supposed to check against a player flag to skip
-	if nsn0 {
-		needsMaskUpdate := p.Appearance == nil
-		needsUpdate := p.Placement || needsMaskUpdate
-
-		if needsUpdate {
-			buf.PBit(1, 1)
-		} else {
-			buf.PBit(1, 0)
-		}
-
-		if needsUpdate {
-			if needsMaskUpdate {
-				buf.PBit(1, 1)
-			} else {
-				buf.PBit(1, 0)
-			}
-
-			buf.PBit(2, 0) // no further update
-
-			//if p.Placement {
-			//	buf.PBit(2, 3) // teleport
-			//	buf.PBit(1, 1) // full location update
-			//	buf.PBit(30, p.pos.Z | p.pos.X << 14 | p.pos.Plane << 28)
-			//}
-		}
-
-		if needsMaskUpdate {
-			p.AppendUpdateBlock(updateBlock)
-		}
+// loadMaps loads the collision of any mapsquares the player has come near.
+func (p *Player) loadMaps() {
+	if p.World.Maps == nil {
+		return
+	}
+	if err := p.World.Maps.LoadAround(p.Pos.X, p.Pos.Z); err != nil {
+		p.Client.Server.Logger.Warn("could not load maps", "error", err)
 	}
-	buf.AccessBytes()
 }
 
-func (p *Player) ProcessInactivePlayers(buf *packet.PacketBit, updateBlock *packet.Packet, nsn2 bool) {
-	buf.AccessBits()
-	// TODO: "nsn2" is supposed to check against a player flag to skip
-	if nsn2 {
-		for i := 1; i < 2048; i++ {
-			if p.ID == i {
-				continue
-			}
+// IsMuted reports whether the player is muted at now.
+func (p *Player) IsMuted(now time.Time) bool {
+	return p.Muted && (p.MutedUntil.IsZero() || now.Before(p.MutedUntil))
+}
 
-			buf.PBit(1, 0)
-			buf.PBit(2, 0)
-		}
-	}
-	buf.AccessBytes()
+func (p *Player) IsClientResizable() bool {
+	// 1 = fixed, 2 = resizable, 3 = fullscreen
+	return p.WindowMode > 1
 }
 
 func (p *Player) GenerateAppearance() {
@@ -296,54 +280,120 @@ func (p *Player) GenerateAppearance() {
 	p.Appearance = new(packet.Packet)
 	x := buf.Bytes()
 	p.Appearance.IPData(x, len(x))
+	p.setMask(MaskAppearance)
 }
 
-func (p *Player) AppendUpdateBlock(buf *packet.Packet) {
-	var flags uint8 = 0
-
-	if p.Appearance == nil {
-		p.GenerateAppearance()
-		flags |= 0x1
-	}
-
-	buf.P1(flags)
-
-	if flags&0x1 == 1 {
-		buf.P1Alt3(uint8(p.Appearance.Len()))
-		l := p.Appearance.Len()
-		buf.PData(p.Appearance.Bytes(), l)
-	}
+// needsUpdate reports whether the player has anything to send in the GPI
+// this tick.
+func (p *Player) needsUpdate() bool {
+	return p.MoveType != MoveNone || p.needsMaskUpdate()
 }
 
 func (p *Player) ProcessIn() {
 	decoded := p.Client.DecodeIn()
 
 	for _, v := range decoded {
+		if !SendUnconfirmed && util.ClientProtUnconfirmed[v.ID] {
+			p.Client.Server.Logger.Debug("ignoring unconfirmed packet", "packetID", v.ID)
+			continue
+		}
+
 		switch v.ID {
-		//case 78: // MOVE_GAMECLICK
-		//	ctrlClick := v.Data.G1() // g1add
-		//
-		//	x := v.Data.G2()
-		//	z := v.Data.G2Alt1()
-		//
-		//	p.Pos.X = int(x)
-		//	p.Pos.Z = int(z)
-		//
-		//	if ctrlClick != 0 {
-		//		p.Placement = true
-		//	}
+		case util.ClientProtMoveGameClick, util.ClientProtMoveMinimapClick:
+			click, err := decodeMoveClick(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad move click", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.WalkTo(click.X, click.Z, click.Ctrl)
+		case util.ClientProtOpLoc1:
+			click, err := decodeOpLoc(int(v.ID), &v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad loc click", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.OpLoc(click)
+		case util.ClientProtIfButton:
+			click, err := decodeIfButton(int(v.ID), &v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad button click", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.HandleButton(click)
+		case util.ClientProtTransmitVarVerifyID:
+			// the client acknowledging a var change, nothing to do
+		case util.ClientProtWindowStatus:
+			p.SetWindowMode(v.Data.G1())
+		case util.ClientProtMessagePublic:
+			msg, err := decodeMessagePublic(p.World.huffman(), &v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad public chat", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.PublicChat(msg, time.Now())
+		case util.ClientProtMessagePrivate:
+			msg, err := decodeMessagePrivate(p.World.huffman(), &v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad private message", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.PrivateChat(msg, time.Now())
+		case util.ClientProtFriendListAdd, util.ClientProtFriendListDel,
+			util.ClientProtIgnoreListAdd, util.ClientProtIgnoreListDel:
+			name, err := decodeName(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad name", "packetID", v.ID, "error", err)
+				continue
+			}
+			switch v.ID {
+			case util.ClientProtFriendListAdd:
+				p.AddFriend(name)
+			case util.ClientProtFriendListDel:
+				p.RemoveFriend(name)
+			case util.ClientProtIgnoreListAdd:
+				p.AddIgnore(name)
+			case util.ClientProtIgnoreListDel:
+				p.RemoveIgnore(name)
+			}
+		case util.ClientProtClanJoinChatLeaveChat:
+			owner, err := decodeClanName(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad clan channel", "packetID", v.ID, "error", err)
+				continue
+			}
+			if owner == 0 {
+				p.LeaveClanChannel()
+			} else {
+				p.JoinClanChannel(owner, time.Now())
+			}
+		case util.ClientProtClanKickUser:
+			name, err := decodeClanName(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad clan kick", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.KickClanMember(util.FromBase37(name), time.Now())
+		case util.ClientProtFriendSetRank:
+			name, rank, err := decodeFriendSetRank(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad friend rank", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.SetClanRank(name, rank)
+		case util.ClientProtChatSetMode:
+			modes, err := decodeChatSetMode(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad chat modes", "packetID", v.ID, "error", err)
+				continue
+			}
+			p.SetChatModes(modes)
 		case util.ClientProtClientCheat:
-			_ = v.Data.G1() // tele :=
-
-			cmd := strings.ToLower(v.Data.GJStr())
-			args := strings.Split(cmd, " ")
-
-			cmd = args[0]
-			args = args[1:]
-
-			if cmd == "logout" {
-				p.Logout()
+			line, err := decodeClientCheat(&v.Data)
+			if err != nil {
+				p.Client.Server.Logger.Warn("bad command", "packetID", v.ID, "error", err)
+				continue
 			}
+			p.RunCommand(line)
 		default:
 			p.Client.Server.Logger.Warn("unhandled packet", "packetID", v.ID)
 		}
@@ -352,43 +402,39 @@ func (p *Player) ProcessIn() {
 
 // events
 
-func (p *Player) OpenChatBox(interfaceID uint16) {
-	if interfaceID == 752 {
-		if p.IsClientResizable() {
-			p.OpenInterface(746, 15, 751, 3)
-			p.OpenInterface(746, 18, 752, 3)
-		} else {
-			p.OpenInterface(548, 20, 751, 3)
-			p.OpenInterface(548, 142, 752, 3)
-		}
+func (p *Player) OpenChatBox() {
+	p.OpenFrameSub(SlotChatOptions, 751, SubFlagsFrame)
+	p.OpenFrameSub(SlotChatBox, 752, SubFlagsFrame)
 
-		if p.IsClientResizable() {
-			p.OpenInterface(752, 9, 137, 3)
-		}
+	if p.IsClientResizable() {
+		p.OpenSub(752, 9, 137, SubFlagsFrame)
 	}
 }
 
-func (p *Player) OpenTab(tabID uint16, interfaceID uint16) {
-	if p.IsClientResizable() {
-		p.OpenInterface(746, 33+tabID, interfaceID, 3)
-	} else {
-		p.OpenInterface(548, 152+tabID, interfaceID, 3)
-	}
+func (p *Player) OpenTab(tab int, interfaceID int) {
+	p.OpenFrameSub(SlotTab(tab), interfaceID, SubFlagsFrame)
 }
 
 // encoders
 
 func (p *Player) Logout() {
 	var response packet.Packet
-	response.P1(58)
+	response.P1(util.ServerProtLogout)
 	respBytes := response.Bytes()
 	util.DebugfBytes(&p.Client.Server.Logger, "Logout() queue", respBytes)
 	p.Client.Queue(respBytes, true)
 }
 
+// Kick logs the player out and closes their connection at the end of the
+// tick, rather than waiting for their client to.
+func (p *Player) Kick() {
+	p.Logout()
+	p.kicked = true
+}
+
 func (p *Player) MessageGame(msg string, msgType uint8, msg2 string, msg3 string) {
 	var response packet.Packet
-	response.P1(99)
+	response.P1(util.ServerProtMessageGame)
 	response.P1(0)
 	start := response.Len() // offset
 
@@ -421,33 +467,3 @@ func (p *Player) MessageGame(msg string, msgType uint8, msg2 string, msg3 string
 	util.DebugfBytes(&p.Client.Server.Logger, "MessageGame() queue", respBytes)
 	p.Client.Queue(respBytes, true)
 }
-
-func (p *Player) OpenGameFrame(interfaceId uint16) {
-	var response packet.Packet
-	response.P1(93)
-
-	response.P1(0)
-	response.IP2(interfaceId)
-	response.IP2(uint16(p.VerifyID))
-	p.VerifyID += 1
-
-	respBytes := response.Bytes()
-	util.DebugfBytes(&p.Client.Server.Logger, "OpenGameFrame() queue", respBytes)
-	p.Client.Queue(respBytes, true)
-}
-
-func (p *Player) OpenInterface(windowID uint16, componentId uint16, interfaceId uint16, flags uint8) {
-	var response packet.Packet
-	response.P1(52)
-
-	response.P2Alt2(uint16(p.VerifyID))
-	p.VerifyID += 1
-	response.P1Alt3(flags)
-	response.P2Alt1(componentId)
-	response.P2Alt1(windowID)
-	response.P2(interfaceId)
-
-	respBytes := response.Bytes()
-	util.DebugfBytes(&p.Client.Server.Logger, "OpenInterface() queue", respBytes)
-	p.Client.Queue(respBytes, true)
-}
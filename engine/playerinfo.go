@@ -0,0 +1,350 @@
+package engine
+
+import (
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// GPI limits
+const (
+	// the client has room for 2047 players, indexed from 1
+	maxPlayers = 2048
+
+	// viewDistance is how many tiles away other players can be seen from.
+	viewDistance = 15
+	// maxLocalPlayers caps the players a client has in high resolution,
+	// itself included.
+	maxLocalPlayers = 255
+	// maxAddsPerTick caps the players added to a client each tick, so a
+	// crowd appears over a few ticks rather than all at once.
+	maxAddsPerTick = 15
+)
+
+// playerInfo is what a player's client knows about every other player. The
+// client keeps the same state and changes it the same way as it reads
+// PLAYER_INFO, so both sides have to agree on it every tick.
+type playerInfo struct {
+	// local holds the players the client has in high resolution, by index.
+	local [maxPlayers]*Player
+	// lowRes holds the mapsquare and plane the client has for players it
+	// doesn't have in high resolution, as from util.Position.LowRes.
+	lowRes [maxPlayers]int
+	// activity holds each player's nsn flags: bit 0 is set if the player
+	// was left alone last tick, and bit 1 is set this tick if they are
+	// left alone again. The client reads the players that were active and
+	// those that weren't in separate passes.
+	activity [maxPlayers]uint8
+
+	// the indices of the players in and out of local, in index order
+	localIndices    []int
+	externalIndices []int
+
+	localCount int
+	added      int
+}
+
+// putInitGPI writes the INIT_GPI part of a REBUILD_NORMAL, which tells the
+// client where the player is and the mapsquare of everyone else, and resets
+// what it knows to match.
+func (p *Player) putInitGPI(buf *packet.PacketBit) {
+	info := &p.gpi
+	*info = playerInfo{}
+
+	buf.AccessBits()
+	buf.PBit(30, p.Pos.HighRes())
+	p.LastPos.Clone(p.Pos)
+	info.local[p.ID] = p
+
+	for i := 1; i < maxPlayers; i++ {
+		if i == p.ID {
+			continue
+		}
+		if other := p.World.GetPlayer(i); other != nil {
+			info.lowRes[i] = other.Pos.LowRes()
+		}
+		buf.PBit(18, info.lowRes[i])
+	}
+	buf.AccessBytes()
+
+	info.nextTick()
+}
+
+// SendPlayerInfo queues PLAYER_INFO, which moves the player and everyone
+// around them on the client.
+func (p *Player) SendPlayerInfo() {
+	var response packet.PacketBit
+	response.P1(util.ServerProtPlayerInfo)
+	response.P2(0)
+	start := response.Len() // offset
+
+	payload := p.encodePlayerInfo()
+	response.PData(payload, len(payload))
+
+	response.PSize2(response.Len() - start) // offset
+	respBytes := response.Bytes()
+	//util.DebugfBytes(&p.Client.Server.Logger, "SendPlayerInfo() queue", respBytes)
+	p.Client.Queue(respBytes, true)
+}
+
+// encodePlayerInfo returns the PLAYER_INFO payload for this tick: the local
+// players in two passes, the others in two passes, then the update blocks
+// of every player flagged for one, in the order they were flagged.
+func (p *Player) encodePlayerInfo() []byte {
+	var buf packet.PacketBit
+	var updateBlock packet.Packet
+
+	p.ProcessActivePlayers(&buf, &updateBlock, true)
+	p.ProcessActivePlayers(&buf, &updateBlock, false)
+	p.ProcessInactivePlayers(&buf, &updateBlock, true)
+	p.ProcessInactivePlayers(&buf, &updateBlock, false)
+	p.gpi.nextTick()
+
+	x := updateBlock.Bytes()
+	buf.PData(x, len(x))
+	return buf.Bytes()
+}
+
+// nextTick ages the nsn flags and sorts the players into local and external
+// lists, as the client does after reading PLAYER_INFO.
+func (info *playerInfo) nextTick() {
+	info.localIndices = info.localIndices[:0]
+	info.externalIndices = info.externalIndices[:0]
+	for i := 1; i < maxPlayers; i++ {
+		info.activity[i] >>= 1
+		if info.local[i] != nil {
+			info.localIndices = append(info.localIndices, i)
+		} else {
+			info.externalIndices = append(info.externalIndices, i)
+		}
+	}
+	info.localCount = len(info.localIndices)
+	info.added = 0
+}
+
+// wasActive reports whether the player on index had an update last tick.
+func (info *playerInfo) wasActive(index int) bool {
+	return info.activity[index]&0x1 == 0
+}
+
+// ProcessActivePlayers writes the local players that were active last tick
+// if nsn0 is set, or the ones that weren't if it isn't.
+func (p *Player) ProcessActivePlayers(buf *packet.PacketBit, updateBlock *packet.Packet, nsn0 bool) {
+	info := &p.gpi
+
+	buf.AccessBits()
+	skip := 0
+	for i, index := range info.localIndices {
+		if info.wasActive(index) != nsn0 {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			info.activity[index] |= 0x2
+			continue
+		}
+
+		other := info.local[index]
+		if p.mustRemove(index, other) {
+			p.putRemove(buf, index, other)
+			continue
+		}
+		if other.needsUpdate() {
+			maskUpdate := other.needsMaskUpdate()
+
+			buf.PBit(1, 1)
+			buf.PBit(1, boolBit(maskUpdate))
+			other.putMovement(buf)
+			if maskUpdate {
+				other.AppendUpdateBlock(updateBlock, p, false)
+			}
+			continue
+		}
+
+		// nothing to do, so skip as many of the players after this one as
+		// can be skipped too
+		buf.PBit(1, 0)
+		for _, next := range info.localIndices[i+1:] {
+			if info.wasActive(next) != nsn0 {
+				continue
+			}
+			if p.mustRemove(next, info.local[next]) || info.local[next].needsUpdate() {
+				break
+			}
+			skip++
+		}
+		putSkip(buf, skip)
+		info.activity[index] |= 0x2
+	}
+	buf.AccessBytes()
+}
+
+// ProcessInactivePlayers writes the players outside the local list that
+// were active last tick if nsn2 is set, or the ones that weren't if it
+// isn't. This is where players are added to the local list.
+func (p *Player) ProcessInactivePlayers(buf *packet.PacketBit, updateBlock *packet.Packet, nsn2 bool) {
+	info := &p.gpi
+
+	buf.AccessBits()
+	skip := 0
+	for i, index := range info.externalIndices {
+		if info.wasActive(index) == nsn2 {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			info.activity[index] |= 0x2
+			continue
+		}
+
+		other := p.World.GetPlayer(index)
+		if p.canAdd(other) {
+			p.putAdd(buf, updateBlock, index, other)
+			continue
+		}
+		if other != nil && other.Pos.LowRes() != info.lowRes[index] {
+			buf.PBit(1, 1)
+			putLowResUpdate(buf, info.lowRes[index], other.Pos.LowRes())
+			info.lowRes[index] = other.Pos.LowRes()
+			continue
+		}
+
+		buf.PBit(1, 0)
+		for _, next := range info.externalIndices[i+1:] {
+			if info.wasActive(next) == nsn2 {
+				continue
+			}
+			nextPlayer := p.World.GetPlayer(next)
+			if p.canAdd(nextPlayer) || nextPlayer != nil && nextPlayer.Pos.LowRes() != info.lowRes[next] {
+				break
+			}
+			skip++
+		}
+		putSkip(buf, skip)
+		info.activity[index] |= 0x2
+	}
+	buf.AccessBytes()
+}
+
+// canSee reports whether other is close enough to be in the player's local
+// list.
+func (p *Player) canSee(other *Player) bool {
+	return other.Loaded && other.Pos.Plane == p.Pos.Plane && p.Pos.Near(other.Pos, viewDistance)
+}
+
+// mustRemove reports whether the local player other on index has to be
+// removed, because they logged out or went out of view.
+func (p *Player) mustRemove(index int, other *Player) bool {
+	if index == p.ID {
+		return false
+	}
+	return p.World.GetPlayer(index) != other || !p.canSee(other)
+}
+
+func (p *Player) canAdd(other *Player) bool {
+	info := &p.gpi
+	return other != nil && other != p && p.canSee(other) &&
+		info.added < maxAddsPerTick && info.localCount < maxLocalPlayers
+}
+
+// putRemove moves a local player back to low resolution, updating their
+// mapsquare if the client's has gone out of date.
+func (p *Player) putRemove(buf *packet.PacketBit, index int, other *Player) {
+	info := &p.gpi
+
+	buf.PBit(1, 1)
+	buf.PBit(1, 0) // no mask update
+	buf.PBit(2, MoveNone)
+
+	// the client keeps the mapsquare of where it last saw them: where they
+	// logged out, or where they were before this tick's movement
+	now := p.World.GetPlayer(index)
+	known := other.Pos.LowRes()
+	if now == other {
+		known = other.LastPos.LowRes()
+	}
+	current := known
+	if now != nil {
+		current = now.Pos.LowRes()
+	}
+
+	if current == known {
+		buf.PBit(1, 0)
+	} else {
+		buf.PBit(1, 1)
+		putLowResUpdate(buf, known, current)
+	}
+	info.lowRes[index] = current
+	info.local[index] = nil
+	info.localCount--
+}
+
+// putAdd moves a player into the local list, with their appearance.
+func (p *Player) putAdd(buf *packet.PacketBit, updateBlock *packet.Packet, index int, other *Player) {
+	info := &p.gpi
+
+	buf.PBit(1, 1)
+	buf.PBit(2, 0) // add
+
+	if current := other.Pos.LowRes(); current == info.lowRes[index] {
+		buf.PBit(1, 0)
+	} else {
+		buf.PBit(1, 1)
+		putLowResUpdate(buf, info.lowRes[index], current)
+		info.lowRes[index] = current
+	}
+	buf.PBit(6, other.Pos.MapLocalX())
+	buf.PBit(6, other.Pos.MapLocalZ())
+
+	buf.PBit(1, 1) // mask update
+	other.AppendUpdateBlock(updateBlock, p, true)
+
+	info.local[index] = other
+	info.activity[index] |= 0x2
+	info.localCount++
+	info.added++
+}
+
+// putLowResUpdate moves a player the client has in low resolution from one
+// mapsquare and plane to another, as a plane change, a step to a
+// neighbouring mapsquare or a jump anywhere.
+func putLowResUpdate(buf *packet.PacketBit, from int, to int) {
+	plane := (to>>16 - from>>16) & 0x3
+	dx := to>>8&0xff - from>>8&0xff
+	dz := to&0xff - from&0xff
+
+	if dx == 0 && dz == 0 {
+		buf.PBit(2, 1)
+		buf.PBit(2, plane)
+	} else if dir := walkDirection(dx, dz); dir != -1 {
+		buf.PBit(2, 2)
+		buf.PBit(5, plane<<3|dir)
+	} else {
+		buf.PBit(2, 3)
+		buf.PBit(18, plane<<16|(dx&0xff)<<8|dz&0xff)
+	}
+}
+
+// putSkip writes how many of the players after the current one are left
+// alone too, in as few bits as it fits.
+func putSkip(buf *packet.PacketBit, skip int) {
+	switch {
+	case skip == 0:
+		buf.PBit(2, 0)
+	case skip < 32:
+		buf.PBit(2, 1)
+		buf.PBit(5, skip)
+	case skip < 256:
+		buf.PBit(2, 2)
+		buf.PBit(8, skip)
+	default:
+		buf.PBit(2, 3)
+		buf.PBit(11, skip)
+	}
+}
+
+func boolBit(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
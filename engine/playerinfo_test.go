@@ -0,0 +1,553 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// gpiClient is the client's side of the GPI: its copy of the players around
+// it, changed by reading PLAYER_INFO the way the client does.
+type gpiClient struct {
+	self int
+
+	// high holds the position of the players in high resolution
+	high     [maxPlayers]*util.Position
+	lowRes   [maxPlayers]int
+	activity [maxPlayers]uint8
+
+	local    []int
+	external []int
+
+	// the players flagged for an update block in the last PLAYER_INFO, in
+	// order, and which of them were sent an appearance
+	masks       []int
+	appearances map[int]bool
+}
+
+// newGPIClient reads the INIT_GPI sent to the player on index self.
+func newGPIClient(self int, init []byte) *gpiClient {
+	r := bitReader{buf: init}
+	c := &gpiClient{self: self}
+
+	v := r.bits(30)
+	c.high[self] = util.NewPosition(v>>14&0x3fff, v&0x3fff, v>>28)
+	for i := 1; i < maxPlayers; i++ {
+		if i != self {
+			c.lowRes[i] = r.bits(18)
+		}
+	}
+	c.nextTick()
+	return c
+}
+
+func (c *gpiClient) nextTick() {
+	c.local = c.local[:0]
+	c.external = c.external[:0]
+	for i := 1; i < maxPlayers; i++ {
+		c.activity[i] >>= 1
+		if c.high[i] != nil {
+			c.local = append(c.local, i)
+		} else {
+			c.external = append(c.external, i)
+		}
+	}
+}
+
+// read reads a PLAYER_INFO payload.
+func (c *gpiClient) read(payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("read past the end: %v", r)
+		}
+	}()
+
+	c.masks = nil
+	c.appearances = make(map[int]bool)
+
+	r := &bitReader{buf: payload}
+	for _, nsn := range []bool{true, false} {
+		if err := c.readLocal(r, nsn); err != nil {
+			return err
+		}
+		r.offset = (r.offset + 7) &^ 7
+	}
+	for _, nsn := range []bool{true, false} {
+		if err := c.readExternal(r, nsn); err != nil {
+			return err
+		}
+		r.offset = (r.offset + 7) &^ 7
+	}
+
+	blocks := packet.NewPacket(payload[r.offset>>3:])
+	for _, index := range c.masks {
+		if decodeUpdateBlock(blocks).Flags&MaskAppearance != 0 {
+			c.appearances[index] = true
+		}
+	}
+	if blocks.Len() != 0 {
+		return fmt.Errorf("%d bytes left after the update blocks", blocks.Len())
+	}
+
+	c.nextTick()
+	return nil
+}
+
+func readSkip(r *bitReader) int {
+	switch r.bits(2) {
+	case 0:
+		return 0
+	case 1:
+		return r.bits(5)
+	case 2:
+		return r.bits(8)
+	default:
+		return r.bits(11)
+	}
+}
+
+func signed(v int, bits int) int {
+	if v >= 1<<(bits-1) {
+		return v - 1<<bits
+	}
+	return v
+}
+
+func (c *gpiClient) readLocal(r *bitReader, nsn0 bool) error {
+	skip := 0
+	for _, index := range c.local {
+		if (c.activity[index]&0x1 == 0) != nsn0 {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			c.activity[index] |= 0x2
+			continue
+		}
+		if r.bits(1) == 0 {
+			skip = readSkip(r)
+			c.activity[index] |= 0x2
+			continue
+		}
+
+		mask := r.bits(1) == 1
+		if mask {
+			c.masks = append(c.masks, index)
+		}
+
+		pos := c.high[index]
+		switch r.bits(2) {
+		case MoveNone:
+			if mask {
+				continue
+			}
+			if index == c.self {
+				return errors.New("removed the local player")
+			}
+			c.lowRes[index] = pos.LowRes()
+			if r.bits(1) == 1 {
+				if err := c.readLowRes(r, index, r.bits(2)); err != nil {
+					return err
+				}
+			}
+			c.high[index] = nil
+		case MoveWalk:
+			d := walkDirections[r.bits(3)]
+			pos.X += d[0]
+			pos.Z += d[1]
+		case MoveRun:
+			d := runDirections[r.bits(4)]
+			pos.X += d[0]
+			pos.Z += d[1]
+		case MoveTeleport:
+			if r.bits(1) == 0 {
+				v := r.bits(12)
+				pos.Plane = (pos.Plane + v>>10) & 0x3
+				pos.X += signed(v>>5&0x1f, 5)
+				pos.Z += signed(v&0x1f, 5)
+			} else {
+				v := r.bits(30)
+				pos.Plane = (pos.Plane + v>>28) & 0x3
+				pos.X = (pos.X + v>>14) & 0x3fff
+				pos.Z = (pos.Z + v) & 0x3fff
+			}
+		}
+	}
+	if skip != 0 {
+		return fmt.Errorf("skip of %d ran past the local players", skip)
+	}
+	return nil
+}
+
+func (c *gpiClient) readExternal(r *bitReader, nsn2 bool) error {
+	skip := 0
+	for _, index := range c.external {
+		if (c.activity[index]&0x1 != 0) != nsn2 {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			c.activity[index] |= 0x2
+			continue
+		}
+		if r.bits(1) == 0 {
+			skip = readSkip(r)
+			c.activity[index] |= 0x2
+			continue
+		}
+
+		if kind := r.bits(2); kind != 0 {
+			if err := c.readLowRes(r, index, kind); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// added
+		if r.bits(1) == 1 {
+			if err := c.readLowRes(r, index, r.bits(2)); err != nil {
+				return err
+			}
+		}
+		lowRes := c.lowRes[index]
+		x := lowRes>>8&0xff<<6 | r.bits(6)
+		z := lowRes&0xff<<6 | r.bits(6)
+		c.high[index] = util.NewPosition(x, z, lowRes>>16)
+		if r.bits(1) == 1 {
+			c.masks = append(c.masks, index)
+		}
+		c.activity[index] |= 0x2
+	}
+	if skip != 0 {
+		return fmt.Errorf("skip of %d ran past the external players", skip)
+	}
+	return nil
+}
+
+func (c *gpiClient) readLowRes(r *bitReader, index int, kind int) error {
+	v := c.lowRes[index]
+	plane, x, z := v>>16, v>>8&0xff, v&0xff
+
+	switch kind {
+	case 1:
+		plane += r.bits(2)
+	case 2:
+		d := r.bits(5)
+		plane += d >> 3
+		x += walkDirections[d&0x7][0]
+		z += walkDirections[d&0x7][1]
+	case 3:
+		d := r.bits(18)
+		plane += d >> 16
+		x += d >> 8
+		z += d
+	default:
+		return fmt.Errorf("low resolution update for %d has no change", index)
+	}
+	c.lowRes[index] = (plane&0x3)<<16 | (x&0xff)<<8 | z&0xff
+	return nil
+}
+
+// check compares the client's copy of the players with the server's.
+func (c *gpiClient) check(t *testing.T, observer *Player) {
+	t.Helper()
+
+	info := &observer.gpi
+	local := 0
+	for i := 1; i < maxPlayers; i++ {
+		if c.activity[i] != info.activity[i] {
+			t.Fatalf("player %d: client activity = %d, server %d", i, c.activity[i], info.activity[i])
+		}
+
+		server := info.local[i]
+		if (c.high[i] != nil) != (server != nil) {
+			t.Fatalf("player %d: local on the client = %v, on the server %v", i, c.high[i] != nil, server != nil)
+		}
+		if server != nil {
+			local++
+			if !c.high[i].Equals(server.Pos) {
+				t.Fatalf("player %d: client position = %v, server %v", i, c.high[i].ToString(), server.Pos.ToString())
+			}
+			continue
+		}
+		if other := observer.World.GetPlayer(i); other != nil && c.lowRes[i] != other.Pos.LowRes() {
+			t.Fatalf("player %d: client low resolution position = %#x, server %#x", i, c.lowRes[i], other.Pos.LowRes())
+		}
+	}
+	if local > maxLocalPlayers {
+		t.Fatalf("client has %d local players", local)
+	}
+}
+
+func addTestPlayer(w *World, x int, z int, plane int) *Player {
+	p := NewPlayer(nil)
+	p.World = w
+	if !w.RegisterPlayer(p) {
+		panic("world is full")
+	}
+	w.AddPlayer(p)
+	p.Pos = util.NewPosition(x, z, plane)
+	p.LastPos.Clone(p.Pos)
+	p.Appearance = packet.NewPacket([]byte{1, 2, 3})
+	p.Loaded = true
+	return p
+}
+
+func connectTestClient(p *Player) *gpiClient {
+	var buf packet.PacketBit
+	p.putInitGPI(&buf)
+	return newGPIClient(p.ID, buf.Bytes())
+}
+
+// tickPlayerInfo moves every player and reads the PLAYER_INFO of each
+// observer into their client, in the same order as World.Tick.
+func tickPlayerInfo(t *testing.T, w *World, clients map[*Player]*gpiClient) {
+	t.Helper()
+
+	for _, v := range w.Players {
+		if v != nil {
+			v.ProcessMovement()
+		}
+	}
+	for p, c := range clients {
+		if err := c.read(p.encodePlayerInfo()); err != nil {
+			t.Fatalf("player %d: %v", p.ID, err)
+		}
+		c.check(t, p)
+	}
+	for _, v := range w.Players {
+		if v != nil {
+			v.Placement = false
+			v.resetMasks()
+		}
+	}
+}
+
+func teleport(p *Player, x int, z int, plane int) {
+	p.LastPos.Clone(p.Pos)
+	p.Pos = util.NewPosition(x, z, plane)
+	p.Placement = true
+	p.Steps = nil
+}
+
+func TestPlayer_encodePlayerInfo(t *testing.T) {
+	w := newTestWorld()
+	observer := addTestPlayer(w, 3200, 3200, 0)
+	near := addTestPlayer(w, 3205, 3200, 0)
+	far := addTestPlayer(w, 3300, 3300, 0)
+	upstairs := addTestPlayer(w, 3201, 3201, 1)
+
+	client := connectTestClient(observer)
+	clients := map[*Player]*gpiClient{observer: client}
+
+	tests := []struct {
+		name string
+		// do changes the world before the tick
+		do func()
+		// the players the client should have in high resolution after it
+		wantLocal []*Player
+		// the players sent an appearance
+		wantAppearances []*Player
+	}{
+		{
+			name:            "nearby player added",
+			do:              func() { observer.GenerateAppearance() },
+			wantLocal:       []*Player{observer, near},
+			wantAppearances: []*Player{observer, near},
+		},
+		{
+			name:      "nothing happens",
+			do:        func() {},
+			wantLocal: []*Player{observer, near},
+		},
+		{
+			name:      "walk",
+			do:        func() { near.WalkTo(3207, 3200, false) },
+			wantLocal: []*Player{observer, near},
+		},
+		{
+			name: "run",
+			do: func() {
+				near.Running = true
+				near.WalkTo(3203, 3204, false)
+			},
+			wantLocal: []*Player{observer, near},
+		},
+		{
+			name:      "observer walks",
+			do:        func() { observer.WalkTo(3199, 3199, false) },
+			wantLocal: []*Player{observer, near},
+		},
+		{
+			name:            "appearance changes",
+			do:              func() { near.GenerateAppearance() },
+			wantLocal:       []*Player{observer, near},
+			wantAppearances: []*Player{near},
+		},
+		{
+			name:      "short teleport",
+			do:        func() { teleport(near, 3190, 3210, 0) },
+			wantLocal: []*Player{observer, near},
+		},
+		{
+			name:      "teleport out of view",
+			do:        func() { teleport(near, 3000, 3400, 0) },
+			wantLocal: []*Player{observer},
+		},
+		{
+			name:      "far player crosses into the next mapsquare",
+			do:        func() { teleport(far, 3300, 3330, 0) },
+			wantLocal: []*Player{observer},
+		},
+		{
+			name:            "player comes downstairs",
+			do:              func() { teleport(upstairs, 3201, 3201, 0) },
+			wantLocal:       []*Player{observer, upstairs},
+			wantAppearances: []*Player{upstairs},
+		},
+		{
+			name:            "far teleport of the observer",
+			do:              func() { teleport(observer, 3000, 3405, 0) },
+			wantLocal:       []*Player{observer, near},
+			wantAppearances: []*Player{near},
+		},
+		{
+			name:      "observer goes upstairs",
+			do:        func() { teleport(observer, 3000, 3405, 2) },
+			wantLocal: []*Player{observer},
+		},
+		{
+			name: "logged out player",
+			do: func() {
+				teleport(observer, 3000, 3405, 0)
+				w.Players[near.ID-1] = nil
+			},
+			wantLocal: []*Player{observer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.do()
+			tickPlayerInfo(t, w, clients)
+
+			var local []*Player
+			for _, index := range client.local {
+				local = append(local, observer.gpi.local[index])
+			}
+			if fmt.Sprint(ids(local)) != fmt.Sprint(ids(tt.wantLocal)) {
+				t.Errorf("local players = %v, want %v", ids(local), ids(tt.wantLocal))
+			}
+
+			var appearances []int
+			for _, index := range client.masks {
+				if client.appearances[index] {
+					appearances = append(appearances, index)
+				}
+			}
+			if fmt.Sprint(appearances) != fmt.Sprint(ids(tt.wantAppearances)) {
+				t.Errorf("appearances = %v, want %v", appearances, ids(tt.wantAppearances))
+			}
+		})
+	}
+}
+
+func ids(players []*Player) []int {
+	var ids []int
+	for _, v := range players {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func TestPlayer_encodePlayerInfo_Crowd(t *testing.T) {
+	w := newTestWorld()
+	observer := addTestPlayer(w, 3200, 3200, 0)
+
+	var crowd []*Player
+	for i := 0; i < 300; i++ {
+		crowd = append(crowd, addTestPlayer(w, 3195+i%10, 3195+i/30, 0))
+	}
+
+	client := connectTestClient(observer)
+	clients := map[*Player]*gpiClient{observer: client}
+
+	for tick := 1; tick <= 20; tick++ {
+		// some of the crowd mills about, so the skips are broken up
+		for i, v := range crowd {
+			if (i+tick)%7 == 0 {
+				v.WalkTo(v.Pos.X+1-tick%2*2, v.Pos.Z, false)
+			}
+		}
+
+		tickPlayerInfo(t, w, clients)
+
+		want := min(1+tick*maxAddsPerTick, maxLocalPlayers)
+		if len(client.local) != want {
+			t.Fatalf("tick %d: %d local players, want %d", tick, len(client.local), want)
+		}
+	}
+
+	// everyone leaves at once
+	for _, v := range crowd {
+		w.Players[v.ID-1] = nil
+	}
+	tickPlayerInfo(t, w, clients)
+	if len(client.local) != 1 {
+		t.Errorf("%d local players after the crowd left, want 1", len(client.local))
+	}
+}
+
+func TestPlayer_encodePlayerInfo_IndexReused(t *testing.T) {
+	w := newTestWorld()
+	observer := addTestPlayer(w, 3200, 3200, 0)
+	first := addTestPlayer(w, 3201, 3200, 0)
+
+	client := connectTestClient(observer)
+	clients := map[*Player]*gpiClient{observer: client}
+	tickPlayerInfo(t, w, clients)
+
+	// someone else logs in on the same index in the same tick
+	w.Players[first.ID-1] = nil
+	second := addTestPlayer(w, 3260, 3200, 0)
+	if second.ID != first.ID {
+		t.Fatalf("second player ID = %d, want %d", second.ID, first.ID)
+	}
+
+	tickPlayerInfo(t, w, clients)
+	if client.high[second.ID] != nil {
+		t.Errorf("client still has the first player")
+	}
+
+	teleport(second, 3202, 3202, 0)
+	tickPlayerInfo(t, w, clients)
+	if client.high[second.ID] == nil || !client.appearances[second.ID] {
+		t.Errorf("client didn't add the second player with their appearance")
+	}
+}
+
+func TestPlayer_encodePlayerInfo_Observers(t *testing.T) {
+	w := newTestWorld()
+	clients := make(map[*Player]*gpiClient)
+	var players []*Player
+	for i := 0; i < 20; i++ {
+		p := addTestPlayer(w, 3200+i*3, 3200+i%4, 0)
+		players = append(players, p)
+	}
+	for _, v := range players {
+		clients[v] = connectTestClient(v)
+	}
+
+	// everyone walks up and down the line, seeing each other come and go
+	for tick := 0; tick < 30; tick++ {
+		for i, v := range players {
+			if tick%10 == 0 {
+				v.Running = i%2 == 0
+				v.WalkTo(3200+(i*7+tick*5)%60, 3200+i%5, false)
+			}
+		}
+		tickPlayerInfo(t, w, clients)
+	}
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+// PlayerSave is the game state kept for a player between logins.
+type PlayerSave struct {
+	Varps     map[int]int `json:"varps,omitempty"`
+	Friends   []string    `json:"friends,omitempty"`
+	Ignores   []string    `json:"ignores,omitempty"`
+	ChatModes ChatModes   `json:"chatModes"`
+	// Clan is the player's channel settings, if they've set it up.
+	Clan *ClanSettings `json:"clan,omitempty"`
+}
+
+// savePath returns where the save of the player called username is kept.
+func (s *Server) savePath(username string) string {
+	return filepath.Join(s.SaveDir, strings.ToLower(strings.ReplaceAll(username, " ", "_"))+".json")
+}
+
+// LoadPlayerSave reads the save at path. A player without one starts with
+// an empty save.
+func LoadPlayerSave(path string) (PlayerSave, error) {
+	var save PlayerSave
+	err := util.ReadJSON(path, &save)
+	if errors.Is(err, os.ErrNotExist) {
+		return PlayerSave{}, nil
+	}
+	return save, err
+}
+
+// Save returns the player's state to keep until they next log in.
+func (p *Player) Save() PlayerSave {
+	save := PlayerSave{
+		Friends:   p.social.friends,
+		Ignores:   p.social.ignores,
+		ChatModes: p.social.modes,
+		Clan:      p.clan,
+	}
+	for id, value := range p.vars.values {
+		if !persistentVarps[id] {
+			continue
+		}
+		if save.Varps == nil {
+			save.Varps = make(map[int]int)
+		}
+		save.Varps[id] = value
+	}
+	return save
+}
+
+// Restore sets the player's state from a save, before they're in the
+// world.
+func (p *Player) Restore(save PlayerSave) {
+	for id, value := range save.Varps {
+		p.vars.values[id] = value
+	}
+	p.Running = p.Varp(VarpRunning) == 1
+
+	p.social.friends = save.Friends
+	p.social.ignores = save.Ignores
+	p.social.modes = save.ChatModes
+	p.clan = save.Clan
+}
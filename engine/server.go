@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/zsrv/rt5-server-go/login"
 	"github.com/zsrv/rt5-server-go/util"
 )
 
@@ -33,6 +34,20 @@ type Server struct {
 
 	World *World
 
+	// Login is the login service this world registers with and authorises
+	// logins against.
+	Login login.Service
+	// SaveDir is the directory player saves are kept in.
+	SaveDir string
+	// WorldParams describes this world in the world list.
+	WorldParams util.WorldParameters
+	// UpdateInterval is how often the world reports its state to the
+	// login service when nothing has changed.
+	UpdateInterval time.Duration
+
+	// signalled when the player count changes
+	worldChanged chan struct{}
+
 	BufferIn  []uint8
 	BufferOut []uint8
 }
@@ -43,8 +58,15 @@ func NewServer() *Server {
 		Logger:  *util.NewLogger(),
 		Clients: make(map[*Client]struct{}),
 
+		done:         make(chan struct{}),
+		worldChanged: make(chan struct{}, 1),
+
 		World: NewWorld(),
 
+		Login:          login.NewLocal(nil),
+		SaveDir:        "data/players",
+		UpdateInterval: 5 * time.Second,
+
 		BufferIn:  make([]uint8, 2048*30000), // pre-allocate 61MB for incoming packets, reduces GC pressure
 		BufferOut: make([]uint8, 2048*30000), // pre-allocate 61MB for outgoing packets, reduces GC pressure
 	}
@@ -67,6 +89,13 @@ func (s *Server) Serve(l net.Listener) error {
 	s.listeners = append(s.listeners, l)
 	s.locker.Unlock()
 
+	err := s.Login.Register(s.worldParams(), s.World.Usernames())
+	if err != nil {
+		// logins are rejected until the login service is reachable again
+		s.Logger.Error("could not register with login service", "error", err)
+	}
+	go s.reportWorld()
+
 	for {
 		socket, err := l.Accept()
 		if err != nil {
@@ -169,6 +198,17 @@ func (s *Server) handleConn(c *Client) error {
 
 		if c.Player != nil {
 			s.World.RemovePlayer(*c)
+
+			err := util.WriteJSON(s.savePath(c.Player.Username), c.Player.Save())
+			if err != nil {
+				s.Logger.Error("could not save player", "username", c.Player.Username, "error", err)
+			}
+
+			err = s.Login.Logout(s.WorldParams.ID, c.Player.Username)
+			if err != nil {
+				s.Logger.Error("could not log out from login service", "error", err)
+			}
+			s.notifyWorldChanged()
 		}
 
 		s.locker.Lock()
@@ -188,8 +228,8 @@ func (s *Server) handleConn(c *Client) error {
 	for {
 		s.Logger.Debug("waiting for new data")
 		n, err := c.Socket.Read(buf)
-		if err == io.EOF {
-			// Connection closed
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
+			// Connection closed, by the client or by us
 			return nil
 		}
 		if err != nil {
@@ -209,3 +249,46 @@ func (s *Server) handleConn(c *Client) error {
 		c.handleData()
 	}
 }
+
+// worldParams returns s.WorldParams with the current player count.
+func (s *Server) worldParams() util.WorldParameters {
+	params := s.WorldParams
+	params.Players = s.World.PlayerCount()
+	return params
+}
+
+// notifyWorldChanged asks reportWorld to send this world's state to the
+// login service without waiting for the next interval.
+func (s *Server) notifyWorldChanged() {
+	select {
+	case s.worldChanged <- struct{}{}:
+	default:
+		// an update is already pending
+	}
+}
+
+// reportWorld sends this world's state to the login service whenever it
+// changes, and periodically otherwise, until the server is closed.
+func (s *Server) reportWorld() {
+	ticker := time.NewTicker(s.UpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.worldChanged:
+		}
+
+		params := s.worldParams()
+		err := s.Login.Update(params)
+		if err != nil {
+			// the login service may have forgotten us, try registering again
+			err = s.Login.Register(params, s.World.Usernames())
+		}
+		if err != nil {
+			s.Logger.Warn("could not update login service", "error", err)
+		}
+	}
+}
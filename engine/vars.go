@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// varps the server uses
+// TODO: confirm against a 578 client
+const (
+	VarpBrightness       = 166
+	VarpOneMouseButton   = 170
+	VarpChatEffectsOff   = 171
+	VarpRunning          = 173
+	VarpSplitPrivateChat = 287
+	VarpAcceptAid        = 427
+)
+
+// persistentVarps holds the varps kept between logins.
+var persistentVarps = map[int]bool{
+	VarpBrightness:       true,
+	VarpOneMouseButton:   true,
+	VarpChatEffectsOff:   true,
+	VarpRunning:          true,
+	VarpSplitPrivateChat: true,
+	VarpAcceptAid:        true,
+}
+
+// vars holds a player's varps, and which have changed since they were last
+// sent.
+type vars struct {
+	values map[int]int
+	// dirty holds the varps to send, in the order they changed.
+	dirty   []int
+	isDirty map[int]bool
+}
+
+func newVars() vars {
+	return vars{
+		values:  make(map[int]int),
+		isDirty: make(map[int]bool),
+	}
+}
+
+// Varp returns the value of varp id.
+func (p *Player) Varp(id int) int {
+	return p.vars.values[id]
+}
+
+// SetVarp sets varp id, sending it to the client at the end of the tick if
+// it changed.
+func (p *Player) SetVarp(id int, value int) {
+	if p.vars.values[id] == value {
+		return
+	}
+	if value == 0 {
+		delete(p.vars.values, id)
+	} else {
+		p.vars.values[id] = value
+	}
+	p.markVarp(id)
+}
+
+func (p *Player) markVarp(id int) {
+	if !p.vars.isDirty[id] {
+		p.vars.isDirty[id] = true
+		p.vars.dirty = append(p.vars.dirty, id)
+	}
+}
+
+// varbit returns the varp varbit id is in, how far its bits are shifted and
+// which bits they are.
+func (p *Player) varbit(id int) (varp int, shift int, mask int, err error) {
+	varbit, err := p.World.Config.Varbits.Get(id)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return varbit.Varp, varbit.LSB, 1<<(varbit.MSB-varbit.LSB+1) - 1, nil
+}
+
+// Varbit returns the value of varbit id.
+func (p *Player) Varbit(id int) (int, error) {
+	varp, shift, mask, err := p.varbit(id)
+	if err != nil {
+		return 0, err
+	}
+	return p.Varp(varp) >> shift & mask, nil
+}
+
+// SetVarbit sets varbit id, within its varp. Bits of value that don't fit
+// are dropped.
+func (p *Player) SetVarbit(id int, value int) error {
+	varp, shift, mask, err := p.varbit(id)
+	if err != nil {
+		return err
+	}
+	p.SetVarp(varp, p.Varp(varp)&^(mask<<shift)|(value&mask)<<shift)
+	return nil
+}
+
+// transmitVars sends every varp that's set, for a client that's just
+// logged in.
+func (p *Player) transmitVars() {
+	ids := make([]int, 0, len(p.vars.values))
+	for id := range p.vars.values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		p.markVarp(id)
+	}
+}
+
+// flushVars queues the varps that changed this tick.
+func (p *Player) flushVars() {
+	for _, id := range p.vars.dirty {
+		p.queueVarp(id, p.Varp(id))
+		delete(p.vars.isDirty, id)
+	}
+	p.vars.dirty = p.vars.dirty[:0]
+}
+
+// queueVarp queues VARP_SMALL for values that fit in a signed byte, or
+// VARP_LARGE.
+// TODO: confirm the byte orders against a 578 client
+func (p *Player) queueVarp(id int, value int) {
+	var response packet.Packet
+	if value >= -128 && value <= 127 {
+		response.P1(util.ServerProtVarpSmall)
+		response.P2(uint16(id))
+		response.P1(uint8(value))
+	} else {
+		response.P1(util.ServerProtVarpLarge)
+		response.P2(uint16(id))
+		response.P4(uint32(value))
+	}
+	p.Client.Queue(response.Bytes(), true)
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/cache"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// varbitSource is a cache holding only varbit types.
+type varbitSource map[int][]byte
+
+func (s varbitSource) ReferenceTable(archive int) (*cache.ReferenceTable, error) {
+	return nil, fmt.Errorf("no archive %d", archive)
+}
+
+func (s varbitSource) Files(archive int, group int) (map[int][]byte, error) {
+	if archive != config.ArchiveVarbitTypes || group != 0 {
+		return nil, fmt.Errorf("no group %d in archive %d", group, archive)
+	}
+	return s, nil
+}
+
+type sentVarp struct {
+	Opcode int
+	ID     int
+	Value  int
+}
+
+// sentVarps returns the varps queued for p, and forgets them.
+func sentVarps(p *Player) []sentVarp {
+	var varps []sentVarp
+	for _, v := range p.Client.NetOut {
+		buf := packet.NewPacket(v.Data)
+		varp := sentVarp{Opcode: int(buf.G1()), ID: int(buf.G2())}
+		if varp.Opcode == util.ServerProtVarpSmall {
+			varp.Value = int(buf.G1B())
+		} else {
+			varp.Value = int(int32(buf.G4()))
+		}
+		varps = append(varps, varp)
+	}
+	p.Client.NetOut = nil
+	return varps
+}
+
+func TestPlayer_flushVars(t *testing.T) {
+	p := newConnectedTestPlayer(1)
+
+	p.SetVarp(300, 5)
+	p.SetVarp(301, 128)
+	p.SetVarp(300, -1)
+	p.SetVarp(302, 0) // unchanged
+	p.SetVarp(303, -200)
+	p.flushVars()
+
+	want := []sentVarp{
+		{util.ServerProtVarpSmall, 300, -1},
+		{util.ServerProtVarpLarge, 301, 128},
+		{util.ServerProtVarpLarge, 303, -200},
+	}
+	if got := sentVarps(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %+v, want %+v", got, want)
+	}
+
+	p.SetVarp(301, 128)
+	p.flushVars()
+	if got := sentVarps(p); len(got) != 0 {
+		t.Errorf("sent %+v for an unchanged varp", got)
+	}
+
+	p.SetVarp(301, 0)
+	p.transmitVars()
+	p.flushVars()
+	want = []sentVarp{
+		{util.ServerProtVarpSmall, 301, 0},
+		{util.ServerProtVarpSmall, 300, -1},
+		{util.ServerProtVarpLarge, 303, -200},
+	}
+	if got := sentVarps(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("after transmitVars() sent %+v, want %+v", got, want)
+	}
+}
+
+func TestPlayer_SetVarbit(t *testing.T) {
+	p := newConnectedTestPlayer(1)
+	p.World = newTestWorld()
+	p.World.Config = config.NewRegistry(varbitSource{
+		1: {1, 0, 50, 0, 3, 0},  // bits 0-3 of varp 50
+		2: {1, 0, 50, 4, 4, 0},  // bit 4
+		3: {1, 0, 50, 8, 31, 0}, // bits 8-31
+	})
+
+	tests := []struct {
+		varbit    int
+		value     int
+		wantVarp  int
+		wantValue int
+	}{
+		{varbit: 1, value: 9, wantVarp: 0x9, wantValue: 9},
+		{varbit: 2, value: 1, wantVarp: 0x19, wantValue: 1},
+		{varbit: 1, value: 0x1f, wantVarp: 0x1f, wantValue: 0xf},
+		{varbit: 3, value: 0xabcdef, wantVarp: 0xabcdef1f, wantValue: 0xabcdef},
+		{varbit: 2, value: 0, wantVarp: 0xabcdef0f, wantValue: 0},
+	}
+	for _, tt := range tests {
+		if err := p.SetVarbit(tt.varbit, tt.value); err != nil {
+			t.Fatalf("SetVarbit(%v) error = %v", tt.varbit, err)
+		}
+		if got := p.Varp(50); got != tt.wantVarp {
+			t.Errorf("SetVarbit(%v, %#x): varp = %#x, want %#x", tt.varbit, tt.value, got, tt.wantVarp)
+		}
+		if got, _ := p.Varbit(tt.varbit); got != tt.wantValue {
+			t.Errorf("Varbit(%v) = %#x, want %#x", tt.varbit, got, tt.wantValue)
+		}
+	}
+
+	if err := p.SetVarbit(4, 1); err == nil {
+		t.Errorf("SetVarbit() of a missing varbit succeeded")
+	}
+}
+
+func TestPlayer_Save(t *testing.T) {
+	p := newConnectedTestPlayer(1)
+	p.SetRunning(true)
+	p.SetVarp(VarpBrightness, 4)
+	p.SetVarp(1000, 7) // not persistent
+	p.social = social{
+		friends: []string{"Zezima"},
+		ignores: []string{"Durial321"},
+		modes:   ChatModes{Public: ChatModeHide, Private: ChatModeFriends},
+	}
+	p.clan = &ClanSettings{Name: "Zezima", KickRank: ClanRankOwner, Ranks: map[uint64]int{util.ToBase37("Zezima"): ClanRankGeneral}}
+
+	path := filepath.Join(t.TempDir(), "players", "someone.json")
+	if err := util.WriteJSON(path, p.Save()); err != nil {
+		t.Fatal(err)
+	}
+	save, err := LoadPlayerSave(path)
+	if err != nil {
+		t.Fatalf("LoadPlayerSave() error = %v", err)
+	}
+
+	restored := newConnectedTestPlayer(1)
+	restored.Restore(save)
+	want := map[int]int{VarpRunning: 1, VarpBrightness: 4}
+	if !reflect.DeepEqual(restored.vars.values, want) {
+		t.Errorf("restored varps = %v, want %v", restored.vars.values, want)
+	}
+	if !restored.Running {
+		t.Errorf("Running = false after restoring")
+	}
+	if !reflect.DeepEqual(restored.social, p.social) {
+		t.Errorf("restored social = %+v, want %+v", restored.social, p.social)
+	}
+	if !reflect.DeepEqual(restored.clan, p.clan) {
+		t.Errorf("restored clan = %+v, want %+v", restored.clan, p.clan)
+	}
+
+	empty, err := LoadPlayerSave(filepath.Join(t.TempDir(), "nobody.json"))
+	if err != nil || empty.Varps != nil {
+		t.Errorf("LoadPlayerSave() of a new player = %+v, %v", empty, err)
+	}
+}
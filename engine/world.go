@@ -1,29 +1,114 @@
 package engine
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/engine/maps"
+	"github.com/zsrv/rt5-server-go/engine/pathfinding"
+	"github.com/zsrv/rt5-server-go/util/cache"
+	"github.com/zsrv/rt5-server-go/util/huffman"
 )
 
 type World struct {
 	Players []*Player
+	// NPCs is indexed by NPC ID.
+	NPCs []*NPC
+
+	Collision  *collision.Map
+	PathFinder *pathfinding.PathFinder
+	Cache      *cache.Cache
+	// Maps flags the collision of mapsquares as players come near them.
+	Maps *maps.Loader
+	// Config holds the config types from the cache.
+	Config *config.Registry
+	// NPCSpawnsPath is the file NPC spawns are loaded from.
+	NPCSpawnsPath string
+	// Huffman is the code chat is compressed with, huffman.Default if nil.
+	Huffman *huffman.Huffman
+	// ChatFilter, if set, checks every line of public chat and every
+	// private message.
+	ChatFilter ChatFilter
+
+	// the ID of the last private or clan channel message sent
+	messageID uint64
+	// the clan channels with players in them, by the owner's name in base
+	// 37
+	channels map[uint64]*clanChannel
+	// the instances in use, by ID
+	instances map[int]*Instance
+	// the zones that differ from the static map or have players watching
+	// them, by ID
+	zones map[int]*Zone
+
+	// work handed to the tick by other goroutines
+	queuedLock sync.Mutex
+	queued     []func()
 }
 
 func NewWorld() *World {
 	// the client index starts at 1
 	w := &World{
 		Players: make([]*Player, 2046),
+		NPCs:    make([]*NPC, maxNPCs),
+
+		Collision:  collision.NewMap(),
+		PathFinder: pathfinding.NewPathFinder(),
 	}
+
+	c := cache.Open("data/cache")
+	w.Cache = c
+	w.Config = config.NewRegistry(c)
+	w.Maps = maps.NewLoader(c, w.Config.Locs, w.Collision)
 	w.Tick()
 	return w
 }
 
-func (w *World) RegisterPlayer(player *Player) {
+// runNextTick has fn run at the start of the next tick, so that work done
+// off the tick, such as waiting on the login service, can change the world.
+// It may be called from any goroutine.
+func (w *World) runNextTick(fn func()) {
+	w.queuedLock.Lock()
+	defer w.queuedLock.Unlock()
+
+	w.queued = append(w.queued, fn)
+}
+
+// runQueued runs the work passed to runNextTick since the last tick.
+func (w *World) runQueued() {
+	w.queuedLock.Lock()
+	queued := w.queued
+	w.queued = nil
+	w.queuedLock.Unlock()
+
+	for _, fn := range queued {
+		fn()
+	}
+}
+
+func (w *World) huffman() *huffman.Huffman {
+	if w.Huffman == nil {
+		return huffman.Default
+	}
+	return w.Huffman
+}
+
+// RegisterPlayer assigns player a free index, reporting false if the world
+// is full.
+func (w *World) RegisterPlayer(player *Player) bool {
 	for i := range w.Players {
 		if w.Players[i] == nil {
 			player.ID = i + 1
-			break
+			return true
 		}
 	}
+	return false
 }
 
 func (w *World) AddPlayer(player *Player) {
@@ -33,11 +118,139 @@ func (w *World) AddPlayer(player *Player) {
 
 func (w *World) RemovePlayer(client Client) {
 	w.Players[client.Player.ID-1] = nil
+	w.notifyFriends(client.Player)
+	client.Player.unloadClan()
+	client.Player.leaveInstance()
+	client.Player.unobserveZones()
+}
+
+// GetPlayer returns the player on index id, or nil if there isn't one.
+func (w *World) GetPlayer(id int) *Player {
+	if id < 1 || id > len(w.Players) {
+		return nil
+	}
+	return w.Players[id-1]
+}
+
+// AddNPC gives n a free index and puts it in the world, reporting false if
+// the world is full.
+func (w *World) AddNPC(n *NPC) bool {
+	for i := range w.NPCs {
+		if w.NPCs[i] == nil {
+			n.ID = i
+			n.World = w
+			w.NPCs[i] = n
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveNPC takes n out of the world.
+func (w *World) RemoveNPC(n *NPC) {
+	if w.GetNPC(n.ID) == n {
+		w.NPCs[n.ID] = nil
+	}
+}
+
+// GetNPC returns the NPC on index id, or nil if there isn't one.
+func (w *World) GetNPC(id int) *NPC {
+	if id < 0 || id >= len(w.NPCs) {
+		return nil
+	}
+	return w.NPCs[id]
+}
+
+// SpawnNPCs adds an NPC for each spawn.
+func (w *World) SpawnNPCs(spawns []NPCSpawn) error {
+	for _, v := range spawns {
+		n := NewNPC(v)
+		if w.Config != nil {
+			npcType, err := w.Config.NPCs.Get(v.Type)
+			if err != nil {
+				return err
+			}
+			n.Size = npcType.Size
+		}
+
+		if !w.AddNPC(n) {
+			return fmt.Errorf("no room for NPC %d at (%d, %d, %d)", v.Type, v.X, v.Z, v.Plane)
+		}
+	}
+	return nil
+}
+
+// LoadNPCs spawns the NPCs in NPCSpawnsPath, replacing any already
+// spawned. A missing file spawns none.
+func (w *World) LoadNPCs() error {
+	spawns, err := LoadNPCSpawns(w.NPCSpawnsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, v := range w.NPCs {
+		if v != nil {
+			w.RemoveNPC(v)
+		}
+	}
+	return w.SpawnNPCs(spawns)
+}
+
+// Reload reloads the config types from the cache and respawns the NPCs.
+func (w *World) Reload() (map[string]int, error) {
+	if w.Cache == nil {
+		return nil, errors.New("there is no cache to reload from")
+	}
+	registry := config.NewRegistry(w.Cache)
+	counts, err := registry.Load()
+	if err != nil {
+		return nil, err
+	}
+	w.Config = registry
+	if w.Maps != nil {
+		w.Maps.LocTypes = registry.Locs
+	}
+
+	return counts, w.LoadNPCs()
+}
+
+// PlayerCount returns the number of players in the world.
+func (w *World) PlayerCount() int {
+	count := 0
+	for _, v := range w.Players {
+		if v != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Usernames returns the usernames of the players in the world.
+func (w *World) Usernames() []string {
+	var names []string
+	for _, v := range w.Players {
+		if v != nil {
+			names = append(names, v.Username)
+		}
+	}
+	return names
+}
+
+// FindPlayer returns the player logged in with username.
+func (w *World) FindPlayer(username string) (*Player, bool) {
+	for _, v := range w.Players {
+		if v != nil && strings.EqualFold(v.Username, username) {
+			return v, true
+		}
+	}
+	return nil, false
 }
 
 func (w *World) Tick() {
 	start := time.Now().UnixMilli()
 
+	w.runQueued()
+
 	// read packets
 	for _, v := range w.Players {
 		if v == nil {
@@ -49,6 +262,14 @@ func (w *World) Tick() {
 	}
 
 	// npc processing
+	for _, v := range w.NPCs {
+		if v == nil {
+			continue
+		}
+
+		v.Tick()
+	}
+
 	// player processing
 	for _, v := range w.Players {
 		if v == nil {
@@ -59,6 +280,18 @@ func (w *World) Tick() {
 		v.Tick()
 	}
 
+	// player info, once everyone has moved
+	for _, v := range w.Players {
+		if v == nil || !v.Loaded {
+			continue
+		}
+
+		v.SendPlayerInfo()
+		v.SendNPCInfo()
+		v.SendZoneUpdates()
+	}
+	w.resetZones()
+
 	// game tasks
 	// flushing packets
 	for _, v := range w.Players {
@@ -67,6 +300,7 @@ func (w *World) Tick() {
 			continue
 		}
 
+		v.flushVars()
 		if len(v.Client.NetOut) > 0 {
 			v.Client.EncodeOut()
 			v.Client.NetOut = make([]NetOutData, 0)
@@ -74,8 +308,21 @@ func (w *World) Tick() {
 
 		v.Client.Flush()
 		v.Client.ResetIn()
+		if v.kicked {
+			v.Client.Socket.Close()
+		}
+
+		v.Placement = false
+		v.resetMasks()
+	}
+
+	for _, v := range w.NPCs {
+		if v == nil {
+			continue
+		}
 
 		v.Placement = false
+		v.masks.reset()
 	}
 
 	// npc aggro etc
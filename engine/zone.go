@@ -0,0 +1,516 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/zsrv/rt5-server-go/engine/maps"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// Zone is an 8x8 tile area of the map on one plane. It holds what's changed
+// there since the map was loaded, and what's happened there this tick, for
+// the players who can see it.
+type Zone struct {
+	// X and Z are the zone's coordinates, which are its south west tile
+	// >> 3.
+	X     int
+	Z     int
+	Plane int
+
+	// the locs added, changed or removed, by tile and layer. A loc of the
+	// static map that's been removed leaves a nil.
+	locs map[locSlot]*maps.Loc
+	objs []*GroundObj
+	// what's happened in the zone this tick
+	events []zoneEvent
+	// the players whose build area the zone is in
+	observers map[*Player]bool
+}
+
+// locSlot is where a loc goes: a tile has at most one loc on each layer.
+type locSlot struct {
+	x, z  int
+	layer int
+}
+
+// zoneEvent is an update to a zone, sent to the players who can see it as
+// the packet it's encoded as.
+type zoneEvent struct {
+	opcode  int
+	payload []byte
+	// receiver, if set, is the only player the event is sent to
+	receiver *Player
+	// transient events, such as projectiles, aren't part of the zone's state
+	transient bool
+}
+
+// GroundObj is a stack of objs lying on a tile.
+type GroundObj struct {
+	ID    int
+	Count int
+	X     int
+	Z     int
+	Plane int
+	// Receiver, if set, is the only player who can see the obj, such as
+	// the player who dropped it.
+	Receiver *Player
+}
+
+// visibleTo reports whether viewer can see the obj.
+func (o *GroundObj) visibleTo(viewer *Player) bool {
+	return o.Receiver == nil || o.Receiver == viewer
+}
+
+// Projectile is a spot anim flying from one tile to another, or to an NPC or
+// player.
+type Projectile struct {
+	SrcX  int
+	SrcZ  int
+	DstX  int
+	DstZ  int
+	Plane int
+	// Target is the NPC's index + 1, or the player's index + 1 negated, of
+	// who the projectile follows, or 0 for none.
+	Target   int
+	SpotAnim int
+	// the heights the projectile leaves and lands at
+	StartHeight int
+	EndHeight   int
+	// the client cycles, of 20ms, after which the projectile appears and
+	// lands
+	StartCycle int
+	EndCycle   int
+	// Angle is how steeply the projectile arcs.
+	Angle int
+	// Offset is how far from the source tile the projectile starts, in
+	// 1/64ths of a tile.
+	Offset int
+}
+
+func zoneID(zoneX int, zoneZ int, plane int) int {
+	return plane<<22 | zoneX<<11 | zoneZ
+}
+
+// zoneTile packs the position of a tile within its zone, the way zone
+// packets send it.
+func zoneTile(x int, z int) uint8 {
+	return uint8((x&7)<<4 | z&7)
+}
+
+// zone returns the zone containing the tile x, z on plane, creating it if
+// needed.
+func (w *World) zone(x int, z int, plane int) *Zone {
+	id := zoneID(x>>3, z>>3, plane)
+	if zone, ok := w.zones[id]; ok {
+		return zone
+	}
+	if w.zones == nil {
+		w.zones = make(map[int]*Zone)
+	}
+
+	zone := &Zone{
+		X:         x >> 3,
+		Z:         z >> 3,
+		Plane:     plane,
+		locs:      make(map[locSlot]*maps.Loc),
+		observers: make(map[*Player]bool),
+	}
+	for _, v := range w.Players {
+		if v != nil && v.zones[id] {
+			zone.observers[v] = true
+		}
+	}
+	w.zones[id] = zone
+	return zone
+}
+
+// event records an update to the zone, if anyone can see it.
+func (z *Zone) event(e zoneEvent) {
+	if len(z.observers) == 0 {
+		return
+	}
+	z.events = append(z.events, e)
+}
+
+// empty reports whether nothing in the zone differs from the static map.
+func (z *Zone) empty() bool {
+	return len(z.locs) == 0 && len(z.objs) == 0
+}
+
+// resetZones drops this tick's zone events, and the zones nobody can see
+// that don't differ from the static map.
+func (w *World) resetZones() {
+	for id, v := range w.zones {
+		v.events = nil
+		if len(v.observers) == 0 && v.empty() {
+			delete(w.zones, id)
+		}
+	}
+}
+
+// staticLocs returns the locs the map places on a tile.
+func (w *World) staticLocs(x int, z int, plane int) []maps.Loc {
+	if w.Maps == nil {
+		return nil
+	}
+	return w.Maps.Locs(x, z, plane)
+}
+
+// findLoc returns the loc on a layer of locs, if there is one.
+func findLoc(locs []maps.Loc, layer int) (maps.Loc, bool) {
+	for _, v := range locs {
+		if maps.LocLayer(v.Shape) == layer {
+			return v, true
+		}
+	}
+	return maps.Loc{}, false
+}
+
+// Locs returns the locs on the tile x, z on plane as players see them, with
+// any added or removed in game.
+func (w *World) Locs(x int, z int, plane int) []maps.Loc {
+	static := w.staticLocs(x, z, plane)
+	zone, ok := w.zones[zoneID(x>>3, z>>3, plane)]
+	if !ok {
+		return static
+	}
+
+	var locs []maps.Loc
+	for _, v := range static {
+		if _, ok := zone.locs[locSlot{x, z, maps.LocLayer(v.Shape)}]; !ok {
+			locs = append(locs, v)
+		}
+	}
+	for layer := maps.LayerWall; layer <= maps.LayerGroundDecoration; layer++ {
+		if v := zone.locs[locSlot{x, z, layer}]; v != nil {
+			locs = append(locs, *v)
+		}
+	}
+	return locs
+}
+
+// flagLoc adds or removes a loc's collision.
+func (w *World) flagLoc(loc maps.Loc, add bool) {
+	if w.Maps == nil {
+		return
+	}
+	locType, err := w.Maps.LocTypes.Get(loc.ID)
+	if err != nil {
+		return
+	}
+	if add {
+		maps.AddLoc(w.Collision, locType, loc.X, loc.Z, loc.Plane, loc.Shape, loc.Rotation)
+	} else {
+		maps.RemoveLoc(w.Collision, locType, loc.X, loc.Z, loc.Plane, loc.Shape, loc.Rotation)
+	}
+}
+
+// AddLoc places a loc, replacing any on the same layer of its tile, and
+// shows it to the players who can see it.
+func (w *World) AddLoc(loc maps.Loc) {
+	layer := maps.LocLayer(loc.Shape)
+	if old, ok := findLoc(w.Locs(loc.X, loc.Z, loc.Plane), layer); ok {
+		w.flagLoc(old, false)
+	}
+	w.flagLoc(loc, true)
+
+	zone := w.zone(loc.X, loc.Z, loc.Plane)
+	slot := locSlot{loc.X, loc.Z, layer}
+	if static, ok := findLoc(w.staticLocs(loc.X, loc.Z, loc.Plane), layer); ok && static == loc {
+		delete(zone.locs, slot)
+	} else {
+		zone.locs[slot] = &loc
+	}
+	zone.event(zoneEvent{opcode: util.ServerProtLocAddChange, payload: encodeLocAddChange(loc)})
+}
+
+// RemoveLoc removes loc from its tile, reporting false if it isn't there.
+func (w *World) RemoveLoc(loc maps.Loc) bool {
+	layer := maps.LocLayer(loc.Shape)
+	old, ok := findLoc(w.Locs(loc.X, loc.Z, loc.Plane), layer)
+	if !ok || old.ID != loc.ID {
+		return false
+	}
+	w.flagLoc(old, false)
+
+	zone := w.zone(loc.X, loc.Z, loc.Plane)
+	slot := locSlot{loc.X, loc.Z, layer}
+	if _, ok := findLoc(w.staticLocs(loc.X, loc.Z, loc.Plane), layer); ok {
+		zone.locs[slot] = nil
+	} else {
+		delete(zone.locs, slot)
+	}
+	zone.event(zoneEvent{opcode: util.ServerProtLocDel, payload: encodeLocDel(old)})
+	return true
+}
+
+// Objs returns the obj stacks viewer can see on the tile x, z on plane.
+func (w *World) Objs(x int, z int, plane int, viewer *Player) []*GroundObj {
+	zone, ok := w.zones[zoneID(x>>3, z>>3, plane)]
+	if !ok {
+		return nil
+	}
+
+	var objs []*GroundObj
+	for _, v := range zone.objs {
+		if v.X == x && v.Z == z && v.visibleTo(viewer) {
+			objs = append(objs, v)
+		}
+	}
+	return objs
+}
+
+// AddObj drops a stack of objs on the ground.
+func (w *World) AddObj(obj GroundObj) *GroundObj {
+	zone := w.zone(obj.X, obj.Z, obj.Plane)
+	zone.objs = append(zone.objs, &obj)
+	zone.event(zoneEvent{opcode: util.ServerProtObjAdd, payload: encodeObjAdd(&obj), receiver: obj.Receiver})
+	return &obj
+}
+
+// RemoveObj takes a stack of objs off the ground, reporting false if it
+// isn't there.
+func (w *World) RemoveObj(obj *GroundObj) bool {
+	zone := w.zone(obj.X, obj.Z, obj.Plane)
+	for i, v := range zone.objs {
+		if v == obj {
+			zone.objs = append(zone.objs[:i], zone.objs[i+1:]...)
+			zone.event(zoneEvent{opcode: util.ServerProtObjDel, payload: encodeObjDel(obj), receiver: obj.Receiver})
+			return true
+		}
+	}
+	return false
+}
+
+// SetObjCount changes how many objs are in a stack on the ground.
+func (w *World) SetObjCount(obj *GroundObj, count int) {
+	var buf packet.Packet
+	buf.P1(zoneTile(obj.X, obj.Z))
+	buf.P2(uint16(obj.ID))
+	buf.P2(objCount(obj.Count))
+	buf.P2(objCount(count))
+	obj.Count = count
+
+	zone := w.zone(obj.X, obj.Z, obj.Plane)
+	zone.event(zoneEvent{opcode: util.ServerProtObjCount, payload: buf.Bytes(), receiver: obj.Receiver})
+}
+
+// Projectile fires a projectile, seen by the players who can see where it's
+// fired from.
+func (w *World) Projectile(proj Projectile) {
+	var buf packet.Packet
+	buf.P1(zoneTile(proj.SrcX, proj.SrcZ))
+	buf.P1(uint8(proj.DstX - proj.SrcX))
+	buf.P1(uint8(proj.DstZ - proj.SrcZ))
+	buf.P2(uint16(proj.Target))
+	buf.P2(uint16(proj.SpotAnim))
+	buf.P1(uint8(proj.StartHeight))
+	buf.P1(uint8(proj.EndHeight))
+	buf.P2(uint16(proj.StartCycle))
+	buf.P2(uint16(proj.EndCycle))
+	buf.P1(uint8(proj.Angle))
+	buf.P1(uint8(proj.Offset))
+
+	zone := w.zone(proj.SrcX, proj.SrcZ, proj.Plane)
+	zone.event(zoneEvent{opcode: util.ServerProtMapProjAnim, payload: buf.Bytes(), transient: true})
+}
+
+// SpotAnimTile plays a spot anim on the tile x, z on plane, height units
+// off the ground and after delay client cycles.
+func (w *World) SpotAnimTile(x int, z int, plane int, id int, height int, delay int) {
+	var buf packet.Packet
+	buf.P1(zoneTile(x, z))
+	buf.P2(uint16(id))
+	buf.P1(uint8(height))
+	buf.P2(uint16(delay))
+
+	zone := w.zone(x, z, plane)
+	zone.event(zoneEvent{opcode: util.ServerProtMapAnim, payload: buf.Bytes(), transient: true})
+}
+
+// SoundArea plays a sound to the players within radius tiles of the tile x,
+// z on plane, loops times after delay client cycles.
+func (w *World) SoundArea(x int, z int, plane int, id int, loops int, radius int, delay int) {
+	var buf packet.Packet
+	buf.P1(zoneTile(x, z))
+	buf.P2(uint16(id))
+	buf.P1(uint8(radius<<4 | loops&0xf))
+	buf.P1(uint8(delay))
+
+	zone := w.zone(x, z, plane)
+	zone.event(zoneEvent{opcode: util.ServerProtSoundArea, payload: buf.Bytes(), transient: true})
+}
+
+func encodeLocAddChange(loc maps.Loc) []byte {
+	var buf packet.Packet
+	buf.P1(zoneTile(loc.X, loc.Z))
+	buf.P1(uint8(loc.Shape<<2 | loc.Rotation))
+	buf.P2(uint16(loc.ID))
+	return buf.Bytes()
+}
+
+func encodeLocDel(loc maps.Loc) []byte {
+	var buf packet.Packet
+	buf.P1(zoneTile(loc.X, loc.Z))
+	buf.P1(uint8(loc.Shape<<2 | loc.Rotation))
+	return buf.Bytes()
+}
+
+func encodeObjAdd(obj *GroundObj) []byte {
+	var buf packet.Packet
+	buf.P1(zoneTile(obj.X, obj.Z))
+	buf.P2(uint16(obj.ID))
+	buf.P2(objCount(obj.Count))
+	return buf.Bytes()
+}
+
+func encodeObjDel(obj *GroundObj) []byte {
+	var buf packet.Packet
+	buf.P1(zoneTile(obj.X, obj.Z))
+	buf.P2(uint16(obj.ID))
+	return buf.Bytes()
+}
+
+// objCount returns the count of an obj stack as zone packets send it, which
+// stops at 65535.
+func objCount(count int) uint16 {
+	if count > 0xffff {
+		return 0xffff
+	}
+	return uint16(count)
+}
+
+// SendZoneUpdates queues the state of the zones that have come into the
+// player's build area, and what's happened this tick in the ones that were
+// already in it.
+func (p *Player) SendZoneUpdates() {
+	zones := make(map[int]bool, len(p.zones))
+	radiusX, radiusZ := p.Origin.BASizeX>>4, p.Origin.BASizeZ>>4
+	for plane := 0; plane < 4; plane++ {
+		for x := p.Origin.ZoneX() - radiusX; x <= p.Origin.ZoneX()+radiusX; x++ {
+			for z := p.Origin.ZoneZ() - radiusZ; z <= p.Origin.ZoneZ()+radiusZ; z++ {
+				id := zoneID(x, z, plane)
+				zones[id] = true
+
+				zone, ok := p.World.zones[id]
+				if !ok {
+					continue
+				}
+				if p.zones[id] {
+					p.sendZonePartialEnclosed(zone)
+				} else {
+					zone.observers[p] = true
+					p.sendZoneState(zone)
+				}
+			}
+		}
+	}
+
+	for id := range p.zones {
+		if zones[id] {
+			continue
+		}
+		if zone, ok := p.World.zones[id]; ok {
+			delete(zone.observers, p)
+		}
+	}
+	p.zones = zones
+}
+
+// unobserveZones stops the player watching the zones in their build area.
+func (p *Player) unobserveZones() {
+	for id := range p.zones {
+		if zone, ok := p.World.zones[id]; ok {
+			delete(zone.observers, p)
+		}
+	}
+	p.zones = nil
+}
+
+// sendZoneState queues UPDATE_ZONE_PARTIAL_FOLLOWS, followed by everything
+// in a zone that differs from the static map and this tick's transient
+// events there.
+func (p *Player) sendZoneState(zone *Zone) {
+	var events []zoneEvent
+
+	slots := make([]locSlot, 0, len(zone.locs))
+	for k := range zone.locs {
+		slots = append(slots, k)
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		a, b := slots[i], slots[j]
+		if a.x != b.x {
+			return a.x < b.x
+		}
+		if a.z != b.z {
+			return a.z < b.z
+		}
+		return a.layer < b.layer
+	})
+	for _, v := range slots {
+		if loc := zone.locs[v]; loc != nil {
+			events = append(events, zoneEvent{opcode: util.ServerProtLocAddChange, payload: encodeLocAddChange(*loc)})
+		} else if static, ok := findLoc(p.World.staticLocs(v.x, v.z, zone.Plane), v.layer); ok {
+			events = append(events, zoneEvent{opcode: util.ServerProtLocDel, payload: encodeLocDel(static)})
+		}
+	}
+	for _, v := range zone.objs {
+		if v.visibleTo(p) {
+			events = append(events, zoneEvent{opcode: util.ServerProtObjAdd, payload: encodeObjAdd(v)})
+		}
+	}
+	for _, v := range zone.events {
+		if v.transient && (v.receiver == nil || v.receiver == p) {
+			events = append(events, v)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	var response packet.Packet
+	response.P1(util.ServerProtUpdateZonePartialFollows)
+	p.putZone(&response, zone)
+	p.Client.Queue(response.Bytes(), true)
+
+	for _, v := range events {
+		var event packet.Packet
+		event.P1(uint8(v.opcode))
+		event.PData(v.payload, len(v.payload))
+		p.Client.Queue(event.Bytes(), true)
+	}
+}
+
+// sendZonePartialEnclosed queues UPDATE_ZONE_PARTIAL_ENCLOSED, with the
+// events in a zone this tick.
+func (p *Player) sendZonePartialEnclosed(zone *Zone) {
+	var response packet.Packet
+	response.P1(util.ServerProtUpdateZonePartialEnclosed)
+	response.P2(0)
+	start := response.Len()
+
+	p.putZone(&response, zone)
+	header := response.Len()
+	for _, v := range zone.events {
+		if v.receiver == nil || v.receiver == p {
+			response.P1(uint8(v.opcode))
+			response.PData(v.payload, len(v.payload))
+		}
+	}
+	if response.Len() == header {
+		return
+	}
+
+	response.PSize2(response.Len() - start)
+	p.Client.Queue(response.Bytes(), true)
+}
+
+// putZone writes the zone the packets after it are for, relative to the
+// player's build area.
+// TODO: confirm the layout against a 578 client
+func (p *Player) putZone(buf *packet.Packet, zone *Zone) {
+	buf.P1(uint8(zone.X<<3 - p.Origin.BAStartX()))
+	buf.P1(uint8(zone.Z<<3 - p.Origin.BAStartZ()))
+	buf.P1(uint8(zone.Plane))
+}
@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/engine/collision"
+	"github.com/zsrv/rt5-server-go/engine/config"
+	"github.com/zsrv/rt5-server-go/engine/maps"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+type testLocTypes map[int]*config.LocType
+
+func (t testLocTypes) Get(id int) (*config.LocType, error) {
+	if v, ok := t[id]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("no loc %d", id)
+}
+
+// the locs of the zone tests
+var (
+	testDoor         = &config.LocType{ID: 1530, Name: "Door", Width: 1, Length: 1, BlockWalk: 2, Ops: [5]string{"Open"}}
+	testOpenDoor     = &config.LocType{ID: 1531, Name: "Door", Width: 1, Length: 1, BlockWalk: 2, Ops: [5]string{"Close"}}
+	testLadder       = &config.LocType{ID: 1747, Name: "Ladder", Width: 1, Length: 1, BlockWalk: 2, Ops: [5]string{"Climb-up", "Climb-down"}}
+	testZoneLocTypes = testLocTypes{1530: testDoor, 1531: testOpenDoor, 1747: testLadder}
+)
+
+// noMaps is a map source with no files in it.
+type noMaps struct{}
+
+func (noMaps) GroupID(archive int, name string) (int, bool, error) {
+	return 0, false, nil
+}
+
+func (noMaps) Read(archive int, group int, key []int32) ([]byte, error) {
+	return nil, errors.New("no files")
+}
+
+// useTestMaps gives w a map with no files, so locs are only where they're
+// placed.
+func useTestMaps(w *World) {
+	w.Maps = maps.NewLoader(noMaps{}, testZoneLocTypes, w.Collision)
+}
+
+// zoneEventSizes is the payload size of each zone packet.
+var zoneEventSizes = map[int]int{
+	util.ServerProtLocAddChange: 4,
+	util.ServerProtLocDel:       2,
+	util.ServerProtObjAdd:       5,
+	util.ServerProtObjDel:       3,
+	util.ServerProtObjCount:     7,
+	util.ServerProtMapProjAnim:  15,
+	util.ServerProtMapAnim:      6,
+	util.ServerProtSoundArea:    5,
+}
+
+type sentZone struct {
+	Opcode int
+	// X and Z are relative to the build area.
+	X      int
+	Z      int
+	Plane  int
+	Events []int
+}
+
+// sentZones returns the zone packets queued for p, with the packets that
+// follow UPDATE_ZONE_PARTIAL_FOLLOWS or are enclosed in
+// UPDATE_ZONE_PARTIAL_ENCLOSED as its events, and forgets everything
+// queued.
+func sentZones(t *testing.T, p *Player) []sentZone {
+	t.Helper()
+
+	var zones []sentZone
+	for _, v := range p.Client.NetOut {
+		buf := packet.NewPacket(v.Data)
+		opcode := int(buf.G1())
+		switch opcode {
+		case util.ServerProtUpdateZonePartialFollows:
+			zones = append(zones, sentZone{Opcode: opcode, X: int(buf.G1()), Z: int(buf.G1()), Plane: int(buf.G1())})
+		case util.ServerProtUpdateZonePartialEnclosed:
+			size := int(buf.G2())
+			if size != buf.Len() {
+				t.Fatalf("UPDATE_ZONE_PARTIAL_ENCLOSED size %d, has %d bytes", size, buf.Len())
+			}
+			zone := sentZone{Opcode: opcode, X: int(buf.G1()), Z: int(buf.G1()), Plane: int(buf.G1())}
+			for buf.Len() > 0 {
+				event := int(buf.G1())
+				zone.Events = append(zone.Events, event)
+				buf.GData(make([]byte, zoneEventSizes[event]), zoneEventSizes[event])
+			}
+			zones = append(zones, zone)
+		default:
+			size, ok := zoneEventSizes[opcode]
+			if !ok || len(zones) == 0 || zones[len(zones)-1].Opcode != util.ServerProtUpdateZonePartialFollows {
+				continue
+			}
+			if buf.Len() != size {
+				t.Fatalf("zone packet %d has %d bytes, want %d", opcode, buf.Len(), size)
+			}
+			zones[len(zones)-1].Events = append(zones[len(zones)-1].Events, opcode)
+		}
+	}
+	p.Client.NetOut = nil
+	return zones
+}
+
+func TestWorld_AddLoc(t *testing.T) {
+	w := newTestWorld()
+	useTestMaps(w)
+	door := maps.Loc{ID: 1530, X: 3200, Z: 3200, Shape: 0, Rotation: 0}
+	if err := w.Maps.PlaceLoc(door); err != nil {
+		t.Fatal(err)
+	}
+	open := maps.Loc{ID: 1531, X: 3200, Z: 3200, Shape: 0, Rotation: 1}
+
+	tests := []struct {
+		name   string
+		change func() bool
+		want   bool
+		locs   []maps.Loc
+		flags  int
+	}{
+		{
+			name:   "remove the static door",
+			change: func() bool { return w.RemoveLoc(door) },
+			want:   true,
+		},
+		{
+			name:   "remove it again",
+			change: func() bool { return w.RemoveLoc(door) },
+		},
+		{
+			name:   "add the open door",
+			change: func() bool { w.AddLoc(open); return true },
+			want:   true,
+			locs:   []maps.Loc{open},
+			flags:  collision.WallNorth,
+		},
+		{
+			name:   "remove the wrong loc",
+			change: func() bool { return w.RemoveLoc(door) },
+			locs:   []maps.Loc{open},
+			flags:  collision.WallNorth,
+		},
+		{
+			name:   "close it again",
+			change: func() bool { w.AddLoc(door); return true },
+			want:   true,
+			locs:   []maps.Loc{door},
+			flags:  collision.WallWest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.change(); got != tt.want {
+				t.Errorf("change = %v, want %v", got, tt.want)
+			}
+			if got := w.Locs(3200, 3200, 0); !reflect.DeepEqual(got, tt.locs) {
+				t.Errorf("Locs() = %v, want %v", got, tt.locs)
+			}
+			if got := w.Collision.Flags(3200, 3200, 0); got != tt.flags {
+				t.Errorf("Flags() = %#x, want %#x", got, tt.flags)
+			}
+		})
+	}
+
+	// back as the map has it, so there's nothing to keep
+	w.resetZones()
+	if len(w.zones) != 0 {
+		t.Errorf("zones = %v, want none", w.zones)
+	}
+}
+
+func TestPlayer_SendZoneUpdates(t *testing.T) {
+	// the build area starts at 3152, 3152
+	p := newBuildAreaTestPlayer(3200, 3200)
+	w := p.World
+	useTestMaps(w)
+	other := addTestPlayer(w, 3000, 3000, 0)
+
+	coins := w.AddObj(GroundObj{ID: 995, Count: 100, X: 3205, Z: 3203})
+	w.AddObj(GroundObj{ID: 526, Count: 1, X: 3206, Z: 3203, Receiver: other})
+	door := maps.Loc{ID: 1530, X: 3210, Z: 3200, Shape: 0, Rotation: 0}
+	if err := w.Maps.PlaceLoc(door); err != nil {
+		t.Fatal(err)
+	}
+	w.RemoveLoc(door)
+
+	// the zones come into view
+	p.SendZoneUpdates()
+	w.resetZones()
+	want := []sentZone{
+		{Opcode: util.ServerProtUpdateZonePartialFollows, X: 48, Z: 48, Events: []int{util.ServerProtObjAdd}},
+		{Opcode: util.ServerProtUpdateZonePartialFollows, X: 56, Z: 48, Events: []int{util.ServerProtLocDel}},
+	}
+	if got := sentZones(t, p); !reflect.DeepEqual(got, want) {
+		t.Errorf("first tick sent %+v, want %+v", got, want)
+	}
+
+	// what happens in them afterwards
+	w.Projectile(Projectile{SrcX: 3201, SrcZ: 3201, DstX: 3205, DstZ: 3205, SpotAnim: 10, EndCycle: 60})
+	w.AddObj(GroundObj{ID: 995, Count: 5, X: 3207, Z: 3207})
+	w.AddObj(GroundObj{ID: 526, Count: 1, X: 3206, Z: 3203, Receiver: other})
+	w.SetObjCount(coins, 100000)
+	w.SpotAnimTile(3200, 3210, 1, 5, 0, 0)
+	p.SendZoneUpdates()
+	w.resetZones()
+	want = []sentZone{
+		{Opcode: util.ServerProtUpdateZonePartialEnclosed, X: 48, Z: 48, Events: []int{
+			util.ServerProtMapProjAnim, util.ServerProtObjAdd, util.ServerProtObjCount,
+		}},
+		{Opcode: util.ServerProtUpdateZonePartialEnclosed, X: 48, Z: 56, Plane: 1, Events: []int{util.ServerProtMapAnim}},
+	}
+	if got := sentZones(t, p); !reflect.DeepEqual(got, want) {
+		t.Errorf("second tick sent %+v, want %+v", got, want)
+	}
+	if len(w.Objs(3205, 3203, 0, p)) != 1 || w.Objs(3205, 3203, 0, p)[0].Count != 100000 {
+		t.Errorf("Objs() = %v, want the coins", w.Objs(3205, 3203, 0, p))
+	}
+	if len(w.Objs(3206, 3203, 0, p)) != 0 || len(w.Objs(3206, 3203, 0, other)) != 2 {
+		t.Errorf("private objs are visible to the wrong players")
+	}
+
+	// nothing happening sends nothing
+	p.SendZoneUpdates()
+	w.resetZones()
+	if got := sentZones(t, p); len(got) != 0 {
+		t.Errorf("quiet tick sent %+v", got)
+	}
+
+	// out of view, zones are only kept for what differs from the map
+	p.Teleport(2965, 3380, 0)
+	p.Tick()
+	p.SendZoneUpdates()
+	w.resetZones()
+	if got := sentZones(t, p); len(got) != 0 {
+		t.Errorf("far away sent %+v", got)
+	}
+	zone, ok := w.zones[zoneID(400, 400, 0)]
+	if !ok || len(zone.observers) != 0 {
+		t.Fatalf("zone with objs dropped, or still watched")
+	}
+	if _, ok := w.zones[zoneID(400, 401, 1)]; ok {
+		t.Errorf("zone with only a spot anim kept")
+	}
+
+	// coming back sends everything again
+	if !w.RemoveObj(coins) || w.RemoveObj(coins) {
+		t.Errorf("RemoveObj() didn't remove the coins once")
+	}
+	p.Teleport(3200, 3200, 0)
+	p.Tick()
+	p.SendZoneUpdates()
+	w.resetZones()
+	want = []sentZone{
+		{Opcode: util.ServerProtUpdateZonePartialFollows, X: 48, Z: 48, Events: []int{util.ServerProtObjAdd}},
+		{Opcode: util.ServerProtUpdateZonePartialFollows, X: 56, Z: 48, Events: []int{util.ServerProtLocDel}},
+	}
+	if got := sentZones(t, p); !reflect.DeepEqual(got, want) {
+		t.Errorf("coming back sent %+v, want %+v", got, want)
+	}
+
+	// logging out stops watching
+	p.Client.Player = p
+	p.Username = "zone test"
+	p.Client.Server.WorldParams.ID = 1
+	w.RemovePlayer(*p.Client)
+	if len(zone.observers) != 0 {
+		t.Errorf("logged out player still watching")
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/zsrv/rt5-server-go
 
 go 1.21
+
+require golang.org/x/crypto v0.33.0
@@ -0,0 +1,161 @@
+package login
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrAccountExists = errors.New("login: account already exists")
+
+// Account is a player's account as stored by the login service.
+type Account struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"` // bcrypt
+	Email        string    `json:"email"`
+	DateOfBirth  string    `json:"date_of_birth"` // YYYY-MM-DD
+	Country      int       `json:"country"`
+	OptIn        bool      `json:"opt_in"`
+	Affiliate    int       `json:"affiliate"`
+	Created      time.Time `json:"created"`
+
+	StaffModLevel  uint8 `json:"staff_mod_level"`
+	PlayerModLevel uint8 `json:"player_mod_level"`
+}
+
+// CheckPassword reports whether password is the account's password.
+func (a *Account) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) == nil
+}
+
+// SetPassword replaces the account's password.
+func (a *Account) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	a.PasswordHash = string(hash)
+	return nil
+}
+
+// Accounts stores accounts as one JSON file per account in Dir. If Dir is
+// empty, accounts are only kept in memory.
+type Accounts struct {
+	Dir string
+
+	mu       sync.Mutex
+	accounts map[string]*Account
+}
+
+func NewAccounts(dir string) *Accounts {
+	return &Accounts{
+		Dir:      dir,
+		accounts: make(map[string]*Account),
+	}
+}
+
+func accountKey(username string) string {
+	return strings.ToLower(strings.ReplaceAll(username, " ", "_"))
+}
+
+func (s *Accounts) path(key string) string {
+	return filepath.Join(s.Dir, key+".json")
+}
+
+// Get returns the account with the given username.
+func (s *Accounts) Get(username string) (*Account, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(accountKey(username))
+}
+
+func (s *Accounts) get(key string) (*Account, bool, error) {
+	if account, ok := s.accounts[key]; ok {
+		return account, true, nil
+	}
+	if s.Dir == "" {
+		return nil, false, nil
+	}
+
+	var account Account
+	err := util.ReadJSON(s.path(key), &account)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.accounts[key] = &account
+	return &account, true, nil
+}
+
+// Exists reports whether an account with the given username exists.
+func (s *Accounts) Exists(username string) (bool, error) {
+	_, found, err := s.Get(username)
+	return found, err
+}
+
+// Create stores a new account, failing with ErrAccountExists if the username
+// is taken.
+func (s *Accounts) Create(account *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := accountKey(account.Username)
+	_, found, err := s.get(key)
+	if err != nil {
+		return err
+	}
+	if found {
+		return ErrAccountExists
+	}
+
+	if s.Dir != "" {
+		err = util.WriteJSON(s.path(key), account)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.accounts[key] = account
+	return nil
+}
+
+// AuditLog records account creation attempts as JSON lines appended to Path.
+// If Path is empty, nothing is recorded.
+type AuditLog struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// CreateAttempt is the audit record of one account creation attempt.
+type CreateAttempt struct {
+	Time        time.Time `json:"time"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	DateOfBirth string    `json:"date_of_birth"`
+	Country     int       `json:"country"`
+	Address     string    `json:"address"`
+	Code        uint8     `json:"code"`
+}
+
+// Record appends an entry to the audit log.
+func (a *AuditLog) Record(entry any) error {
+	if a == nil || a.Path == "" {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return util.AppendJSON(a.Path, entry)
+}
@@ -0,0 +1,341 @@
+package login
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// Client is a world's connection to a remote login Server.
+//
+// The connection is opened on first use and re-opened whenever it is lost;
+// the world is registered again each time that happens. Requests made while
+// the login server can't be reached fail with ErrOffline, and requests that
+// aren't answered within Timeout fail with ErrNoReply.
+type Client struct {
+	Addr    string
+	Timeout time.Duration
+
+	Logger slog.Logger
+
+	// Online returns the usernames of the players on the registered world.
+	// They're sent when the world is registered again after reconnecting,
+	// so the login server doesn't forget the players are logged in.
+	Online func() []string
+
+	locker   sync.Mutex
+	conn     net.Conn
+	sequence uint32
+	pending  map[uint32]chan frame
+
+	// the last parameters passed to Register, sent again on reconnect
+	world *util.WorldParameters
+}
+
+func NewClient(addr string, logger slog.Logger) *Client {
+	return &Client{
+		Addr:    addr,
+		Timeout: 5 * time.Second,
+		Logger:  logger,
+		pending: make(map[uint32]chan frame),
+	}
+}
+
+func (c *Client) Register(world util.WorldParameters, online []string) error {
+	c.locker.Lock()
+	c.world = &world
+	c.locker.Unlock()
+
+	var buf packet.Packet
+	putRegister(&buf, world, online)
+	_, err := c.request(opRegister, buf.Bytes())
+	return err
+}
+
+func (c *Client) Unregister(worldID int) error {
+	c.locker.Lock()
+	if c.world != nil && c.world.ID == worldID {
+		c.world = nil
+	}
+	c.locker.Unlock()
+
+	var buf packet.Packet
+	buf.P2(uint16(worldID))
+	_, err := c.request(opUnregister, buf.Bytes())
+	return err
+}
+
+func (c *Client) Update(world util.WorldParameters) error {
+	c.locker.Lock()
+	if c.world != nil && c.world.ID == world.ID {
+		c.world = &world
+	}
+	c.locker.Unlock()
+
+	var buf packet.Packet
+	putWorld(&buf, world)
+	_, err := c.request(opUpdate, buf.Bytes())
+	return err
+}
+
+func (c *Client) Login(req Request) (Response, error) {
+	var buf packet.Packet
+	putRequest(&buf, req)
+	reply, err := c.request(opLogin, buf.Bytes())
+	if err != nil {
+		return Response{}, err
+	}
+
+	var resp Response
+	err = decode(func() {
+		resp = getResponse(reply)
+	})
+	return resp, err
+}
+
+func (c *Client) Logout(worldID int, username string) error {
+	var buf packet.Packet
+	buf.P2(uint16(worldID))
+	buf.PJStr(username)
+	_, err := c.request(opLogout, buf.Bytes())
+	return err
+}
+
+func (c *Client) WorldList() (WorldListSnapshot, error) {
+	reply, err := c.request(opWorldList, nil)
+	if err != nil {
+		return WorldListSnapshot{}, err
+	}
+
+	var list WorldListSnapshot
+	err = decode(func() {
+		list = getWorldList(reply)
+	})
+	return list, err
+}
+
+func (c *Client) CheckName(username string) (uint8, []string, error) {
+	var buf packet.Packet
+	buf.PJStr(username)
+	reply, err := c.request(opCheckName, buf.Bytes())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var code uint8
+	var suggestions []string
+	err = decode(func() {
+		code = reply.G1()
+		suggestions = make([]string, reply.G1())
+		for i := range suggestions {
+			suggestions[i] = reply.GJStr()
+		}
+	})
+	return code, suggestions, err
+}
+
+func (c *Client) CreateAccount(req CreateRequest) (uint8, error) {
+	var buf packet.Packet
+	putCreateRequest(&buf, req)
+	reply, err := c.request(opCreate, buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	var code uint8
+	err = decode(func() {
+		code = reply.G1()
+	})
+	return code, err
+}
+
+func (c *Client) Sanction(s Sanction) error {
+	var buf packet.Packet
+	putSanction(&buf, s)
+	_, err := c.request(opSanction, buf.Bytes())
+	return err
+}
+
+func (c *Client) Pardon(kind SanctionKind, target string) (bool, error) {
+	var buf packet.Packet
+	buf.P1(uint8(kind))
+	buf.PJStr(target)
+	reply, err := c.request(opPardon, buf.Bytes())
+	if err != nil {
+		return false, err
+	}
+
+	var found bool
+	err = decode(func() {
+		found = reply.G1() == 1
+	})
+	return found, err
+}
+
+// Close closes the connection to the login server.
+func (c *Client) Close() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// request sends a request frame and waits for its reply, returning the reply
+// payload positioned after the status byte.
+func (c *Client) request(opcode uint8, payload []byte) (*packet.Packet, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(conn, opcode, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	in := packet.NewPacket(reply.Payload)
+	var status uint8
+	var msg string
+	if derr := decode(func() {
+		status = in.G1()
+		if status != statusOK {
+			msg = in.GJStr()
+		}
+	}); derr != nil {
+		return nil, derr
+	}
+	if status != statusOK {
+		return nil, errors.New(msg)
+	}
+	return in, nil
+}
+
+func (c *Client) roundTrip(conn net.Conn, opcode uint8, payload []byte) (frame, error) {
+	ch := make(chan frame, 1)
+
+	c.locker.Lock()
+	c.sequence++
+	seq := c.sequence
+	c.pending[seq] = ch
+	c.locker.Unlock()
+
+	defer func() {
+		c.locker.Lock()
+		delete(c.pending, seq)
+		c.locker.Unlock()
+	}()
+
+	err := writeFrame(conn, frame{Opcode: opcode, Sequence: seq, Payload: payload})
+	if err != nil {
+		c.drop(conn)
+		return frame{}, fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+
+	select {
+	case f, ok := <-ch:
+		if !ok {
+			return frame{}, ErrOffline
+		}
+		return f, nil
+	case <-timer.C:
+		return frame{}, ErrNoReply
+	}
+}
+
+// connect returns the current connection, dialing the login server and
+// re-registering the world if there isn't one.
+func (c *Client) connect() (net.Conn, error) {
+	c.locker.Lock()
+	if c.conn != nil {
+		conn := c.conn
+		c.locker.Unlock()
+		return conn, nil
+	}
+	c.locker.Unlock()
+
+	conn, err := net.DialTimeout("tcp", c.Addr, c.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+
+	c.locker.Lock()
+	if c.conn != nil {
+		// lost a race with another request
+		existing := c.conn
+		c.locker.Unlock()
+		conn.Close()
+		return existing, nil
+	}
+	c.conn = conn
+	world := c.world
+	c.locker.Unlock()
+
+	c.Logger.Info("connected to login server", "addr", c.Addr)
+	go c.readLoop(conn)
+
+	if world != nil {
+		var online []string
+		if c.Online != nil {
+			online = c.Online()
+		}
+
+		var buf packet.Packet
+		putRegister(&buf, *world, online)
+		if _, err := c.roundTrip(conn, opRegister, buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *Client) readLoop(conn net.Conn) {
+	defer c.drop(conn)
+
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		// sent while holding the lock so drop can't close ch underneath us;
+		// ch is buffered and only ever receives one reply
+		c.locker.Lock()
+		if ch, ok := c.pending[f.Sequence]; ok {
+			ch <- f
+		}
+		c.locker.Unlock()
+	}
+}
+
+// drop forgets conn after it has failed, failing any requests waiting on it.
+func (c *Client) drop(conn net.Conn) {
+	conn.Close()
+
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.conn != conn {
+		return
+	}
+	c.conn = nil
+	for seq, ch := range c.pending {
+		close(ch)
+		delete(c.pending, seq)
+	}
+	c.Logger.Warn("lost connection to login server", "addr", c.Addr)
+}
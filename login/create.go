@@ -0,0 +1,150 @@
+package login
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+// CreateRequest is everything the client sends when creating an account.
+type CreateRequest struct {
+	Username  string
+	Password  string
+	Email     string
+	Day       int
+	Month     int // 0-11
+	Year      int
+	Country   int // index into util.CountriesList
+	OptIn     bool
+	Affiliate int
+	Address   string
+}
+
+// ValidateUsername reports whether name can be used as an account name. Names
+// are compared after being decoded from base37, so they only contain a-z, 0-9
+// and underscores (the client shows underscores as spaces).
+func ValidateUsername(name string) uint8 {
+	if len(name) == 0 || len(name) > 12 {
+		return util.CreateProtOutInvalidUsername
+	}
+	if name[0] == '_' || name[len(name)-1] == '_' || strings.Contains(name, "__") {
+		return util.CreateProtOutInvalidUsername
+	}
+	// what util.FromBase37 returns for a name that doesn't fit in 12 chars
+	if name == "invalid_name" {
+		return util.CreateProtOutInvalidUsername
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '_' {
+			return util.CreateProtOutInvalidUsername
+		}
+	}
+	return util.CreateProtOutSuccess
+}
+
+// ValidatePassword reports whether password can be used for the account name.
+func ValidatePassword(name string, password string) uint8 {
+	if len(password) < 5 || len(password) > 20 {
+		return util.CreateProtOutInvalidPassword
+	}
+	for i := 0; i < len(password); i++ {
+		if password[i] < 0x20 || password[i] > 0x7E {
+			return util.CreateProtOutInvalidPassword
+		}
+	}
+	if strings.Contains(strings.ToLower(password), strings.ReplaceAll(name, "_", "")) {
+		return util.CreateProtOutInvalidPassword
+	}
+	return util.CreateProtOutSuccess
+}
+
+// ValidateDateOfBirth reports whether day/month/year is a real date of birth
+// of someone at least a year old at now.
+func ValidateDateOfBirth(day int, month int, year int, now time.Time) uint8 {
+	if year < 1900 || month < 0 || month > 11 || day < 1 {
+		return util.CreateProtOutInvalidDateOfBirth
+	}
+
+	dob := time.Date(year, time.Month(month+1), day, 0, 0, 0, 0, time.UTC)
+	if dob.Day() != day {
+		// time.Date normalised an out of range day, e.g. 31 February
+		return util.CreateProtOutInvalidDateOfBirth
+	}
+	if dob.After(now) {
+		return util.CreateProtOutDateOfBirthFuture
+	}
+	if year >= now.Year()-1 {
+		return util.CreateProtOutDateOfBirthRecent
+	}
+	return util.CreateProtOutSuccess
+}
+
+// ValidateCountry reports whether country is a country the client offers.
+func ValidateCountry(country int) uint8 {
+	if country < 0 || country >= len(util.CountriesList) {
+		return util.CreateProtOutInvalidCountry
+	}
+	return util.CreateProtOutSuccess
+}
+
+// ValidateEmail reports whether email looks like a deliverable address.
+func ValidateEmail(email string) uint8 {
+	if len(email) > 100 {
+		return util.CreateProtOutInvalidEmail
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return util.CreateProtOutInvalidEmail
+	}
+
+	at := strings.LastIndexByte(email, '@')
+	domain := email[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return util.CreateProtOutInvalidEmail
+	}
+	return util.CreateProtOutSuccess
+}
+
+// ValidateCreate checks everything in req that doesn't depend on existing
+// accounts, returning the first failing response code.
+func ValidateCreate(req CreateRequest, now time.Time) uint8 {
+	checks := []func() uint8{
+		func() uint8 { return ValidateUsername(req.Username) },
+		func() uint8 { return ValidatePassword(req.Username, req.Password) },
+		func() uint8 { return ValidateDateOfBirth(req.Day, req.Month, req.Year, now) },
+		func() uint8 { return ValidateCountry(req.Country) },
+		func() uint8 { return ValidateEmail(req.Email) },
+	}
+
+	for _, check := range checks {
+		if code := check(); code != util.CreateProtOutSuccess {
+			return code
+		}
+	}
+	return util.CreateProtOutSuccess
+}
+
+// suggestNames returns up to count available names based on name.
+func suggestNames(name string, count int, taken func(string) bool) []string {
+	base := name
+	if len(base) > 10 {
+		base = base[:10]
+	}
+
+	var names []string
+	for i := 1; i < 100 && len(names) < count; i++ {
+		candidate := fmt.Sprintf("%s%d", base, i)
+		if len(candidate) > 12 {
+			break
+		}
+		if !taken(candidate) {
+			names = append(names, candidate)
+		}
+	}
+	return names
+}
@@ -0,0 +1,181 @@
+package login
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+var testNow = time.Date(2010, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+func validCreateRequest() CreateRequest {
+	return CreateRequest{
+		Username: "zezima",
+		Password: "hunter22",
+		Email:    "zezima@example.com",
+		Day:      22,
+		Month:    4,
+		Year:     1990,
+		Country:  11,
+	}
+}
+
+func TestValidateCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(req *CreateRequest)
+		want   uint8
+	}{
+		{
+			name:   "valid",
+			modify: func(req *CreateRequest) {},
+			want:   util.CreateProtOutSuccess,
+		},
+		{
+			name:   "empty username",
+			modify: func(req *CreateRequest) { req.Username = "" },
+			want:   util.CreateProtOutInvalidUsername,
+		},
+		{
+			name:   "leading space in username",
+			modify: func(req *CreateRequest) { req.Username = "_zezima" },
+			want:   util.CreateProtOutInvalidUsername,
+		},
+		{
+			name:   "invalid base37 username",
+			modify: func(req *CreateRequest) { req.Username = util.FromBase37(6582952005840035281) },
+			want:   util.CreateProtOutInvalidUsername,
+		},
+		{
+			name:   "short password",
+			modify: func(req *CreateRequest) { req.Password = "abc" },
+			want:   util.CreateProtOutInvalidPassword,
+		},
+		{
+			name:   "password contains username",
+			modify: func(req *CreateRequest) { req.Password = "myZezima1" },
+			want:   util.CreateProtOutInvalidPassword,
+		},
+		{
+			name:   "31 february",
+			modify: func(req *CreateRequest) { req.Day, req.Month = 31, 1 },
+			want:   util.CreateProtOutInvalidDateOfBirth,
+		},
+		{
+			name:   "month out of range",
+			modify: func(req *CreateRequest) { req.Month = 12 },
+			want:   util.CreateProtOutInvalidDateOfBirth,
+		},
+		{
+			name:   "year out of range",
+			modify: func(req *CreateRequest) { req.Year = 1899 },
+			want:   util.CreateProtOutInvalidDateOfBirth,
+		},
+		{
+			name:   "born in the future",
+			modify: func(req *CreateRequest) { req.Day, req.Month, req.Year = 16, 2, 2010 },
+			want:   util.CreateProtOutDateOfBirthFuture,
+		},
+		{
+			name:   "born last year",
+			modify: func(req *CreateRequest) { req.Year = 2009 },
+			want:   util.CreateProtOutDateOfBirthRecent,
+		},
+		{
+			name:   "country out of range",
+			modify: func(req *CreateRequest) { req.Country = len(util.CountriesList) },
+			want:   util.CreateProtOutInvalidCountry,
+		},
+		{
+			name:   "email without domain",
+			modify: func(req *CreateRequest) { req.Email = "zezima@" },
+			want:   util.CreateProtOutInvalidEmail,
+		},
+		{
+			name:   "email without tld",
+			modify: func(req *CreateRequest) { req.Email = "zezima@localhost" },
+			want:   util.CreateProtOutInvalidEmail,
+		},
+		{
+			name:   "email with display name",
+			modify: func(req *CreateRequest) { req.Email = "Zezima <zezima@example.com>" },
+			want:   util.CreateProtOutInvalidEmail,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validCreateRequest()
+			tt.modify(&req)
+			if got := ValidateCreate(req, testNow); got != tt.want {
+				t.Errorf("ValidateCreate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocal_CreateAccount(t *testing.T) {
+	dir := t.TempDir()
+
+	l := NewLocal(nil)
+	l.Accounts = NewAccounts(filepath.Join(dir, "accounts"))
+	l.Audit = &AuditLog{Path: filepath.Join(dir, "create.jsonl")}
+	l.Register(testWorld, nil)
+
+	req := validCreateRequest()
+	if code, err := l.CreateAccount(req); err != nil || code != util.CreateProtOutSuccess {
+		t.Fatalf("CreateAccount() = %v, %v, want %v", code, err, util.CreateProtOutSuccess)
+	}
+	if code, _ := l.CreateAccount(req); code != util.CreateProtOutUsernameTaken {
+		t.Errorf("CreateAccount() of a taken name = %v, want %v", code, util.CreateProtOutUsernameTaken)
+	}
+
+	code, names, _ := l.CheckName("zezima")
+	if code != util.CreateProtOutUsernameSuggestion || len(names) == 0 || names[0] != "zezima1" {
+		t.Errorf("CheckName() = %v, %v, want suggestions starting with zezima1", code, names)
+	}
+	if code, _, _ := l.CheckName("zezima1"); code != util.CreateProtOutSuccess {
+		t.Errorf("CheckName() of a free name = %v, want %v", code, util.CreateProtOutSuccess)
+	}
+
+	// accounts are read back from disk
+	l.Accounts = NewAccounts(filepath.Join(dir, "accounts"))
+
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima", Password: "wrong"}); resp.Code != util.LoginProtOutInvalidCredentials {
+		t.Errorf("Login() with a wrong password = %v, want %v", resp.Code, util.LoginProtOutInvalidCredentials)
+	}
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima", Password: req.Password}); resp.Code != util.LoginProtOutSuccess {
+		t.Errorf("Login() = %v, want %v", resp.Code, util.LoginProtOutSuccess)
+	}
+
+	var attempts []CreateAttempt
+	err := readJSONLines(filepath.Join(dir, "create.jsonl"), func(v *CreateAttempt) {
+		attempts = append(attempts, *v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].Code != util.CreateProtOutSuccess || attempts[1].Code != util.CreateProtOutUsernameTaken {
+		t.Errorf("audit records = %+v, want a success then a taken name", attempts)
+	}
+}
+
+func readJSONLines[T any](path string, fn func(v *T)) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var v T
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			return err
+		}
+		fn(&v)
+	}
+	return nil
+}
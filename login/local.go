@@ -0,0 +1,298 @@
+package login
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+// Local is an in-process login service. It is the state behind Server, and
+// can be used directly by a world that doesn't need a separate login server
+// (for example in tests).
+type Local struct {
+	// OfflinePlayers is the player count reported for worlds on the list
+	// that aren't currently registered.
+	OfflinePlayers int
+
+	// Accounts holds player accounts.
+	Accounts *Accounts
+	// AllowUnregistered lets players without an account log in with any
+	// password. It's only meant for development.
+	AllowUnregistered bool
+	// Audit records account creation attempts.
+	Audit *AuditLog
+	// Moderation holds the bans, mutes and locks checked at login.
+	Moderation *Moderation
+
+	mu sync.Mutex
+
+	worlds     *util.WorldList
+	configured map[int]bool // worlds that stay on the list while offline
+	registered map[int]bool
+	online     map[string]int // username -> world ID
+}
+
+// NewLocal creates a login service serving the world list worlds. The worlds
+// already on the list are shown as offline until they register; other worlds
+// are added to the list when they register and removed when they leave. If
+// worlds is nil, the list starts out with the default countries and no worlds.
+func NewLocal(worlds *util.WorldList) *Local {
+	if worlds == nil {
+		var err error
+		worlds, err = util.NewWorldList(util.CountriesList, nil)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	configured := make(map[int]bool)
+	for _, v := range worlds.Worlds() {
+		configured[v.ID] = true
+	}
+
+	return &Local{
+		OfflinePlayers: util.WorldPlayersOffline,
+		Accounts:       NewAccounts(""),
+		Audit:          &AuditLog{},
+		Moderation:     NewModeration(""),
+
+		worlds:     worlds,
+		configured: configured,
+		registered: make(map[int]bool),
+		online:     make(map[string]int),
+	}
+}
+
+func (l *Local) Register(world util.WorldParameters, online []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	if _, found := l.worlds.World(world.ID); found {
+		err = l.worlds.UpdateWorld(world)
+	} else {
+		err = l.worlds.AddWorld(world)
+	}
+	if err != nil {
+		return err
+	}
+
+	l.registered[world.ID] = true
+
+	for name, id := range l.online {
+		if id == world.ID {
+			delete(l.online, name)
+		}
+	}
+	for _, v := range online {
+		name := strings.ToLower(v)
+		if _, ok := l.online[name]; ok {
+			// logged in to another world while this one was away
+			continue
+		}
+		l.online[name] = world.ID
+	}
+	return nil
+}
+
+func (l *Local) Unregister(worldID int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.registered, worldID)
+	if !l.configured[worldID] {
+		l.worlds.RemoveWorld(worldID)
+	}
+
+	for name, id := range l.online {
+		if id == worldID {
+			delete(l.online, name)
+		}
+	}
+	return nil
+}
+
+func (l *Local) Update(world util.WorldParameters) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.registered[world.ID] {
+		return fmt.Errorf("login: world %d is not registered", world.ID)
+	}
+	return l.worlds.UpdateWorld(world)
+}
+
+func (l *Local) Login(req Request) (Response, error) {
+	l.mu.Lock()
+	registered := l.registered[req.WorldID]
+	l.mu.Unlock()
+	if !registered {
+		return Response{Code: util.LoginProtOutInvalidLoginServer}, nil
+	}
+
+	// the account and sanction checks go to disk and bcrypt, so they're
+	// done without holding l.mu
+	account, found, err := l.Accounts.Get(req.Username)
+	if err != nil {
+		return Response{Code: util.LoginProtOutErrorLoadingProfile}, nil
+	}
+	if found && !account.CheckPassword(req.Password) || !found && !l.AllowUnregistered {
+		return Response{Code: util.LoginProtOutInvalidCredentials}, nil
+	}
+
+	now := time.Now()
+	if _, banned := l.Moderation.Find(SanctionAddressBan, req.Address, now); banned {
+		return Response{Code: util.LoginProtOutAddressBanned}, nil
+	}
+	if _, banned := l.Moderation.Find(SanctionUIDBan, UIDTarget(req.UID), now); banned {
+		return Response{Code: util.LoginProtOutAddressBanned}, nil
+	}
+	if _, banned := l.Moderation.Find(SanctionBan, req.Username, now); banned {
+		return Response{Code: util.LoginProtOutBanned}, nil
+	}
+	if _, locked := l.Moderation.Find(SanctionLock, req.Username, now); locked {
+		return Response{Code: util.LoginProtOutLocked}, nil
+	}
+
+	resp := Response{Code: util.LoginProtOutSuccess, Members: true}
+	if req.Reconnecting {
+		resp.Code = util.LoginProtOutReconnecting
+	}
+	if found {
+		resp.StaffModLevel = account.StaffModLevel
+		resp.PlayerModLevel = account.PlayerModLevel
+	}
+	if mute, muted := l.Moderation.Find(SanctionMute, req.Username, now); muted {
+		resp.Muted = true
+		resp.MutedUntil = mute.Expires
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.registered[req.WorldID] {
+		// the world left while the account was being checked
+		return Response{Code: util.LoginProtOutInvalidLoginServer}, nil
+	}
+	name := strings.ToLower(req.Username)
+	if id, ok := l.online[name]; ok && !(req.Reconnecting && id == req.WorldID) {
+		return Response{Code: util.LoginProtOutAlreadyOnline}, nil
+	}
+	l.online[name] = req.WorldID
+	return resp, nil
+}
+
+func (l *Local) Logout(worldID int, username string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	name := strings.ToLower(username)
+	if id, ok := l.online[name]; ok && id == worldID {
+		delete(l.online, name)
+	}
+	return nil
+}
+
+func (l *Local) Sanction(s Sanction) error {
+	if s.Target == "" {
+		return errors.New("login: sanction has no target")
+	}
+	if s.Issued.IsZero() {
+		s.Issued = time.Now()
+	}
+	return l.Moderation.Add(s)
+}
+
+func (l *Local) Pardon(kind SanctionKind, target string) (bool, error) {
+	return l.Moderation.Remove(kind, target)
+}
+
+func (l *Local) CheckName(username string) (uint8, []string, error) {
+	if code := ValidateUsername(username); code != util.CreateProtOutSuccess {
+		return code, nil, nil
+	}
+
+	exists, err := l.Accounts.Exists(username)
+	if err != nil {
+		return util.CreateProtOutServerBusy, nil, nil
+	}
+	if !exists {
+		return util.CreateProtOutSuccess, nil, nil
+	}
+
+	suggestions := suggestNames(username, 3, func(name string) bool {
+		taken, err := l.Accounts.Exists(name)
+		return taken || err != nil
+	})
+	return util.CreateProtOutUsernameSuggestion, suggestions, nil
+}
+
+func (l *Local) CreateAccount(req CreateRequest) (uint8, error) {
+	now := time.Now()
+	dob := fmt.Sprintf("%04d-%02d-%02d", req.Year, req.Month+1, req.Day)
+
+	code := ValidateCreate(req, now)
+	if code == util.CreateProtOutSuccess {
+		account := &Account{
+			Username:    req.Username,
+			Email:       req.Email,
+			DateOfBirth: dob,
+			Country:     req.Country,
+			OptIn:       req.OptIn,
+			Affiliate:   req.Affiliate,
+			Created:     now,
+		}
+		err := account.SetPassword(req.Password)
+		if err == nil {
+			err = l.Accounts.Create(account)
+		}
+		if errors.Is(err, ErrAccountExists) {
+			code = util.CreateProtOutUsernameTaken
+		} else if err != nil {
+			code = util.CreateProtOutServerBusy
+		}
+	}
+
+	err := l.Audit.Record(CreateAttempt{
+		Time:        now,
+		Username:    req.Username,
+		Email:       req.Email,
+		DateOfBirth: dob,
+		Country:     req.Country,
+		Address:     req.Address,
+		Code:        code,
+	})
+	if err != nil {
+		return code, fmt.Errorf("login: could not record account creation: %w", err)
+	}
+
+	return code, nil
+}
+
+func (l *Local) WorldList() (WorldListSnapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	raw, checksum := l.worlds.Encoded()
+	worlds := l.worlds.Worlds()
+
+	players := make([]WorldPlayers, 0, len(worlds))
+	for _, v := range worlds {
+		count := v.Players
+		if !l.registered[v.ID] {
+			count = l.OfflinePlayers
+		}
+		players = append(players, WorldPlayers{ID: v.ID, Players: count})
+	}
+
+	return WorldListSnapshot{
+		Raw:      raw,
+		Checksum: checksum,
+		MinID:    l.worlds.MinID(),
+		Players:  players,
+	}, nil
+}
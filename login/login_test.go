@@ -0,0 +1,306 @@
+package login
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+var testWorld = util.WorldParameters{
+	ID:        1,
+	Hostname:  "localhost",
+	Port:      43594,
+	Country:   6,
+	Members:   true,
+	LootShare: true,
+	Players:   3,
+}
+
+func TestLocal_Login(t *testing.T) {
+	tests := []struct {
+		name    string
+		online  []Request
+		req     Request
+		want    uint8
+		wantErr bool
+	}{
+		{
+			name: "success",
+			req:  Request{WorldID: 1, Username: "zezima"},
+			want: util.LoginProtOutSuccess,
+		},
+		{
+			name: "unknown world",
+			req:  Request{WorldID: 2, Username: "zezima"},
+			want: util.LoginProtOutInvalidLoginServer,
+		},
+		{
+			name:   "already online",
+			online: []Request{{WorldID: 1, Username: "zezima"}},
+			req:    Request{WorldID: 1, Username: "Zezima"},
+			want:   util.LoginProtOutAlreadyOnline,
+		},
+		{
+			name:   "reconnecting",
+			online: []Request{{WorldID: 1, Username: "zezima"}},
+			req:    Request{WorldID: 1, Username: "zezima", Reconnecting: true},
+			want:   util.LoginProtOutReconnecting,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLocal(nil)
+			l.AllowUnregistered = true
+			l.Register(testWorld, nil)
+			for _, v := range tt.online {
+				l.Login(v)
+			}
+
+			got, err := l.Login(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Login() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Code != tt.want {
+				t.Errorf("Login() code = %v, want %v", got.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocal_Login_Unregistered(t *testing.T) {
+	l := NewLocal(nil)
+	l.Register(testWorld, nil)
+
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima", Password: "hunter22"}); resp.Code != util.LoginProtOutInvalidCredentials {
+		t.Errorf("Login() without an account code = %v, want %v", resp.Code, util.LoginProtOutInvalidCredentials)
+	}
+
+	l.AllowUnregistered = true
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima", Password: "hunter22"}); resp.Code != util.LoginProtOutSuccess {
+		t.Errorf("Login() without an account with AllowUnregistered code = %v, want %v", resp.Code, util.LoginProtOutSuccess)
+	}
+}
+
+func TestLocal_Register_Online(t *testing.T) {
+	l := NewLocal(nil)
+	l.AllowUnregistered = true
+	l.Register(testWorld, nil)
+	l.Login(Request{WorldID: 1, Username: "durial321"})
+
+	// the world lost the login service and came back with one player
+	l.Unregister(1)
+	l.Register(testWorld, []string{"Zezima"})
+
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima"}); resp.Code != util.LoginProtOutAlreadyOnline {
+		t.Errorf("Login() of a player sent with Register() code = %v, want %v", resp.Code, util.LoginProtOutAlreadyOnline)
+	}
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "durial321"}); resp.Code != util.LoginProtOutSuccess {
+		t.Errorf("Login() of a player who left while away code = %v, want %v", resp.Code, util.LoginProtOutSuccess)
+	}
+}
+
+func TestLocal_WorldList(t *testing.T) {
+	l := NewLocal(nil)
+	l.Register(testWorld, nil)
+
+	first, _ := l.WorldList()
+	if len(first.Players) != 1 || first.Players[0].Players != 3 {
+		t.Fatalf("WorldList() players = %v, want one world with 3 players", first.Players)
+	}
+
+	second := testWorld
+	second.ID = 2
+	l.Register(second, nil)
+
+	got, _ := l.WorldList()
+	if got.Checksum == first.Checksum {
+		t.Errorf("WorldList() checksum unchanged after a world registered")
+	}
+
+	l.Unregister(2)
+
+	got, _ = l.WorldList()
+	if got.Checksum != first.Checksum {
+		t.Errorf("WorldList() checksum = %v, want %v after the world left", got.Checksum, first.Checksum)
+	}
+}
+
+func TestLocal_OfflineWorlds(t *testing.T) {
+	worlds, err := util.NewWorldList(util.CountriesList, []util.WorldParameters{testWorld})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLocal(worlds)
+	l.OfflinePlayers = 9999
+
+	players := func() int {
+		list, _ := l.WorldList()
+		if len(list.Players) != 1 {
+			t.Fatalf("WorldList() has %d worlds, want 1", len(list.Players))
+		}
+		return list.Players[0].Players
+	}
+
+	if got := players(); got != 9999 {
+		t.Errorf("players before Register() = %v, want 9999", got)
+	}
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima"}); resp.Code != util.LoginProtOutInvalidLoginServer {
+		t.Errorf("Login() to an offline world code = %v, want %v", resp.Code, util.LoginProtOutInvalidLoginServer)
+	}
+
+	l.Register(testWorld, nil)
+	if got := players(); got != testWorld.Players {
+		t.Errorf("players after Register() = %v, want %v", got, testWorld.Players)
+	}
+
+	l.Unregister(testWorld.ID)
+	if got := players(); got != 9999 {
+		t.Errorf("players after Unregister() = %v, want 9999", got)
+	}
+	if err := l.Update(testWorld); err == nil {
+		t.Errorf("Update() of an unregistered world succeeded")
+	}
+}
+
+func startServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewLocal(nil)
+	service.AllowUnregistered = true
+	s := NewServer(service, *util.NewLogger())
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	return s, l.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	s, addr := startServer(t)
+
+	c := NewClient(addr, *util.NewLogger())
+	c.Online = func() []string { return []string{"Zezima"} }
+	defer c.Close()
+
+	if err := c.Register(testWorld, nil); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	resp, err := c.Login(Request{WorldID: 1, Username: "zezima", UID: make([]byte, 24)})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if resp.Code != util.LoginProtOutSuccess {
+		t.Errorf("Login() code = %v, want %v", resp.Code, util.LoginProtOutSuccess)
+	}
+
+	updated := testWorld
+	updated.Players = 42
+	updated.Activity = "Trade"
+	if err := c.Update(updated); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got, err := c.WorldList()
+	if err != nil {
+		t.Fatalf("WorldList() error = %v", err)
+	}
+	want, _ := s.Service.WorldList()
+	if got.Checksum != want.Checksum || len(got.Players) != 1 || got.Players[0].Players != 42 {
+		t.Errorf("WorldList() = %+v, want %+v", got, want)
+	}
+
+	// dropping the connection unregisters the world, and the client
+	// registers it again when it reconnects
+	c.Close()
+	waitFor(t, func() bool {
+		list, _ := s.Service.WorldList()
+		return len(list.Players) == 0
+	})
+
+	if _, err := c.WorldList(); err != nil {
+		t.Fatalf("WorldList() after reconnect error = %v", err)
+	}
+	list, _ := s.Service.WorldList()
+	if len(list.Players) != 1 {
+		t.Errorf("world not registered again after reconnect")
+	}
+
+	// the players still on the world were sent with the registration
+	resp, err = c.Login(Request{WorldID: 1, Username: "zezima", UID: make([]byte, 24)})
+	if err != nil {
+		t.Fatalf("Login() after reconnect error = %v", err)
+	}
+	if resp.Code != util.LoginProtOutAlreadyOnline {
+		t.Errorf("Login() after reconnect code = %v, want %v", resp.Code, util.LoginProtOutAlreadyOnline)
+	}
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	c := NewClient(addr, *util.NewLogger())
+	_, err = c.Login(Request{WorldID: 1, Username: "zezima"})
+	if !errors.Is(err, ErrOffline) {
+		t.Fatalf("Login() error = %v, want %v", err, ErrOffline)
+	}
+	if got := ResponseCode(err); got != util.LoginProtOutLoginServerOffline {
+		t.Errorf("ResponseCode() = %v, want %v", got, util.LoginProtOutLoginServerOffline)
+	}
+}
+
+func TestClient_NoReply(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// accepts connections but never answers
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := NewClient(l.Addr().String(), *util.NewLogger())
+	c.Timeout = 50 * time.Millisecond
+	defer c.Close()
+
+	_, err = c.Login(Request{WorldID: 1, Username: "zezima"})
+	if !errors.Is(err, ErrNoReply) {
+		t.Fatalf("Login() error = %v, want %v", err, ErrNoReply)
+	}
+	if got := ResponseCode(err); got != util.LoginProtOutNoReplyFromLoginServer {
+		t.Errorf("ResponseCode() = %v, want %v", got, util.LoginProtOutNoReplyFromLoginServer)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
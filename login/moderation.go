@@ -0,0 +1,190 @@
+package login
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+// SanctionKind is the kind of restriction a Sanction places on its target.
+type SanctionKind uint8
+
+const (
+	// SanctionBan stops an account from logging in.
+	SanctionBan SanctionKind = 1
+	// SanctionMute stops an account from talking in public chat.
+	SanctionMute SanctionKind = 2
+	// SanctionLock stops an account from logging in until it is recovered.
+	SanctionLock SanctionKind = 3
+	// SanctionAddressBan stops any account logging in from an IP address.
+	SanctionAddressBan SanctionKind = 4
+	// SanctionUIDBan stops any account logging in from a client uid.
+	SanctionUIDBan SanctionKind = 5
+)
+
+func (k SanctionKind) String() string {
+	switch k {
+	case SanctionBan:
+		return "ban"
+	case SanctionMute:
+		return "mute"
+	case SanctionLock:
+		return "lock"
+	case SanctionAddressBan:
+		return "address ban"
+	case SanctionUIDBan:
+		return "uid ban"
+	default:
+		return fmt.Sprintf("SanctionKind(%d)", uint8(k))
+	}
+}
+
+// Sanction is a ban, mute or lock placed on an account, IP address or
+// client uid.
+type Sanction struct {
+	Kind SanctionKind `json:"kind"`
+	// Target is the username for account sanctions, the IP address for
+	// address bans and the hex encoded uid for uid bans.
+	Target  string    `json:"target"`
+	Reason  string    `json:"reason"`
+	Issuer  string    `json:"issuer"`
+	Issued  time.Time `json:"issued"`
+	Expires time.Time `json:"expires"` // zero for sanctions that don't expire
+}
+
+// Permanent reports whether the sanction never expires.
+func (s Sanction) Permanent() bool {
+	return s.Expires.IsZero()
+}
+
+// Active reports whether the sanction is in effect at now.
+func (s Sanction) Active(now time.Time) bool {
+	return s.Permanent() || now.Before(s.Expires)
+}
+
+// UIDTarget returns the Sanction target for a client uid.
+func UIDTarget(uid []byte) string {
+	return hex.EncodeToString(uid)
+}
+
+// sanctionTarget normalises target so that it can be compared.
+func sanctionTarget(kind SanctionKind, target string) string {
+	switch kind {
+	case SanctionBan, SanctionMute, SanctionLock:
+		return accountKey(target)
+	default:
+		return strings.ToLower(target)
+	}
+}
+
+type sanctionKey struct {
+	Kind   SanctionKind
+	Target string
+}
+
+// Moderation stores the active sanctions in the JSON file at Path. If Path
+// is empty, sanctions are only kept in memory.
+type Moderation struct {
+	Path string
+
+	mu        sync.Mutex
+	sanctions map[sanctionKey]Sanction
+}
+
+func NewModeration(path string) *Moderation {
+	return &Moderation{
+		Path:      path,
+		sanctions: make(map[sanctionKey]Sanction),
+	}
+}
+
+// LoadModeration reads the sanctions stored at path. A missing file is
+// treated as having no sanctions.
+func LoadModeration(path string) (*Moderation, error) {
+	m := NewModeration(path)
+
+	var sanctions []Sanction
+	err := util.ReadJSON(path, &sanctions)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range sanctions {
+		v.Target = sanctionTarget(v.Kind, v.Target)
+		m.sanctions[sanctionKey{v.Kind, v.Target}] = v
+	}
+	return m, nil
+}
+
+// Add places a sanction, replacing any sanction of the same kind on the same
+// target.
+func (m *Moderation) Add(s Sanction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.Target = sanctionTarget(s.Kind, s.Target)
+	m.sanctions[sanctionKey{s.Kind, s.Target}] = s
+	return m.save()
+}
+
+// Remove lifts the sanction of kind on target, reporting whether there was
+// one.
+func (m *Moderation) Remove(kind SanctionKind, target string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := sanctionKey{kind, sanctionTarget(kind, target)}
+	if _, ok := m.sanctions[key]; !ok {
+		return false, nil
+	}
+	delete(m.sanctions, key)
+	return true, m.save()
+}
+
+// Find returns the sanction of kind on target that is in effect at now.
+func (m *Moderation) Find(kind SanctionKind, target string, now time.Time) (Sanction, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sanctions[sanctionKey{kind, sanctionTarget(kind, target)}]
+	if !ok || !s.Active(now) {
+		return Sanction{}, false
+	}
+	return s, true
+}
+
+// save writes the sanctions that are still in effect to Path, dropping the
+// rest.
+func (m *Moderation) save() error {
+	now := time.Now()
+
+	sanctions := make([]Sanction, 0, len(m.sanctions))
+	for key, v := range m.sanctions {
+		if !v.Active(now) {
+			delete(m.sanctions, key)
+			continue
+		}
+		sanctions = append(sanctions, v)
+	}
+	if m.Path == "" {
+		return nil
+	}
+
+	sort.Slice(sanctions, func(i, j int) bool {
+		if sanctions[i].Kind != sanctions[j].Kind {
+			return sanctions[i].Kind < sanctions[j].Kind
+		}
+		return sanctions[i].Target < sanctions[j].Target
+	})
+	return util.WriteJSON(m.Path, sanctions)
+}
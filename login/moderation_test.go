@@ -0,0 +1,168 @@
+package login
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+func TestLocal_Login_Sanctions(t *testing.T) {
+	uid := make([]byte, 24)
+	uid[0] = 0xab
+
+	hour := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		sanction  Sanction
+		want      uint8
+		wantMuted bool
+	}{
+		{
+			name:     "banned",
+			sanction: Sanction{Kind: SanctionBan, Target: "Zezima"},
+			want:     util.LoginProtOutBanned,
+		},
+		{
+			name:     "temporarily banned",
+			sanction: Sanction{Kind: SanctionBan, Target: "zezima", Expires: hour},
+			want:     util.LoginProtOutBanned,
+		},
+		{
+			name:     "ban expired",
+			sanction: Sanction{Kind: SanctionBan, Target: "zezima", Expires: expired},
+			want:     util.LoginProtOutSuccess,
+		},
+		{
+			name:     "other account banned",
+			sanction: Sanction{Kind: SanctionBan, Target: "durial321"},
+			want:     util.LoginProtOutSuccess,
+		},
+		{
+			name:     "locked",
+			sanction: Sanction{Kind: SanctionLock, Target: "zezima"},
+			want:     util.LoginProtOutLocked,
+		},
+		{
+			name:     "address banned",
+			sanction: Sanction{Kind: SanctionAddressBan, Target: "10.0.0.1"},
+			want:     util.LoginProtOutAddressBanned,
+		},
+		{
+			name:     "uid banned",
+			sanction: Sanction{Kind: SanctionUIDBan, Target: UIDTarget(uid)},
+			want:     util.LoginProtOutAddressBanned,
+		},
+		{
+			name:      "muted",
+			sanction:  Sanction{Kind: SanctionMute, Target: "zezima", Expires: hour},
+			want:      util.LoginProtOutSuccess,
+			wantMuted: true,
+		},
+		{
+			name:     "mute expired",
+			sanction: Sanction{Kind: SanctionMute, Target: "zezima", Expires: expired},
+			want:     util.LoginProtOutSuccess,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLocal(nil)
+			l.AllowUnregistered = true
+			l.Register(testWorld, nil)
+			if err := l.Sanction(tt.sanction); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := l.Login(Request{WorldID: 1, Username: "zezima", Address: "10.0.0.1", UID: uid})
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+			if got.Code != tt.want {
+				t.Errorf("Login() code = %v, want %v", got.Code, tt.want)
+			}
+			if got.Muted != tt.wantMuted {
+				t.Errorf("Login() muted = %v, want %v", got.Muted, tt.wantMuted)
+			}
+		})
+	}
+}
+
+func TestLocal_Pardon(t *testing.T) {
+	l := NewLocal(nil)
+	l.AllowUnregistered = true
+	l.Register(testWorld, nil)
+	l.Sanction(Sanction{Kind: SanctionBan, Target: "zezima"})
+
+	if found, _ := l.Pardon(SanctionBan, "Zezima"); !found {
+		t.Errorf("Pardon() found = false, want true")
+	}
+	if found, _ := l.Pardon(SanctionBan, "zezima"); found {
+		t.Errorf("Pardon() of a lifted ban found = true, want false")
+	}
+	if resp, _ := l.Login(Request{WorldID: 1, Username: "zezima"}); resp.Code != util.LoginProtOutSuccess {
+		t.Errorf("Login() after Pardon() code = %v, want %v", resp.Code, util.LoginProtOutSuccess)
+	}
+}
+
+func TestLoadModeration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moderation.json")
+
+	m, err := LoadModeration(path)
+	if err != nil {
+		t.Fatalf("LoadModeration() of a missing file error = %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	m.Add(Sanction{Kind: SanctionMute, Target: "Zezima", Reason: "spam", Issuer: "Mod", Expires: expires})
+	m.Add(Sanction{Kind: SanctionBan, Target: "durial321", Expires: time.Now().Add(-time.Hour)})
+	m.Add(Sanction{Kind: SanctionAddressBan, Target: "10.0.0.1"})
+
+	m, err = LoadModeration(path)
+	if err != nil {
+		t.Fatalf("LoadModeration() error = %v", err)
+	}
+
+	mute, found := m.Find(SanctionMute, "zezima", time.Now())
+	if !found || mute.Reason != "spam" || mute.Issuer != "Mod" || !mute.Expires.Equal(expires) {
+		t.Errorf("Find() mute = %+v, %v", mute, found)
+	}
+	if _, found := m.Find(SanctionAddressBan, "10.0.0.1", time.Now()); !found {
+		t.Errorf("Find() address ban not found")
+	}
+	if len(m.sanctions) != 2 {
+		t.Errorf("loaded %d sanctions, want 2 (expired ones are dropped)", len(m.sanctions))
+	}
+}
+
+func TestClient_Sanction(t *testing.T) {
+	_, addr := startServer(t)
+
+	c := NewClient(addr, *util.NewLogger())
+	defer c.Close()
+
+	if err := c.Register(testWorld, nil); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if err := c.Sanction(Sanction{Kind: SanctionMute, Target: "zezima", Expires: expires}); err != nil {
+		t.Fatalf("Sanction() error = %v", err)
+	}
+
+	resp, err := c.Login(Request{WorldID: 1, Username: "zezima"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if !resp.Muted || !resp.MutedUntil.Equal(expires) {
+		t.Errorf("Login() muted = %v until %v, want true until %v", resp.Muted, resp.MutedUntil, expires)
+	}
+
+	found, err := c.Pardon(SanctionMute, "zezima")
+	if err != nil || !found {
+		t.Errorf("Pardon() = %v, %v, want true", found, err)
+	}
+}
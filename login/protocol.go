@@ -0,0 +1,306 @@
+package login
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// Every message between a world and the login server is a frame:
+//
+//	opcode (1 byte) | sequence (4 bytes) | payload length (4 bytes) | payload
+//
+// Requests are sent by the world. The login server answers each request with
+// a frame carrying the same sequence number and the opcode OR'd with
+// opReply.
+const (
+	opRegister   = 1
+	opUnregister = 2
+	opUpdate     = 3
+	opLogin      = 4
+	opLogout     = 5
+	opWorldList  = 6
+	opCheckName  = 7
+	opCreate     = 8
+	opSanction   = 9
+	opPardon     = 10
+
+	opReply = 0x80
+)
+
+// reply status, first byte of every reply payload
+const (
+	statusOK    = 0
+	statusError = 1
+)
+
+const maxFrameSize = 1 << 20
+
+type frame struct {
+	Opcode   uint8
+	Sequence uint32
+	Payload  []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	var buf packet.Packet
+	buf.P1(f.Opcode)
+	buf.P4(f.Sequence)
+	buf.P4(uint32(len(f.Payload)))
+	buf.PData(f.Payload, len(f.Payload))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return frame{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[5:])
+	if length > maxFrameSize {
+		return frame{}, fmt.Errorf("login: frame too large (%d bytes)", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+
+	return frame{
+		Opcode:   header[0],
+		Sequence: binary.BigEndian.Uint32(header[1:]),
+		Payload:  payload,
+	}, nil
+}
+
+// decode runs fn, turning a panic from reading past the end of a packet
+// into an error.
+func decode(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("login: malformed message: %v", r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+func putWorld(buf *packet.Packet, world util.WorldParameters) {
+	var flags uint8 = 0
+	if world.Members {
+		flags |= util.WorldFlagMembers
+	}
+	if world.QuickChat {
+		flags |= util.WorldFlagQuickChat
+	}
+	if world.PvP {
+		flags |= util.WorldFlagPvP
+	}
+	if world.LootShare {
+		flags |= util.WorldFlagLootShare
+	}
+	if world.Highlight {
+		flags |= util.WorldFlagHighlight
+	}
+
+	buf.P2(uint16(world.ID))
+	buf.PJStr(world.Hostname)
+	buf.P2(uint16(world.Port))
+	buf.P1(uint8(world.Country))
+	buf.PJStr(world.Activity)
+	buf.P1(flags)
+	buf.P2(uint16(world.Players))
+}
+
+func getWorld(buf *packet.Packet) util.WorldParameters {
+	var world util.WorldParameters
+	world.ID = int(buf.G2())
+	world.Hostname = buf.GJStr()
+	world.Port = int(buf.G2())
+	world.Country = int(buf.G1())
+	world.Activity = buf.GJStr()
+
+	flags := buf.G1()
+	world.Members = flags&util.WorldFlagMembers != 0
+	world.QuickChat = flags&util.WorldFlagQuickChat != 0
+	world.PvP = flags&util.WorldFlagPvP != 0
+	world.LootShare = flags&util.WorldFlagLootShare != 0
+	world.Highlight = flags&util.WorldFlagHighlight != 0
+
+	world.Players = int(buf.G2())
+	return world
+}
+
+func putRegister(buf *packet.Packet, world util.WorldParameters, online []string) {
+	putWorld(buf, world)
+	buf.P2(uint16(len(online)))
+	for _, v := range online {
+		buf.PJStr(v)
+	}
+}
+
+func getRegister(buf *packet.Packet) (util.WorldParameters, []string) {
+	world := getWorld(buf)
+	online := make([]string, buf.G2())
+	for i := range online {
+		online[i] = buf.GJStr()
+	}
+	return world, online
+}
+
+func putRequest(buf *packet.Packet, req Request) {
+	buf.P2(uint16(req.WorldID))
+	buf.PJStr(req.Username)
+	buf.PJStr(req.Password)
+	buf.PJStr(req.Address)
+	buf.P1(uint8(len(req.UID)))
+	buf.PData(req.UID, len(req.UID))
+	if req.Reconnecting {
+		buf.P1(1)
+	} else {
+		buf.P1(0)
+	}
+}
+
+func getRequest(buf *packet.Packet) Request {
+	var req Request
+	req.WorldID = int(buf.G2())
+	req.Username = buf.GJStr()
+	req.Password = buf.GJStr()
+	req.Address = buf.GJStr()
+	req.UID = make([]byte, buf.G1())
+	buf.GData(req.UID, len(req.UID))
+	req.Reconnecting = buf.G1() == 1
+	return req
+}
+
+func putResponse(buf *packet.Packet, resp Response) {
+	buf.P1(resp.Code)
+	buf.P1(resp.StaffModLevel)
+	buf.P1(resp.PlayerModLevel)
+	if resp.Members {
+		buf.P1(1)
+	} else {
+		buf.P1(0)
+	}
+	if resp.Muted {
+		buf.P1(1)
+	} else {
+		buf.P1(0)
+	}
+	putTime(buf, resp.MutedUntil)
+}
+
+func getResponse(buf *packet.Packet) Response {
+	var resp Response
+	resp.Code = buf.G1()
+	resp.StaffModLevel = buf.G1()
+	resp.PlayerModLevel = buf.G1()
+	resp.Members = buf.G1() == 1
+	resp.Muted = buf.G1() == 1
+	resp.MutedUntil = getTime(buf)
+	return resp
+}
+
+func putWorldList(buf *packet.Packet, list WorldListSnapshot) {
+	buf.P4(list.Checksum)
+	buf.P2(uint16(list.MinID))
+	buf.P4(uint32(len(list.Raw)))
+	buf.PData(list.Raw, len(list.Raw))
+	buf.P2(uint16(len(list.Players)))
+	for _, v := range list.Players {
+		buf.P2(uint16(v.ID))
+		buf.P2(uint16(v.Players))
+	}
+}
+
+func getWorldList(buf *packet.Packet) WorldListSnapshot {
+	var list WorldListSnapshot
+	list.Checksum = buf.G4()
+	list.MinID = int(buf.G2())
+	list.Raw = make([]byte, buf.G4())
+	buf.GData(list.Raw, len(list.Raw))
+	list.Players = make([]WorldPlayers, buf.G2())
+	for i := range list.Players {
+		list.Players[i].ID = int(buf.G2())
+		list.Players[i].Players = int(buf.G2())
+	}
+	return list
+}
+
+func putCreateRequest(buf *packet.Packet, req CreateRequest) {
+	buf.PJStr(req.Username)
+	buf.PJStr(req.Password)
+	buf.PJStr(req.Email)
+	buf.P1(uint8(req.Day))
+	buf.P1(uint8(req.Month))
+	buf.P2(uint16(req.Year))
+	buf.P2(uint16(req.Country))
+	if req.OptIn {
+		buf.P1(1)
+	} else {
+		buf.P1(0)
+	}
+	buf.P2(uint16(req.Affiliate))
+	buf.PJStr(req.Address)
+}
+
+func getCreateRequest(buf *packet.Packet) CreateRequest {
+	var req CreateRequest
+	req.Username = buf.GJStr()
+	req.Password = buf.GJStr()
+	req.Email = buf.GJStr()
+	req.Day = int(buf.G1())
+	req.Month = int(buf.G1())
+	req.Year = int(buf.G2())
+	req.Country = int(buf.G2())
+	req.OptIn = buf.G1() == 1
+	req.Affiliate = int(buf.G2())
+	req.Address = buf.GJStr()
+	return req
+}
+
+func putSanction(buf *packet.Packet, s Sanction) {
+	buf.P1(uint8(s.Kind))
+	buf.PJStr(s.Target)
+	buf.PJStr(s.Reason)
+	buf.PJStr(s.Issuer)
+	putTime(buf, s.Issued)
+	putTime(buf, s.Expires)
+}
+
+func getSanction(buf *packet.Packet) Sanction {
+	var s Sanction
+	s.Kind = SanctionKind(buf.G1())
+	s.Target = buf.GJStr()
+	s.Reason = buf.GJStr()
+	s.Issuer = buf.GJStr()
+	s.Issued = getTime(buf)
+	s.Expires = getTime(buf)
+	return s
+}
+
+// putTime writes t as milliseconds since the Unix epoch, with the zero time
+// written as 0.
+func putTime(buf *packet.Packet, t time.Time) {
+	if t.IsZero() {
+		buf.P8(0)
+		return
+	}
+	buf.P8(uint64(t.UnixMilli()))
+}
+
+func getTime(buf *packet.Packet) time.Time {
+	millis := buf.G8()
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(millis))
+}
@@ -0,0 +1,294 @@
+package login
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// Server exposes a Local login service to worlds over TCP.
+//
+// A world stays registered for as long as the connection it registered on is
+// open, so worlds that crash or lose their connection drop out of the world
+// list on their own.
+type Server struct {
+	Addr string
+
+	Logger  slog.Logger
+	Service *Local
+
+	locker    sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+func NewServer(service *Local, logger slog.Logger) *Server {
+	return &Server{
+		Logger:  logger,
+		Service: service,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the network address s.Addr and then calls Serve
+// to handle requests from worlds.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts world connections on the Listener l.
+func (s *Server) Serve(l net.Listener) error {
+	s.locker.Lock()
+	s.listeners = append(s.listeners, l)
+	s.locker.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.locker.Lock()
+			closed := s.closed
+			s.locker.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// Close closes all listeners and world connections.
+func (s *Server) Close() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.closed = true
+
+	var err error
+	for _, l := range s.listeners {
+		if lerr := l.Close(); lerr != nil && err == nil {
+			err = lerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	s.locker.Lock()
+	s.conns[conn] = struct{}{}
+	s.locker.Unlock()
+
+	s.Logger.Info("world connected", "remoteAddr", conn.RemoteAddr())
+
+	// worlds registered over this connection
+	worlds := make(map[int]struct{})
+
+	defer func() {
+		conn.Close()
+		for id := range worlds {
+			s.Service.Unregister(id)
+			s.Logger.Info("world unregistered", "worldID", id)
+		}
+		s.Logger.Info("world disconnected", "remoteAddr", conn.RemoteAddr())
+
+		s.locker.Lock()
+		delete(s.conns, conn)
+		s.locker.Unlock()
+	}()
+
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.Logger.Error("login conn read error", "error", err)
+			}
+			return
+		}
+
+		reply, err := s.handle(f, worlds)
+		if err != nil {
+			s.Logger.Warn("login request failed", "opcode", f.Opcode, "error", err)
+			reply.Reset()
+			reply.P1(statusError)
+			reply.PJStr(err.Error())
+		}
+
+		err = writeFrame(conn, frame{
+			Opcode:   f.Opcode | opReply,
+			Sequence: f.Sequence,
+			Payload:  reply.Bytes(),
+		})
+		if err != nil {
+			s.Logger.Error("login conn write error", "error", err)
+			return
+		}
+	}
+}
+
+func (s *Server) handle(f frame, worlds map[int]struct{}) (packet.Packet, error) {
+	var reply packet.Packet
+	in := packet.NewPacket(f.Payload)
+
+	switch f.Opcode {
+	case opRegister:
+		var err error
+		if derr := decode(func() {
+			world, online := getRegister(in)
+			err = s.Service.Register(world, online)
+			if err == nil {
+				worlds[world.ID] = struct{}{}
+				s.Logger.Info("world registered", "worldID", world.ID, "hostname", world.Hostname)
+			}
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+
+	case opUnregister:
+		var err error
+		if derr := decode(func() {
+			id := int(in.G2())
+			err = s.Service.Unregister(id)
+			delete(worlds, id)
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+
+	case opUpdate:
+		var err error
+		if derr := decode(func() {
+			err = s.Service.Update(getWorld(in))
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+
+	case opLogin:
+		var resp Response
+		var err error
+		if derr := decode(func() {
+			resp, err = s.Service.Login(getRequest(in))
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+		putResponse(&reply, resp)
+
+	case opLogout:
+		var err error
+		if derr := decode(func() {
+			id := int(in.G2())
+			err = s.Service.Logout(id, in.GJStr())
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+
+	case opWorldList:
+		list, err := s.Service.WorldList()
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+		putWorldList(&reply, list)
+
+	case opCheckName:
+		var code uint8
+		var suggestions []string
+		var err error
+		if derr := decode(func() {
+			code, suggestions, err = s.Service.CheckName(in.GJStr())
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+		reply.P1(code)
+		reply.P1(uint8(len(suggestions)))
+		for _, v := range suggestions {
+			reply.PJStr(v)
+		}
+
+	case opCreate:
+		var code uint8
+		var err error
+		if derr := decode(func() {
+			code, err = s.Service.CreateAccount(getCreateRequest(in))
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+		reply.P1(code)
+
+	case opSanction:
+		var err error
+		if derr := decode(func() {
+			err = s.Service.Sanction(getSanction(in))
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+
+	case opPardon:
+		var found bool
+		var err error
+		if derr := decode(func() {
+			kind := SanctionKind(in.G1())
+			found, err = s.Service.Pardon(kind, in.GJStr())
+		}); derr != nil {
+			return reply, derr
+		}
+		if err != nil {
+			return reply, err
+		}
+		reply.P1(statusOK)
+		if found {
+			reply.P1(1)
+		} else {
+			reply.P1(0)
+		}
+
+	default:
+		return reply, errors.New("login: unknown opcode")
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,97 @@
+// Package login implements the login service that game worlds register with.
+//
+// The service owns the world list and the set of players that are online on
+// any world, so logins can be authorised centrally. Worlds talk to it through
+// the Service interface, either over TCP using Client or in-process using
+// Local.
+package login
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zsrv/rt5-server-go/util"
+)
+
+var (
+	ErrOffline = errors.New("login: login server offline")
+	ErrNoReply = errors.New("login: no reply from login server")
+)
+
+// Request describes a player attempting to log in to a world.
+type Request struct {
+	WorldID      int
+	Username     string
+	Password     string
+	Address      string
+	UID          []byte
+	Reconnecting bool
+}
+
+// Response is the login service's answer to a Request.
+type Response struct {
+	Code           uint8
+	StaffModLevel  uint8
+	PlayerModLevel uint8
+	Members        bool
+
+	// Muted is set if the player may not talk in public chat, until
+	// MutedUntil (or for good, if MutedUntil is zero).
+	Muted      bool
+	MutedUntil time.Time
+}
+
+// WorldPlayers is the player count of a single world.
+type WorldPlayers struct {
+	ID      int
+	Players int
+}
+
+// WorldListSnapshot is everything needed to answer a client world list fetch.
+type WorldListSnapshot struct {
+	Raw      []byte
+	Checksum uint32
+	MinID    int
+	Players  []WorldPlayers
+}
+
+// Service is the set of operations a world performs against the login service.
+type Service interface {
+	// Register adds a world to the world list. online is the usernames of
+	// the players already on the world, which it still has when it
+	// registers again after losing the login service.
+	Register(world util.WorldParameters, online []string) error
+	// Unregister removes a world from the world list and logs out its players.
+	Unregister(worldID int) error
+	// Update replaces the parameters (player count, activity, flags) of a
+	// registered world.
+	Update(world util.WorldParameters) error
+	// Login authorises a player to log in to a world.
+	Login(req Request) (Response, error)
+	// Logout tells the login service a player has left a world.
+	Logout(worldID int, username string) error
+	// WorldList returns the current world list.
+	WorldList() (WorldListSnapshot, error)
+	// CheckName reports whether an account could be created with username,
+	// suggesting other names if it is taken.
+	CheckName(username string) (uint8, []string, error)
+	// CreateAccount validates and creates an account, returning the
+	// response code to send to the client.
+	CreateAccount(req CreateRequest) (uint8, error)
+	// Sanction places a ban, mute or lock. It takes effect the next time
+	// the target logs in; the world is responsible for players already
+	// online.
+	Sanction(s Sanction) error
+	// Pardon lifts the sanction of kind on target, reporting whether there
+	// was one.
+	Pardon(kind SanctionKind, target string) (bool, error)
+}
+
+// ResponseCode returns the login response code to send to the client when
+// the login service could not be reached.
+func ResponseCode(err error) uint8 {
+	if errors.Is(err, ErrNoReply) {
+		return util.LoginProtOutNoReplyFromLoginServer
+	}
+	return util.LoginProtOutLoginServerOffline
+}
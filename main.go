@@ -1,48 +1,120 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"sync"
 
 	"github.com/zsrv/rt5-server-go/engine"
+	"github.com/zsrv/rt5-server-go/login"
+	"github.com/zsrv/rt5-server-go/util"
+	"github.com/zsrv/rt5-server-go/util/huffman"
+)
+
+var (
+	listenAddr = flag.String("addr", "127.0.0.1:40001", "address to listen for game clients on")
+	worldID    = flag.Int("world", 1, "ID of this world in the world list")
+	loginAddr  = flag.String("login", "", "address of the login server (empty runs the login service in-process)")
+	worldsPath = flag.String("worlds", "", "world list config file (empty uses the built-in world list)")
+	npcsPath   = flag.String("npcs", "data/npcs.json", "file NPC spawns are loaded from")
+	xteasPath  = flag.String("xteas", "data/xteas.json", "file the map keys are loaded from")
+	savesDir   = flag.String("saves", "data/players", "directory player saves are kept in")
+
+	// used when the login service runs in-process
+	accountsDir = flag.String("accounts", "data/accounts", "directory player accounts are stored in")
+	auditPath   = flag.String("audit", "data/audit/create.jsonl", "file account creation attempts are recorded in")
+	modPath     = flag.String("moderation", "data/moderation.json", "file bans, mutes and locks are stored in")
+	devLogins   = flag.Bool("dev-logins", false, "let players without an account log in with any password (for development only)")
+
+	unconfirmed = flag.Bool("unconfirmed-packets", false, "use packets and update masks not yet checked against a 578 client (for development only)")
 )
 
 func main() {
+	flag.Parse()
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		s := engine.NewServer()
 
-		s.Addr = "127.0.0.1:40001"
+		s.Addr = *listenAddr
+		s.SaveDir = *savesDir
+		engine.SendUnconfirmed = *unconfirmed
+
+		worlds := util.DefaultWorldList()
+		if *worldsPath != "" {
+			var err error
+			worlds, err = util.LoadWorldList(*worldsPath)
+			if err != nil {
+				s.Logger.Error("could not load world list", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		params, found := worlds.World(*worldID)
+		if !found {
+			s.Logger.Error("unknown world", "worldID", *worldID)
+			os.Exit(1)
+		}
+		s.WorldParams = params
+
+		if *loginAddr != "" {
+			client := login.NewClient(*loginAddr, s.Logger)
+			client.Online = s.World.Usernames
+			s.Login = client
+		} else {
+			service := login.NewLocal(worlds)
+			service.Accounts = login.NewAccounts(*accountsDir)
+			service.AllowUnregistered = *devLogins
+			service.Audit = &login.AuditLog{Path: *auditPath}
 
-		s.Logger.Info("starting server", "listenAddr", s.Addr)
-		err := s.ListenAndServe()
+			moderation, err := login.LoadModeration(*modPath)
+			if err != nil {
+				s.Logger.Error("could not load moderation state", "error", err)
+				os.Exit(1)
+			}
+			service.Moderation = moderation
+			s.Login = service
+		}
+
+		if err := util.LoadXTEAs(*xteasPath); err != nil {
+			s.Logger.Error("could not load map keys", "error", err)
+			os.Exit(1)
+		}
+
+		counts, err := s.World.Config.Load()
 		if err != nil {
-			s.Logger.Error("error", err)
+			s.Logger.Error("could not load config types", "error", err)
+			os.Exit(1)
+		}
+		for _, err := range s.World.Config.Failed() {
+			s.Logger.Warn("skipped config type", "error", err)
+		}
+		s.Logger.Info("loaded config types", "counts", counts)
+
+		codec, err := huffman.Load(s.World.Cache)
+		if err != nil {
+			s.Logger.Warn("could not load the huffman table, using the bundled one", "error", err)
+		} else {
+			s.World.Huffman = codec
+		}
+
+		s.World.NPCSpawnsPath = *npcsPath
+		if err := s.World.LoadNPCs(); err != nil {
+			s.Logger.Error("could not spawn NPCs", "error", err)
+			os.Exit(1)
+		}
+
+		s.Logger.Info("starting server", "listenAddr", s.Addr, "worldID", params.ID)
+		err = s.ListenAndServe()
+		if err != nil {
+			s.Logger.Error("error", "error", err)
 			os.Exit(1)
 		} else {
 			s.Logger.Info("server exiting")
 		}
 	}()
 
-	//wg.Add(1)
-	//go func() {
-	//	defer wg.Done()
-	//	s := network.NewServer()
-	//
-	//	s.Addr = "127.0.0.1:50001"
-	//
-	//	log.Println("Starting server at", s.Addr)
-	//	log.Fatal(s.ListenAndServe())
-	//}()
-
 	wg.Wait()
-
-	//s := network.NewServer()
-	//
-	//s.Addr = "127.0.0.1:40001"
-	//
-	//log.Println("Starting server at", s.Addr)
-	//log.Fatal(s.ListenAndServe())
 }
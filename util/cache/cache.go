@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ArchiveReferenceTables is the archive holding every other archive's
+// reference table.
+const ArchiveReferenceTables = 255
+
+// Cache reads groups from a directory laid out as <archive>/<group>.dat,
+// each file holding one container, as served over JS5.
+type Cache struct {
+	Dir string
+
+	mu     sync.Mutex
+	tables map[int]*ReferenceTable
+}
+
+func Open(dir string) *Cache {
+	return &Cache{
+		Dir:    dir,
+		tables: make(map[int]*ReferenceTable),
+	}
+}
+
+// Raw returns the container of a group as stored.
+func (c *Cache) Raw(archive int, group int) ([]byte, error) {
+	return os.ReadFile(filepath.Join(c.Dir, fmt.Sprint(archive), fmt.Sprintf("%d.dat", group)))
+}
+
+// Read returns the decompressed contents of a group, decrypted with key if
+// it's encrypted.
+func (c *Cache) Read(archive int, group int, key []int32) ([]byte, error) {
+	data, err := c.Raw(archive, group)
+	if err != nil {
+		return nil, err
+	}
+	return Decompress(data, key)
+}
+
+// ReferenceTable returns the reference table of archive, reading it on first
+// use.
+func (c *Cache) ReferenceTable(archive int) (*ReferenceTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if table, ok := c.tables[archive]; ok {
+		return table, nil
+	}
+
+	data, err := c.Read(ArchiveReferenceTables, archive, nil)
+	if err != nil {
+		return nil, err
+	}
+	table, err := DecodeReferenceTable(data)
+	if err != nil {
+		return nil, fmt.Errorf("archive %d: %w", archive, err)
+	}
+	c.tables[archive] = table
+	return table, nil
+}
+
+// GroupID returns the id of the group called name in archive.
+func (c *Cache) GroupID(archive int, name string) (int, bool, error) {
+	table, err := c.ReferenceTable(archive)
+	if err != nil {
+		return 0, false, err
+	}
+	id, ok := table.GroupID(name)
+	return id, ok, nil
+}
+
+// Files returns the files of a group, keyed by file id.
+func (c *Cache) Files(archive int, group int) (map[int][]byte, error) {
+	table, err := c.ReferenceTable(archive)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := table.Groups[group]
+	if !ok {
+		return nil, fmt.Errorf("cache: archive %d has no group %d", archive, group)
+	}
+
+	data, err := c.Read(archive, group, nil)
+	if err != nil {
+		return nil, err
+	}
+	return SplitGroup(data, entry.Files)
+}
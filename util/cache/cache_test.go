@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// "hello world hello world" compressed by bzip2, header included
+const bzip2Hello = "425a683931415926535976668c420000039180400006449080200020aa869e810c08ec4457ed686311a2ee48a70a120eccd18840"
+
+func TestDecompress(t *testing.T) {
+	hello := []byte("hello world hello world")
+	key := []int32{1, -2, 3, -4}
+
+	bz, _ := hex.DecodeString(bzip2Hello)
+	bzip2Container := []byte{CompressionBzip2, 0, 0, 0, byte(len(bz) - 4), 0, 0, 0, byte(len(hello))}
+	bzip2Container = append(bzip2Container, bz[4:]...)
+
+	mustCompress := func(compression int, key []int32) []byte {
+		data, err := Compress(compression, hello, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		key     []int32
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "none",
+			data: mustCompress(CompressionNone, nil),
+			want: hello,
+		},
+		{
+			name: "gzip",
+			data: mustCompress(CompressionGzip, nil),
+			want: hello,
+		},
+		{
+			name: "bzip2",
+			data: bzip2Container,
+			want: hello,
+		},
+		{
+			name: "version trailer",
+			data: append(mustCompress(CompressionGzip, nil), 0, 7),
+			want: hello,
+		},
+		{
+			name: "encrypted",
+			data: mustCompress(CompressionGzip, key),
+			key:  key,
+			want: hello,
+		},
+		{
+			name: "zero key",
+			data: mustCompress(CompressionNone, nil),
+			key:  []int32{0, 0, 0, 0},
+			want: hello,
+		},
+		{
+			name:    "wrong key",
+			data:    mustCompress(CompressionGzip, key),
+			key:     []int32{4, 3, 2, 1},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    mustCompress(CompressionNone, nil)[:10],
+			wantErr: true,
+		},
+		{
+			name:    "unknown compression",
+			data:    []byte{9, 0, 0, 0, 0, 0, 0, 0, 0},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decompress(tt.data, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decompress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("Decompress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameHash(t *testing.T) {
+	tests := []struct {
+		name string
+		want int32
+	}{
+		// String.hashCode() values
+		{name: "", want: 0},
+		{name: "m50_50", want: -1123920270},
+		{name: "M50_50", want: -1123920270},
+		{name: "l50_50", want: -1152549421},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NameHash(tt.name); got != tt.want {
+				t.Errorf("NameHash(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// encodeReferenceTable encodes a protocol 6 reference table of named groups.
+func encodeReferenceTable(groups map[string]*GroupEntry) []byte {
+	var ids []int
+	byID := make(map[int]string)
+	for name, v := range groups {
+		ids = append(ids, v.ID)
+		byID[v.ID] = name
+	}
+	sort.Ints(ids)
+
+	var buf packet.Packet
+	buf.P1(6)
+	buf.P4(1) // version
+	buf.P1(flagNames)
+	buf.P2(uint16(len(ids)))
+	last := 0
+	for _, id := range ids {
+		buf.P2(uint16(id - last))
+		last = id
+	}
+	for _, id := range ids {
+		buf.P4(uint32(NameHash(byID[id])))
+	}
+	for _, id := range ids {
+		buf.P4(groups[byID[id]].CRC)
+	}
+	for _, id := range ids {
+		buf.P4(uint32(groups[byID[id]].Version))
+	}
+	for _, id := range ids {
+		buf.P2(uint16(len(groups[byID[id]].Files)))
+	}
+	for _, id := range ids {
+		last := 0
+		for _, file := range groups[byID[id]].Files {
+			buf.P2(uint16(file - last))
+			last = file
+		}
+	}
+	for _, id := range ids {
+		for range groups[byID[id]].Files {
+			buf.P4(0)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestCache_GroupID(t *testing.T) {
+	dir := t.TempDir()
+	table := encodeReferenceTable(map[string]*GroupEntry{
+		"m50_50": {ID: 3, Files: []int{0}},
+		"l50_50": {ID: 10, Version: 4, Files: []int{0}},
+	})
+	writeGroup(t, dir, ArchiveReferenceTables, 5, table)
+
+	c := Open(dir)
+	tests := []struct {
+		name   string
+		want   int
+		wantOk bool
+	}{
+		{name: "m50_50", want: 3, wantOk: true},
+		{name: "l50_50", want: 10, wantOk: true},
+		{name: "m51_50", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := c.GroupID(5, tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("GroupID() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	if _, _, err := c.GroupID(6, "m50_50"); err == nil {
+		t.Errorf("GroupID() of a missing archive didn't fail")
+	}
+}
+
+func writeGroup(t *testing.T, dir string, archive int, group int, data []byte) {
+	t.Helper()
+
+	container, err := Compress(CompressionGzip, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, fmt.Sprint(archive), fmt.Sprintf("%d.dat", group))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, container, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitGroup(t *testing.T) {
+	// two files in two stripes: "ab" + "c", then "d" + "ef"
+	var table packet.Packet
+	table.P4(2)
+	table.P4(uint32(-1 & 0xffffffff)) // 1, stored as the difference from 2
+	table.P4(1)
+	table.P4(1)
+	striped := append([]byte("abcdef"), table.Bytes()...)
+	striped = append(striped, 2)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		fileIDs []int
+		want    map[int][]byte
+		wantErr bool
+	}{
+		{
+			name:    "single file",
+			data:    []byte("whole"),
+			fileIDs: []int{4},
+			want:    map[int][]byte{4: []byte("whole")},
+		},
+		{
+			name:    "striped",
+			data:    striped,
+			fileIDs: []int{0, 7},
+			want:    map[int][]byte{0: []byte("abd"), 7: []byte("cef")},
+		},
+		{
+			name:    "truncated",
+			data:    striped[2:],
+			fileIDs: []int{0, 7},
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			fileIDs: []int{0, 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitGroup(tt.data, tt.fileIDs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitGroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitGroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Package cache reads the game cache: JS5 containers, the reference tables
+// that index each archive, and the files packed into each group.
+package cache
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Container compression types, the first byte of every container.
+const (
+	CompressionNone  = 0
+	CompressionBzip2 = 1
+	CompressionGzip  = 2
+)
+
+// the header the cache strips from bzip2 streams, for a 100k block size
+var bzip2Header = []byte("BZh1")
+
+var ErrTruncated = errors.New("cache: container is truncated")
+
+// Decompress unpacks a JS5 container, first decrypting it with key if key
+// isn't nil or all zero. Any version trailer after the data is ignored.
+func Decompress(data []byte, key []int32) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, ErrTruncated
+	}
+
+	compression := data[0]
+	length := int(binary.BigEndian.Uint32(data[1:5]))
+	if length < 0 {
+		return nil, fmt.Errorf("cache: bad container length %d", length)
+	}
+
+	end := 5 + length
+	if compression != CompressionNone {
+		// the decompressed length comes before the data
+		end += 4
+	}
+	if len(data) < end {
+		return nil, ErrTruncated
+	}
+
+	payload := data[5:end]
+	if !zeroKey(key) {
+		payload = append([]byte(nil), payload...)
+		decipher(payload, key)
+	}
+
+	switch compression {
+	case CompressionNone:
+		return payload, nil
+	case CompressionBzip2, CompressionGzip:
+		size := int(binary.BigEndian.Uint32(payload[:4]))
+		compressed := payload[4:]
+
+		var r io.Reader
+		if compression == CompressionBzip2 {
+			r = bzip2.NewReader(io.MultiReader(bytes.NewReader(bzip2Header), bytes.NewReader(compressed)))
+		} else {
+			gz, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				return nil, fmt.Errorf("cache: %w", err)
+			}
+			defer gz.Close()
+			r = gz
+		}
+
+		out := make([]byte, size)
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("cache: unknown compression type %d", compression)
+	}
+}
+
+func zeroKey(key []int32) bool {
+	for _, v := range key {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// decipher XTEA decrypts every whole 8 byte block of data in place, leaving
+// any bytes after the last block as they are.
+func decipher(data []byte, key []int32) {
+	var k [4]uint32
+	for i := range k {
+		k[i] = uint32(key[i])
+	}
+
+	for off := 0; off+8 <= len(data); off += 8 {
+		v0 := binary.BigEndian.Uint32(data[off:])
+		v1 := binary.BigEndian.Uint32(data[off+4:])
+		sum := uint32(0xC6EF3720)
+
+		for i := 0; i < 32; i++ {
+			v1 -= (k[sum>>11&3] + sum) ^ (v0<<4 ^ v0>>5 + v0)
+			sum -= 0x9E3779B9
+			v0 -= (k[sum&3] + sum) ^ (v1<<4 ^ v1>>5 + v1)
+		}
+
+		binary.BigEndian.PutUint32(data[off:], v0)
+		binary.BigEndian.PutUint32(data[off+4:], v1)
+	}
+}
+
+// Compress packs data into a container, encrypting it with key if key isn't
+// nil or all zero. Only CompressionNone and CompressionGzip can be written.
+func Compress(compression int, data []byte, key []int32) ([]byte, error) {
+	var payload []byte
+	switch compression {
+	case CompressionNone:
+		payload = append(payload, data...)
+	case CompressionGzip:
+		var b bytes.Buffer
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+		gz := gzip.NewWriter(&b)
+		if _, err := gz.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		payload = b.Bytes()
+	default:
+		return nil, fmt.Errorf("cache: can't write compression type %d", compression)
+	}
+
+	if !zeroKey(key) {
+		encipher(payload, key)
+	}
+
+	length := len(payload)
+	if compression != CompressionNone {
+		length -= 4
+	}
+
+	out := []byte{byte(compression)}
+	out = binary.BigEndian.AppendUint32(out, uint32(length))
+	return append(out, payload...), nil
+}
+
+// encipher XTEA encrypts every whole 8 byte block of data in place.
+func encipher(data []byte, key []int32) {
+	var k [4]uint32
+	for i := range k {
+		k[i] = uint32(key[i])
+	}
+
+	for off := 0; off+8 <= len(data); off += 8 {
+		v0 := binary.BigEndian.Uint32(data[off:])
+		v1 := binary.BigEndian.Uint32(data[off+4:])
+		sum := uint32(0)
+
+		for i := 0; i < 32; i++ {
+			v0 += (k[sum&3] + sum) ^ (v1<<4 ^ v1>>5 + v1)
+			sum += 0x9E3779B9
+			v1 += (k[sum>>11&3] + sum) ^ (v0<<4 ^ v0>>5 + v0)
+		}
+
+		binary.BigEndian.PutUint32(data[off:], v0)
+		binary.BigEndian.PutUint32(data[off+4:], v1)
+	}
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+// reference table flags
+const (
+	flagNames     = 0x1
+	flagWhirlpool = 0x2
+)
+
+// ReferenceTable indexes the groups of an archive and the files in each
+// group. It's stored in archive 255, in the group of the archive it indexes.
+type ReferenceTable struct {
+	Protocol int
+	Version  int
+	Groups   map[int]*GroupEntry
+
+	// group ids by name hash, for archives with named groups
+	names map[int32]int
+}
+
+// GroupEntry is a group in a ReferenceTable.
+type GroupEntry struct {
+	ID       int
+	NameHash int32
+	CRC      uint32
+	Version  int
+	// Files holds the ids of the files packed into the group, in the order
+	// they're stored.
+	Files []int
+}
+
+// DecodeReferenceTable decodes a decompressed reference table.
+func DecodeReferenceTable(data []byte) (table *ReferenceTable, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			table = nil
+			err = fmt.Errorf("cache: reference table is truncated: %v", r)
+		}
+	}()
+
+	buf := packet.NewPacket(data)
+
+	table = &ReferenceTable{
+		Groups: make(map[int]*GroupEntry),
+		names:  make(map[int32]int),
+	}
+
+	table.Protocol = int(buf.G1())
+	if table.Protocol < 5 || table.Protocol > 6 {
+		return nil, fmt.Errorf("cache: unsupported reference table protocol %d", table.Protocol)
+	}
+	if table.Protocol >= 6 {
+		table.Version = int(buf.G4())
+	}
+	flags := buf.G1()
+
+	count := int(buf.G2())
+	groups := make([]*GroupEntry, count)
+	id := 0
+	for i := range groups {
+		id += int(buf.G2())
+		groups[i] = &GroupEntry{ID: id}
+		table.Groups[id] = groups[i]
+	}
+
+	if flags&flagNames != 0 {
+		for _, v := range groups {
+			v.NameHash = int32(buf.G4())
+			table.names[v.NameHash] = v.ID
+		}
+	}
+	for _, v := range groups {
+		v.CRC = buf.G4()
+	}
+	if flags&flagWhirlpool != 0 {
+		for range groups {
+			buf.Next(64)
+		}
+	}
+	for _, v := range groups {
+		v.Version = int(buf.G4())
+	}
+	for _, v := range groups {
+		v.Files = make([]int, buf.G2())
+	}
+	for _, v := range groups {
+		file := 0
+		for i := range v.Files {
+			file += int(buf.G2())
+			v.Files[i] = file
+		}
+	}
+	if flags&flagNames != 0 {
+		// the file name hashes aren't used by anything yet
+		for _, v := range groups {
+			buf.Next(4 * len(v.Files))
+		}
+	}
+
+	return table, nil
+}
+
+// GroupID returns the id of the group called name.
+func (t *ReferenceTable) GroupID(name string) (int, bool) {
+	id, ok := t.names[NameHash(name)]
+	return id, ok
+}
+
+// NameHash is the hash groups and files are named by, the Java string hash
+// of the lowercased name.
+func NameHash(name string) int32 {
+	var hash int32
+	for _, v := range []byte(name) {
+		if v >= 'A' && v <= 'Z' {
+			v += 'a' - 'A'
+		}
+		hash = hash*31 + int32(v)
+	}
+	return hash
+}
+
+// SplitGroup unpacks the files of a decompressed group. A group holding a
+// single file is the file itself; otherwise the files are stored in one or
+// more stripes, followed by the size of each file's part of each stripe and
+// the stripe count.
+func SplitGroup(data []byte, fileIDs []int) (map[int][]byte, error) {
+	files := make(map[int][]byte, len(fileIDs))
+	if len(fileIDs) == 1 {
+		files[fileIDs[0]] = data
+		return files, nil
+	}
+	if len(data) == 0 {
+		return nil, ErrTruncated
+	}
+
+	stripes := int(data[len(data)-1])
+	tableStart := len(data) - 1 - stripes*len(fileIDs)*4
+	if tableStart < 0 {
+		return nil, ErrTruncated
+	}
+
+	table := packet.NewPacket(data[tableStart : len(data)-1])
+	sizes := make([][]int, stripes)
+	for stripe := range sizes {
+		sizes[stripe] = make([]int, len(fileIDs))
+		size := 0
+		for i := range fileIDs {
+			// sizes are stored as the difference from the last file's
+			size += int(int32(table.G4()))
+			sizes[stripe][i] = size
+		}
+	}
+
+	off := 0
+	for stripe := range sizes {
+		for i, id := range fileIDs {
+			size := sizes[stripe][i]
+			if size < 0 || off+size > tableStart {
+				return nil, ErrTruncated
+			}
+			files[id] = append(files[id], data[off:off+size]...)
+			off += size
+		}
+	}
+	return files, nil
+}
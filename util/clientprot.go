@@ -20,8 +20,37 @@ const (
 	ClientProtClientCheat         = 76
 	ClientProtMoveGameClick       = 78
 	ClientProtIdleTimer           = 81 // not an official name
+
+	// TODO: confirm the social opcodes below
+	ClientProtIgnoreListAdd  = 29
+	ClientProtMessagePrivate = 30
+	ClientProtFriendListAdd  = 34
+	ClientProtChatSetMode    = 36
+	ClientProtFriendListDel  = 56
+	ClientProtIgnoreListDel  = 64
+
+	// TODO: confirm the clan opcodes below
+	ClientProtClanJoinChatLeaveChat = 2
+	ClientProtClanKickUser          = 4
+	ClientProtFriendSetRank         = 42
 )
 
+// ClientProtUnconfirmed are the opcodes of the packets added on top of the
+// known ones above that are marked for confirmation. The engine ignores
+// them unless asked not to.
+var ClientProtUnconfirmed = map[uint8]bool{
+	ClientProtIgnoreListAdd:  true,
+	ClientProtMessagePrivate: true,
+	ClientProtFriendListAdd:  true,
+	ClientProtChatSetMode:    true,
+	ClientProtFriendListDel:  true,
+	ClientProtIgnoreListDel:  true,
+
+	ClientProtClanJoinChatLeaveChat: true,
+	ClientProtClanKickUser:          true,
+	ClientProtFriendSetRank:         true,
+}
+
 // TODO: Reverse lookup
 
 var ClientProtLengths = make([]uint8, 256)
@@ -0,0 +1,147 @@
+// Package huffman implements the Huffman code the client compresses chat
+// with.
+package huffman
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTruncated is returned when compressed text ends before all of its
+// characters are read.
+var ErrTruncated = errors.New("huffman: compressed text is truncated")
+
+// Huffman is a canonical Huffman code over bytes, built from the code length
+// of each byte the same way the client builds it.
+type Huffman struct {
+	sizes []uint8
+	// codes holds the code of each byte, in its top bits.
+	codes []uint32
+	// tree is the decoding tree. Following a 0 bit goes to the next node, a
+	// 1 bit to the node tree[node] names; a leaf holds ^byte.
+	tree []int32
+}
+
+// New builds the code from the code length of each byte, 0 for bytes that
+// can't be encoded.
+func New(sizes []uint8) *Huffman {
+	h := &Huffman{
+		sizes: sizes,
+		codes: make([]uint32, len(sizes)),
+		tree:  make([]int32, 8),
+	}
+
+	var nextCodes [33]uint32
+	nextFree := int32(0)
+	for i, size := range sizes {
+		if size == 0 {
+			continue
+		}
+
+		bit := uint32(1) << (32 - size)
+		code := nextCodes[size]
+		h.codes[i] = code
+
+		var next uint32
+		if code&bit != 0 {
+			next = nextCodes[size-1]
+		} else {
+			next = code | bit
+			for j := int(size) - 1; j >= 1; j-- {
+				c := nextCodes[j]
+				if c != code {
+					break
+				}
+				b := uint32(1) << (32 - j)
+				if c&b != 0 {
+					nextCodes[j] = nextCodes[j-1]
+					break
+				}
+				nextCodes[j] = c | b
+			}
+		}
+		nextCodes[size] = next
+		for j := int(size) + 1; j <= 32; j++ {
+			if nextCodes[j] == code {
+				nextCodes[j] = next
+			}
+		}
+
+		node := int32(0)
+		for j := 0; j < int(size); j++ {
+			if code&(0x80000000>>j) != 0 {
+				if h.tree[node] == 0 {
+					h.tree[node] = nextFree
+				}
+				node = h.tree[node]
+			} else {
+				node++
+			}
+			for int(node) >= len(h.tree) {
+				h.tree = append(h.tree, make([]int32, len(h.tree))...)
+			}
+		}
+		h.tree[node] = ^int32(i)
+		if node >= nextFree {
+			nextFree = node + 1
+		}
+	}
+	return h
+}
+
+// Encode compresses text. The length of text has to be sent with it for it
+// to be decoded.
+func (h *Huffman) Encode(text string) ([]byte, error) {
+	var out []byte
+	bitPos := 0
+	for _, r := range text {
+		b := int(uint8(r))
+		if b >= len(h.sizes) || h.sizes[b] == 0 {
+			return nil, fmt.Errorf("huffman: %q can't be encoded", r)
+		}
+
+		size := int(h.sizes[b])
+		code := h.codes[b]
+		for i := 0; i < size; i++ {
+			if bitPos&7 == 0 {
+				out = append(out, 0)
+			}
+			if code&(0x80000000>>i) != 0 {
+				out[bitPos>>3] |= 0x80 >> (bitPos & 7)
+			}
+			bitPos++
+		}
+	}
+	return out, nil
+}
+
+// Decode decompresses length characters from data.
+func (h *Huffman) Decode(data []byte, length int) (string, error) {
+	out := make([]byte, 0, length)
+	if length == 0 {
+		return "", nil
+	}
+
+	node := int32(0)
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			if b>>bit&1 != 0 {
+				node = h.tree[node]
+			} else {
+				node++
+			}
+			if int(node) >= len(h.tree) {
+				return "", fmt.Errorf("huffman: bad compressed text")
+			}
+
+			if leaf := h.tree[node]; leaf < 0 {
+				out = append(out, byte(^leaf))
+				if len(out) == length {
+					return string(out), nil
+				}
+				node = 0
+			}
+		}
+	}
+	return "", ErrTruncated
+}
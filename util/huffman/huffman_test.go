@@ -0,0 +1,116 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDefault_Complete(t *testing.T) {
+	// every bit string decodes to something, so the lengths fill the code
+	// space exactly
+	var total uint64
+	for _, size := range sizes {
+		total += 1 << (32 - size)
+	}
+	if total != 1<<32 {
+		t.Errorf("code space used = %#x, want %#x", total, uint64(1)<<32)
+	}
+	if len(sizes) != 256 {
+		t.Errorf("len(sizes) = %v, want 256", len(sizes))
+	}
+}
+
+func TestHuffman_Encode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []byte
+	}{
+		{
+			name: "space",
+			text: " ",
+			want: []byte{0x20},
+		},
+		{
+			name: "one letter",
+			text: "e",
+			want: []byte{0x60},
+		},
+		{
+			name: "words",
+			text: "hello world",
+			want: []byte{0x83, 0x8c, 0x70, 0xfd, 0x95, 0x8a, 0x80},
+		},
+		{
+			name: "capitals, digits and punctuation",
+			text: "Buying rune scimitar 25k!",
+			want: []byte{0x0c, 0x3d, 0xfc, 0xda, 0xc6, 0xbe, 0xb6, 0x74, 0x69, 0xa2, 0x79, 0x2a, 0x40, 0x30, 0x03, 0xd7, 0x00, 0x80},
+		},
+		{
+			name: "empty",
+			text: "",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Default.Encode(tt.text)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Encode() = %#v, want %#v", got, tt.want)
+			}
+
+			decoded, err := Default.Decode(got, len(tt.text))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if decoded != tt.text {
+				t.Errorf("Decode() = %q, want %q", decoded, tt.text)
+			}
+		})
+	}
+}
+
+func TestHuffman_RoundTrip(t *testing.T) {
+	// every byte, in every alignment
+	var all []byte
+	for i := 0; i < 256; i++ {
+		all = append(all, byte(i))
+	}
+	for offset := 0; offset < 8; offset++ {
+		text := string(bytes.Repeat([]byte{'a'}, offset)) + string(all)
+		runes := []rune{}
+		for _, b := range []byte(text) {
+			runes = append(runes, rune(b))
+		}
+
+		encoded, err := Default.Encode(string(runes))
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		decoded, err := Default.Decode(encoded, len(runes))
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if decoded != text {
+			t.Errorf("offset %d: round trip = %q, want %q", offset, decoded, text)
+		}
+	}
+}
+
+func TestHuffman_Decode_Truncated(t *testing.T) {
+	encoded, _ := Default.Encode("hello world")
+	if _, err := Default.Decode(encoded[:3], 11); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Decode() error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestHuffman_Encode_Unencodable(t *testing.T) {
+	h := New([]uint8{1, 1})
+	if _, err := h.Encode("\x02"); err == nil {
+		t.Errorf("Encode() of a byte without a code succeeded")
+	}
+}
@@ -13,3 +13,44 @@ const (
 
 	LoginProtWorldListFetch = 23
 )
+
+// login responses
+const (
+	LoginProtOutUnexpected             = 0
+	LoginProtOutSuccess                = 2
+	LoginProtOutInvalidCredentials     = 3
+	LoginProtOutBanned                 = 4
+	LoginProtOutAlreadyOnline          = 5
+	LoginProtOutOutOfDate              = 6
+	LoginProtOutWorldFull              = 7
+	LoginProtOutLoginServerOffline     = 8
+	LoginProtOutTooManyConnections     = 9
+	LoginProtOutBadSessionID           = 10
+	LoginProtOutCouldNotLogin          = 13
+	LoginProtOutUpdating               = 14
+	LoginProtOutReconnecting           = 15
+	LoginProtOutTooManyAttempts        = 16
+	LoginProtOutLocked                 = 18
+	LoginProtOutInvalidLoginServer     = 20
+	LoginProtOutMalformed              = 22
+	LoginProtOutNoReplyFromLoginServer = 23
+	LoginProtOutErrorLoadingProfile    = 24
+	LoginProtOutAddressBanned          = 26
+	LoginProtOutServiceUnavailable     = 27
+)
+
+// account creation responses
+const (
+	CreateProtOutSuccess            = 2
+	CreateProtOutServerBusy         = 7  // TODO: confirm
+	CreateProtOutTooManyAttempts    = 9  // TODO: confirm
+	CreateProtOutInvalidDateOfBirth = 10 // TODO: confirm
+	CreateProtOutDateOfBirthFuture  = 11 // TODO: confirm
+	CreateProtOutDateOfBirthRecent  = 12 // TODO: confirm
+	CreateProtOutInvalidCountry     = 14 // TODO: confirm
+	CreateProtOutUsernameTaken      = 20 // TODO: confirm
+	CreateProtOutUsernameSuggestion = 21
+	CreateProtOutInvalidUsername    = 22 // TODO: confirm
+	CreateProtOutInvalidPassword    = 30 // TODO: confirm
+	CreateProtOutInvalidEmail       = 31 // TODO: confirm
+)
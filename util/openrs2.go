@@ -1,7 +1,6 @@
 package util
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 )
@@ -19,40 +18,32 @@ type XTEA struct {
 
 var XTEAs []XTEA
 
-func init() {
-	content, err := os.ReadFile("/home/owner/Code/github.com/zsrv/rt5-server-go/data/xteas.json")
-	if err != nil {
-		panic(err)
-	}
-
-	err = json.Unmarshal(content, &XTEAs)
-	if err != nil {
-		panic(err)
+// LoadXTEAs reads the map keys from the JSON file at path, replacing any
+// read before.
+func LoadXTEAs(path string) error {
+	var xteas []XTEA
+	if err := ReadJSON(path, &xteas); err != nil {
+		return fmt.Errorf("xteas %s: %w", path, err)
 	}
+	XTEAs = xteas
+	return nil
 }
 
+// GetXTEA returns the key of a mapsquare's loc file, if LoadXTEAs read one.
 func GetXTEA(x int, z int) (XTEA, bool) {
 	for _, v := range XTEAs {
 		if v.MapSquare == x<<8|z {
 			return v, true
 		}
 	}
-	fmt.Printf("WARNING: BAD XTEA RETURNED for x %v, z %v\n", x, z)
 	return XTEA{}, false
 }
 
 func GetGroup(archive uint8, group uint16) ([]byte, error) {
 	path := fmt.Sprintf("data/cache/%d/%d.dat", archive, group)
-	if _, err := os.Stat(path); err != nil {
-		fmt.Printf("path %s does not exist!\n", path)
-		return nil, err
-	}
-
 	file, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Printf("could not read file %s!\n", path)
-		return nil, err
+		return nil, fmt.Errorf("group %d/%d: %w", archive, group, err)
 	}
-
 	return file, nil
 }
@@ -690,7 +690,16 @@ func (p *Packet) RSAEnc(modulus *big.Int, exponent *big.Int) {
 	p.PData(ciphertextBytes, len(ciphertextBytes))
 }
 
-// TODO: add a test for this
+// RSAModulus and RSAPrivateExponent are the key used by RSADec.
+var RSAModulus, RSAPrivateExponent *big.Int
+
+func init() {
+	RSAPrivateExponent, _ = new(big.Int).SetString("571fb062048b61721ebfcf1e877153241b70c3aa26edb0f9f06a1b2be07c4e45eaba4fc356ea806cbed298d38613590a53fde0383c3a411758516293240925e5", 16)
+	RSAModulus, _ = new(big.Int).SetString("0088c38748a58228f7261cdc340b5691d7d0975dee0ecdb717609e6bf971eb3fe723ef9d130e4686813739768ad9472eb46d8bfcc042c1a5fcb05e931f632eea5d", 16)
+}
+
+// RSADec RSA-decrypts a block written by RSAEnc, using RSAModulus and
+// RSAPrivateExponent.
 func (p *Packet) RSADec() (*Packet, error) {
 	// we aren't using BigInteger, so we have to do this manually
 	numBytes := p.G1()
@@ -706,22 +715,13 @@ func (p *Packet) RSADec() (*Packet, error) {
 		rsax = temp
 	}
 
-	// TODO: move this into an init() or something, and make key a package-level var?
-	// private exponent
-	keyD, ok := new(big.Int).SetString("571fb062048b61721ebfcf1e877153241b70c3aa26edb0f9f06a1b2be07c4e45eaba4fc356ea806cbed298d38613590a53fde0383c3a411758516293240925e5", 16)
-	if !ok {
-		return nil, errors.New("bad keyD")
-	}
-	// modulus
-	keyN, ok := new(big.Int).SetString("0088c38748a58228f7261cdc340b5691d7d0975dee0ecdb717609e6bf971eb3fe723ef9d130e4686813739768ad9472eb46d8bfcc042c1a5fcb05e931f632eea5d", 16)
-	if !ok {
-		return nil, errors.New("bad keyN")
-	}
-
 	// RSA raw decryption (no padding)
 	// better: take decrypt() from crypto/rsa/rsa.go
 	c := new(big.Int).SetBytes(rsax)
-	decrypted := c.Exp(c, keyD, keyN).Bytes()
+	if RSAModulus == nil || RSAPrivateExponent == nil {
+		return nil, errors.New("rsa key not set")
+	}
+	decrypted := c.Exp(c, RSAPrivateExponent, RSAModulus).Bytes()
 	//decryptedBuf := NewBuffer(decrypted)
 	decryptedBuf := NewPacket(decrypted)
 
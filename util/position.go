@@ -120,5 +120,5 @@ func (p *Position) HighRes() int {
 }
 
 func (p *Position) LowRes() int {
-	return p.MapSquareZ() | p.MapSquareX()<<8 | p.Plane
+	return p.MapSquareZ() | p.MapSquareX()<<8 | p.Plane<<16
 }
@@ -0,0 +1,95 @@
+package util
+
+const (
+	ServerProtIfOpenSub     = 52
+	ServerProtLogout        = 58
+	ServerProtPlayerInfo    = 72
+	ServerProtIfOpenTop     = 93
+	ServerProtRebuildNormal = 98
+	ServerProtRebuildRegion = 107 // TODO: confirm
+	ServerProtMessageGame   = 99
+	ServerProtNPCInfo       = 6 // TODO: confirm
+
+	// TODO: confirm the IF_* opcodes below
+	ServerProtIfSetEvents   = 13
+	ServerProtIfCloseSub    = 18
+	ServerProtIfSetText     = 37
+	ServerProtIfMoveSub     = 44
+	ServerProtIfSetHide     = 69
+	ServerProtIfSetModel    = 75
+	ServerProtIfSetAnim     = 83
+	ServerProtIfSetObject   = 105
+	ServerProtIfSetPosition = 108
+	ServerProtIfSetColour   = 112
+
+	ServerProtVarpSmall = 116 // TODO: confirm
+	ServerProtVarpLarge = 117 // TODO: confirm
+
+	// TODO: confirm the social opcodes below
+	ServerProtChatFilterSettingsPrivateChat = 43
+	ServerProtUpdateFriendList              = 62
+	ServerProtMessagePrivate                = 70
+	ServerProtMessagePrivateEcho            = 71
+	ServerProtFriendListStatus              = 85 // not an official name
+	ServerProtChatFilterSettings            = 120
+	ServerProtUpdateIgnoreList              = 126
+
+	// TODO: confirm the clan opcodes below
+	ServerProtUpdateClanChannel  = 55
+	ServerProtMessageClanChannel = 74
+
+	// TODO: confirm the zone opcodes below
+	ServerProtUpdateZonePartialFollows  = 26
+	ServerProtUpdateZonePartialEnclosed = 27
+	ServerProtLocAddChange              = 20
+	ServerProtLocDel                    = 21
+	ServerProtObjAdd                    = 22
+	ServerProtObjDel                    = 23
+	ServerProtObjCount                  = 24
+	ServerProtMapProjAnim               = 25
+	ServerProtMapAnim                   = 28
+	ServerProtSoundArea                 = 29
+)
+
+// ServerProtUnconfirmed are the opcodes marked for confirmation above. The
+// engine only sends them when asked to.
+var ServerProtUnconfirmed = map[uint8]bool{
+	ServerProtRebuildRegion: true,
+	ServerProtNPCInfo:       true,
+
+	ServerProtIfSetEvents:   true,
+	ServerProtIfCloseSub:    true,
+	ServerProtIfSetText:     true,
+	ServerProtIfMoveSub:     true,
+	ServerProtIfSetHide:     true,
+	ServerProtIfSetModel:    true,
+	ServerProtIfSetAnim:     true,
+	ServerProtIfSetObject:   true,
+	ServerProtIfSetPosition: true,
+	ServerProtIfSetColour:   true,
+
+	ServerProtVarpSmall: true,
+	ServerProtVarpLarge: true,
+
+	ServerProtChatFilterSettingsPrivateChat: true,
+	ServerProtUpdateFriendList:              true,
+	ServerProtMessagePrivate:                true,
+	ServerProtMessagePrivateEcho:            true,
+	ServerProtFriendListStatus:              true,
+	ServerProtChatFilterSettings:            true,
+	ServerProtUpdateIgnoreList:              true,
+
+	ServerProtUpdateClanChannel:  true,
+	ServerProtMessageClanChannel: true,
+
+	ServerProtUpdateZonePartialFollows:  true,
+	ServerProtUpdateZonePartialEnclosed: true,
+	ServerProtLocAddChange:              true,
+	ServerProtLocDel:                    true,
+	ServerProtObjAdd:                    true,
+	ServerProtObjDel:                    true,
+	ServerProtObjCount:                  true,
+	ServerProtMapProjAnim:               true,
+	ServerProtMapAnim:                   true,
+	ServerProtSoundArea:                 true,
+}
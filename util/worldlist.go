@@ -1,18 +1,26 @@
 package util
 
 import (
+	"encoding/json"
+	"fmt"
 	"hash/crc32"
+	"os"
+	"sort"
+	"sync"
 
 	"github.com/zsrv/rt5-server-go/util/packet"
 )
 
+// CountriesS is a country shown in the world list. The client only knows
+// countries by their position in the list, so worlds refer to countries by
+// ID and the ID is translated to a position when the list is encoded.
 type CountriesS struct {
-	ID          int
-	DisplayName string
-	Flag        int
+	ID          int    `json:"id"`
+	DisplayName string `json:"name"`
+	Flag        int    `json:"flag"`
 }
 
-// TODO: is there not actually an ID, it's just written in a sequence?
+// CountriesList is the country list used when no world list config is loaded.
 var CountriesList = []CountriesS{
 	{ID: 0, DisplayName: "United States", Flag: 0},
 	{ID: 1, DisplayName: "Austria", Flag: 15},
@@ -36,21 +44,62 @@ var CountriesList = []CountriesS{
 	{ID: 19, DisplayName: "Sweden", Flag: 191},
 }
 
+// world flags, as decoded by the client
+const (
+	WorldFlagMembers   = 0x1
+	WorldFlagQuickChat = 0x2
+	WorldFlagPvP       = 0x4
+	WorldFlagLootShare = 0x8
+	WorldFlagHighlight = 0x10
+)
+
+// WorldPlayersOffline is the player count the client shows as "OFFLINE".
+const WorldPlayersOffline = 65535
+
 type WorldParameters struct {
-	ID        int
-	Hostname  string
-	Port      int
-	Country   int
-	Activity  string
-	Members   bool
-	QuickChat bool
-	PvP       bool
-	LootShare bool
-	Highlight bool
-	Players   int
-}
-
-var WorldList = []WorldParameters{
+	ID        int    `json:"id"`
+	Hostname  string `json:"hostname"`
+	Port      int    `json:"port"`
+	Country   int    `json:"country"`
+	Activity  string `json:"activity"`
+	Members   bool   `json:"members"`
+	QuickChat bool   `json:"quickchat"`
+	PvP       bool   `json:"pvp"`
+	LootShare bool   `json:"lootshare"`
+	Highlight bool   `json:"highlight"`
+	Players   int    `json:"-"`
+}
+
+// Flags returns the flags the client uses to describe the world.
+func (w WorldParameters) Flags() uint32 {
+	var flags uint32 = 0
+
+	if w.Members {
+		flags |= WorldFlagMembers
+	}
+
+	if w.QuickChat {
+		flags |= WorldFlagQuickChat
+	}
+
+	if w.PvP {
+		flags |= WorldFlagPvP
+	}
+
+	if w.LootShare {
+		flags |= WorldFlagLootShare
+	}
+
+	// the client only highlights worlds that have an activity name to show
+	if w.Activity != "" && w.Highlight {
+		flags |= WorldFlagHighlight
+	}
+
+	return flags
+}
+
+// DefaultWorlds is the world list used when no world list config is loaded.
+var DefaultWorlds = []WorldParameters{
 	{
 		ID:        1,
 		Hostname:  "localhost",
@@ -62,7 +111,6 @@ var WorldList = []WorldParameters{
 		PvP:       false,
 		LootShare: true,
 		Highlight: false,
-		Players:   5,
 	},
 	{
 		ID:        2,
@@ -75,88 +123,325 @@ var WorldList = []WorldParameters{
 		PvP:       false,
 		LootShare: true,
 		Highlight: true,
-		Players:   5,
 	},
 }
 
-var WorldListRaw packet.Packet
-var WorldListChecksum uint32 = 0
+// WorldList is the set of countries and worlds shown in the world list.
+//
+// The encoded form of the list, and its checksum, are rebuilt whenever the
+// list changes, so readers always see an encoding that matches the worlds
+// and countries returned alongside it.
+type WorldList struct {
+	mu sync.RWMutex
 
-func init() {
-	WorldListRaw.PSmart(uint16(len(CountriesList)))
+	countries []CountriesS      // sorted by ID
+	worlds    []WorldParameters // sorted by ID
 
-	for _, v := range CountriesList {
-		WorldListRaw.PSmart(uint16(v.Flag))
-		WorldListRaw.PJStr2(v.DisplayName)
-	}
+	raw      []byte
+	checksum uint32
 }
 
-var MinID int
-var MaxID int
+// NewWorldList creates a world list from countries and worlds.
+func NewWorldList(countries []CountriesS, worlds []WorldParameters) (*WorldList, error) {
+	l := &WorldList{}
 
-func init() {
-	initialized := false
-	for _, v := range WorldList {
-		if !initialized {
-			MinID = v.ID
-			MaxID = v.ID
-			initialized = true
-		}
-		if v.ID < MinID {
-			MinID = v.ID
+	for _, v := range countries {
+		if err := l.addCountry(v); err != nil {
+			return nil, err
 		}
-		if v.ID > MaxID {
-			MaxID = v.ID
+	}
+
+	for _, v := range worlds {
+		if err := l.addWorld(v); err != nil {
+			return nil, err
 		}
 	}
+
+	l.rebuild()
+	return l, nil
 }
 
-func init() {
-	WorldListRaw.PSmart(uint16(MinID))
-	WorldListRaw.PSmart(uint16(MaxID))
-	WorldListRaw.PSmart(uint16(len(WorldList)))
+// DefaultWorldList creates a world list from CountriesList and DefaultWorlds.
+func DefaultWorldList() *WorldList {
+	l, err := NewWorldList(CountriesList, DefaultWorlds)
+	if err != nil {
+		panic(err)
+	}
+	return l
 }
 
-func init() {
-	for _, world := range WorldList {
-		WorldListRaw.PSmart(uint16(world.ID - MinID))
-		WorldListRaw.P1(uint8(world.Country))
+type worldListConfig struct {
+	Countries []CountriesS      `json:"countries"`
+	Worlds    []WorldParameters `json:"worlds"`
+}
 
-		var flags uint32 = 0
+// LoadWorldList reads a world list from a JSON config file. If the file
+// doesn't list any countries, CountriesList is used.
+func LoadWorldList(path string) (*WorldList, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 
-		if world.Members {
-			flags |= 0x1
-		}
+	var config worldListConfig
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return nil, fmt.Errorf("world list %s: %w", path, err)
+	}
 
-		if world.QuickChat {
-			flags |= 0x2
-		}
+	if len(config.Countries) == 0 {
+		config.Countries = CountriesList
+	}
 
-		if world.PvP {
-			//flags |= 0x4
-		}
+	return NewWorldList(config.Countries, config.Worlds)
+}
 
-		if world.LootShare {
-			flags |= 0x8
-		}
+// Encoded returns the encoded countries and worlds along with their checksum.
+func (l *WorldList) Encoded() ([]byte, uint32) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.raw, l.checksum
+}
+
+// Worlds returns a copy of the worlds in the list, sorted by ID.
+func (l *WorldList) Worlds() []WorldParameters {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	worlds := make([]WorldParameters, len(l.worlds))
+	copy(worlds, l.worlds)
+	return worlds
+}
+
+// World returns the world with the given ID.
+func (l *WorldList) World(id int) (WorldParameters, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if i, found := l.findWorld(id); found {
+		return l.worlds[i], true
+	}
+	return WorldParameters{}, false
+}
+
+// MinID returns the lowest world ID in the list. Player counts are sent to
+// the client relative to it.
+func (l *WorldList) MinID() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	minID, _ := WorldIDRange(l.worlds)
+	return minID
+}
+
+// AddWorld adds a world to the list.
+func (l *WorldList) AddWorld(world WorldParameters) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.addWorld(world); err != nil {
+		return err
+	}
+	l.rebuild()
+	return nil
+}
+
+// UpdateWorld replaces the parameters of a world already in the list.
+func (l *WorldList) UpdateWorld(world WorldParameters) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i, found := l.findWorld(world.ID)
+	if !found {
+		return fmt.Errorf("world %d is not in the world list", world.ID)
+	}
+	if _, found := l.findCountry(world.Country); !found {
+		return fmt.Errorf("world %d: unknown country %d", world.ID, world.Country)
+	}
 
-		if world.Activity != "" && world.Highlight {
-			flags |= 0x10
+	l.worlds[i] = world
+	l.rebuild()
+	return nil
+}
+
+// RemoveWorld removes a world from the list, reporting whether it was there.
+func (l *WorldList) RemoveWorld(id int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i, found := l.findWorld(id)
+	if !found {
+		return false
+	}
+
+	l.worlds = append(l.worlds[:i], l.worlds[i+1:]...)
+	l.rebuild()
+	return true
+}
+
+// Countries returns a copy of the countries in the list, sorted by ID.
+func (l *WorldList) Countries() []CountriesS {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	countries := make([]CountriesS, len(l.countries))
+	copy(countries, l.countries)
+	return countries
+}
+
+// Country returns the country with the given ID.
+func (l *WorldList) Country(id int) (CountriesS, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if i, found := l.findCountry(id); found {
+		return l.countries[i], true
+	}
+	return CountriesS{}, false
+}
+
+// AddCountry adds a country to the list.
+func (l *WorldList) AddCountry(country CountriesS) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.addCountry(country); err != nil {
+		return err
+	}
+	l.rebuild()
+	return nil
+}
+
+// UpdateCountry replaces the name and flag of a country already in the list.
+func (l *WorldList) UpdateCountry(country CountriesS) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i, found := l.findCountry(country.ID)
+	if !found {
+		return fmt.Errorf("country %d is not in the world list", country.ID)
+	}
+
+	l.countries[i] = country
+	l.rebuild()
+	return nil
+}
+
+// RemoveCountry removes a country that no world refers to.
+func (l *WorldList) RemoveCountry(id int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i, found := l.findCountry(id)
+	if !found {
+		return fmt.Errorf("country %d is not in the world list", id)
+	}
+	for _, v := range l.worlds {
+		if v.Country == id {
+			return fmt.Errorf("country %d is used by world %d", id, v.ID)
 		}
+	}
 
-		WorldListRaw.P4(flags)
+	l.countries = append(l.countries[:i], l.countries[i+1:]...)
+	l.rebuild()
+	return nil
+}
 
-		// if there is no activity name, client will fall back to country flag + name
-		WorldListRaw.PJStr2(world.Activity)
-		WorldListRaw.PJStr2(world.Hostname)
+func (l *WorldList) findWorld(id int) (int, bool) {
+	i := sort.Search(len(l.worlds), func(i int) bool {
+		return l.worlds[i].ID >= id
+	})
+	return i, i < len(l.worlds) && l.worlds[i].ID == id
+}
+
+func (l *WorldList) findCountry(id int) (int, bool) {
+	i := sort.Search(len(l.countries), func(i int) bool {
+		return l.countries[i].ID >= id
+	})
+	return i, i < len(l.countries) && l.countries[i].ID == id
+}
+
+func (l *WorldList) addWorld(world WorldParameters) error {
+	i, found := l.findWorld(world.ID)
+	if found {
+		return fmt.Errorf("world %d is already in the world list", world.ID)
+	}
+	if world.ID < 0 || world.ID > 32767 {
+		return fmt.Errorf("world %d: ID out of range", world.ID)
+	}
+	if _, found := l.findCountry(world.Country); !found {
+		return fmt.Errorf("world %d: unknown country %d", world.ID, world.Country)
+	}
+
+	l.worlds = append(l.worlds, WorldParameters{})
+	copy(l.worlds[i+1:], l.worlds[i:])
+	l.worlds[i] = world
+	return nil
+}
+
+func (l *WorldList) addCountry(country CountriesS) error {
+	i, found := l.findCountry(country.ID)
+	if found {
+		return fmt.Errorf("country %d is already in the world list", country.ID)
 	}
+
+	l.countries = append(l.countries, CountriesS{})
+	copy(l.countries[i+1:], l.countries[i:])
+	l.countries[i] = country
+	return nil
 }
 
-func init() {
-	b := WorldListRaw.Bytes()
-	WorldListRaw = *packet.NewPacket(b) // bad workaround since we can't calc checksum without clearing buffer
+// rebuild re-encodes the list. It must be called with l.mu held for writing.
+func (l *WorldList) rebuild() {
+	var raw packet.Packet
+
+	raw.PSmart(uint16(len(l.countries)))
+
+	for _, v := range l.countries {
+		raw.PSmart(uint16(v.Flag))
+		raw.PJStr2(v.DisplayName)
+	}
+
+	minID, maxID := WorldIDRange(l.worlds)
+	raw.PSmart(uint16(minID))
+	raw.PSmart(uint16(maxID))
+	raw.PSmart(uint16(len(l.worlds)))
 
-	WorldListChecksum = crc32.ChecksumIEEE(b)
+	for _, world := range l.worlds {
+		country, _ := l.findCountry(world.Country)
+
+		raw.PSmart(uint16(world.ID - minID))
+		raw.P1(uint8(country))
+		raw.P4(world.Flags())
+
+		// if there is no activity name, client will fall back to country flag + name
+		raw.PJStr2(world.Activity)
+		raw.PJStr2(world.Hostname)
+	}
+
+	b := raw.Bytes()
+	l.raw = b
+	l.checksum = crc32.ChecksumIEEE(b)
+}
+
+// WorldIDRange returns the lowest and highest world IDs in worlds.
+func WorldIDRange(worlds []WorldParameters) (minID int, maxID int) {
+	initialized := false
+	for _, v := range worlds {
+		if !initialized {
+			minID = v.ID
+			maxID = v.ID
+			initialized = true
+		}
+		if v.ID < minID {
+			minID = v.ID
+		}
+		if v.ID > maxID {
+			maxID = v.ID
+		}
+	}
+	return minID, maxID
 }
 
 const (
@@ -0,0 +1,210 @@
+package util
+
+import (
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zsrv/rt5-server-go/util/packet"
+)
+
+type decodedCountry struct {
+	Flag int
+	Name string
+}
+
+type decodedWorld struct {
+	ID       int
+	Country  int
+	Flags    uint32
+	Activity string
+	Hostname string
+}
+
+// decodeWorldList decodes an encoded world list the same way the client does.
+func decodeWorldList(raw []byte) ([]decodedCountry, []decodedWorld) {
+	buf := packet.NewPacket(raw)
+
+	countries := make([]decodedCountry, buf.GSmart())
+	for i := range countries {
+		countries[i].Flag = int(buf.GSmart())
+		countries[i].Name = buf.GJStr2()
+	}
+
+	minID := int(buf.GSmart())
+	_ = buf.GSmart() // maxID
+	worlds := make([]decodedWorld, buf.GSmart())
+	for i := range worlds {
+		worlds[i].ID = int(buf.GSmart()) + minID
+		worlds[i].Country = int(buf.G1())
+		worlds[i].Flags = buf.G4()
+		worlds[i].Activity = buf.GJStr2()
+		worlds[i].Hostname = buf.GJStr2()
+	}
+
+	if buf.Len() != 0 {
+		panic("trailing data after world list")
+	}
+	return countries, worlds
+}
+
+func TestWorldParameters_Flags(t *testing.T) {
+	tests := []struct {
+		name  string
+		world WorldParameters
+		want  uint32
+	}{
+		{
+			name:  "none",
+			world: WorldParameters{},
+			want:  0,
+		},
+		{
+			name:  "all",
+			world: WorldParameters{Activity: "PvP", Members: true, QuickChat: true, PvP: true, LootShare: true, Highlight: true},
+			want:  WorldFlagMembers | WorldFlagQuickChat | WorldFlagPvP | WorldFlagLootShare | WorldFlagHighlight,
+		},
+		{
+			name:  "highlight without activity",
+			world: WorldParameters{Highlight: true},
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.world.Flags(); got != tt.want {
+				t.Errorf("Flags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorldList_Encoded(t *testing.T) {
+	countries := []CountriesS{
+		{ID: 3, DisplayName: "Germany", Flag: 22},
+		{ID: 11, DisplayName: "United Kingdom", Flag: 77},
+	}
+	worlds := []WorldParameters{
+		{ID: 66, Hostname: "world66", Country: 11, Activity: "Trade", Highlight: true, Members: true},
+		{ID: 2, Hostname: "world2", Country: 3, PvP: true},
+	}
+
+	l, err := NewWorldList(countries, worlds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, checksum := l.Encoded()
+	if checksum != crc32.ChecksumIEEE(raw) {
+		t.Errorf("Encoded() checksum = %v, want %v", checksum, crc32.ChecksumIEEE(raw))
+	}
+
+	gotCountries, gotWorlds := decodeWorldList(raw)
+
+	wantCountries := []decodedCountry{{22, "Germany"}, {77, "United Kingdom"}}
+	if len(gotCountries) != len(wantCountries) {
+		t.Fatalf("decoded %d countries, want %d", len(gotCountries), len(wantCountries))
+	}
+	for i := range wantCountries {
+		if gotCountries[i] != wantCountries[i] {
+			t.Errorf("country %d = %+v, want %+v", i, gotCountries[i], wantCountries[i])
+		}
+	}
+
+	wantWorlds := []decodedWorld{
+		{ID: 2, Country: 0, Flags: WorldFlagPvP, Hostname: "world2"},
+		{ID: 66, Country: 1, Flags: WorldFlagMembers | WorldFlagHighlight, Activity: "Trade", Hostname: "world66"},
+	}
+	if len(gotWorlds) != len(wantWorlds) {
+		t.Fatalf("decoded %d worlds, want %d", len(gotWorlds), len(wantWorlds))
+	}
+	for i := range wantWorlds {
+		if gotWorlds[i] != wantWorlds[i] {
+			t.Errorf("world %d = %+v, want %+v", i, gotWorlds[i], wantWorlds[i])
+		}
+	}
+}
+
+func TestWorldList_Changes(t *testing.T) {
+	l, err := NewWorldList(CountriesList, DefaultWorlds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, initial := l.Encoded()
+
+	world := WorldParameters{ID: 10, Hostname: "world10", Country: 0}
+	if err := l.AddWorld(world); err != nil {
+		t.Fatalf("AddWorld() error = %v", err)
+	}
+	if err := l.AddWorld(world); err == nil {
+		t.Errorf("AddWorld() of a duplicate world succeeded")
+	}
+	_, added := l.Encoded()
+	if added == initial {
+		t.Errorf("checksum unchanged after AddWorld()")
+	}
+
+	// player counts aren't part of the encoded list
+	world.Players = 100
+	if err := l.UpdateWorld(world); err != nil {
+		t.Fatalf("UpdateWorld() error = %v", err)
+	}
+	if _, got := l.Encoded(); got != added {
+		t.Errorf("checksum changed after a player count update")
+	}
+
+	world.Activity = "Minigames"
+	l.UpdateWorld(world)
+	if _, got := l.Encoded(); got == added {
+		t.Errorf("checksum unchanged after an activity update")
+	}
+
+	if err := l.RemoveCountry(0); err == nil {
+		t.Errorf("RemoveCountry() of a country in use succeeded")
+	}
+
+	if !l.RemoveWorld(10) {
+		t.Errorf("RemoveWorld() = false, want true")
+	}
+	if _, got := l.Encoded(); got != initial {
+		t.Errorf("checksum = %v after RemoveWorld(), want %v", got, initial)
+	}
+
+	if err := l.UpdateCountry(CountriesS{ID: 6, DisplayName: "Helvetia", Flag: 43}); err != nil {
+		t.Fatalf("UpdateCountry() error = %v", err)
+	}
+	raw, _ := l.Encoded()
+	countries, _ := decodeWorldList(raw)
+	if countries[6].Name != "Helvetia" {
+		t.Errorf("country name = %v, want Helvetia", countries[6].Name)
+	}
+}
+
+func TestLoadWorldList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "worlds.json")
+	config := `{
+		"worlds": [
+			{"id": 1, "hostname": "world1", "country": 0, "members": true, "pvp": true}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadWorldList(path)
+	if err != nil {
+		t.Fatalf("LoadWorldList() error = %v", err)
+	}
+
+	world, found := l.World(1)
+	if !found {
+		t.Fatalf("World(1) not found")
+	}
+	if got := world.Flags(); got != WorldFlagMembers|WorldFlagPvP {
+		t.Errorf("Flags() = %v, want %v", got, WorldFlagMembers|WorldFlagPvP)
+	}
+	if got := len(l.Countries()); got != len(CountriesList) {
+		t.Errorf("len(Countries()) = %v, want %v", got, len(CountriesList))
+	}
+}